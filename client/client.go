@@ -0,0 +1,497 @@
+// Package client is an HTTP client for the pr-reviewer-service API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+const (
+	DEFAULT_TIMEOUT = 10 * time.Second
+	DEFAULT_BACKOFF = 200 * time.Millisecond
+)
+
+// Client calls the service API. It is safe for concurrent use.
+//
+// Every attempt is limited by the client timeout. GET requests are retried
+// with exponential backoff on network errors and on 502, 503 and 504; other
+// methods are never retried because the operations are not idempotent
+// (a repeated reassign picks another reviewer).
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	header     http.Header
+	timeout    time.Duration
+	retries    int
+	backoff    time.Duration
+}
+
+type Option func(*Client)
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTimeout limits each attempt; zero disables the limit.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithRetries sets how many times a failed GET is repeated and the delay
+// before the first retry, doubled for every next one.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// WithHeader adds a header to every request, e.g. X-Actor for the audit log.
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.header.Add(key, value)
+	}
+}
+
+// WithToken authenticates every request with a static API token or a JWT.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// WithTenant sends every request to a tenant other than the default one.
+// Tokens bound to a tenant select it without this option.
+func WithTenant(tenantId string) Option {
+	return func(c *Client) {
+		c.header.Set("X-Tenant", tenantId)
+	}
+}
+
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		header:     http.Header{},
+		timeout:    DEFAULT_TIMEOUT,
+		backoff:    DEFAULT_BACKOFF,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Client) TeamAdd(ctx context.Context, team models.Team) (models.Team, error) {
+	var response models.TeamResponse
+	err := c.do(ctx, http.MethodPost, "/team/add", nil, team, &response)
+	return response.Team, err
+}
+
+func (c *Client) TeamGet(ctx context.Context, teamName string) (models.Team, error) {
+	var team models.Team
+	err := c.do(ctx, http.MethodGet, "/team/get", url.Values{"team_name": {teamName}}, nil, &team)
+	return team, err
+}
+
+// TeamGetSubtree returns the team with its sub-teams and the members of the
+// whole subtree.
+func (c *Client) TeamGetSubtree(ctx context.Context, teamName string) (models.TeamTree, error) {
+	var tree models.TeamTree
+	err := c.do(ctx, http.MethodGet, "/team/get", url.Values{"team_name": {teamName}, "subtree": {"true"}}, nil, &tree)
+	return tree, err
+}
+
+func (c *Client) TeamSetMemberRole(ctx context.Context, teamName, userId string, role models.TeamRole) (models.Team, error) {
+	request := struct {
+		TeamName string          `json:"team_name"`
+		UserId   string          `json:"user_id"`
+		Role     models.TeamRole `json:"role"`
+	}{teamName, userId, role}
+
+	var response models.TeamResponse
+	err := c.do(ctx, http.MethodPost, "/team/setMemberRole", nil, request, &response)
+	return response.Team, err
+}
+
+// TeamSetPolicy replaces the reviewer policy of the team, nil removes it.
+func (c *Client) TeamSetPolicy(ctx context.Context, teamName string, policy *models.TeamPolicy) (models.Team, error) {
+	request := struct {
+		TeamName string             `json:"team_name"`
+		Policy   *models.TeamPolicy `json:"policy"`
+	}{teamName, policy}
+
+	var response models.TeamResponse
+	err := c.do(ctx, http.MethodPost, "/team/setPolicy", nil, request, &response)
+	return response.Team, err
+}
+
+// TeamSetSLA sets how long the reviews of the team may take, "" removes it.
+func (c *Client) TeamSetSLA(ctx context.Context, teamName, sla string) (models.Team, error) {
+	request := struct {
+		TeamName  string `json:"team_name"`
+		ReviewSLA string `json:"review_sla"`
+	}{teamName, sla}
+
+	var response models.TeamResponse
+	err := c.do(ctx, http.MethodPost, "/team/setSLA", nil, request, &response)
+	return response.Team, err
+}
+
+func (c *Client) UsersSetIsActive(ctx context.Context, userId string, isActive bool) (models.User, error) {
+	request := struct {
+		UserId   string `json:"user_id"`
+		IsActive bool   `json:"is_active"`
+	}{userId, isActive}
+
+	var response models.UserResponse
+	err := c.do(ctx, http.MethodPost, "/users/setIsActive", nil, request, &response)
+	return response.User, err
+}
+
+func (c *Client) UsersSetPrimaryTeam(ctx context.Context, userId, teamName string) (models.User, error) {
+	request := struct {
+		UserId   string `json:"user_id"`
+		TeamName string `json:"team_name"`
+	}{userId, teamName}
+
+	var response models.UserResponse
+	err := c.do(ctx, http.MethodPost, "/users/setPrimaryTeam", nil, request, &response)
+	return response.User, err
+}
+
+func (c *Client) UsersGetReview(ctx context.Context, userId string) (models.UserReviewsResponse, error) {
+	var response models.UserReviewsResponse
+	err := c.do(ctx, http.MethodGet, "/users/getReview", url.Values{"user_id": {userId}}, nil, &response)
+	return response, err
+}
+
+// PullRequestCreate picks the reviewers from teamName, one of the author's
+// teams, or from the author's primary team when teamName is empty.
+func (c *Client) PullRequestCreate(ctx context.Context, pullRequestId, pullRequestName, authorId, teamName string) (models.PullRequest, error) {
+	request := struct {
+		PullRequestId   string `json:"pull_request_id"`
+		PullRequestName string `json:"pull_request_name"`
+		AuthorId        string `json:"author_id"`
+		TeamName        string `json:"team_name,omitempty"`
+	}{pullRequestId, pullRequestName, authorId, teamName}
+
+	var response models.PullRequestResponse
+	err := c.do(ctx, http.MethodPost, "/pullRequest/create", nil, request, &response)
+	return response.PR, err
+}
+
+func (c *Client) PullRequestMerge(ctx context.Context, pullRequestId string) (models.PullRequest, error) {
+	var response models.PullRequestResponse
+	err := c.pullRequestAction(ctx, "/pullRequest/merge", pullRequestId, &response)
+	return response.PR, err
+}
+
+func (c *Client) PullRequestClose(ctx context.Context, pullRequestId string) (models.PullRequest, error) {
+	var response models.PullRequestResponse
+	err := c.pullRequestAction(ctx, "/pullRequest/close", pullRequestId, &response)
+	return response.PR, err
+}
+
+func (c *Client) pullRequestAction(ctx context.Context, path, pullRequestId string, out any) error {
+	request := struct {
+		PullRequestId string `json:"pull_request_id"`
+	}{pullRequestId}
+
+	return c.do(ctx, http.MethodPost, path, nil, request, out)
+}
+
+// PullRequestReassign replaces oldUserId; with an empty newUserId the server
+// picks the replacement.
+func (c *Client) PullRequestReassign(ctx context.Context, pullRequestId, oldUserId, newUserId string) (models.ReassignResponse, error) {
+	request := struct {
+		PullRequestId string `json:"pull_request_id"`
+		OldUserId     string `json:"old_user_id"`
+		NewUserId     string `json:"new_user_id,omitempty"`
+	}{pullRequestId, oldUserId, newUserId}
+
+	var response models.ReassignResponse
+	err := c.do(ctx, http.MethodPost, "/pullRequest/reassign", nil, request, &response)
+	return response, err
+}
+
+func (c *Client) PullRequestHistory(ctx context.Context, pullRequestId string) (models.PullRequestHistory, error) {
+	var history models.PullRequestHistory
+	err := c.do(ctx, http.MethodGet, "/pullRequest/history", url.Values{"pull_request_id": {pullRequestId}}, nil, &history)
+	return history, err
+}
+
+// PullRequestOverdue lists the reviews past their SLA; empty userId and
+// teamName do not filter.
+func (c *Client) PullRequestOverdue(ctx context.Context, userId, teamName string) ([]models.OverdueReview, error) {
+	query := url.Values{}
+	if userId != "" {
+		query.Set("user_id", userId)
+	}
+	if teamName != "" {
+		query.Set("team_name", teamName)
+	}
+
+	var response models.OverdueResponse
+	err := c.do(ctx, http.MethodGet, "/pullRequest/overdue", query, nil, &response)
+	return response.Reviews, err
+}
+
+func (c *Client) Audit(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	query := url.Values{}
+	if filter.EntityType != "" {
+		query.Set("entity_type", string(filter.EntityType))
+	}
+	if filter.EntityId != "" {
+		query.Set("entity_id", filter.EntityId)
+	}
+	if filter.Actor != "" {
+		query.Set("actor", filter.Actor)
+	}
+	if filter.From != nil {
+		query.Set("from", filter.From.Format(time.RFC3339Nano))
+	}
+	if filter.To != nil {
+		query.Set("to", filter.To.Format(time.RFC3339Nano))
+	}
+
+	var events []models.AuditEvent
+	err := c.do(ctx, http.MethodGet, "/audit", query, nil, &events)
+	return events, err
+}
+
+func (c *Client) WebhookSubscribe(ctx context.Context, subscription models.WebhookSubscription) (models.WebhookSubscription, error) {
+	var created models.WebhookSubscription
+	err := c.do(ctx, http.MethodPost, "/webhooks/subscribe", nil, subscription, &created)
+	return created, err
+}
+
+func (c *Client) WebhookList(ctx context.Context) ([]models.WebhookSubscription, error) {
+	var subscriptions []models.WebhookSubscription
+	err := c.do(ctx, http.MethodGet, "/webhooks/list", nil, nil, &subscriptions)
+	return subscriptions, err
+}
+
+func (c *Client) WebhookUnsubscribe(ctx context.Context, subscriptionId string) error {
+	request := struct {
+		SubscriptionId string `json:"subscription_id"`
+	}{subscriptionId}
+	return c.do(ctx, http.MethodPost, "/webhooks/unsubscribe", nil, request, nil)
+}
+
+func (c *Client) WebhookDeliveries(ctx context.Context, subscriptionId string) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := c.do(ctx, http.MethodGet, "/webhooks/deliveries", url.Values{"subscription_id": {subscriptionId}}, nil, &deliveries)
+	return deliveries, err
+}
+
+// IngestGithub posts a GitHub webhook payload signed with secret, the way
+// GitHub itself would.
+func (c *Client) IngestGithub(ctx context.Context, event string, payload []byte, secret string) (models.IngestResult, error) {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	headers := http.Header{
+		"X-Github-Event":      {event},
+		"X-Hub-Signature-256": {"sha256=" + hex.EncodeToString(mac.Sum(nil))},
+	}
+
+	var result models.IngestResult
+	err := c.send(ctx, http.MethodPost, "/ingest/github", nil, headers, payload, &result)
+	return result, err
+}
+
+func (c *Client) IngestGitlab(ctx context.Context, event string, payload []byte, token string) (models.IngestResult, error) {
+	headers := http.Header{
+		"X-Gitlab-Event": {event},
+		"X-Gitlab-Token": {token},
+	}
+
+	var result models.IngestResult
+	err := c.send(ctx, http.MethodPost, "/ingest/gitlab", nil, headers, payload, &result)
+	return result, err
+}
+
+// Metrics returns the raw Prometheus text exposition.
+func (c *Client) Metrics(ctx context.Context) (string, error) {
+	var b strings.Builder
+	err := c.send(ctx, http.MethodGet, "/metrics", nil, nil, nil, &b)
+	return b.String(), err
+}
+
+func (c *Client) ConsistencyCheck(ctx context.Context, repair bool) (models.ConsistencyReport, error) {
+	method, path := http.MethodGet, "/admin/consistency"
+	if repair {
+		method, path = http.MethodPost, "/admin/consistency/repair"
+	}
+
+	var report models.ConsistencyReport
+	err := c.do(ctx, method, path, nil, nil, &report)
+	return report, err
+}
+
+func (c *Client) SnapshotExport(ctx context.Context) (models.Snapshot, error) {
+	var snapshot models.Snapshot
+	err := c.do(ctx, http.MethodGet, "/admin/snapshot/export", nil, nil, &snapshot)
+	return snapshot, err
+}
+
+func (c *Client) SnapshotImport(ctx context.Context, snapshot models.Snapshot) (models.SnapshotImportResult, error) {
+	var result models.SnapshotImportResult
+	err := c.do(ctx, http.MethodPost, "/admin/snapshot/import", nil, snapshot, &result)
+	return result, err
+}
+
+func (c *Client) TenantCreate(ctx context.Context, tenant models.Tenant) (models.Tenant, error) {
+	var response models.TenantResponse
+	err := c.do(ctx, http.MethodPost, "/admin/tenants", nil, tenant, &response)
+	return response.Tenant, err
+}
+
+func (c *Client) Tenants(ctx context.Context) ([]models.Tenant, error) {
+	var response models.TenantsResponse
+	err := c.do(ctx, http.MethodGet, "/admin/tenants", nil, nil, &response)
+	return response.Tenants, err
+}
+
+func (c *Client) HealthLive(ctx context.Context) (models.HealthReport, error) {
+	var report models.HealthReport
+	err := c.do(ctx, http.MethodGet, "/health/live", nil, nil, &report)
+	return report, err
+}
+
+// HealthReady returns the report together with an *Error for 503, so callers
+// can still see which check failed.
+func (c *Client) HealthReady(ctx context.Context) (models.HealthReport, error) {
+	var report models.HealthReport
+	err := c.do(ctx, http.MethodGet, "/health/ready", nil, nil, &report)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusServiceUnavailable {
+		_ = json.Unmarshal(apiErr.body, &report)
+	}
+	return report, err
+}
+
+// do sends body as JSON and decodes a JSON response into out (unless out is nil).
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	var data []byte
+	headers := http.Header{}
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+		headers.Set("Content-Type", "application/json")
+	}
+	return c.send(ctx, method, path, query, headers, data, out)
+}
+
+// send performs the request with retries. out may be nil, a *strings.Builder
+// for raw text or a pointer to decode JSON into.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, headers http.Header, body []byte, out any) error {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		data, err := c.attempt(ctx, method, target, headers, body)
+		if err == nil {
+			return decode(data, out)
+		}
+		if attempt >= c.retries || method != http.MethodGet || !retryable(ctx, err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, method, target string, headers http.Header, body []byte) ([]byte, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	for key, values := range headers {
+		req.Header[http.CanonicalHeaderKey(key)] = values
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return data, newError(resp.StatusCode, data)
+	}
+	return data, nil
+}
+
+// retryable reports whether a failed attempt may succeed if repeated:
+// the caller's context is still alive and the failure was on the way or
+// a gateway/availability status.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+func decode(data []byte, out any) error {
+	switch out := out.(type) {
+	case nil:
+		return nil
+	case *strings.Builder:
+		out.Write(data)
+		return nil
+	default:
+		return json.Unmarshal(data, out)
+	}
+}
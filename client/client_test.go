@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+func TestTypedErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pullRequest/reassign":
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.NO_CANDIDATE, "no active replacement candidate in team"))
+		case "/team/get":
+			http.Error(w, "wrong TeamNameQuery", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	c := New(server.URL)
+
+	_, err := c.PullRequestReassign(context.Background(), "r1", "u2", "")
+	if !errors.Is(err, ErrNoCandidate) {
+		t.Fatalf("Expected ErrNoCandidate, got %v", err)
+	}
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict || apiErr.Message != "no active replacement candidate in team" {
+		t.Fatalf("Unexpected error details: %+v", apiErr)
+	}
+
+	_, err = c.TeamGet(context.Background(), "")
+	if !errors.Is(err, ErrBadRequest) || !errors.As(err, &apiErr) || apiErr.Message != "wrong TeamNameQuery" {
+		t.Fatalf("Expected ErrBadRequest with the plain text body, got %v", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(models.Team{TeamName: "backend"})
+	}))
+	defer server.Close()
+
+	c := New(server.URL, WithRetries(2, time.Millisecond))
+	team, err := c.TeamGet(context.Background(), "backend")
+	if err != nil || team.TeamName != "backend" || calls.Load() != 3 {
+		t.Fatalf("Expected success on the third attempt, got %v after %d calls", err, calls.Load())
+	}
+
+	// mutations are not repeated
+	calls.Store(0)
+	_, err = c.PullRequestMerge(context.Background(), "r1")
+	if !errors.Is(err, ErrUnavailable) || calls.Load() != 1 {
+		t.Fatalf("Expected one failed attempt, got %v after %d calls", err, calls.Load())
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c := New(server.URL, WithTimeout(20*time.Millisecond))
+	_, err := c.HealthLive(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+// Sentinel errors for the API error codes, match them with errors.Is:
+//
+//	if errors.Is(err, client.ErrNoCandidate) { ... }
+var (
+	ErrTeamExists        = errors.New("team already exists")
+	ErrPRExists          = errors.New("pull request already exists")
+	ErrPRMerged          = errors.New("pull request is merged")
+	ErrPRClosed          = errors.New("pull request is closed")
+	ErrNotAssigned       = errors.New("reviewer is not assigned")
+	ErrNoCandidate       = errors.New("no replacement candidate")
+	ErrNotFound          = errors.New("not found")
+	ErrCandidateIsAuthor = errors.New("candidate is the author")
+	ErrCandidateInactive = errors.New("candidate is inactive")
+	ErrAlreadyAssigned   = errors.New("candidate is already assigned")
+	ErrWrongTeam         = errors.New("candidate is in a wrong team")
+	ErrUnauthorized      = errors.New("unauthorized")
+	ErrForbidden         = errors.New("forbidden")
+	ErrTenantExists      = errors.New("tenant already exists")
+	ErrTenantNotFound    = errors.New("tenant not found")
+	ErrNotEmpty          = errors.New("instance is not empty")
+	ErrInvalidSnapshot   = errors.New("invalid snapshot")
+	ErrInternal          = errors.New("internal server error")
+
+	// ErrBadRequest is a BAD_REQUEST, or any 400 without an error code: the
+	// request itself was malformed.
+	ErrBadRequest = errors.New("bad request")
+	// ErrValidation is a VALIDATION_ERROR, Error.Details names the fields.
+	ErrValidation       = errors.New("invalid request fields")
+	ErrMethodNotAllowed = errors.New("method not allowed")
+	// ErrUnavailable is a 503, e.g. a failed readiness check.
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+var codeErrors = map[models.ErrorDetailCode]error{
+	models.TEAM_EXISTS:         ErrTeamExists,
+	models.PR_EXISTS:           ErrPRExists,
+	models.PR_MERGED:           ErrPRMerged,
+	models.PR_CLOSED:           ErrPRClosed,
+	models.NOT_ASSIGNED:        ErrNotAssigned,
+	models.NO_CANDIDATE:        ErrNoCandidate,
+	models.NOT_FOUND:           ErrNotFound,
+	models.CANDIDATE_IS_AUTHOR: ErrCandidateIsAuthor,
+	models.CANDIDATE_INACTIVE:  ErrCandidateInactive,
+	models.ALREADY_ASSIGNED:    ErrAlreadyAssigned,
+	models.WRONG_TEAM:          ErrWrongTeam,
+	models.UNAUTHORIZED:        ErrUnauthorized,
+	models.FORBIDDEN:           ErrForbidden,
+	models.TENANT_EXISTS:       ErrTenantExists,
+	models.TENANT_NOT_FOUND:    ErrTenantNotFound,
+	models.NOT_EMPTY:           ErrNotEmpty,
+	models.INVALID_SNAPSHOT:    ErrInvalidSnapshot,
+	models.BAD_REQUEST:         ErrBadRequest,
+	models.VALIDATION_ERROR:    ErrValidation,
+	models.METHOD_NOT_ALLOWED:  ErrMethodNotAllowed,
+	models.FATAL_ERROR:         ErrInternal,
+}
+
+// Error is returned for every non-2xx response. Code, Message and Details
+// come from models.ErrorResponse when the server sent one, otherwise Message
+// is the raw body. It unwraps to the sentinel error of its code.
+type Error struct {
+	StatusCode int
+	Code       models.ErrorDetailCode
+	Message    string
+	Details    []models.FieldError
+
+	body []byte
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("server responded with %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("server responded with %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	if err, ok := codeErrors[e.Code]; ok {
+		return err
+	}
+	switch {
+	case e.StatusCode == http.StatusServiceUnavailable:
+		return ErrUnavailable
+	case e.StatusCode == http.StatusBadRequest:
+		return ErrBadRequest
+	case e.StatusCode >= 500:
+		return ErrInternal
+	}
+	return nil
+}
+
+func newError(statusCode int, body []byte) *Error {
+	var response models.ErrorResponse
+	if err := json.Unmarshal(body, &response); err == nil && response.Detail.Code != "" {
+		return &Error{StatusCode: statusCode, Code: response.Detail.Code, Message: response.Detail.Message, Details: response.Detail.Details, body: body}
+	}
+	return &Error{StatusCode: statusCode, Message: strings.TrimSpace(string(body)), body: body}
+}
@@ -0,0 +1,95 @@
+package client
+
+import "github.com/Dowtai/pr-reviewer-service/internal/models"
+
+// Aliases of the service models, so code outside this module (which cannot
+// import internal packages) can name the request and response types.
+type (
+	Team                 = models.Team
+	TeamTree             = models.TeamTree
+	TeamRole             = models.TeamRole
+	TeamPolicy           = models.TeamPolicy
+	PolicyResult         = models.PolicyResult
+	TeamMember           = models.TeamMember
+	User                 = models.User
+	Role                 = models.Role
+	PullRequest          = models.PullRequest
+	PullRequestShort     = models.PullRequestShort
+	UserReviewsResponse  = models.UserReviewsResponse
+	PullRequestStatus    = models.PullRequestStatus
+	ReassignResponse     = models.ReassignResponse
+	PullRequestHistory   = models.PullRequestHistory
+	OverdueReview        = models.OverdueReview
+	PullRequestEvent     = models.PullRequestEvent
+	PullRequestEventType = models.PullRequestEventType
+	AuditEvent           = models.AuditEvent
+	AuditFilter          = models.AuditFilter
+	AuditAction          = models.AuditAction
+	AuditEntity          = models.AuditEntity
+	WebhookSubscription  = models.WebhookSubscription
+	WebhookDelivery      = models.WebhookDelivery
+	WebhookPayload       = models.WebhookPayload
+	IngestResult         = models.IngestResult
+	ConsistencyReport    = models.ConsistencyReport
+	Snapshot             = models.Snapshot
+	SnapshotImportResult = models.SnapshotImportResult
+	HealthReport         = models.HealthReport
+	Tenant               = models.Tenant
+	ErrorDetailCode      = models.ErrorDetailCode
+	ErrorResponse        = models.ErrorResponse
+	FieldError           = models.FieldError
+)
+
+const (
+	OPEN   = models.OPEN
+	MERGED = models.MERGED
+	CLOSED = models.CLOSED
+)
+
+const (
+	ROLE_ADMIN = models.ROLE_ADMIN
+	ROLE_BOT   = models.ROLE_BOT
+	ROLE_USER  = models.ROLE_USER
+)
+
+const (
+	TEAM_LEAD   = models.TEAM_LEAD
+	TEAM_SENIOR = models.TEAM_SENIOR
+	TEAM_MEMBER = models.TEAM_MEMBER
+	TEAM_JUNIOR = models.TEAM_JUNIOR
+)
+
+const (
+	EVENT_PR_CREATED        = models.EVENT_PR_CREATED
+	EVENT_REVIEWER_ASSIGNED = models.EVENT_REVIEWER_ASSIGNED
+	EVENT_REVIEWER_REPLACED = models.EVENT_REVIEWER_REPLACED
+	EVENT_PR_MERGED         = models.EVENT_PR_MERGED
+	EVENT_PR_CLOSED         = models.EVENT_PR_CLOSED
+	EVENT_REVIEW_OVERDUE    = models.EVENT_REVIEW_OVERDUE
+	EVENT_REVIEW_ESCALATED  = models.EVENT_REVIEW_ESCALATED
+)
+
+// Error codes, as found in Error.Code.
+const (
+	TEAM_EXISTS         = models.TEAM_EXISTS
+	PR_EXISTS           = models.PR_EXISTS
+	PR_MERGED           = models.PR_MERGED
+	PR_CLOSED           = models.PR_CLOSED
+	NOT_ASSIGNED        = models.NOT_ASSIGNED
+	NO_CANDIDATE        = models.NO_CANDIDATE
+	NOT_FOUND           = models.NOT_FOUND
+	FATAL_ERROR         = models.FATAL_ERROR
+	UNAUTHORIZED        = models.UNAUTHORIZED
+	FORBIDDEN           = models.FORBIDDEN
+	NOT_EMPTY           = models.NOT_EMPTY
+	INVALID_SNAPSHOT    = models.INVALID_SNAPSHOT
+	BAD_REQUEST         = models.BAD_REQUEST
+	VALIDATION_ERROR    = models.VALIDATION_ERROR
+	METHOD_NOT_ALLOWED  = models.METHOD_NOT_ALLOWED
+	TENANT_EXISTS       = models.TENANT_EXISTS
+	TENANT_NOT_FOUND    = models.TENANT_NOT_FOUND
+	CANDIDATE_IS_AUTHOR = models.CANDIDATE_IS_AUTHOR
+	CANDIDATE_INACTIVE  = models.CANDIDATE_INACTIVE
+	ALREADY_ASSIGNED    = models.ALREADY_ASSIGNED
+	WRONG_TEAM          = models.WRONG_TEAM
+)
@@ -0,0 +1,94 @@
+// Command loadtest replays a JSONL scenario against a running
+// pr-reviewer-service and reports throughput and latency percentiles.
+//
+// Usage:
+//
+//	loadtest [--server URL] [--token TOKEN] [--tenant ID] [--runs N] [--concurrency N] [--session ID] [--timeout D] SCENARIO.jsonl
+//
+// The steps marked "once" run first, then the other steps are replayed --runs
+// times, --concurrency replays at once. See internal/loadtest for the format
+// and scenario.jsonl next to this file for an example. The exit code is 1
+// when a request failed.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/loadtest"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	server := flags.String("server", "http://localhost:8080", "server URL")
+	token := flags.String("token", os.Getenv("PRCTL_TOKEN"), "API token or JWT, $PRCTL_TOKEN by default")
+	tenant := flags.String("tenant", "", "tenant of the requests, the default one when empty")
+	runs := flags.Int("runs", 100, "how many times the scenario is replayed")
+	concurrency := flags.Int("concurrency", 8, "how many replays run at once")
+	session := flags.String("session", strconv.FormatInt(time.Now().UnixNano(), 36), "value of {{session}}, unique by default so a scenario can be replayed against the same server")
+	timeout := flags.Duration("timeout", 10*time.Second, "timeout of one request")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(stderr, "usage: loadtest [flags] SCENARIO.jsonl")
+		flags.PrintDefaults()
+		return 2
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	scenario, err := loadtest.ParseScenario(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", flags.Arg(0), err)
+		return 1
+	}
+
+	header := http.Header{}
+	if *token != "" {
+		header.Set("Authorization", "Bearer "+*token)
+	}
+	if *tenant != "" {
+		header.Set("X-Tenant", *tenant)
+	}
+	// the default transport keeps only 2 idle connections per host, a
+	// reconnect for every request would be measured as well
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = *concurrency
+
+	runner := loadtest.Runner{BaseURL: strings.TrimRight(*server, "/"), Client: &http.Client{Transport: transport, Timeout: *timeout}}
+	report, err := runner.Run(ctx, scenario, loadtest.Options{Runs: *runs, Concurrency: *concurrency, Header: header, Session: *session})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if err := report.Write(stdout); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if report.Total.Failures > 0 {
+		return 1
+	}
+	return 0
+}
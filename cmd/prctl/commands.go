@@ -0,0 +1,785 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/client"
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+var errUsage = errors.New("usage")
+
+// cli is the state shared by all commands: global flags, the client built
+// from them and the output streams.
+type cli struct {
+	ctx    context.Context
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	server     string
+	configPath string
+	output     string
+	token      string
+	tenant     string
+	timeout    time.Duration
+	client     *client.Client
+}
+
+type command struct {
+	usage string
+	run   func(c *cli, args []string) error
+}
+
+var commands = map[string]command{
+	"team add":            {"team add NAME [--parent TEAM] --member ID:USERNAME[:inactive][:ROLE]... | --file team.json", teamAdd},
+	"team set-role":       {"team set-role TEAM USER_ID lead|senior|member|junior", teamSetRole},
+	"team set-policy":     {"team set-policy TEAM [--require-senior] [--no-junior-only]", teamSetPolicy},
+	"team set-sla":        {"team set-sla TEAM DURATION|\"\"", teamSetSLA},
+	"team get":            {"team get NAME [--subtree]", teamGet},
+	"user set-active":     {"user set-active USER_ID true|false", userSetActive},
+	"user set-primary":    {"user set-primary USER_ID TEAM", userSetPrimary},
+	"user reviews":        {"user reviews USER_ID [--watch] [--interval 5s]", userReviews},
+	"pr create":           {"pr create ID --name NAME --author USER_ID [--team TEAM]", prCreate},
+	"pr merge":            {"pr merge ID", prMerge},
+	"pr close":            {"pr close ID", prClose},
+	"pr reassign":         {"pr reassign ID OLD_USER_ID [--to NEW_USER_ID]", prReassign},
+	"pr history":          {"pr history ID", prHistory},
+	"pr overdue":          {"pr overdue [--user USER_ID] [--team TEAM]", prOverdue},
+	"audit":               {"audit [--entity-type T] [--entity-id ID] [--actor A] [--from RFC3339] [--to RFC3339]", audit},
+	"webhook subscribe":   {"webhook subscribe --url URL --secret SECRET [--event TYPE]...", webhookSubscribe},
+	"webhook list":        {"webhook list", webhookList},
+	"webhook unsubscribe": {"webhook unsubscribe SUBSCRIPTION_ID", webhookUnsubscribe},
+	"webhook deliveries":  {"webhook deliveries SUBSCRIPTION_ID", webhookDeliveries},
+	"ingest github":       {"ingest github --secret SECRET [--event pull_request] [--file payload.json]", ingestGithub},
+	"ingest gitlab":       {"ingest gitlab --token TOKEN [--event \"Merge Request Hook\"] [--file payload.json]", ingestGitlab},
+	"metrics":             {"metrics", metrics},
+	"consistency":         {"consistency [--repair]", consistency},
+	"snapshot export":     {"snapshot export [--file snapshot.json]", snapshotExport},
+	"snapshot import":     {"snapshot import [--file snapshot.json]", snapshotImport},
+	"health live":         {"health live", healthLive},
+	"health ready":        {"health ready", healthReady},
+	"tenant create":       {"tenant create ID --name NAME", tenantCreate},
+	"tenant list":         {"tenant list", tenantList},
+}
+
+// run executes one command and returns the process exit code:
+// 0 on success, 1 when the request failed, 2 on bad usage.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{ctx: ctx, stdin: stdin, stdout: stdout, stderr: stderr, timeout: client.DEFAULT_TIMEOUT}
+
+	// global flags may also come before the command
+	global := c.flags("prctl")
+	if err := global.Parse(args); err != nil {
+		return 2
+	}
+	args = global.Args()
+
+	name, cmd, ok := lookup(args)
+	if !ok {
+		printUsage(stderr)
+		return 2
+	}
+
+	err := cmd.run(c, args[len(strings.Fields(name)):])
+	var apiErr *client.Error
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage):
+		fmt.Fprintf(stderr, "usage: prctl %s\n", cmd.usage)
+		return 2
+	case errors.Is(err, flag.ErrHelp):
+		return 2
+	case errors.As(err, &apiErr):
+		fmt.Fprintln(stderr, apiErr)
+		for _, detail := range apiErr.Details {
+			fmt.Fprintf(stderr, "  %s: %s\n", detail.Field, detail.Message)
+		}
+		return 1
+	default:
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+}
+
+func lookup(args []string) (string, command, bool) {
+	if len(args) >= 2 {
+		if cmd, ok := commands[args[0]+" "+args[1]]; ok {
+			return args[0] + " " + args[1], cmd, true
+		}
+	}
+	if len(args) >= 1 {
+		if cmd, ok := commands[args[0]]; ok {
+			return args[0], cmd, true
+		}
+	}
+	return "", command{}, false
+}
+
+func printUsage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "usage: prctl [--server URL] [--config FILE] [--token TOKEN] [--tenant ID] [-o table|json|yaml] [--timeout 10s] <command>")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\n", commands[name].usage)
+	}
+}
+
+// flags returns a flag set with the global flags registered.
+func (c *cli) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.StringVar(&c.server, "server", c.server, "server base url (default from config file)")
+	fs.StringVar(&c.configPath, "config", c.configPath, "config file")
+	fs.StringVar(&c.output, "o", c.output, "output format: table, json or yaml")
+	fs.StringVar(&c.token, "token", c.token, "API token or JWT (default $PRCTL_TOKEN or from config file)")
+	fs.StringVar(&c.tenant, "tenant", c.tenant, "tenant of the requests (default from config file, then the server default)")
+	fs.DurationVar(&c.timeout, "timeout", c.timeout, "timeout of a single request")
+	return fs
+}
+
+// parse parses flags mixed with positional arguments, checks that exactly
+// want positional arguments were given (any number for a negative want)
+// and sets up the client.
+func (c *cli) parse(fs *flag.FlagSet, args []string, want int) ([]string, error) {
+	positional := make([]string, 0)
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if want >= 0 && len(positional) != want {
+		return nil, errUsage
+	}
+
+	path, explicit := c.configPath, c.configPath != ""
+	if !explicit {
+		path = defaultConfigPath()
+	}
+	conf, err := loadConfig(path, explicit)
+	if err != nil {
+		return nil, err
+	}
+	if c.server == "" {
+		c.server = conf.Server
+	}
+	if c.output == "" {
+		c.output = conf.Output
+	}
+	if c.token == "" {
+		c.token = os.Getenv("PRCTL_TOKEN")
+	}
+	if c.token == "" {
+		c.token = conf.Token
+	}
+	if c.tenant == "" {
+		c.tenant = conf.Tenant
+	}
+	if !validFormat(c.output) {
+		return nil, fmt.Errorf("unknown output format %q", c.output)
+	}
+
+	opts := []client.Option{client.WithTimeout(c.timeout), client.WithRetries(2, client.DEFAULT_BACKOFF)}
+	if c.token != "" {
+		opts = append(opts, client.WithToken(c.token))
+	}
+	if c.tenant != "" {
+		opts = append(opts, client.WithTenant(c.tenant))
+	}
+	c.client = client.New(c.server, opts...)
+	return positional, nil
+}
+
+func (c *cli) print(v any) error {
+	return write(c.stdout, c.output, v)
+}
+
+// input reads a file, or stdin for an empty path or "-".
+func (c *cli) input(path string) ([]byte, error) {
+	if path == "" || path == "-" {
+		return io.ReadAll(c.stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// memberFlag collects --member ID:USERNAME[:inactive][:ROLE] values.
+type memberFlag []models.TeamMember
+
+func (m *memberFlag) String() string {
+	return fmt.Sprint(*m)
+}
+
+func (m *memberFlag) Set(value string) error {
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 4 || parts[0] == "" {
+		return fmt.Errorf("expected ID:USERNAME[:inactive][:ROLE], got %q", value)
+	}
+	member := models.TeamMember{UserId: parts[0], Username: parts[1], IsActive: true}
+	for _, part := range parts[2:] {
+		switch role := models.TeamRole(strings.ToUpper(part)); {
+		case part == "inactive" && member.IsActive:
+			member.IsActive = false
+		case slices.Contains(models.TEAM_ROLES, role) && member.Role == "":
+			member.Role = role
+		default:
+			return fmt.Errorf("expected ID:USERNAME[:inactive][:ROLE], got %q", value)
+		}
+	}
+	*m = append(*m, member)
+	return nil
+}
+
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func teamAdd(c *cli, args []string) error {
+	fs := c.flags("team add")
+	var members memberFlag
+	fs.Var(&members, "member", "team member as ID:USERNAME[:inactive][:ROLE], repeatable")
+	parent := fs.String("parent", "", "parent team")
+	file := fs.String("file", "", "read the team from a JSON file instead (- for stdin)")
+	positional, err := c.parse(fs, args, -1)
+	if err != nil {
+		return err
+	}
+	if (*file == "") != (len(positional) == 1) || len(positional) > 1 {
+		return errUsage
+	}
+
+	team := models.Team{Members: []models.TeamMember(members)}
+	if *file != "" {
+		data, err := c.input(*file)
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(data, &team); err != nil {
+			return err
+		}
+	} else {
+		team.TeamName = positional[0]
+		team.ParentTeam = *parent
+	}
+	if team.Members == nil {
+		team.Members = []models.TeamMember{}
+	}
+
+	created, err := c.client.TeamAdd(c.ctx, team)
+	if err != nil {
+		return err
+	}
+	return c.print(created)
+}
+
+func teamGet(c *cli, args []string) error {
+	fs := c.flags("team get")
+	subtree := fs.Bool("subtree", false, "include the sub-teams and their members")
+	positional, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *subtree {
+		tree, err := c.client.TeamGetSubtree(c.ctx, positional[0])
+		if err != nil {
+			return err
+		}
+		return c.print(tree)
+	}
+	team, err := c.client.TeamGet(c.ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	return c.print(team)
+}
+
+func teamSetRole(c *cli, args []string) error {
+	positional, err := c.parse(c.flags("team set-role"), args, 3)
+	if err != nil {
+		return err
+	}
+	team, err := c.client.TeamSetMemberRole(c.ctx, positional[0], positional[1], models.TeamRole(strings.ToUpper(positional[2])))
+	if err != nil {
+		return err
+	}
+	return c.print(team)
+}
+
+// teamSetPolicy replaces the policy of the team, without flags it removes it.
+func teamSetPolicy(c *cli, args []string) error {
+	fs := c.flags("team set-policy")
+	var policy models.TeamPolicy
+	fs.BoolVar(&policy.RequireSenior, "require-senior", false, "require a lead or senior reviewer")
+	fs.BoolVar(&policy.NoJuniorOnly, "no-junior-only", false, "forbid juniors as the only reviewers")
+	positional, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	team, err := c.client.TeamSetPolicy(c.ctx, positional[0], &policy)
+	if err != nil {
+		return err
+	}
+	return c.print(team)
+}
+
+// teamSetSLA sets the review SLA of the team, an empty duration removes it.
+func teamSetSLA(c *cli, args []string) error {
+	positional, err := c.parse(c.flags("team set-sla"), args, 2)
+	if err != nil {
+		return err
+	}
+	team, err := c.client.TeamSetSLA(c.ctx, positional[0], positional[1])
+	if err != nil {
+		return err
+	}
+	return c.print(team)
+}
+
+func userSetActive(c *cli, args []string) error {
+	positional, err := c.parse(c.flags("user set-active"), args, 2)
+	if err != nil {
+		return err
+	}
+	isActive, err := strconv.ParseBool(positional[1])
+	if err != nil {
+		return errUsage
+	}
+	user, err := c.client.UsersSetIsActive(c.ctx, positional[0], isActive)
+	if err != nil {
+		return err
+	}
+	return c.print(user)
+}
+
+func userSetPrimary(c *cli, args []string) error {
+	positional, err := c.parse(c.flags("user set-primary"), args, 2)
+	if err != nil {
+		return err
+	}
+	user, err := c.client.UsersSetPrimaryTeam(c.ctx, positional[0], positional[1])
+	if err != nil {
+		return err
+	}
+	return c.print(user)
+}
+
+// userReviews prints the review queue; with --watch it polls the server and
+// prints the queue again whenever it changes, until interrupted.
+func userReviews(c *cli, args []string) error {
+	fs := c.flags("user reviews")
+	watch := fs.Bool("watch", false, "keep polling and print the queue when it changes")
+	interval := fs.Duration("interval", 5*time.Second, "polling interval for --watch")
+	positional, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *interval <= 0 {
+		return errUsage
+	}
+
+	var last []byte
+	for {
+		reviews, err := c.client.UsersGetReview(c.ctx, positional[0])
+		if err != nil {
+			if c.ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if !*watch {
+			return c.print(reviews)
+		}
+
+		current, _ := json.Marshal(reviews)
+		if !bytes.Equal(current, last) {
+			last = current
+			fmt.Fprintf(c.stdout, "# %s, %d pull requests, %d overdue\n",
+				time.Now().Format(time.DateTime), len(reviews.PullRequests), reviews.OverdueCount)
+			if err = c.print(reviews); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return nil
+		case <-time.After(*interval):
+		}
+	}
+}
+
+func prCreate(c *cli, args []string) error {
+	fs := c.flags("pr create")
+	name := fs.String("name", "", "pull request name")
+	author := fs.String("author", "", "author user_id")
+	team := fs.String("team", "", "team to pick reviewers from, the author's primary team when empty")
+	positional, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *name == "" || *author == "" {
+		return errUsage
+	}
+	pr, err := c.client.PullRequestCreate(c.ctx, positional[0], *name, *author, *team)
+	if err != nil {
+		return err
+	}
+	return c.print(pr)
+}
+
+func prMerge(c *cli, args []string) error {
+	positional, err := c.parse(c.flags("pr merge"), args, 1)
+	if err != nil {
+		return err
+	}
+	pr, err := c.client.PullRequestMerge(c.ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	return c.print(pr)
+}
+
+func prClose(c *cli, args []string) error {
+	positional, err := c.parse(c.flags("pr close"), args, 1)
+	if err != nil {
+		return err
+	}
+	pr, err := c.client.PullRequestClose(c.ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	return c.print(pr)
+}
+
+func prReassign(c *cli, args []string) error {
+	fs := c.flags("pr reassign")
+	to := fs.String("to", "", "new reviewer, picked by the server when empty")
+	positional, err := c.parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	response, err := c.client.PullRequestReassign(c.ctx, positional[0], positional[1], *to)
+	if err != nil {
+		return err
+	}
+	return c.print(response)
+}
+
+func prHistory(c *cli, args []string) error {
+	positional, err := c.parse(c.flags("pr history"), args, 1)
+	if err != nil {
+		return err
+	}
+	history, err := c.client.PullRequestHistory(c.ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	return c.print(history)
+}
+
+func prOverdue(c *cli, args []string) error {
+	fs := c.flags("pr overdue")
+	user := fs.String("user", "", "only the reviews of this user")
+	team := fs.String("team", "", "only the pull requests of this team")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	reviews, err := c.client.PullRequestOverdue(c.ctx, *user, *team)
+	if err != nil {
+		return err
+	}
+	return c.print(reviews)
+}
+
+func audit(c *cli, args []string) error {
+	fs := c.flags("audit")
+	entityType := fs.String("entity-type", "", "team, user or pull_request")
+	entityId := fs.String("entity-id", "", "entity id")
+	actor := fs.String("actor", "", "actor")
+	from := fs.String("from", "", "RFC 3339 lower bound")
+	to := fs.String("to", "", "RFC 3339 upper bound")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	filter := models.AuditFilter{
+		EntityType: models.AuditEntity(*entityType),
+		EntityId:   *entityId,
+		Actor:      *actor,
+	}
+	var err error
+	if filter.From, err = parseTime(*from); err != nil {
+		return err
+	}
+	if filter.To, err = parseTime(*to); err != nil {
+		return err
+	}
+
+	events, err := c.client.Audit(c.ctx, filter)
+	if err != nil {
+		return err
+	}
+	return c.print(events)
+}
+
+func parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func webhookSubscribe(c *cli, args []string) error {
+	fs := c.flags("webhook subscribe")
+	url := fs.String("url", "", "receiver url")
+	secret := fs.String("secret", "", "secret used to sign deliveries")
+	var events listFlag
+	fs.Var(&events, "event", "event type to deliver, repeatable; all events when omitted")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *url == "" || *secret == "" {
+		return errUsage
+	}
+
+	subscription := models.WebhookSubscription{Url: *url, Secret: *secret, EventTypes: []models.PullRequestEventType{}}
+	for _, event := range events {
+		subscription.EventTypes = append(subscription.EventTypes, models.PullRequestEventType(event))
+	}
+	created, err := c.client.WebhookSubscribe(c.ctx, subscription)
+	if err != nil {
+		return err
+	}
+	return c.print(created)
+}
+
+func webhookList(c *cli, args []string) error {
+	if _, err := c.parse(c.flags("webhook list"), args, 0); err != nil {
+		return err
+	}
+	subscriptions, err := c.client.WebhookList(c.ctx)
+	if err != nil {
+		return err
+	}
+	return c.print(subscriptions)
+}
+
+func webhookUnsubscribe(c *cli, args []string) error {
+	positional, err := c.parse(c.flags("webhook unsubscribe"), args, 1)
+	if err != nil {
+		return err
+	}
+	return c.client.WebhookUnsubscribe(c.ctx, positional[0])
+}
+
+func webhookDeliveries(c *cli, args []string) error {
+	positional, err := c.parse(c.flags("webhook deliveries"), args, 1)
+	if err != nil {
+		return err
+	}
+	deliveries, err := c.client.WebhookDeliveries(c.ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	return c.print(deliveries)
+}
+
+func ingestGithub(c *cli, args []string) error {
+	fs := c.flags("ingest github")
+	secret := fs.String("secret", "", "GitHub webhook secret of the tenant")
+	event := fs.String("event", "pull_request", "X-GitHub-Event value")
+	file := fs.String("file", "", "payload file, stdin when empty")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	payload, err := c.input(*file)
+	if err != nil {
+		return err
+	}
+	result, err := c.client.IngestGithub(c.ctx, *event, payload, *secret)
+	if err != nil {
+		return err
+	}
+	return c.print(result)
+}
+
+func ingestGitlab(c *cli, args []string) error {
+	fs := c.flags("ingest gitlab")
+	token := fs.String("token", "", "GitLab webhook token of the tenant")
+	event := fs.String("event", "Merge Request Hook", "X-Gitlab-Event value")
+	file := fs.String("file", "", "payload file, stdin when empty")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	payload, err := c.input(*file)
+	if err != nil {
+		return err
+	}
+	result, err := c.client.IngestGitlab(c.ctx, *event, payload, *token)
+	if err != nil {
+		return err
+	}
+	return c.print(result)
+}
+
+// metrics prints the Prometheus exposition as is, regardless of -o.
+func metrics(c *cli, args []string) error {
+	if _, err := c.parse(c.flags("metrics"), args, 0); err != nil {
+		return err
+	}
+	text, err := c.client.Metrics(c.ctx)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(c.stdout, text)
+	return err
+}
+
+func consistency(c *cli, args []string) error {
+	fs := c.flags("consistency")
+	repair := fs.Bool("repair", false, "fix violations that can be fixed automatically")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	report, err := c.client.ConsistencyCheck(c.ctx, *repair)
+	if err != nil {
+		return err
+	}
+	return c.print(report)
+}
+
+// snapshotExport writes JSON, the format snapshot import expects, unless
+// -o yaml is given explicitly.
+func snapshotExport(c *cli, args []string) error {
+	fs := c.flags("snapshot export")
+	file := fs.String("file", "", "output file, stdout when empty")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	snapshot, err := c.client.SnapshotExport(c.ctx)
+	if err != nil {
+		return err
+	}
+
+	format := c.output
+	if format == TABLE {
+		format = JSON
+	}
+	if *file == "" {
+		return write(c.stdout, format, snapshot)
+	}
+	var b bytes.Buffer
+	if err = write(&b, format, snapshot); err != nil {
+		return err
+	}
+	return os.WriteFile(*file, b.Bytes(), 0o600)
+}
+
+func snapshotImport(c *cli, args []string) error {
+	fs := c.flags("snapshot import")
+	file := fs.String("file", "", "snapshot file, stdin when empty")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	data, err := c.input(*file)
+	if err != nil {
+		return err
+	}
+	var snapshot models.Snapshot
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+	result, err := c.client.SnapshotImport(c.ctx, snapshot)
+	if err != nil {
+		return err
+	}
+	return c.print(result)
+}
+
+func healthLive(c *cli, args []string) error {
+	if _, err := c.parse(c.flags("health live"), args, 0); err != nil {
+		return err
+	}
+	report, err := c.client.HealthLive(c.ctx)
+	if err != nil {
+		return err
+	}
+	return c.print(report)
+}
+
+// healthReady prints the report even when the server is not ready, the exit
+// code is 1 then.
+func healthReady(c *cli, args []string) error {
+	if _, err := c.parse(c.flags("health ready"), args, 0); err != nil {
+		return err
+	}
+	report, err := c.client.HealthReady(c.ctx)
+	if report.Status != "" {
+		if printErr := c.print(report); printErr != nil {
+			return printErr
+		}
+	}
+	return err
+}
+
+func tenantCreate(c *cli, args []string) error {
+	fs := c.flags("tenant create")
+	name := fs.String("name", "", "tenant name")
+	positional, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *name == "" {
+		return errUsage
+	}
+	tenant, err := c.client.TenantCreate(c.ctx, models.Tenant{TenantId: positional[0], Name: *name})
+	if err != nil {
+		return err
+	}
+	return c.print(tenant)
+}
+
+func tenantList(c *cli, args []string) error {
+	if _, err := c.parse(c.flags("tenant list"), args, 0); err != nil {
+		return err
+	}
+	tenants, err := c.client.Tenants(c.ctx)
+	if err != nil {
+		return err
+	}
+	return c.print(tenants)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const DEFAULT_SERVER_URL = "http://localhost:8080"
+
+type config struct {
+	Server string
+	Output string
+	Token  string
+	Tenant string
+}
+
+// defaultConfigPath returns $PRCTL_CONFIG or <user config dir>/prctl/config.yaml.
+func defaultConfigPath() string {
+	if path := os.Getenv("PRCTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "prctl", "config.yaml")
+}
+
+// loadConfig reads a flat "key: value" file:
+//
+//	server: http://pr-reviewer.internal:8080
+//	output: table
+//	token: s3cret
+//	tenant: acme
+//
+// A missing file is not an error unless it was asked for explicitly.
+func loadConfig(path string, explicit bool) (config, error) {
+	conf := config{Server: DEFAULT_SERVER_URL, Output: TABLE}
+	if path == "" {
+		return conf, nil
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return conf, nil
+	}
+	if err != nil {
+		return conf, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, ":")
+		if !ok {
+			return conf, fmt.Errorf("%s:%d: expected \"key: value\"", path, line)
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+
+		switch strings.TrimSpace(key) {
+		case "server":
+			conf.Server = value
+		case "output":
+			conf.Output = value
+		case "token":
+			conf.Token = value
+		case "tenant":
+			conf.Tenant = value
+		default:
+			return conf, fmt.Errorf("%s:%d: unknown key %q", path, line, strings.TrimSpace(key))
+		}
+	}
+	return conf, scanner.Err()
+}
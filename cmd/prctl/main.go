@@ -0,0 +1,24 @@
+// Command prctl is a command-line client for pr-reviewer-service.
+//
+// Usage:
+//
+//	prctl [--server URL] [--config FILE] [--token TOKEN] [--tenant ID] [-o table|json|yaml] <command> [args]
+//
+// The server URL, the API token, the tenant and the default output format are
+// read from the config file ($PRCTL_CONFIG or <user config dir>/prctl/config.yaml),
+// flags take precedence. The token may also come from $PRCTL_TOKEN.
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+const (
+	TABLE = "table"
+	JSON  = "json"
+	YAML  = "yaml"
+)
+
+func validFormat(format string) bool {
+	return format == TABLE || format == JSON || format == YAML
+}
+
+func write(w io.Writer, format string, v any) error {
+	switch format {
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case YAML:
+		return writeYAML(w, v)
+	default:
+		return writeTable(w, v)
+	}
+}
+
+// writeTable prints the known response types as aligned columns, anything
+// else falls back to JSON.
+func writeTable(w io.Writer, v any) error {
+	switch v := v.(type) {
+	case models.Team:
+		rows := make([][]string, 0, len(v.Members))
+		for _, m := range v.Members {
+			rows = append(rows, []string{v.TeamName, m.UserId, m.Username, strconv.FormatBool(m.IsActive), roleName(m.Role)})
+		}
+		return table(w, []string{"TEAM", "USER_ID", "USERNAME", "ACTIVE", "ROLE"}, rows)
+	case models.TeamTree:
+		var rows [][]string
+		var walk func(tree models.TeamTree, depth int)
+		walk = func(tree models.TeamTree, depth int) {
+			name := strings.Repeat("  ", depth) + tree.TeamName
+			for _, m := range tree.Members {
+				rows = append(rows, []string{name, m.UserId, m.Username, strconv.FormatBool(m.IsActive), roleName(m.Role)})
+			}
+			if len(tree.Members) == 0 {
+				rows = append(rows, []string{name, "", "", "", ""})
+			}
+			for _, subtree := range tree.Subteams {
+				walk(subtree, depth+1)
+			}
+		}
+		walk(v, 0)
+		return table(w, []string{"TEAM", "USER_ID", "USERNAME", "ACTIVE", "ROLE"}, rows)
+	case models.User:
+		return table(w, []string{"USER_ID", "USERNAME", "TEAM", "TEAMS", "ACTIVE"},
+			[][]string{{v.UserId, v.Username, v.TeamName, strings.Join(v.Teams, ","), strconv.FormatBool(v.IsActive)}})
+	case models.PullRequest:
+		return table(w, []string{"ID", "NAME", "AUTHOR", "STATUS", "REVIEWERS", "CREATED"}, [][]string{prRow(&v)})
+	case models.ReassignResponse:
+		return table(w, []string{"ID", "NAME", "AUTHOR", "STATUS", "REVIEWERS", "CREATED", "REPLACED_BY"},
+			[][]string{append(prRow(&v.PR), v.ReplacedBy)})
+	case models.UserReviewsResponse:
+		return writeTable(w, v.PullRequests)
+	case []models.PullRequestShort:
+		rows := make([][]string, 0, len(v))
+		for _, pr := range v {
+			rows = append(rows, []string{pr.PullRequestId, pr.PullRequestName, pr.AuthorId, string(pr.Status), strconv.FormatBool(pr.Overdue)})
+		}
+		return table(w, []string{"ID", "NAME", "AUTHOR", "STATUS", "OVERDUE"}, rows)
+	case []models.OverdueReview:
+		rows := make([][]string, 0, len(v))
+		for _, r := range v {
+			rows = append(rows, []string{r.PullRequestId, r.PullRequestName, r.TeamName, r.ReviewerId, formatTime(&r.AssignedAt), formatTime(&r.DueAt)})
+		}
+		return table(w, []string{"ID", "NAME", "TEAM", "REVIEWER", "ASSIGNED", "DUE"}, rows)
+	case models.PullRequestHistory:
+		rows := make([][]string, 0, len(v.Events))
+		for _, e := range v.Events {
+			rows = append(rows, []string{strconv.FormatInt(e.Seq, 10), formatTime(&e.Timestamp), string(e.Type), e.ReviewerId, e.OldReviewerId})
+		}
+		return table(w, []string{"SEQ", "TIME", "TYPE", "REVIEWER", "OLD_REVIEWER"}, rows)
+	case []models.AuditEvent:
+		rows := make([][]string, 0, len(v))
+		for _, e := range v {
+			rows = append(rows, []string{strconv.FormatInt(e.Id, 10), formatTime(&e.Timestamp), e.Actor, string(e.Action), string(e.EntityType), e.EntityId})
+		}
+		return table(w, []string{"ID", "TIME", "ACTOR", "ACTION", "ENTITY", "ENTITY_ID"}, rows)
+	case models.WebhookSubscription:
+		return writeTable(w, []models.WebhookSubscription{v})
+	case []models.WebhookSubscription:
+		rows := make([][]string, 0, len(v))
+		for _, s := range v {
+			events := make([]string, 0, len(s.EventTypes))
+			for _, t := range s.EventTypes {
+				events = append(events, string(t))
+			}
+			rows = append(rows, []string{s.Id, s.Url, strings.Join(events, ","), formatTime(&s.CreatedAt)})
+		}
+		return table(w, []string{"ID", "URL", "EVENTS", "CREATED"}, rows)
+	case []models.WebhookDelivery:
+		rows := make([][]string, 0, len(v))
+		for _, d := range v {
+			rows = append(rows, []string{d.DeliveryId, string(d.EventType), strconv.Itoa(d.Attempt), formatTime(&d.Timestamp),
+				strconv.Itoa(d.StatusCode), strconv.FormatBool(d.Delivered), d.Error})
+		}
+		return table(w, []string{"DELIVERY", "EVENT", "ATTEMPT", "TIME", "STATUS", "DELIVERED", "ERROR"}, rows)
+	case models.IngestResult:
+		row := []string{v.Action, "", ""}
+		if v.PR != nil {
+			row[1], row[2] = v.PR.PullRequestId, string(v.PR.Status)
+		}
+		return table(w, []string{"ACTION", "PR", "STATUS"}, [][]string{row})
+	case models.ConsistencyReport:
+		if v.Consistent {
+			_, err := fmt.Fprintln(w, "consistent")
+			return err
+		}
+		rows := make([][]string, 0, len(v.Violations))
+		for _, violation := range v.Violations {
+			rows = append(rows, []string{string(violation.Rule), string(violation.EntityType), violation.EntityId,
+				strconv.FormatBool(violation.Repaired), violation.Message})
+		}
+		return table(w, []string{"RULE", "ENTITY", "ENTITY_ID", "REPAIRED", "MESSAGE"}, rows)
+	case models.HealthReport:
+		checks := make([]string, 0, len(v.Checks))
+		for name, status := range v.Checks {
+			checks = append(checks, name+"="+status)
+		}
+		return table(w, []string{"STATUS", "VERSION", "UPTIME", "CHECKS"},
+			[][]string{{v.Status, v.Version, (time.Duration(v.UptimeSeconds) * time.Second).String(), strings.Join(checks, ",")}})
+	case models.Tenant:
+		return writeTable(w, []models.Tenant{v})
+	case []models.Tenant:
+		rows := make([][]string, 0, len(v))
+		for _, t := range v {
+			rows = append(rows, []string{t.TenantId, t.Name, formatTime(&t.CreatedAt)})
+		}
+		return table(w, []string{"ID", "NAME", "CREATED"}, rows)
+	case models.SnapshotImportResult:
+		return table(w, []string{"TEAMS", "USERS", "PULL_REQUESTS"},
+			[][]string{{strconv.Itoa(v.Teams), strconv.Itoa(v.Users), strconv.Itoa(v.PullRequests)}})
+	}
+	return write(w, JSON, v)
+}
+
+func prRow(pr *models.PullRequest) []string {
+	return []string{pr.PullRequestId, pr.PullRequestName, pr.AuthorId, string(pr.Status), strings.Join(pr.AssignedReviewers, ","), formatTime(pr.CreatedAt)}
+}
+
+// roleName shows the default role of members without one.
+func roleName(role models.TeamRole) string {
+	if role == "" {
+		return string(models.TEAM_MEMBER)
+	}
+	return string(role)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+func table(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// field keeps object keys in the order encoding/json produced them.
+type field struct {
+	key   string
+	value any
+}
+
+// writeYAML renders v as YAML by walking its JSON encoding, so json tags and
+// omitempty apply the same way as in JSON output.
+func writeYAML(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	node, err := decodeNode(dec)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	switch node := node.(type) {
+	case []field, []any:
+		if isEmpty(node) {
+			b.WriteString(scalar(node) + "\n")
+		} else {
+			writeBlock(&b, node, 0)
+		}
+	default:
+		b.WriteString(scalar(node) + "\n")
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+func decodeNode(dec *json.Decoder) (any, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		fields := make([]field, 0)
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, field{key: key.(string), value: value})
+		}
+		_, err = dec.Token()
+		return fields, err
+	case json.Delim('['):
+		items := make([]any, 0)
+		for dec.More() {
+			item, err := decodeNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		_, err = dec.Token()
+		return items, err
+	}
+	return token, nil
+}
+
+// writeBlock writes a non-empty object or array at the given indentation.
+func writeBlock(b *strings.Builder, node any, indent int) {
+	pad := strings.Repeat(" ", indent)
+	switch node := node.(type) {
+	case []field:
+		for _, f := range node {
+			key := scalar(f.key)
+			if isEmpty(f.value) || !isCollection(f.value) {
+				fmt.Fprintf(b, "%s%s: %s\n", pad, key, scalar(f.value))
+				continue
+			}
+			fmt.Fprintf(b, "%s%s:\n", pad, key)
+			writeBlock(b, f.value, indent+2)
+		}
+	case []any:
+		for _, item := range node {
+			if isEmpty(item) || !isCollection(item) {
+				fmt.Fprintf(b, "%s- %s\n", pad, scalar(item))
+				continue
+			}
+			// render the item two columns deeper and put the dash in front
+			// of its first line
+			var nested strings.Builder
+			writeBlock(&nested, item, indent+2)
+			b.WriteString(pad + "- " + strings.TrimPrefix(nested.String(), pad+"  "))
+		}
+	}
+}
+
+func isCollection(node any) bool {
+	switch node.(type) {
+	case []field, []any:
+		return true
+	}
+	return false
+}
+
+func isEmpty(node any) bool {
+	switch node := node.(type) {
+	case []field:
+		return len(node) == 0
+	case []any:
+		return len(node) == 0
+	}
+	return false
+}
+
+func scalar(node any) string {
+	switch node := node.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(node)
+	case json.Number:
+		return node.String()
+	case string:
+		return quoteIfNeeded(node)
+	case []field:
+		return "{}"
+	case []any:
+		return "[]"
+	}
+	return fmt.Sprint(node)
+}
+
+// quoteIfNeeded leaves plain strings bare and quotes anything a YAML parser
+// would read as another type or as syntax.
+func quoteIfNeeded(s string) string {
+	if s == "" || strings.TrimSpace(s) != s || strings.ContainsAny(s, "\n\t\"\\") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") ||
+		strings.ContainsRune("-?:,[]{}#&*!|>'%@`", rune(s[0])) {
+		return strconv.Quote(s)
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~", "y", "n":
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+func fakeServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/team/get", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("team_name") != "backend" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.NOT_FOUND, "team_name not found"))
+			return
+		}
+		json.NewEncoder(w).Encode(models.Team{TeamName: "backend", Members: []models.TeamMember{
+			{UserId: "u1", Username: "Alice", IsActive: true},
+			{UserId: "u2", Username: "Bob", IsActive: false},
+		}})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func runPrctl(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	t.Setenv("PRCTL_CONFIG", filepath.Join(t.TempDir(), "missing.yaml"))
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, strings.NewReader(""), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestOutputFormats(t *testing.T) {
+	server := fakeServer(t)
+
+	for _, tc := range []struct {
+		format   string
+		expected string
+	}{
+		{TABLE, "TEAM     USER_ID  USERNAME  ACTIVE  ROLE\nbackend  u1       Alice     true    MEMBER\nbackend  u2       Bob       false   MEMBER\n"},
+		{YAML, "team_name: backend\nmembers:\n  - user_id: u1\n    username: Alice\n    is_active: true\n  - user_id: u2\n    username: Bob\n    is_active: false\n"},
+		{JSON, "{\n  \"team_name\": \"backend\",\n  \"members\": [\n    {\n      \"user_id\": \"u1\",\n      \"username\": \"Alice\",\n      \"is_active\": true\n    },\n    {\n      \"user_id\": \"u2\",\n      \"username\": \"Bob\",\n      \"is_active\": false\n    }\n  ]\n}\n"},
+	} {
+		// flags are accepted before and after positional arguments
+		code, stdout, stderr := runPrctl(t, "--server", server.URL, "team", "get", "backend", "-o", tc.format)
+		if code != 0 {
+			t.Fatalf("%s: exit code %d, stderr: %s", tc.format, code, stderr)
+		}
+		if stdout != tc.expected {
+			t.Fatalf("%s: expected\n%s\ngot\n%s", tc.format, tc.expected, stdout)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	server := fakeServer(t)
+
+	code, _, stderr := runPrctl(t, "--server", server.URL, "team", "get", "frontend")
+	if code != 1 || !strings.Contains(stderr, "NOT_FOUND") {
+		t.Fatalf("Expected exit code 1 with NOT_FOUND, got %d: %s", code, stderr)
+	}
+
+	code, _, stderr = runPrctl(t, "--server", server.URL, "team", "get")
+	if code != 2 || !strings.Contains(stderr, "usage: prctl team get NAME") {
+		t.Fatalf("Expected usage error, got %d: %s", code, stderr)
+	}
+
+	code, _, _ = runPrctl(t, "unknown")
+	if code != 2 {
+		t.Fatalf("Expected exit code 2 for an unknown command, got %d", code)
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	server := fakeServer(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := "# prctl\nserver: " + server.URL + "\noutput: yaml\n"
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr := runPrctl(t, "--config", path, "team", "get", "backend")
+	if code != 0 {
+		t.Fatalf("Exit code %d, stderr: %s", code, stderr)
+	}
+	if !strings.HasPrefix(stdout, "team_name: backend\n") {
+		t.Fatalf("Expected YAML from the configured output format, got %s", stdout)
+	}
+
+	code, _, _ = runPrctl(t, "--config", filepath.Join(t.TempDir(), "nope.yaml"), "team", "get", "backend")
+	if code != 1 {
+		t.Fatalf("Expected a missing explicit config to fail, got %d", code)
+	}
+}
+
+func TestToken(t *testing.T) {
+	var authorization atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization.Store(r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.Team{TeamName: "backend"})
+	}))
+	t.Cleanup(server.Close)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("server: "+server.URL+"\ntoken: from-config\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		env      string
+		args     []string
+		expected string
+	}{
+		{"", nil, "Bearer from-config"},
+		{"from-env", nil, "Bearer from-env"},
+		{"from-env", []string{"--token", "from-flag"}, "Bearer from-flag"},
+	} {
+		t.Setenv("PRCTL_TOKEN", tc.env)
+		args := append([]string{"--config", path, "team", "get", "backend"}, tc.args...)
+		if code, _, stderr := runPrctl(t, args...); code != 0 {
+			t.Fatalf("Exit code %d, stderr: %s", code, stderr)
+		}
+		if got := authorization.Load(); got != tc.expected {
+			t.Fatalf("Expected %q, got %q", tc.expected, got)
+		}
+	}
+}
+
+func TestTenant(t *testing.T) {
+	var tenant atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant.Store(r.Header.Get("X-Tenant"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.TenantsResponse{Tenants: []models.Tenant{{TenantId: "acme", Name: "Acme"}}})
+	}))
+	t.Cleanup(server.Close)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("server: "+server.URL+"\ntenant: from-config\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "from-config"},
+		{[]string{"--tenant", "from-flag"}, "from-flag"},
+	} {
+		args := append([]string{"--config", path, "tenant", "list"}, tc.args...)
+		code, stdout, stderr := runPrctl(t, args...)
+		if code != 0 {
+			t.Fatalf("Exit code %d, stderr: %s", code, stderr)
+		}
+		if got := tenant.Load(); got != tc.expected {
+			t.Fatalf("Expected %q, got %q", tc.expected, got)
+		}
+		if !strings.Contains(stdout, "acme") {
+			t.Fatalf("Expected the tenant in the table, got %q", stdout)
+		}
+	}
+}
+
+func TestConsistency(t *testing.T) {
+	var repaired atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/consistency", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(models.ConsistencyReport{Violations: []models.ConsistencyViolation{
+			{Rule: models.REVIEWER_MISSING, EntityType: models.PR_ENTITY, EntityId: "r1", Message: "reviewer u9 does not exist"},
+		}})
+	})
+	mux.HandleFunc("POST /admin/consistency/repair", func(w http.ResponseWriter, r *http.Request) {
+		repaired.Store(true)
+		json.NewEncoder(w).Encode(models.ConsistencyReport{Consistent: true})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	code, stdout, stderr := runPrctl(t, "--server", server.URL, "consistency")
+	if code != 0 || !strings.Contains(stdout, "REVIEWER_MISSING") || !strings.Contains(stdout, "reviewer u9 does not exist") {
+		t.Fatalf("Expected the violation in the table, got %d: %s%s", code, stdout, stderr)
+	}
+	code, stdout, stderr = runPrctl(t, "--server", server.URL, "consistency", "--repair")
+	if code != 0 || stdout != "consistent\n" || !repaired.Load() {
+		t.Fatalf("Expected a repair, got %d: %s%s", code, stdout, stderr)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	snapshot := models.Snapshot{Version: 1, Teams: []models.Team{{TeamName: "backend"}}, Users: []models.User{}, PullRequests: []models.PullRequest{}}
+	var imported atomic.Value
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/snapshot/export", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(snapshot)
+	})
+	mux.HandleFunc("POST /admin/snapshot/import", func(w http.ResponseWriter, r *http.Request) {
+		var body models.Snapshot
+		json.NewDecoder(r.Body).Decode(&body)
+		imported.Store(body)
+		json.NewEncoder(w).Encode(models.SnapshotImportResult{Teams: len(body.Teams)})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	file := filepath.Join(t.TempDir(), "snapshot.json")
+
+	code, _, stderr := runPrctl(t, "--server", server.URL, "snapshot", "export", "--file", file)
+	if code != 0 {
+		t.Fatalf("export: exit code %d, stderr: %s", code, stderr)
+	}
+	code, stdout, stderr := runPrctl(t, "--server", server.URL, "snapshot", "import", "--file", file)
+	if code != 0 || !strings.Contains(stdout, "TEAMS") {
+		t.Fatalf("import: exit code %d, stdout: %s, stderr: %s", code, stdout, stderr)
+	}
+	if got, _ := imported.Load().(models.Snapshot); len(got.Teams) != 1 || got.Teams[0].TeamName != "backend" {
+		t.Fatalf("Expected the exported snapshot to be imported, got %+v", got)
+	}
+}
+
+func TestWatchReviews(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prs := []models.PullRequestShort{{PullRequestId: "r1", PullRequestName: "req1", AuthorId: "u2", Status: models.OPEN}}
+		if calls.Add(1) > 2 {
+			prs = append(prs, models.PullRequestShort{PullRequestId: "r2", PullRequestName: "req2", AuthorId: "u3", Status: models.OPEN})
+		}
+		json.NewEncoder(w).Encode(models.UserReviewsResponse{UserId: "u1", PullRequests: prs})
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for calls.Load() < 4 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+
+	t.Setenv("PRCTL_CONFIG", filepath.Join(t.TempDir(), "missing.yaml"))
+	var stdout, stderr bytes.Buffer
+	code := run(ctx, []string{"--server", server.URL, "user", "reviews", "u1", "--watch", "--interval", "1ms"}, nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Exit code %d, stderr: %s", code, stderr.String())
+	}
+
+	// the queue is printed once per change, not once per poll
+	if n := strings.Count(stdout.String(), "# "); n != 2 {
+		t.Fatalf("Expected 2 snapshots of the queue, got %d:\n%s", n, stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "2 pull requests") {
+		t.Fatalf("Expected the updated queue, got:\n%s", stdout.String())
+	}
+}
+
+func TestQuoteIfNeeded(t *testing.T) {
+	for in, expected := range map[string]string{
+		"plain":       "plain",
+		"":            `""`,
+		"true":        `"true"`,
+		"42":          `"42"`,
+		"a: b":        `"a: b"`,
+		"-x":          `"-x"`,
+		"org/repo#12": "org/repo#12",
+	} {
+		if got := quoteIfNeeded(in); got != expected {
+			t.Fatalf("quoteIfNeeded(%q) = %s, expected %s", in, got, expected)
+		}
+	}
+}
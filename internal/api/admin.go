@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/service"
+)
+
+func ConsistencyCheckHandler(svc *service.PrReviewerService) http.HandlerFunc {
+	return consistencyHandler(svc, false)
+}
+
+func ConsistencyRepairHandler(svc *service.PrReviewerService) http.HandlerFunc {
+	return consistencyHandler(svc, true)
+}
+
+func consistencyHandler(svc *service.PrReviewerService, repair bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		report, err := svc.CheckConsistency(r.Context(), repair)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, err.Error()))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+func SnapshotExportHandler(svc *service.PrReviewerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		snapshot, err := svc.SnapshotExport(r.Context())
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, err.Error()))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(snapshot)
+	}
+}
+
+func SnapshotImportHandler(svc *service.PrReviewerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var snapshot models.Snapshot
+		if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.BAD_REQUEST, err.Error()))
+			return
+		}
+
+		result, err := svc.SnapshotImport(r.Context(), snapshot)
+		if err != nil {
+			var svcErr service.ErrorService
+			if errors.As(err, &svcErr) {
+				switch svcErr.Code {
+				case service.INVALID_INPUT:
+					w.WriteHeader(http.StatusUnprocessableEntity)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, svcErr.Error()))
+				case service.DOMAIN_ERROR:
+					w.WriteHeader(http.StatusConflict)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, svcErr.Error()))
+				default:
+					w.WriteHeader(http.StatusInternalServerError)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, svcErr.Error()))
+				}
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, err.Error()))
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+func TenantCreateHandler(svc *service.PrReviewerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var tenant models.Tenant
+		if err := json.NewDecoder(r.Body).Decode(&tenant); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.BAD_REQUEST, err.Error()))
+			return
+		}
+
+		created, err := svc.TenantCreate(r.Context(), tenant)
+		if err != nil {
+			var svcErr service.ErrorService
+			if errors.As(err, &svcErr) {
+				switch svcErr.ApiCode {
+				case models.TENANT_EXISTS:
+					w.WriteHeader(http.StatusBadRequest)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, "tenant_id already exists"))
+				default:
+					writeServiceError(w, svcErr)
+				}
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, err.Error()))
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(models.TenantResponse{Tenant: created})
+	}
+}
+
+func TenantListHandler(svc *service.PrReviewerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		tenants, err := svc.Tenants(r.Context())
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(models.TenantsResponse{Tenants: tenants})
+	}
+}
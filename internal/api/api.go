@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/Dowtai/pr-reviewer-service/internal/models"
 	"github.com/Dowtai/pr-reviewer-service/internal/service"
@@ -15,21 +17,24 @@ func TeamAddHandler(svc *service.PrReviewerService) http.HandlerFunc {
 
 		var team models.Team
 		if err := json.NewDecoder(r.Body).Decode(&team); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.BAD_REQUEST, err.Error()))
 			return
 		}
 
-		createdTeam, err := svc.TeamAdd(team)
+		createdTeam, err := svc.TeamAdd(r.Context(), team)
 		if err != nil {
 			var svcErr service.ErrorService
 			if errors.As(err, &svcErr) {
-				switch svcErr.Code {
-				case service.INTERNAL_ERROR:
+				switch {
+				case svcErr.Code == service.INTERNAL_ERROR:
 					w.WriteHeader(http.StatusInternalServerError)
 					json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, svcErr.Error()))
-				case service.OBJECT_EXISTS:
+				case svcErr.ApiCode == models.TEAM_EXISTS:
 					w.WriteHeader(http.StatusBadRequest)
 					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, "team_name already exists"))
+				default:
+					writeServiceError(w, svcErr)
 				}
 			} else {
 				w.WriteHeader(http.StatusInternalServerError)
@@ -39,7 +44,7 @@ func TeamAddHandler(svc *service.PrReviewerService) http.HandlerFunc {
 		}
 
 		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(createdTeam)
+		json.NewEncoder(w).Encode(models.TeamResponse{Team: createdTeam})
 	}
 }
 
@@ -49,11 +54,19 @@ func TeamGetHandler(svc *service.PrReviewerService) http.HandlerFunc {
 
 		teamName := r.URL.Query().Get("team_name")
 		if teamName == "" {
-			http.Error(w, "wrong TeamNameQuery", http.StatusBadRequest)
+			writeValidationError(w, models.FieldError{Field: "team_name", Message: "is required"})
 			return
 		}
 
-		team, err := svc.TeamGet(teamName)
+		// the spec only lets booleans through
+		subtree, _ := strconv.ParseBool(r.URL.Query().Get("subtree"))
+		var team any
+		var err error
+		if subtree {
+			team, err = svc.TeamGetSubtree(r.Context(), teamName)
+		} else {
+			team, err = svc.TeamGet(r.Context(), teamName)
+		}
 		if err != nil {
 			var svcErr service.ErrorService
 			if errors.As(err, &svcErr) {
@@ -64,6 +77,8 @@ func TeamGetHandler(svc *service.PrReviewerService) http.HandlerFunc {
 				case service.OBJECT_NOT_FOUND:
 					w.WriteHeader(http.StatusNotFound)
 					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, "team_name not found"))
+				default:
+					writeServiceError(w, svcErr)
 				}
 			} else {
 				w.WriteHeader(http.StatusInternalServerError)
@@ -77,6 +92,127 @@ func TeamGetHandler(svc *service.PrReviewerService) http.HandlerFunc {
 	}
 }
 
+func TeamSetMemberRoleHandler(svc *service.PrReviewerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var request struct {
+			TeamName string          `json:"team_name"`
+			UserId   string          `json:"user_id"`
+			Role     models.TeamRole `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.BAD_REQUEST, err.Error()))
+			return
+		}
+
+		updatedTeam, err := svc.TeamSetMemberRole(r.Context(), request.TeamName, request.UserId, request.Role)
+		if err != nil {
+			var svcErr service.ErrorService
+			if errors.As(err, &svcErr) {
+				switch svcErr.Code {
+				case service.INTERNAL_ERROR:
+					w.WriteHeader(http.StatusInternalServerError)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, svcErr.Error()))
+				case service.OBJECT_NOT_FOUND:
+					w.WriteHeader(http.StatusNotFound)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, "team_name or user_id not found"))
+				default:
+					writeServiceError(w, svcErr)
+				}
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, err.Error()))
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(models.TeamResponse{Team: updatedTeam})
+	}
+}
+
+func TeamSetPolicyHandler(svc *service.PrReviewerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var request struct {
+			TeamName string             `json:"team_name"`
+			Policy   *models.TeamPolicy `json:"policy"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.BAD_REQUEST, err.Error()))
+			return
+		}
+
+		updatedTeam, err := svc.TeamSetPolicy(r.Context(), request.TeamName, request.Policy)
+		if err != nil {
+			var svcErr service.ErrorService
+			if errors.As(err, &svcErr) {
+				switch svcErr.Code {
+				case service.INTERNAL_ERROR:
+					w.WriteHeader(http.StatusInternalServerError)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, svcErr.Error()))
+				case service.OBJECT_NOT_FOUND:
+					w.WriteHeader(http.StatusNotFound)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, "team_name not found"))
+				default:
+					writeServiceError(w, svcErr)
+				}
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, err.Error()))
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(models.TeamResponse{Team: updatedTeam})
+	}
+}
+
+func TeamSetSLAHandler(svc *service.PrReviewerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var request struct {
+			TeamName  string `json:"team_name"`
+			ReviewSLA string `json:"review_sla"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.BAD_REQUEST, err.Error()))
+			return
+		}
+
+		updatedTeam, err := svc.TeamSetSLA(r.Context(), request.TeamName, request.ReviewSLA)
+		if err != nil {
+			var svcErr service.ErrorService
+			if errors.As(err, &svcErr) {
+				switch svcErr.Code {
+				case service.INTERNAL_ERROR:
+					w.WriteHeader(http.StatusInternalServerError)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, svcErr.Error()))
+				case service.OBJECT_NOT_FOUND:
+					w.WriteHeader(http.StatusNotFound)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, "team_name not found"))
+				default:
+					writeServiceError(w, svcErr)
+				}
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, err.Error()))
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(models.TeamResponse{Team: updatedTeam})
+	}
+}
+
 func UsersSetIsActiveHandler(svc *service.PrReviewerService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -86,11 +222,12 @@ func UsersSetIsActiveHandler(svc *service.PrReviewerService) http.HandlerFunc {
 			IsActive bool   `json:"is_active"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.BAD_REQUEST, err.Error()))
 			return
 		}
 
-		updatedUser, err := svc.UsersSetIsActive(request.UserId, request.IsActive)
+		updatedUser, err := svc.UsersSetIsActive(r.Context(), request.UserId, request.IsActive)
 		if err != nil {
 			var svcErr service.ErrorService
 			if errors.As(err, &svcErr) {
@@ -101,6 +238,8 @@ func UsersSetIsActiveHandler(svc *service.PrReviewerService) http.HandlerFunc {
 				case service.OBJECT_NOT_FOUND:
 					w.WriteHeader(http.StatusNotFound)
 					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, "user_id not found"))
+				default:
+					writeServiceError(w, svcErr)
 				}
 			} else {
 				w.WriteHeader(http.StatusInternalServerError)
@@ -110,7 +249,47 @@ func UsersSetIsActiveHandler(svc *service.PrReviewerService) http.HandlerFunc {
 		}
 
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(updatedUser)
+		json.NewEncoder(w).Encode(models.UserResponse{User: updatedUser})
+	}
+}
+
+func UsersSetPrimaryTeamHandler(svc *service.PrReviewerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var request struct {
+			UserId   string `json:"user_id"`
+			TeamName string `json:"team_name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.BAD_REQUEST, err.Error()))
+			return
+		}
+
+		updatedUser, err := svc.UsersSetPrimaryTeam(r.Context(), request.UserId, request.TeamName)
+		if err != nil {
+			var svcErr service.ErrorService
+			if errors.As(err, &svcErr) {
+				switch svcErr.Code {
+				case service.INTERNAL_ERROR:
+					w.WriteHeader(http.StatusInternalServerError)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, svcErr.Error()))
+				case service.OBJECT_NOT_FOUND:
+					w.WriteHeader(http.StatusNotFound)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, "user_id not found"))
+				default:
+					writeServiceError(w, svcErr)
+				}
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, err.Error()))
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(models.UserResponse{User: updatedUser})
 	}
 }
 
@@ -122,13 +301,15 @@ func PullRequestCreateHandler(svc *service.PrReviewerService) http.HandlerFunc {
 			PullRequestId   string `json:"pull_request_id"`
 			PullRequestName string `json:"pull_request_name"`
 			AuthorId        string `json:"author_id"`
+			TeamName        string `json:"team_name"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.BAD_REQUEST, err.Error()))
 			return
 		}
 
-		createdPullRequest, err := svc.PullRequestCreate(request.PullRequestId, request.PullRequestName, request.AuthorId)
+		createdPullRequest, err := svc.PullRequestCreate(r.Context(), request.PullRequestId, request.PullRequestName, request.AuthorId, request.TeamName)
 		if err != nil {
 			var svcErr service.ErrorService
 			if errors.As(err, &svcErr) {
@@ -140,8 +321,14 @@ func PullRequestCreateHandler(svc *service.PrReviewerService) http.HandlerFunc {
 					w.WriteHeader(http.StatusNotFound)
 					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, "author or team not found"))
 				case service.DOMAIN_ERROR:
+					message := svcErr.Error()
+					if svcErr.ApiCode == models.PR_EXISTS {
+						message = "pull_request already exists"
+					}
 					w.WriteHeader(http.StatusConflict)
-					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, "pull_request already exists"))
+					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, message))
+				default:
+					writeServiceError(w, svcErr)
 				}
 			} else {
 				w.WriteHeader(http.StatusInternalServerError)
@@ -151,7 +338,7 @@ func PullRequestCreateHandler(svc *service.PrReviewerService) http.HandlerFunc {
 		}
 
 		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(createdPullRequest)
+		json.NewEncoder(w).Encode(models.PullRequestResponse{PR: createdPullRequest})
 	}
 }
 
@@ -163,11 +350,54 @@ func PullRequestMergeHandler(svc *service.PrReviewerService) http.HandlerFunc {
 			PullRequestId string `json:"pull_request_id"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.BAD_REQUEST, err.Error()))
+			return
+		}
+
+		mergedPullRequest, err := svc.PullRequestMerge(r.Context(), request.PullRequestId)
+		if err != nil {
+			var svcErr service.ErrorService
+			if errors.As(err, &svcErr) {
+				switch svcErr.Code {
+				case service.INTERNAL_ERROR:
+					w.WriteHeader(http.StatusInternalServerError)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, svcErr.Error()))
+				case service.OBJECT_NOT_FOUND:
+					w.WriteHeader(http.StatusNotFound)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, "pull_request not found"))
+				case service.DOMAIN_ERROR:
+					w.WriteHeader(http.StatusConflict)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, svcErr.Error()))
+				default:
+					writeServiceError(w, svcErr)
+				}
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, err.Error()))
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(models.PullRequestResponse{PR: mergedPullRequest})
+	}
+}
+
+func PullRequestCloseHandler(svc *service.PrReviewerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var request struct {
+			PullRequestId string `json:"pull_request_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.BAD_REQUEST, err.Error()))
 			return
 		}
 
-		mergedPullRequest, err := svc.PullRequestMerge(request.PullRequestId)
+		closedPullRequest, err := svc.PullRequestClose(r.Context(), request.PullRequestId)
 		if err != nil {
 			var svcErr service.ErrorService
 			if errors.As(err, &svcErr) {
@@ -178,6 +408,11 @@ func PullRequestMergeHandler(svc *service.PrReviewerService) http.HandlerFunc {
 				case service.OBJECT_NOT_FOUND:
 					w.WriteHeader(http.StatusNotFound)
 					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, "pull_request not found"))
+				case service.DOMAIN_ERROR:
+					w.WriteHeader(http.StatusConflict)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, svcErr.Error()))
+				default:
+					writeServiceError(w, svcErr)
 				}
 			} else {
 				w.WriteHeader(http.StatusInternalServerError)
@@ -187,7 +422,7 @@ func PullRequestMergeHandler(svc *service.PrReviewerService) http.HandlerFunc {
 		}
 
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(mergedPullRequest)
+		json.NewEncoder(w).Encode(models.PullRequestResponse{PR: closedPullRequest})
 	}
 }
 
@@ -198,13 +433,15 @@ func PullRequestReassignHandler(svc *service.PrReviewerService) http.HandlerFunc
 		var request struct {
 			PullRequestId string `json:"pull_request_id"`
 			OldUserId     string `json:"old_user_id"`
+			NewUserId     string `json:"new_user_id"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.BAD_REQUEST, err.Error()))
 			return
 		}
 
-		reassignedPullRequest, replacedBy, err := svc.PullRequestReassign(request.PullRequestId, request.OldUserId)
+		reassignedPullRequest, replacedBy, err := svc.PullRequestReassign(r.Context(), request.PullRequestId, request.OldUserId, request.NewUserId)
 		if err != nil {
 			var svcErr service.ErrorService
 			if errors.As(err, &svcErr) {
@@ -218,6 +455,8 @@ func PullRequestReassignHandler(svc *service.PrReviewerService) http.HandlerFunc
 				case service.DOMAIN_ERROR:
 					w.WriteHeader(http.StatusConflict)
 					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, svcErr.Error()))
+				default:
+					writeServiceError(w, svcErr)
 				}
 			} else {
 				w.WriteHeader(http.StatusInternalServerError)
@@ -227,10 +466,7 @@ func PullRequestReassignHandler(svc *service.PrReviewerService) http.HandlerFunc
 		}
 
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(struct {
-			PR         models.PullRequest `json:"pr"`
-			ReplacedBy string             `json:"replaced_by"`
-		}{
+		json.NewEncoder(w).Encode(models.ReassignResponse{
 			PR:         reassignedPullRequest,
 			ReplacedBy: replacedBy,
 		})
@@ -241,7 +477,8 @@ func UsersGetReviewHandler(svc *service.PrReviewerService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
-		prs, err := svc.UsersGetReview(r.URL.Query().Get("user_id"))
+		userId := r.URL.Query().Get("user_id")
+		prs, err := svc.UsersGetReview(r.Context(), userId)
 		if err != nil {
 			var svcErr service.ErrorService
 			if errors.As(err, &svcErr) {
@@ -252,6 +489,8 @@ func UsersGetReviewHandler(svc *service.PrReviewerService) http.HandlerFunc {
 				case service.OBJECT_NOT_FOUND:
 					w.WriteHeader(http.StatusNotFound)
 					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, "user not found"))
+				default:
+					writeServiceError(w, svcErr)
 				}
 			} else {
 				w.WriteHeader(http.StatusInternalServerError)
@@ -260,7 +499,120 @@ func UsersGetReviewHandler(svc *service.PrReviewerService) http.HandlerFunc {
 			return
 		}
 
+		overdue := 0
+		for _, pr := range prs {
+			if pr.Overdue {
+				overdue++
+			}
+		}
+
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(prs)
+		json.NewEncoder(w).Encode(models.UserReviewsResponse{UserId: userId, PullRequests: prs, OverdueCount: overdue})
+	}
+}
+
+func PullRequestHistoryHandler(svc *service.PrReviewerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		pullRequestId := r.URL.Query().Get("pull_request_id")
+		if pullRequestId == "" {
+			writeValidationError(w, models.FieldError{Field: "pull_request_id", Message: "is required"})
+			return
+		}
+
+		history, err := svc.PullRequestHistory(r.Context(), pullRequestId)
+		if err != nil {
+			var svcErr service.ErrorService
+			if errors.As(err, &svcErr) {
+				switch svcErr.Code {
+				case service.INTERNAL_ERROR:
+					w.WriteHeader(http.StatusInternalServerError)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, svcErr.Error()))
+				case service.OBJECT_NOT_FOUND:
+					w.WriteHeader(http.StatusNotFound)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, "pull_request not found"))
+				default:
+					writeServiceError(w, svcErr)
+				}
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, err.Error()))
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(history)
+	}
+}
+
+func PullRequestOverdueHandler(svc *service.PrReviewerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		query := r.URL.Query()
+		reviews, err := svc.PullRequestOverdue(r.Context(), query.Get("user_id"), query.Get("team_name"))
+		if err != nil {
+			var svcErr service.ErrorService
+			if errors.As(err, &svcErr) {
+				switch svcErr.Code {
+				case service.INTERNAL_ERROR:
+					w.WriteHeader(http.StatusInternalServerError)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, svcErr.Error()))
+				default:
+					writeServiceError(w, svcErr)
+				}
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, err.Error()))
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(models.OverdueResponse{Reviews: reviews})
+	}
+}
+
+func AuditHandler(svc *service.PrReviewerService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		query := r.URL.Query()
+		filter := models.AuditFilter{
+			EntityType: models.AuditEntity(query.Get("entity_type")),
+			EntityId:   query.Get("entity_id"),
+			Actor:      query.Get("actor"),
+		}
+		var err error
+		if filter.From, err = parseTimeQuery(query.Get("from")); err != nil {
+			writeValidationError(w, models.FieldError{Field: "from", Message: "must be an RFC 3339 date-time"})
+			return
+		}
+		if filter.To, err = parseTimeQuery(query.Get("to")); err != nil {
+			writeValidationError(w, models.FieldError{Field: "to", Message: "must be an RFC 3339 date-time"})
+			return
+		}
+
+		events, err := svc.AuditQuery(r.Context(), filter)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(events)
+	}
+}
+
+func parseTimeQuery(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
 	}
+	return &t, nil
 }
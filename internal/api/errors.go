@@ -0,0 +1,31 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/service"
+)
+
+// writeServiceError is the fallback of the handlers' error switches: a
+// service error gets its code as the status and its own message, anything
+// else is a 500 FATAL_ERROR. Either way the body is a models.ErrorResponse.
+func writeServiceError(w http.ResponseWriter, err error) {
+	var svcErr service.ErrorService
+	if !errors.As(err, &svcErr) || svcErr.Code == service.INTERNAL_ERROR || svcErr.ApiCode == "" || http.StatusText(svcErr.Code) == "" {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, err.Error()))
+		return
+	}
+	response := models.NewErrorResponse(svcErr.ApiCode, svcErr.Error())
+	response.Detail.Details = svcErr.Details
+	w.WriteHeader(svcErr.Code)
+	json.NewEncoder(w).Encode(response)
+}
+
+func writeValidationError(w http.ResponseWriter, details ...models.FieldError) {
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(models.NewValidationErrorResponse(details))
+}
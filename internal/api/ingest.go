@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/ingest"
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/service"
+)
+
+const MAX_INGEST_BODY = 5 << 20
+
+type ingestFunc func(ctx context.Context, header http.Header, body []byte) (models.IngestResult, error)
+
+func GithubIngestHandler(ingestor *ingest.Ingestor) http.HandlerFunc {
+	return ingestHandler(ingestor.Github)
+}
+
+func GitlabIngestHandler(ingestor *ingest.Ingestor) http.HandlerFunc {
+	return ingestHandler(ingestor.Gitlab)
+}
+
+func ingestHandler(handle ingestFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MAX_INGEST_BODY))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.BAD_REQUEST, err.Error()))
+			return
+		}
+
+		// providers cannot add headers, the tenant comes with the webhook url;
+		// the ingestor checks the webhook against that tenant's own secret
+		ctx := r.Context()
+		if tenantId := r.URL.Query().Get("tenant"); tenantId != "" {
+			ctx = service.WithTenant(ctx, tenantId)
+		}
+
+		result, err := handle(ctx, r.Header, body)
+		if err != nil {
+			var svcErr service.ErrorService
+			if errors.As(err, &svcErr) {
+				switch svcErr.Code {
+				case service.INTERNAL_ERROR:
+					w.WriteHeader(http.StatusInternalServerError)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, svcErr.Error()))
+				case service.UNAUTHENTICATED:
+					w.WriteHeader(http.StatusUnauthorized)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, svcErr.Error()))
+				case service.OBJECT_NOT_FOUND:
+					w.WriteHeader(http.StatusNotFound)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, svcErr.Error()))
+				case service.DOMAIN_ERROR:
+					w.WriteHeader(http.StatusConflict)
+					json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, svcErr.Error()))
+				default:
+					writeServiceError(w, svcErr)
+				}
+			} else if errors.Is(err, ingest.ErrBadPayload) {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(models.NewErrorResponse(models.BAD_REQUEST, err.Error()))
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(models.NewErrorResponse(models.FATAL_ERROR, err.Error()))
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(result)
+	}
+}
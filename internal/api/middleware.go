@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/ids"
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/service"
+)
+
+const (
+	ACTOR_HEADER      = "X-Actor"
+	REQUEST_ID_HEADER = "X-Request-Id"
+)
+
+// RequestContext puts the caller and the request id into the request context,
+// so the service can attribute the changes it makes. The caller named by
+// X-Actor is not authenticated, auth.Authenticator replaces it when
+// authentication is enabled.
+// The request id is taken from the client or generated, and echoed back.
+func RequestContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get(REQUEST_ID_HEADER)
+		if requestId == "" {
+			requestId = ids.Random{}.NewId()
+		}
+		w.Header().Set(REQUEST_ID_HEADER, requestId)
+
+		ctx := service.WithRequestId(r.Context(), requestId)
+		ctx = service.WithActor(ctx, service.Actor{Name: r.Header.Get(ACTOR_HEADER)})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// MuxErrors makes the 404 and 405 responses of the mux, which it writes as
+// plain text, models.ErrorResponse like every other error. The Allow header
+// of a 405 is kept.
+func MuxErrors(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern == "" {
+			w = &muxErrorWriter{ResponseWriter: w, request: r}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// muxErrorWriter replaces the body of the mux's own error with JSON.
+type muxErrorWriter struct {
+	http.ResponseWriter
+	request     *http.Request
+	wroteHeader bool
+}
+
+func (e *muxErrorWriter) WriteHeader(status int) {
+	if e.wroteHeader {
+		return
+	}
+	e.wroteHeader = true
+
+	code, message := models.NOT_FOUND, fmt.Sprintf("no route for %s %s", e.request.Method, e.request.URL.Path)
+	if status == http.StatusMethodNotAllowed {
+		code = models.METHOD_NOT_ALLOWED
+		message = fmt.Sprintf("method %s is not allowed for %s, allowed: %s", e.request.Method, e.request.URL.Path, e.Header().Get("Allow"))
+	}
+	e.Header().Set("Content-Type", "application/json")
+	e.ResponseWriter.WriteHeader(status)
+	json.NewEncoder(e.ResponseWriter).Encode(models.NewErrorResponse(code, message))
+}
+
+func (e *muxErrorWriter) Write(b []byte) (int, error) {
+	if !e.wroteHeader {
+		e.WriteHeader(http.StatusOK)
+	}
+	return len(b), nil
+}
@@ -0,0 +1,13 @@
+package api
+
+import "net/http"
+
+// OpenAPIHandler serves the spec the requests are validated against.
+func OpenAPIHandler(spec []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(spec)
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/service"
+	"github.com/Dowtai/pr-reviewer-service/internal/webhook"
+)
+
+func WebhookSubscribeHandler(dispatcher *webhook.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var subscription models.WebhookSubscription
+		if err := json.NewDecoder(r.Body).Decode(&subscription); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.BAD_REQUEST, err.Error()))
+			return
+		}
+		if err := webhook.ValidateSubscription(&subscription); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.BAD_REQUEST, err.Error()))
+			return
+		}
+
+		created, err := dispatcher.Subscribe(r.Context(), subscription)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(created)
+	}
+}
+
+func WebhookListHandler(dispatcher *webhook.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(dispatcher.Subscriptions(r.Context()))
+	}
+}
+
+func WebhookUnsubscribeHandler(dispatcher *webhook.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var request struct {
+			SubscriptionId string `json:"subscription_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(models.NewErrorResponse(models.BAD_REQUEST, err.Error()))
+			return
+		}
+
+		if err := dispatcher.Unsubscribe(r.Context(), request.SubscriptionId); err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func WebhookDeliveriesHandler(dispatcher *webhook.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		deliveries, err := dispatcher.Deliveries(r.Context(), r.URL.Query().Get("subscription_id"))
+		if err != nil {
+			writeWebhookError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(deliveries)
+	}
+}
+
+func writeWebhookError(w http.ResponseWriter, err error) {
+	var svcErr service.ErrorService
+	if errors.As(err, &svcErr) && svcErr.ApiCode == models.NOT_FOUND {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(models.NewErrorResponse(svcErr.ApiCode, "subscription not found"))
+		return
+	}
+	writeServiceError(w, err)
+}
@@ -0,0 +1,239 @@
+// Package auth authenticates API callers with static tokens or HMAC-signed
+// JWTs and lets every endpoint name the roles allowed to call it.
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/service"
+)
+
+const (
+	AUTHORIZATION_HEADER = "Authorization"
+	BEARER_PREFIX        = "Bearer "
+	TENANT_HEADER        = "X-Tenant"
+)
+
+// ROLES are all the roles, in the order of decreasing privileges.
+var ROLES = []models.Role{models.ROLE_ADMIN, models.ROLE_BOT, models.ROLE_USER}
+
+// Config holds the credentials the service accepts. Authentication is only
+// disabled on request, a config without credentials is not valid otherwise.
+type Config struct {
+	// Tokens maps a static token to the actor it authenticates.
+	Tokens map[string]service.Actor
+	// JWTSecret is the HS256 key of the JWTs, none are accepted when empty.
+	JWTSecret []byte
+	// Disabled turns authentication off, every caller is an admin.
+	Disabled bool
+}
+
+func (c Config) Enabled() bool {
+	return !c.Disabled && (len(c.Tokens) > 0 || len(c.JWTSecret) > 0)
+}
+
+// Validate rejects a config without credentials that does not disable
+// authentication, a forgotten variable must not open the service to anyone,
+// and a config that disables authentication while naming credentials.
+func (c Config) Validate() error {
+	credentials := len(c.Tokens) > 0 || len(c.JWTSecret) > 0
+	switch {
+	case c.Disabled && credentials:
+		return errors.New("AUTH_DISABLED=true contradicts AUTH_TOKENS and AUTH_JWT_SECRET")
+	case !c.Disabled && !credentials:
+		return errors.New("set AUTH_TOKENS or AUTH_JWT_SECRET, or AUTH_DISABLED=true to run without authentication")
+	}
+	return nil
+}
+
+// ConfigFromEnv reads AUTH_JWT_SECRET, AUTH_DISABLED and AUTH_TOKENS, a
+// comma-separated list of token=role:name[@tenant], e.g.
+// "s3cret=admin:alice,ci-token=bot:ci@payments". The config is validated.
+func ConfigFromEnv() (Config, error) {
+	config := Config{JWTSecret: []byte(os.Getenv("AUTH_JWT_SECRET"))}
+	tokens, err := ParseTokens(os.Getenv("AUTH_TOKENS"))
+	if err != nil {
+		return config, fmt.Errorf("wrong AUTH_TOKENS: %w", err)
+	}
+	config.Tokens = tokens
+	if value := os.Getenv("AUTH_DISABLED"); value != "" {
+		if config.Disabled, err = strconv.ParseBool(value); err != nil {
+			return config, fmt.Errorf("wrong AUTH_DISABLED: %w", err)
+		}
+	}
+	return config, config.Validate()
+}
+
+// ParseTokens parses the AUTH_TOKENS format.
+func ParseTokens(value string) (map[string]service.Actor, error) {
+	tokens := map[string]service.Actor{}
+	for i, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		token, actor, ok := strings.Cut(entry, "=")
+		role, name, ok2 := strings.Cut(actor, ":")
+		name, tenant, bound := strings.Cut(name, "@")
+		if !ok || !ok2 || token == "" || name == "" || (bound && tenant == "") {
+			return nil, fmt.Errorf("entry %d: expected token=role:name[@tenant]", i+1)
+		}
+		if !slices.Contains(ROLES, models.Role(role)) {
+			return nil, fmt.Errorf("entry %d: unknown role %q", i+1, role)
+		}
+		if _, ok := tokens[token]; ok {
+			return nil, fmt.Errorf("entry %d: duplicate token", i+1)
+		}
+		tokens[token] = service.Actor{Name: name, Role: models.Role(role), Tenant: tenant}
+	}
+	return tokens, nil
+}
+
+// Authenticator resolves the bearer token of a request to an actor and
+// selects the tenant of the request.
+type Authenticator struct {
+	enabled      bool
+	tenantExists func(tenantId string) bool
+	// tokens is keyed by the SHA-256 of the token, so the lookup does not
+	// depend on how much of a guessed token is right.
+	tokens map[[sha256.Size]byte]service.Actor
+	secret []byte
+	now    func() time.Time
+}
+
+func NewAuthenticator(config Config, tenantExists func(tenantId string) bool) *Authenticator {
+	a := &Authenticator{
+		enabled:      config.Enabled(),
+		tenantExists: tenantExists,
+		tokens:       make(map[[sha256.Size]byte]service.Actor, len(config.Tokens)),
+		secret:       config.JWTSecret,
+		now:          time.Now,
+	}
+	for token, actor := range config.Tokens {
+		a.tokens[sha256.Sum256([]byte(token))] = actor
+	}
+	return a
+}
+
+// Authenticate returns the actor of a static token or a JWT.
+func (a *Authenticator) Authenticate(token string) (service.Actor, error) {
+	if actor, ok := a.tokens[sha256.Sum256([]byte(token))]; ok {
+		return actor, nil
+	}
+	if len(a.secret) == 0 || strings.Count(token, ".") != 2 {
+		return service.Actor{}, fmt.Errorf("%w: unknown token", ErrInvalidToken)
+	}
+
+	claims, err := ParseJWT(a.secret, token, a.now())
+	if err != nil {
+		return service.Actor{}, err
+	}
+	if claims.Subject == "" {
+		return service.Actor{}, fmt.Errorf("%w: sub is required", ErrInvalidToken)
+	}
+	if !slices.Contains(ROLES, claims.Role) {
+		return service.Actor{}, fmt.Errorf("%w: unknown role %q", ErrInvalidToken, claims.Role)
+	}
+	return service.Actor{Name: claims.Subject, Role: claims.Role, Tenant: claims.Tenant}, nil
+}
+
+// Middleware replaces the actor of the request context with the one of the
+// "Authorization: Bearer" header and rejects invalid tokens with a 401. A
+// request without the header goes on as an anonymous actor without a role,
+// which only public endpoints accept. With authentication disabled every
+// request is an admin named by X-Actor, as before authentication existed.
+//
+// The tenant is the one the credentials are bound to, otherwise the one named
+// by X-Tenant, models.DEFAULT_TENANT by default. Naming another tenant than
+// the bound one is a 403, an unknown tenant a 404 TENANT_NOT_FOUND.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.enabled {
+			actor := service.ActorFromContext(r.Context())
+			actor.Role = models.ROLE_ADMIN
+			a.serveAs(next, w, r, actor)
+			return
+		}
+
+		header := r.Header.Get(AUTHORIZATION_HEADER)
+		if header == "" {
+			a.serveAs(next, w, r, service.Actor{})
+			return
+		}
+		token, ok := strings.CutPrefix(header, BEARER_PREFIX)
+		if !ok {
+			writeUnauthorized(w, "expected a Bearer token")
+			return
+		}
+		actor, err := a.Authenticate(strings.TrimSpace(token))
+		if err != nil {
+			writeUnauthorized(w, err.Error())
+			return
+		}
+		a.serveAs(next, w, r, actor)
+	})
+}
+
+func (a *Authenticator) serveAs(next http.Handler, w http.ResponseWriter, r *http.Request, actor service.Actor) {
+	tenantId := r.Header.Get(TENANT_HEADER)
+	switch {
+	case actor.Tenant != "" && tenantId != "" && tenantId != actor.Tenant:
+		writeError(w, http.StatusForbidden, models.FORBIDDEN, fmt.Sprintf("actor %s belongs to tenant %s", actor.Name, actor.Tenant))
+		return
+	case actor.Tenant != "":
+		tenantId = actor.Tenant
+	case tenantId == "":
+		tenantId = models.DEFAULT_TENANT
+	}
+	if !a.tenantExists(tenantId) {
+		writeError(w, http.StatusNotFound, models.TENANT_NOT_FOUND, fmt.Sprintf("tenant %s not found", tenantId))
+		return
+	}
+
+	ctx := service.WithTenant(service.WithActor(r.Context(), actor), tenantId)
+	authenticated := r.WithContext(ctx)
+	next.ServeHTTP(w, authenticated)
+	// the mux names the route on the request it was given, pass the name
+	// up to the metrics middleware
+	r.Pattern = authenticated.Pattern
+}
+
+// Require lets only the given roles call a handler: an anonymous caller gets
+// a 401, any other role a 403 FORBIDDEN.
+func Require(roles ...models.Role) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			actor := service.ActorFromContext(r.Context())
+			if actor.Role == "" {
+				writeUnauthorized(w, "authentication required")
+				return
+			}
+			if !slices.Contains(roles, actor.Role) {
+				writeError(w, http.StatusForbidden, models.FORBIDDEN, fmt.Sprintf("role %s may not call %s", actor.Role, r.Pattern))
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+func writeUnauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="pr-reviewer-service"`)
+	writeError(w, http.StatusUnauthorized, models.UNAUTHORIZED, message)
+}
+
+func writeError(w http.ResponseWriter, status int, code models.ErrorDetailCode, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.NewErrorResponse(code, message))
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/service"
+)
+
+var secret = []byte("jwt-secret")
+
+func TestJWT(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	claims := Claims{Subject: "u1", Role: models.ROLE_USER, ExpiresAt: now.Add(time.Hour).Unix()}
+	token, err := SignJWT(secret, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseJWT(secret, token, now)
+	if err != nil || parsed != claims {
+		t.Fatalf("Expected %+v, got %+v %v", claims, parsed, err)
+	}
+
+	if _, err := ParseJWT(secret, token, now.Add(time.Hour+JWT_LEEWAY+time.Second)); !errors.Is(err, ErrExpiredToken) {
+		t.Fatalf("Expected an expired token, got %v", err)
+	}
+	if _, err := ParseJWT([]byte("other"), token, now); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Expected a bad signature, got %v", err)
+	}
+	forever, _ := SignJWT(secret, Claims{Subject: "u1", Role: models.ROLE_USER})
+	if _, err := ParseJWT(secret, forever, now); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Expected a token without exp to be rejected, got %v", err)
+	}
+
+	// the claims cannot be changed, nor the signature dropped with alg none
+	parts := strings.Split(token, ".")
+	admin, _ := json.Marshal(Claims{Subject: "u1", Role: models.ROLE_ADMIN})
+	none := encoding.EncodeToString([]byte(`{"alg":"none"}`))
+	for _, forged := range []string{
+		parts[0] + "." + encoding.EncodeToString(admin) + "." + parts[2],
+		none + "." + parts[1] + ".",
+		parts[0] + "." + parts[1],
+	} {
+		if _, err := ParseJWT(secret, forged, now); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("Expected %q to be rejected, got %v", forged, err)
+		}
+	}
+}
+
+func TestParseTokens(t *testing.T) {
+	tokens, err := ParseTokens(" t1=admin:alice, t2=bot:ci ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 || tokens["t2"] != (service.Actor{Name: "ci", Role: models.ROLE_BOT}) {
+		t.Fatalf("Unexpected tokens %+v", tokens)
+	}
+
+	for _, value := range []string{"t1", "t1=admin", "=admin:alice", "t1=root:alice", "t1=user:u1,t1=user:u2"} {
+		if _, err := ParseTokens(value); err == nil {
+			t.Fatalf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	authenticator := NewAuthenticator(Config{
+		Tokens: map[string]service.Actor{
+			"bot-token":  {Name: "ci", Role: models.ROLE_BOT},
+			"acme-token": {Name: "acme-ci", Role: models.ROLE_BOT, Tenant: "acme"},
+		},
+		JWTSecret: secret,
+	}, func(tenantId string) bool { return tenantId == models.DEFAULT_TENANT || tenantId == "acme" })
+	exp := time.Now().Add(time.Hour).Unix()
+	userToken, _ := SignJWT(secret, Claims{Subject: "u1", Role: models.ROLE_USER, ExpiresAt: exp})
+	unknownRole, _ := SignJWT(secret, Claims{Subject: "u1", Role: "root", ExpiresAt: exp})
+	noExpiry, _ := SignJWT(secret, Claims{Subject: "ci", Role: models.ROLE_BOT})
+
+	var seen service.Actor
+	var seenTenant string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /merge", Require(models.ROLE_ADMIN, models.ROLE_BOT)(func(w http.ResponseWriter, r *http.Request) {
+		seen = service.ActorFromContext(r.Context())
+		seenTenant = service.TenantFromContext(r.Context())
+	}))
+	var pattern string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authenticator.Middleware(mux).ServeHTTP(w, r)
+		pattern = r.Pattern
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name          string
+		authorization string
+		tenant        string
+		status        int
+		code          models.ErrorDetailCode
+		seenTenant    string
+	}{
+		{"Bot", "Bearer bot-token", "", http.StatusOK, "", models.DEFAULT_TENANT},
+		{"TenantHeader", "Bearer bot-token", "acme", http.StatusOK, "", "acme"},
+		{"Anonymous", "", "", http.StatusUnauthorized, models.UNAUTHORIZED, ""},
+		{"UnknownToken", "Bearer nope", "", http.StatusUnauthorized, models.UNAUTHORIZED, ""},
+		{"NotBearer", "Basic Ym90LXRva2Vu", "", http.StatusUnauthorized, models.UNAUTHORIZED, ""},
+		{"UnknownRole", "Bearer " + unknownRole, "", http.StatusUnauthorized, models.UNAUTHORIZED, ""},
+		{"NoExpiry", "Bearer " + noExpiry, "", http.StatusUnauthorized, models.UNAUTHORIZED, ""},
+		{"WrongRole", "Bearer " + userToken, "", http.StatusForbidden, models.FORBIDDEN, ""},
+		{"UnknownTenant", "Bearer bot-token", "nope", http.StatusNotFound, models.TENANT_NOT_FOUND, ""},
+		{"OtherTenant", "Bearer acme-token", models.DEFAULT_TENANT, http.StatusForbidden, models.FORBIDDEN, ""},
+		{"BoundToken", "Bearer acme-token", "", http.StatusOK, "", "acme"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, server.URL+"/merge", nil)
+			if tc.authorization != "" {
+				req.Header.Set(AUTHORIZATION_HEADER, tc.authorization)
+			}
+			if tc.tenant != "" {
+				req.Header.Set(TENANT_HEADER, tc.tenant)
+			}
+			seenTenant = ""
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.status {
+				t.Fatalf("Expected %d, got %d", tc.status, resp.StatusCode)
+			}
+			if seenTenant != tc.seenTenant {
+				t.Fatalf("Expected the handler to see tenant %q, got %q", tc.seenTenant, seenTenant)
+			}
+			if tc.code == "" {
+				return
+			}
+			var response models.ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil || response.Detail.Code != tc.code {
+				t.Fatalf("Expected %s, got %+v %v", tc.code, response, err)
+			}
+		})
+	}
+
+	if seen != (service.Actor{Name: "acme-ci", Role: models.ROLE_BOT, Tenant: "acme"}) {
+		t.Fatalf("Expected the handler to see the bound bot, got %+v", seen)
+	}
+	if pattern != "POST /merge" {
+		t.Fatalf("Expected the route to be passed up, got %q", pattern)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		tokens   string
+		secret   string
+		disabled string
+		enabled  bool
+		valid    bool
+	}{
+		{"Tokens", "t1=admin:alice", "", "", true, true},
+		{"JWT", "", "jwt-secret", "false", true, true},
+		{"Disabled", "", "", "true", false, true},
+		{"Nothing", "", "", "", false, false},
+		{"NotDisabled", "", "", "false", false, false},
+		{"DisabledWithTokens", "t1=admin:alice", "", "true", false, false},
+		{"WrongDisabled", "", "", "yes please", false, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("AUTH_TOKENS", tc.tokens)
+			t.Setenv("AUTH_JWT_SECRET", tc.secret)
+			t.Setenv("AUTH_DISABLED", tc.disabled)
+			config, err := ConfigFromEnv()
+			if (err == nil) != tc.valid {
+				t.Fatalf("Expected valid %v, got %v", tc.valid, err)
+			}
+			if tc.valid && config.Enabled() != tc.enabled {
+				t.Fatalf("Expected enabled %v, got %+v", tc.enabled, config)
+			}
+		})
+	}
+}
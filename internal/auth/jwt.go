@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+// JWT_LEEWAY is the clock skew allowed when checking exp and nbf.
+const JWT_LEEWAY = 30 * time.Second
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token is expired")
+)
+
+// Claims are the JWT claims the service reads: sub is the actor name (the
+// user_id for ROLE_USER), tenant binds the token to one tenant, exp is the
+// required expiry and nbf the optional start, both unix times.
+type Claims struct {
+	Subject   string      `json:"sub"`
+	Role      models.Role `json:"role"`
+	Tenant    string      `json:"tenant,omitempty"`
+	ExpiresAt int64       `json:"exp,omitempty"`
+	NotBefore int64       `json:"nbf,omitempty"`
+	IssuedAt  int64       `json:"iat,omitempty"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+var encoding = base64.RawURLEncoding
+
+// SignJWT makes an HS256 JWT with the claims.
+func SignJWT(secret []byte, claims Claims) (string, error) {
+	header, err := json.Marshal(jwtHeader{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := encoding.EncodeToString(header) + "." + encoding.EncodeToString(payload)
+	return unsigned + "." + encoding.EncodeToString(sign(secret, unsigned)), nil
+}
+
+// ParseJWT checks the HS256 signature and the time claims of a JWT and
+// returns its claims. Other algorithms, "none" included, are rejected, and
+// so are tokens without exp, which would never expire.
+func ParseJWT(secret []byte, token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, fmt.Errorf("%w: malformed JWT", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, err
+	}
+	if header.Alg != "HS256" {
+		return Claims{}, fmt.Errorf("%w: unsupported alg %q", ErrInvalidToken, header.Alg)
+	}
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, sign(secret, parts[0]+"."+parts[1])) {
+		return Claims{}, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, err
+	}
+	if claims.ExpiresAt == 0 {
+		return Claims{}, fmt.Errorf("%w: exp is required", ErrInvalidToken)
+	}
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(JWT_LEEWAY)) {
+		return Claims{}, ErrExpiredToken
+	}
+	if claims.NotBefore != 0 && now.Add(JWT_LEEWAY).Before(time.Unix(claims.NotBefore, 0)) {
+		return Claims{}, fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+func sign(secret []byte, unsigned string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := encoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: malformed JWT", ErrInvalidToken)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: malformed JWT", ErrInvalidToken)
+	}
+	return nil
+}
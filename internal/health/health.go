@@ -0,0 +1,98 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/clock"
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+const (
+	STATUS_OK          = "ok"
+	STATUS_UNAVAILABLE = "unavailable"
+	STATUS_DRAINING    = "shutting_down"
+
+	CHECK_TIMEOUT = 2 * time.Second
+)
+
+type check struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Checker answers liveness and readiness probes. Readiness runs every
+// registered check and fails as soon as shutdown has begun, so traffic is
+// drained before the server stops accepting connections.
+type Checker struct {
+	version      string
+	clock        clock.Clock
+	startedAt    time.Time
+	mx           sync.RWMutex
+	checks       []check
+	shuttingDown atomic.Bool
+}
+
+// NewChecker counts the uptime on clock from the moment it is called.
+func NewChecker(version string, clock clock.Clock) *Checker {
+	return &Checker{
+		version:   version,
+		clock:     clock,
+		startedAt: clock.Now(),
+	}
+}
+
+func (c *Checker) AddCheck(name string, fn func(ctx context.Context) error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+func (c *Checker) Live() models.HealthReport {
+	return c.report(STATUS_OK, nil)
+}
+
+// Ready returns the report and whether the service can take traffic.
+func (c *Checker) Ready(ctx context.Context) (models.HealthReport, bool) {
+	ctx, cancel := context.WithTimeout(ctx, CHECK_TIMEOUT)
+	defer cancel()
+
+	c.mx.RLock()
+	checks := append([]check(nil), c.checks...)
+	c.mx.RUnlock()
+
+	ready := true
+	results := make(map[string]string, len(checks))
+	for _, ch := range checks {
+		if err := ch.fn(ctx); err != nil {
+			results[ch.name] = err.Error()
+			ready = false
+		} else {
+			results[ch.name] = STATUS_OK
+		}
+	}
+
+	if c.shuttingDown.Load() {
+		return c.report(STATUS_DRAINING, results), false
+	}
+	if !ready {
+		return c.report(STATUS_UNAVAILABLE, results), false
+	}
+	return c.report(STATUS_OK, results), true
+}
+
+func (c *Checker) report(status string, checks map[string]string) models.HealthReport {
+	return models.HealthReport{
+		Status:        status,
+		Version:       c.version,
+		UptimeSeconds: int64(c.clock.Now().Sub(c.startedAt).Seconds()),
+		Checks:        checks,
+	}
+}
@@ -0,0 +1,26 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/clock"
+)
+
+func TestReport(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, time.March, 3, 9, 0, 0, 0, time.UTC))
+	checker := NewChecker("v1", clk)
+	clk.Advance(90 * time.Second)
+
+	if report := checker.Live(); report.Status != STATUS_OK || report.Version != "v1" || report.UptimeSeconds != 90 {
+		t.Fatalf("Unexpected liveness report %+v", report)
+	}
+
+	checker.AddCheck("storage", func(ctx context.Context) error { return errors.New("down") })
+	report, ready := checker.Ready(context.Background())
+	if ready || report.Status != STATUS_UNAVAILABLE || report.Checks["storage"] != "down" {
+		t.Fatalf("Expected the failing check to make the service unavailable, got %+v", report)
+	}
+}
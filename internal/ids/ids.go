@@ -0,0 +1,37 @@
+// Package ids makes the identifiers the service assigns itself. Sequence is
+// the predictable generator for tests.
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+)
+
+type Generator interface {
+	NewId() string
+}
+
+// Random makes 16 hex digit ids from crypto/rand.
+type Random struct{}
+
+func (Random) NewId() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Sequence makes prefix1, prefix2 and so on.
+type Sequence struct {
+	prefix string
+	n      atomic.Int64
+}
+
+func NewSequence(prefix string) *Sequence {
+	return &Sequence{prefix: prefix}
+}
+
+func (s *Sequence) NewId() string {
+	return fmt.Sprintf("%s%d", s.prefix, s.n.Add(1))
+}
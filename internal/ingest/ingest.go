@@ -0,0 +1,260 @@
+package ingest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/service"
+)
+
+const (
+	GITHUB_EVENT_HEADER     = "X-GitHub-Event"
+	GITHUB_SIGNATURE_HEADER = "X-Hub-Signature-256"
+	GITLAB_EVENT_HEADER     = "X-Gitlab-Event"
+	GITLAB_TOKEN_HEADER     = "X-Gitlab-Token"
+
+	CREATED = "created"
+	MERGED  = "merged"
+	CLOSED  = "closed"
+	IGNORED = "ignored"
+)
+
+var ErrBadPayload = errors.New("bad webhook payload")
+
+// TenantConfig holds the provider secrets of a tenant and the mapping of
+// external logins to its user_ids. A provider without a secret rejects every
+// request.
+type TenantConfig struct {
+	GithubSecret string            `json:"github_secret"`
+	GitlabToken  string            `json:"gitlab_token"`
+	GithubLogins map[string]string `json:"github"`
+	GitlabLogins map[string]string `json:"gitlab"`
+}
+
+// Config holds the ingest settings per tenant id. Webhooks of a tenant
+// without settings are rejected, a secret of one tenant is not accepted for
+// another.
+type Config struct {
+	Tenants map[string]TenantConfig
+}
+
+// fileConfig is the USER_MAPPING_FILE, its top-level keys configure the
+// default tenant.
+type fileConfig struct {
+	TenantConfig
+	Tenants map[string]TenantConfig `json:"tenants"`
+}
+
+// ConfigFromEnv reads GITHUB_WEBHOOK_SECRET and GITLAB_WEBHOOK_TOKEN of the
+// default tenant and USER_MAPPING_FILE, a JSON file like
+// {"github": {"octocat": "u1"}, "gitlab": {...}, "tenants": {"acme": {"github_secret": "...", "github": {...}}}}.
+func ConfigFromEnv() (Config, error) {
+	var file fileConfig
+	if path := os.Getenv("USER_MAPPING_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		if err = json.Unmarshal(data, &file); err != nil {
+			return Config{}, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		if _, ok := file.Tenants[models.DEFAULT_TENANT]; ok {
+			return Config{}, fmt.Errorf("%s: the %s tenant is configured by the top-level keys", path, models.DEFAULT_TENANT)
+		}
+	}
+
+	config := Config{Tenants: map[string]TenantConfig{}}
+	for tenantId, tenant := range file.Tenants {
+		config.Tenants[tenantId] = tenant
+	}
+	defaults := file.TenantConfig
+	if secret := os.Getenv("GITHUB_WEBHOOK_SECRET"); secret != "" {
+		defaults.GithubSecret = secret
+	}
+	if token := os.Getenv("GITLAB_WEBHOOK_TOKEN"); token != "" {
+		defaults.GitlabToken = token
+	}
+	config.Tenants[models.DEFAULT_TENANT] = defaults
+	return config, nil
+}
+
+// Ingestor turns GitHub pull_request and GitLab merge_request webhooks
+// into service operations of the tenant the webhook is sent for.
+type Ingestor struct {
+	svc    *service.PrReviewerService
+	config Config
+}
+
+func NewIngestor(svc *service.PrReviewerService, config Config) *Ingestor {
+	return &Ingestor{
+		svc:    svc,
+		config: config,
+	}
+}
+
+type githubPayload struct {
+	Action      string `json:"action"`
+	PullRequest struct {
+		Number int    `json:"number"`
+		Title  string `json:"title"`
+		Merged bool   `json:"merged"`
+		User   struct {
+			Login string `json:"login"`
+		} `json:"user"`
+	} `json:"pull_request"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Sender struct {
+		Login string `json:"login"`
+	} `json:"sender"`
+}
+
+func (i *Ingestor) Github(ctx context.Context, header http.Header, body []byte) (models.IngestResult, error) {
+	tenantId := service.TenantFromContext(ctx)
+	config := i.config.Tenants[tenantId]
+	if !validGithubSignature(config.GithubSecret, header.Get(GITHUB_SIGNATURE_HEADER), body) {
+		return models.IngestResult{}, service.NewErrorApi(service.UNAUTHENTICATED, models.UNAUTHORIZED, "invalid signature")
+	}
+	if header.Get(GITHUB_EVENT_HEADER) != "pull_request" {
+		return models.IngestResult{Action: IGNORED}, nil
+	}
+
+	var payload githubPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return models.IngestResult{}, fmt.Errorf("%w: %s", ErrBadPayload, err)
+	}
+	if payload.Repository.FullName == "" || payload.PullRequest.Number == 0 {
+		return models.IngestResult{}, fmt.Errorf("%w: missing repository or pull request number", ErrBadPayload)
+	}
+
+	ctx = service.WithActor(ctx, service.Actor{Name: "github:" + payload.Sender.Login, Role: models.ROLE_BOT, Tenant: tenantId})
+	prId := fmt.Sprintf("%s#%d", payload.Repository.FullName, payload.PullRequest.Number)
+
+	switch {
+	case payload.Action == "opened":
+		authorId, ok := config.GithubLogins[payload.PullRequest.User.Login]
+		if !ok {
+			return models.IngestResult{}, unmapped(payload.PullRequest.User.Login)
+		}
+		return i.create(ctx, prId, payload.PullRequest.Title, authorId)
+	case payload.Action == "closed" && payload.PullRequest.Merged:
+		return i.merge(ctx, prId)
+	case payload.Action == "closed":
+		return i.close(ctx, prId)
+	case payload.Action == "reopened":
+		// the service has no way back from CLOSED, the PR stays closed; open
+		// it again under a new id if it needs reviewers
+		return models.IngestResult{Action: IGNORED}, nil
+	}
+	return models.IngestResult{Action: IGNORED}, nil
+}
+
+type gitlabPayload struct {
+	ObjectKind string `json:"object_kind"`
+	User       struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		Iid    int    `json:"iid"`
+		Title  string `json:"title"`
+		Action string `json:"action"`
+	} `json:"object_attributes"`
+}
+
+func (i *Ingestor) Gitlab(ctx context.Context, header http.Header, body []byte) (models.IngestResult, error) {
+	tenantId := service.TenantFromContext(ctx)
+	config := i.config.Tenants[tenantId]
+	if !validGitlabToken(config.GitlabToken, header.Get(GITLAB_TOKEN_HEADER)) {
+		return models.IngestResult{}, service.NewErrorApi(service.UNAUTHENTICATED, models.UNAUTHORIZED, "invalid token")
+	}
+	if header.Get(GITLAB_EVENT_HEADER) != "Merge Request Hook" {
+		return models.IngestResult{Action: IGNORED}, nil
+	}
+
+	var payload gitlabPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return models.IngestResult{}, fmt.Errorf("%w: %s", ErrBadPayload, err)
+	}
+	if payload.ObjectKind != "merge_request" || payload.Project.PathWithNamespace == "" || payload.ObjectAttributes.Iid == 0 {
+		return models.IngestResult{}, fmt.Errorf("%w: missing project or merge request iid", ErrBadPayload)
+	}
+
+	ctx = service.WithActor(ctx, service.Actor{Name: "gitlab:" + payload.User.Username, Role: models.ROLE_BOT, Tenant: tenantId})
+	prId := fmt.Sprintf("%s!%d", payload.Project.PathWithNamespace, payload.ObjectAttributes.Iid)
+
+	switch payload.ObjectAttributes.Action {
+	case "open":
+		// for "open" the user who triggered the hook is the author
+		authorId, ok := config.GitlabLogins[payload.User.Username]
+		if !ok {
+			return models.IngestResult{}, unmapped(payload.User.Username)
+		}
+		return i.create(ctx, prId, payload.ObjectAttributes.Title, authorId)
+	case "merge":
+		return i.merge(ctx, prId)
+	case "close":
+		return i.close(ctx, prId)
+	case "reopen":
+		// see the "reopened" action of Github
+		return models.IngestResult{Action: IGNORED}, nil
+	}
+	return models.IngestResult{Action: IGNORED}, nil
+}
+
+func (i *Ingestor) create(ctx context.Context, prId, name, authorId string) (models.IngestResult, error) {
+	pr, err := i.svc.PullRequestCreate(ctx, prId, name, authorId, "")
+	if err != nil {
+		return models.IngestResult{}, err
+	}
+	return models.IngestResult{Action: CREATED, PR: &pr}, nil
+}
+
+func (i *Ingestor) merge(ctx context.Context, prId string) (models.IngestResult, error) {
+	pr, err := i.svc.PullRequestMerge(ctx, prId)
+	if err != nil {
+		return models.IngestResult{}, err
+	}
+	return models.IngestResult{Action: MERGED, PR: &pr}, nil
+}
+
+func (i *Ingestor) close(ctx context.Context, prId string) (models.IngestResult, error) {
+	pr, err := i.svc.PullRequestClose(ctx, prId)
+	if err != nil {
+		return models.IngestResult{}, err
+	}
+	return models.IngestResult{Action: CLOSED, PR: &pr}, nil
+}
+
+func validGithubSignature(secret, signature string, body []byte) bool {
+	if secret == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+func validGitlabToken(expected, token string) bool {
+	if expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+func unmapped(login string) error {
+	return service.NewErrorApi(service.OBJECT_NOT_FOUND, models.NOT_FOUND, fmt.Sprintf("login %q is not mapped to a user", login))
+}
@@ -0,0 +1,320 @@
+package ingest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/clock"
+	"github.com/Dowtai/pr-reviewer-service/internal/ids"
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/repo/memory_repo"
+	"github.com/Dowtai/pr-reviewer-service/internal/service"
+)
+
+const (
+	testSecret = "github-secret"
+	testToken  = "gitlab-token"
+)
+
+func newTestIngestor(t *testing.T) *Ingestor {
+	t.Helper()
+	clk := clock.NewFake(time.Date(2025, time.March, 3, 9, 0, 0, 0, time.UTC))
+	svc := service.NewService(memory_repo.NewMemoryTenantRepo(memory_repo.NewMemoryStore(), clk), clk, ids.NewSequence("bg-"))
+	_, err := svc.TeamAdd(context.Background(), models.Team{TeamName: "backend", Members: []models.TeamMember{
+		{UserId: "u1", Username: "Alice", IsActive: true},
+		{UserId: "u2", Username: "Bob", IsActive: true},
+		{UserId: "u3", Username: "Carol", IsActive: true},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewIngestor(svc, Config{Tenants: map[string]TenantConfig{models.DEFAULT_TENANT: {
+		GithubSecret: testSecret,
+		GitlabToken:  testToken,
+		GithubLogins: map[string]string{"octocat": "u1"},
+		GitlabLogins: map[string]string{"tanuki": "u2"},
+	}}})
+}
+
+// configure changes the settings of the default tenant.
+func configure(ingestor *Ingestor, change func(config *TenantConfig)) {
+	config := ingestor.config.Tenants[models.DEFAULT_TENANT]
+	change(&config)
+	ingestor.config.Tenants[models.DEFAULT_TENANT] = config
+}
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func githubHeader(event, signature string) http.Header {
+	header := http.Header{}
+	header.Set(GITHUB_EVENT_HEADER, event)
+	header.Set(GITHUB_SIGNATURE_HEADER, signature)
+	return header
+}
+
+func gitlabHeader(event, token string) http.Header {
+	header := http.Header{}
+	header.Set(GITLAB_EVENT_HEADER, event)
+	header.Set(GITLAB_TOKEN_HEADER, token)
+	return header
+}
+
+func githubBody(action string, merged bool) []byte {
+	mergedValue := "false"
+	if merged {
+		mergedValue = "true"
+	}
+	return []byte(`{"action": "` + action + `", "pull_request": {"number": 7, "title": "Add search", "merged": ` + mergedValue +
+		`, "user": {"login": "octocat"}}, "repository": {"full_name": "acme/api"}, "sender": {"login": "octocat"}}`)
+}
+
+func gitlabBody(action string) []byte {
+	return []byte(`{"object_kind": "merge_request", "user": {"username": "tanuki"}, "project": {"path_with_namespace": "acme/web"},
+		"object_attributes": {"iid": 3, "title": "Fix login", "action": "` + action + `"}}`)
+}
+
+func expectUnauthenticated(t *testing.T, err error) {
+	t.Helper()
+	var svcErr service.ErrorService
+	if !errors.As(err, &svcErr) || svcErr.Code != service.UNAUTHENTICATED || svcErr.ApiCode != models.UNAUTHORIZED {
+		t.Fatalf("Expected an unauthenticated error, got %v", err)
+	}
+}
+
+func TestGithubSignature(t *testing.T) {
+	ctx := context.Background()
+	body := githubBody("opened", false)
+
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+	}{
+		{"Missing", testSecret, ""},
+		{"WrongSecret", testSecret, sign("other", body)},
+		{"WithoutPrefix", testSecret, sign(testSecret, body)[len("sha256="):]},
+		{"NoSecretConfigured", "", sign("", body)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ingestor := newTestIngestor(t)
+			configure(ingestor, func(config *TenantConfig) { config.GithubSecret = test.secret })
+			_, err := ingestor.Github(ctx, githubHeader("pull_request", test.signature), body)
+			expectUnauthenticated(t, err)
+		})
+	}
+
+	t.Run("TamperedBody", func(t *testing.T) {
+		ingestor := newTestIngestor(t)
+		_, err := ingestor.Github(ctx, githubHeader("pull_request", sign(testSecret, body)), githubBody("closed", false))
+		expectUnauthenticated(t, err)
+	})
+}
+
+func TestGitlabToken(t *testing.T) {
+	ctx := context.Background()
+	body := gitlabBody("open")
+
+	for name, token := range map[string]string{"Missing": "", "Wrong": "other", "Prefix": testToken[:3]} {
+		t.Run(name, func(t *testing.T) {
+			_, err := newTestIngestor(t).Gitlab(ctx, gitlabHeader("Merge Request Hook", token), body)
+			expectUnauthenticated(t, err)
+		})
+	}
+
+	t.Run("NoTokenConfigured", func(t *testing.T) {
+		ingestor := newTestIngestor(t)
+		configure(ingestor, func(config *TenantConfig) { config.GitlabToken = "" })
+		_, err := ingestor.Gitlab(ctx, gitlabHeader("Merge Request Hook", ""), body)
+		expectUnauthenticated(t, err)
+	})
+}
+
+func TestTenants(t *testing.T) {
+	ctx := context.Background()
+	ingestor := newTestIngestor(t)
+	if _, err := ingestor.svc.TenantCreate(ctx, models.Tenant{TenantId: "acme", Name: "Acme"}); err != nil {
+		t.Fatal(err)
+	}
+	acme := service.WithTenant(ctx, "acme")
+	if _, err := ingestor.svc.TeamAdd(acme, models.Team{TeamName: "backend", Members: []models.TeamMember{
+		{UserId: "a1", Username: "Alice", IsActive: true},
+		{UserId: "a2", Username: "Bob", IsActive: true},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	body := githubBody("opened", false)
+
+	// a tenant without settings takes no webhooks, not even with the secret of another tenant
+	_, err := ingestor.Github(acme, githubHeader("pull_request", sign(testSecret, body)), body)
+	expectUnauthenticated(t, err)
+	_, err = ingestor.Gitlab(acme, gitlabHeader("Merge Request Hook", testToken), gitlabBody("open"))
+	expectUnauthenticated(t, err)
+
+	ingestor.config.Tenants["acme"] = TenantConfig{GithubSecret: "acme-secret", GithubLogins: map[string]string{"octocat": "a1"}}
+	_, err = ingestor.Github(acme, githubHeader("pull_request", sign(testSecret, body)), body)
+	expectUnauthenticated(t, err)
+
+	result, err := ingestor.Github(acme, githubHeader("pull_request", sign("acme-secret", body)), body)
+	if err != nil || result.PR.AuthorId != "a1" || len(result.PR.AssignedReviewers) != 1 || result.PR.AssignedReviewers[0] != "a2" {
+		t.Fatalf("Expected a PR of the tenant's users, got %+v, %v", result, err)
+	}
+	if _, err = ingestor.svc.UsersGetReview(ctx, "a2"); err == nil {
+		t.Fatal("Expected the PR to stay in its tenant")
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapping.json")
+	mapping := `{"github": {"octocat": "u1"}, "github_secret": "from-file", "tenants": {"acme": {"gitlab_token": "acme-token", "gitlab": {"tanuki": "a2"}}}}`
+	if err := os.WriteFile(path, []byte(mapping), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("USER_MAPPING_FILE", path)
+	t.Setenv("GITHUB_WEBHOOK_SECRET", "")
+	t.Setenv("GITLAB_WEBHOOK_TOKEN", "default-token")
+
+	config, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]TenantConfig{
+		models.DEFAULT_TENANT: {GithubSecret: "from-file", GitlabToken: "default-token", GithubLogins: map[string]string{"octocat": "u1"}},
+		"acme":                {GitlabToken: "acme-token", GitlabLogins: map[string]string{"tanuki": "a2"}},
+	}
+	if !reflect.DeepEqual(config.Tenants, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, config.Tenants)
+	}
+
+	if err = os.WriteFile(path, []byte(`{"tenants": {"default": {}}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ConfigFromEnv(); err == nil {
+		t.Fatal("Expected the default tenant in tenants to be refused")
+	}
+}
+
+func TestGithubPayloadMapping(t *testing.T) {
+	ctx := context.Background()
+	ingestor := newTestIngestor(t)
+	send := func(event string, body []byte) (models.IngestResult, error) {
+		return ingestor.Github(ctx, githubHeader(event, sign(testSecret, body)), body)
+	}
+
+	result, err := send("pull_request", githubBody("opened", false))
+	if err != nil || result.Action != CREATED || result.PR == nil {
+		t.Fatalf("Expected a created PR, got %+v, %v", result, err)
+	}
+	pr := result.PR
+	if pr.PullRequestId != "acme/api#7" || pr.PullRequestName != "Add search" || pr.AuthorId != "u1" || len(pr.AssignedReviewers) != 2 {
+		t.Fatalf("Unexpected PR %+v", pr)
+	}
+
+	for _, action := range []string{"edited", "reopened", "synchronize"} {
+		if result, err := send("pull_request", githubBody(action, false)); err != nil || result.Action != IGNORED {
+			t.Fatalf("Expected %s to be ignored, got %+v, %v", action, result, err)
+		}
+	}
+	if result, err := send("push", []byte(`{}`)); err != nil || result.Action != IGNORED {
+		t.Fatalf("Expected a push to be ignored, got %+v, %v", result, err)
+	}
+
+	result, err = send("pull_request", githubBody("closed", true))
+	if err != nil || result.Action != MERGED || result.PR.Status != models.MERGED {
+		t.Fatalf("Expected a merged PR, got %+v, %v", result, err)
+	}
+}
+
+func TestGithubClose(t *testing.T) {
+	ctx := context.Background()
+	ingestor := newTestIngestor(t)
+	for _, step := range []struct {
+		action string
+		want   string
+	}{{"opened", CREATED}, {"closed", CLOSED}, {"reopened", IGNORED}} {
+		body := githubBody(step.action, false)
+		result, err := ingestor.Github(ctx, githubHeader("pull_request", sign(testSecret, body)), body)
+		if err != nil || result.Action != step.want {
+			t.Fatalf("%s: expected %s, got %+v, %v", step.action, step.want, result, err)
+		}
+	}
+
+	// a reopened PR stays closed
+	prs, err := ingestor.svc.UsersGetReview(ctx, "u2")
+	if err != nil || len(prs) != 1 || prs[0].Status != models.CLOSED {
+		t.Fatalf("Expected the PR to stay closed, got %+v, %v", prs, err)
+	}
+}
+
+func TestGithubBadPayload(t *testing.T) {
+	ctx := context.Background()
+	ingestor := newTestIngestor(t)
+
+	for name, body := range map[string][]byte{
+		"NotJson":      []byte(`{`),
+		"NoRepository": []byte(`{"action": "opened", "pull_request": {"number": 7}}`),
+		"NoNumber":     []byte(`{"action": "opened", "repository": {"full_name": "acme/api"}}`),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ingestor.Github(ctx, githubHeader("pull_request", sign(testSecret, body)), body)
+			if !errors.Is(err, ErrBadPayload) {
+				t.Fatalf("Expected ErrBadPayload, got %v", err)
+			}
+		})
+	}
+
+	t.Run("UnmappedLogin", func(t *testing.T) {
+		body := []byte(`{"action": "opened", "pull_request": {"number": 8, "user": {"login": "stranger"}}, "repository": {"full_name": "acme/api"}}`)
+		_, err := ingestor.Github(ctx, githubHeader("pull_request", sign(testSecret, body)), body)
+		var svcErr service.ErrorService
+		if !errors.As(err, &svcErr) || svcErr.ApiCode != models.NOT_FOUND {
+			t.Fatalf("Expected NOT_FOUND, got %v", err)
+		}
+	})
+}
+
+func TestGitlabPayloadMapping(t *testing.T) {
+	ctx := context.Background()
+	ingestor := newTestIngestor(t)
+	send := func(event string, body []byte) (models.IngestResult, error) {
+		return ingestor.Gitlab(ctx, gitlabHeader(event, testToken), body)
+	}
+
+	result, err := send("Merge Request Hook", gitlabBody("open"))
+	if err != nil || result.Action != CREATED || result.PR == nil {
+		t.Fatalf("Expected a created PR, got %+v, %v", result, err)
+	}
+	if pr := result.PR; pr.PullRequestId != "acme/web!3" || pr.PullRequestName != "Fix login" || pr.AuthorId != "u2" {
+		t.Fatalf("Unexpected PR %+v", pr)
+	}
+
+	if result, err := send("Push Hook", gitlabBody("open")); err != nil || result.Action != IGNORED {
+		t.Fatalf("Expected a push hook to be ignored, got %+v, %v", result, err)
+	}
+	for _, action := range []string{"update", "reopen"} {
+		if result, err := send("Merge Request Hook", gitlabBody(action)); err != nil || result.Action != IGNORED {
+			t.Fatalf("Expected %s to be ignored, got %+v, %v", action, result, err)
+		}
+	}
+	if _, err := send("Merge Request Hook", []byte(`{"object_kind": "note"}`)); !errors.Is(err, ErrBadPayload) {
+		t.Fatalf("Expected ErrBadPayload, got %v", err)
+	}
+
+	result, err = send("Merge Request Hook", gitlabBody("close"))
+	if err != nil || result.Action != CLOSED || result.PR.Status != models.CLOSED {
+		t.Fatalf("Expected a closed PR, got %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,175 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testScenario = `
+# a team once, then create and reassign
+{"once": true, "method": "post", "path": "/team/add", "body": {"team_name": "t-{{session}}"}, "expect": 201}
+
+{"name": "create", "method": "POST", "path": "/pullRequest/create", "body": {"pull_request_id": "{{session}}-{{run}}", "author_id": "u{{run%3}}"}, "expect": 201, "save": {"reviewer": "pr.assigned_reviewers.1"}}
+{"name": "reassign", "method": "POST", "path": "/pullRequest/reassign", "body": {"pull_request_id": "{{session}}-{{run}}", "old_user_id": "{{reviewer}}"}}
+`
+
+func TestParseScenario(t *testing.T) {
+	scenario, err := ParseScenario(strings.NewReader(testScenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scenario.Setup) != 1 || scenario.Setup[0].Name != "POST /team/add" || len(scenario.Steps) != 2 {
+		t.Fatalf("Unexpected scenario: %+v", scenario)
+	}
+
+	for _, bad := range []string{
+		`{"method": "GET"}`,
+		`{"method": "GET", "path": "/x", "weight": 2}`,
+		`{"once": true, "method": "GET", "path": "/x"}`,
+		`not json`,
+	} {
+		if _, err := ParseScenario(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected %s to be rejected", bad)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	vars := map[string]string{"session": "s1", "reviewer": "u2"}
+	expanded, err := expand(`{"id": "{{session}}-{{run}}", "author": "u{{run%3}}", "old": "{{reviewer}}"}`, 7, vars, true)
+	if err != nil || expanded != `{"id": "s1-7", "author": "u1", "old": "u2"}` {
+		t.Fatalf("Unexpected expansion %s, %v", expanded, err)
+	}
+
+	// saved values are escaped in bodies only
+	vars["name"] = `say "hi"\`
+	expanded, err = expand(`{"name": "{{name}}"}`, 1, vars, true)
+	if err != nil || expanded != `{"name": "say \"hi\"\\"}` {
+		t.Fatalf("Unexpected expansion %s, %v", expanded, err)
+	}
+	var body map[string]string
+	if err := json.Unmarshal([]byte(expanded), &body); err != nil || body["name"] != vars["name"] {
+		t.Fatalf("Expected the body to keep %q, got %v, %v", vars["name"], body, err)
+	}
+	if expanded, err = expand("/team/get?team_name={{name}}", 1, vars, false); err != nil || expanded != `/team/get?team_name=say "hi"\` {
+		t.Fatalf("Unexpected expansion %s, %v", expanded, err)
+	}
+
+	for _, bad := range []string{"{{missing}}", "{{run%0}}", "{{reviewer%2}}"} {
+		if _, err := expand(bad, 1, vars, false); err == nil {
+			t.Errorf("Expected %s to fail", bad)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	for p, expected := range map[int]time.Duration{50: 50 * time.Millisecond, 90: 90 * time.Millisecond, 99: 99 * time.Millisecond, 100: 100 * time.Millisecond} {
+		if actual := percentile(latencies, p); actual != expected {
+			t.Errorf("p%d: expected %s, got %s", p, expected, actual)
+		}
+	}
+	if percentile([]time.Duration{time.Second}, 1) != time.Second || percentile(nil, 50) != 0 {
+		t.Error("Unexpected percentile of one or no latencies")
+	}
+}
+
+func TestRun(t *testing.T) {
+	var mx sync.Mutex
+	reassigned := map[string]string{}
+	teams := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /team/add", func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		teams++
+		mx.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("POST /pullRequest/create", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0k" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var request map[string]string
+		json.NewDecoder(r.Body).Decode(&request)
+		// every fifth pull request fails, its reassign must be skipped
+		if strings.HasSuffix(request["pull_request_id"], "5") {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"pr": map[string]any{
+			"pull_request_id":    request["pull_request_id"],
+			"assigned_reviewers": []string{"x", "reviewer-of-" + request["pull_request_id"]},
+		}})
+	})
+	mux.HandleFunc("POST /pullRequest/reassign", func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]string
+		json.NewDecoder(r.Body).Decode(&request)
+		mx.Lock()
+		reassigned[request["pull_request_id"]] = request["old_user_id"]
+		mx.Unlock()
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	scenario, err := ParseScenario(strings.NewReader(testScenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{"Authorization": {"Bearer t0k"}}
+	report, err := Runner{BaseURL: server.URL}.Run(context.Background(), scenario, Options{Runs: 20, Concurrency: 4, Header: header, Session: "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if teams != 1 {
+		t.Fatalf("Expected the setup to run once, got %d", teams)
+	}
+	create, reassign := report.Steps[0], report.Steps[1]
+	if create.Requests != 20 || create.Failures != 2 || create.Statuses[201] != 18 || create.Statuses[409] != 2 {
+		t.Fatalf("Unexpected create stats: %+v", create)
+	}
+	if reassign.Requests != 18 || reassign.Failures != 0 || report.Total.Requests != 38 || report.Total.Failures != 2 {
+		t.Fatalf("Unexpected stats: %+v, %+v", reassign, report.Total)
+	}
+	if len(reassigned) != 18 || reassigned["s-7"] != "reviewer-of-s-7" {
+		t.Fatalf("Expected the saved reviewers to be reassigned, got %v", reassigned)
+	}
+	if create.P50 <= 0 || create.P50 > create.P99 || create.P99 > create.Max {
+		t.Fatalf("Unexpected percentiles: %+v", create)
+	}
+
+	var out bytes.Buffer
+	if err := report.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"create", "reassign", "total", "201:18 409:2", "38 requests in", "create: unexpected status 409"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Missing %q in report:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestRunStopsOnFailedSetup(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	scenario, err := ParseScenario(strings.NewReader(testScenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (Runner{BaseURL: server.URL}).Run(context.Background(), scenario, Options{Runs: 1, Concurrency: 1}); err == nil || !strings.Contains(err.Error(), "setup POST /team/add") {
+		t.Fatalf("Expected the setup to fail, got %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// MAX_ERRORS is how many distinct failure messages a Stats keeps.
+const MAX_ERRORS = 5
+
+// Stats are the numbers of one step name or of the whole run.
+type Stats struct {
+	Name     string
+	Requests int
+	Failures int
+	// Statuses counts the responses by status, 0 for transport errors.
+	Statuses map[int]int
+	P50      time.Duration
+	P90      time.Duration
+	P99      time.Duration
+	Max      time.Duration
+	// Errors are the first distinct failure messages.
+	Errors []string
+}
+
+// Report is the result of a run.
+type Report struct {
+	Duration time.Duration
+	Steps    []Stats
+	Total    Stats
+}
+
+// Throughput is the number of requests per second of the replays.
+func (r *Report) Throughput() float64 {
+	return r.rate(r.Total.Requests)
+}
+
+func (r *Report) rate(requests int) float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(requests) / r.Duration.Seconds()
+}
+
+// Write prints the report as a table, one row per step name and the total.
+func (r *Report) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tREQUESTS\tFAILURES\tRPS\tP50\tP90\tP99\tMAX\tSTATUSES")
+	for _, stats := range append(slices.Clone(r.Steps), r.Total) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\t%s\n", stats.Name, stats.Requests, stats.Failures,
+			r.rate(stats.Requests), round(stats.P50), round(stats.P90), round(stats.P99), round(stats.Max), statuses(stats.Statuses))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\n%d requests in %s, %.1f requests/s\n", r.Total.Requests, round(r.Duration), r.Throughput())
+	for _, stats := range r.Steps {
+		for _, message := range stats.Errors {
+			if err == nil {
+				_, err = fmt.Fprintf(w, "%s: %s\n", stats.Name, message)
+			}
+		}
+	}
+	return err
+}
+
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	default:
+		return d.Round(time.Microsecond)
+	}
+}
+
+func statuses(counts map[int]int) string {
+	codes := make([]int, 0, len(counts))
+	for code := range counts {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	s := ""
+	for i, code := range codes {
+		if i > 0 {
+			s += " "
+		}
+		s += fmt.Sprintf("%d:%d", code, counts[code])
+	}
+	return s
+}
+
+// samples are the raw measurements of one step name.
+type samples struct {
+	latencies []time.Duration
+	statuses  map[int]int
+	failures  int
+	errors    []string
+}
+
+func (s *samples) merge(other *samples) {
+	s.latencies = append(s.latencies, other.latencies...)
+	for code, n := range other.statuses {
+		s.statuses[code] += n
+	}
+	s.failures += other.failures
+	for _, message := range other.errors {
+		s.addError(message)
+	}
+}
+
+func (s *samples) addError(message string) {
+	if len(s.errors) < MAX_ERRORS && !slices.Contains(s.errors, message) {
+		s.errors = append(s.errors, message)
+	}
+}
+
+func (s *samples) stats(name string) Stats {
+	sorted := slices.Clone(s.latencies)
+	slices.Sort(sorted)
+	stats := Stats{
+		Name:     name,
+		Requests: len(sorted),
+		Failures: s.failures,
+		Statuses: s.statuses,
+		P50:      percentile(sorted, 50),
+		P90:      percentile(sorted, 90),
+		P99:      percentile(sorted, 99),
+		Errors:   s.errors,
+	}
+	if len(sorted) > 0 {
+		stats.Max = sorted[len(sorted)-1]
+	}
+	return stats
+}
+
+// percentile returns the nearest-rank percentile p of the sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// recorder collects the samples of one worker, so the workers do not share a
+// lock while measuring.
+type recorder struct {
+	steps map[string]*samples
+}
+
+func newRecorder() *recorder {
+	return &recorder{steps: map[string]*samples{}}
+}
+
+func newSamples() *samples {
+	return &samples{statuses: map[int]int{}}
+}
+
+func (r *recorder) record(name string, status int, latency time.Duration, err error) {
+	s, ok := r.steps[name]
+	if !ok {
+		s = newSamples()
+		r.steps[name] = s
+	}
+	s.latencies = append(s.latencies, latency)
+	s.statuses[status]++
+	if err != nil {
+		s.failures++
+		s.addError(err.Error())
+	}
+}
+
+func newReport(steps []Step, recorders []*recorder, duration time.Duration) *Report {
+	report := &Report{Duration: duration}
+	total := newSamples()
+	var names []string
+	for _, step := range steps {
+		if !slices.Contains(names, step.Name) {
+			names = append(names, step.Name)
+		}
+	}
+	for _, name := range names {
+		merged := newSamples()
+		for _, rec := range recorders {
+			if s, ok := rec.steps[name]; ok {
+				merged.merge(s)
+			}
+		}
+		report.Steps = append(report.Steps, merged.stats(name))
+		total.merge(merged)
+	}
+	report.Total = total.stats("total")
+	return report
+}
@@ -0,0 +1,128 @@
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Options of a load test run.
+type Options struct {
+	// Runs is how many times the steps are replayed.
+	Runs int
+	// Concurrency is how many replays run at once.
+	Concurrency int
+	// Header is sent with every request, e.g. Authorization.
+	Header http.Header
+	// Session is the value of {{session}}, a different one for every run
+	// keeps the ids of the runs against one server apart.
+	Session string
+}
+
+// Runner replays a scenario against the server at BaseURL.
+type Runner struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// Run executes the setup steps once, failing on the first unexpected
+// response, and then the replays. The failures of the replays are counted in
+// the report and do not stop the run; a failed step skips the rest of its
+// replay, whose later steps may depend on it. A cancelled ctx ends the run
+// early with the report of what was done.
+func (r Runner) Run(ctx context.Context, scenario Scenario, opts Options) (*Report, error) {
+	if opts.Runs <= 0 || opts.Concurrency <= 0 {
+		return nil, errors.New("runs and concurrency must be positive")
+	}
+
+	for _, step := range scenario.Setup {
+		if _, _, err := r.do(ctx, step, opts.Header, 0, opts.vars()); err != nil {
+			return nil, fmt.Errorf("setup %s: %w", step.Name, err)
+		}
+	}
+
+	runs := make(chan int)
+	recorders := make([]*recorder, opts.Concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := range recorders {
+		recorders[w] = newRecorder()
+		wg.Add(1)
+		go func(rec *recorder) {
+			defer wg.Done()
+			for run := range runs {
+				r.replay(ctx, scenario.Steps, opts, run, rec)
+			}
+		}(recorders[w])
+	}
+
+dispatch:
+	for run := 1; run <= opts.Runs; run++ {
+		select {
+		case runs <- run:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(runs)
+	wg.Wait()
+
+	return newReport(scenario.Steps, recorders, time.Since(start)), nil
+}
+
+// vars are the variables a replay starts with.
+func (o Options) vars() map[string]string {
+	return map[string]string{"session": o.Session}
+}
+
+func (r Runner) replay(ctx context.Context, steps []Step, opts Options, run int, rec *recorder) {
+	vars := opts.vars()
+	for _, step := range steps {
+		if ctx.Err() != nil {
+			return
+		}
+		status, latency, err := r.do(ctx, step, opts.Header, run, vars)
+		rec.record(step.Name, status, latency, err)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// do sends one step and returns the status and latency of the response. An
+// unexpected status is an error.
+func (r Runner) do(ctx context.Context, step Step, header http.Header, run int, vars map[string]string) (int, time.Duration, error) {
+	req, err := step.request(r.BaseURL, header, run, vars)
+	if err != nil {
+		return 0, 0, err
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, time.Since(start), err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	latency := time.Since(start)
+	if err != nil {
+		return resp.StatusCode, latency, err
+	}
+
+	ok := resp.StatusCode == step.Expect
+	if step.Expect == 0 {
+		ok = resp.StatusCode >= 200 && resp.StatusCode < 300
+	}
+	if !ok {
+		return resp.StatusCode, latency, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
+	}
+	return resp.StatusCode, latency, step.save(body, vars)
+}
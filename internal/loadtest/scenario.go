@@ -0,0 +1,191 @@
+// Package loadtest replays a scenario of HTTP requests against a running
+// server and reports throughput and latency percentiles.
+package loadtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Step is one request of a scenario, a line of the JSONL file:
+//
+//	{"once": true, "method": "POST", "path": "/team/add", "body": {"team_name": "load", "members": [...]}}
+//	{"name": "create", "method": "POST", "path": "/pullRequest/create", "body": {"pull_request_id": "load-{{run}}", "pull_request_name": "load", "author_id": "u{{run%10}}"}, "expect": 201, "save": {"reviewer": "pr.assigned_reviewers.0"}}
+//	{"name": "reassign", "method": "POST", "path": "/pullRequest/reassign", "body": {"pull_request_id": "load-{{run}}", "old_user_id": "{{reviewer}}"}}
+//
+// {{run}} is the number of the replay, {{run%N}} the number modulo N,
+// {{session}} is Options.Session and any other {{name}} a value saved by an
+// earlier step of the same replay.
+type Step struct {
+	// Name groups the step in the report, METHOD path by default.
+	Name   string          `json:"name,omitempty"`
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	// Expect is the status of a successful response, any 2xx when 0.
+	Expect int `json:"expect,omitempty"`
+	// Once steps run a single time before the replays, in file order.
+	Once bool `json:"once,omitempty"`
+	// Save maps a variable to a dotted path into the JSON response,
+	// array elements are addressed by index.
+	Save map[string]string `json:"save,omitempty"`
+}
+
+// Scenario is the parsed file: Setup are the once steps, Steps are replayed.
+type Scenario struct {
+	Setup []Step
+	Steps []Step
+}
+
+// ParseScenario reads a JSONL scenario, blank lines and lines starting with #
+// are skipped.
+func ParseScenario(r io.Reader) (Scenario, error) {
+	var scenario Scenario
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var step Step
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&step); err != nil {
+			return scenario, fmt.Errorf("line %d: %w", line, err)
+		}
+		step.Method = strings.ToUpper(step.Method)
+		if step.Method == "" || !strings.HasPrefix(step.Path, "/") {
+			return scenario, fmt.Errorf("line %d: method and a path starting with / are required", line)
+		}
+		if step.Name == "" {
+			step.Name = step.Method + " " + step.Path
+		}
+
+		if step.Once {
+			scenario.Setup = append(scenario.Setup, step)
+		} else {
+			scenario.Steps = append(scenario.Steps, step)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return scenario, err
+	}
+	if len(scenario.Steps) == 0 {
+		return scenario, fmt.Errorf("no steps to replay")
+	}
+	return scenario, nil
+}
+
+var placeholder = regexp.MustCompile(`\{\{([A-Za-z_][A-Za-z0-9_]*)(?:%(\d+))?\}\}`)
+
+// expand fills in the placeholders of s for replay run. Saved values going
+// into a JSON body are escaped, the placeholders sit inside its strings.
+func expand(s string, run int, vars map[string]string, inJSON bool) (string, error) {
+	var missing error
+	expanded := placeholder.ReplaceAllStringFunc(s, func(match string) string {
+		groups := placeholder.FindStringSubmatch(match)
+		name, modulo := groups[1], groups[2]
+		if name == "run" {
+			if modulo == "" {
+				return strconv.Itoa(run)
+			}
+			n, err := strconv.Atoi(modulo)
+			if err != nil || n == 0 {
+				missing = fmt.Errorf("wrong modulo in %s", match)
+				return match
+			}
+			return strconv.Itoa(run % n)
+		}
+		value, ok := vars[name]
+		if !ok || modulo != "" {
+			missing = fmt.Errorf("%s is not saved by an earlier step", match)
+			return match
+		}
+		if inJSON {
+			quoted, _ := json.Marshal(value)
+			return string(quoted[1 : len(quoted)-1])
+		}
+		return value
+	})
+	return expanded, missing
+}
+
+// request builds the HTTP request of the step for replay run.
+func (step Step) request(baseURL string, header http.Header, run int, vars map[string]string) (*http.Request, error) {
+	path, err := expand(step.Path, run, vars, false)
+	if err != nil {
+		return nil, err
+	}
+	var body io.Reader
+	if len(step.Body) > 0 {
+		expanded, err := expand(string(step.Body), run, vars, true)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(expanded)
+	}
+
+	req, err := http.NewRequest(step.Method, baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// save stores the values of step.Save found in the response body in vars.
+func (step Step) save(body []byte, vars map[string]string) error {
+	if len(step.Save) == 0 {
+		return nil
+	}
+	var document any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return fmt.Errorf("response is not JSON: %w", err)
+	}
+
+	for name, path := range step.Save {
+		value := document
+		for _, key := range strings.Split(path, ".") {
+			switch node := value.(type) {
+			case map[string]any:
+				value = node[key]
+			case []any:
+				i, err := strconv.Atoi(key)
+				if err != nil || i < 0 || i >= len(node) {
+					value = nil
+				} else {
+					value = node[i]
+				}
+			default:
+				value = nil
+			}
+		}
+		switch value := value.(type) {
+		case string:
+			vars[name] = value
+		case json.Number:
+			vars[name] = value.String()
+		case bool:
+			vars[name] = strconv.FormatBool(value)
+		default:
+			return fmt.Errorf("no value at %s", path)
+		}
+	}
+	return nil
+}
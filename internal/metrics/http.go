@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const UNMATCHED_ROUTE = "unmatched"
+
+type HTTPMetrics struct {
+	requests *Vec
+	latency  *Vec
+}
+
+func NewHTTPMetrics(registry *Registry) *HTTPMetrics {
+	return &HTTPMetrics{
+		requests: registry.Counter("http_requests_total", "Number of HTTP requests.", "route", "method", "status"),
+		latency:  registry.Histogram("http_request_duration_seconds", "HTTP request latency.", DEFAULT_BUCKETS, "route", "method", "status"),
+	}
+}
+
+// Middleware has to wrap the ServeMux, or handlers that pass the request to it
+// unchanged: the route label is the pattern the mux matched, which it stores
+// in the request it was given.
+func (m *HTTPMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		// "POST /team/add" is labelled /team/add, the method has its own label
+		route := r.Pattern
+		if i := strings.IndexByte(route, ' '); i >= 0 {
+			route = route[i+1:]
+		}
+		if route == "" {
+			route = UNMATCHED_ROUTE
+		}
+		status := strconv.Itoa(recorder.status)
+		m.requests.Inc(route, r.Method, status)
+		m.latency.Observe(time.Since(start).Seconds(), route, r.Method, status)
+	})
+}
+
+func Handler(registry *Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_ = registry.WriteText(w)
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
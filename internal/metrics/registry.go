@@ -0,0 +1,193 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	COUNTER   = "counter"
+	GAUGE     = "gauge"
+	HISTOGRAM = "histogram"
+)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+var DEFAULT_BUCKETS = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// Registry keeps metric families and renders them in the Prometheus
+// text exposition format.
+type Registry struct {
+	mx       sync.Mutex
+	families []*Vec
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Vec is a metric family: one metric name with a series per label values.
+type Vec struct {
+	registry *Registry
+	name     string
+	help     string
+	kind     string
+	labels   []string
+	buckets  []float64
+	series   map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	count       uint64
+}
+
+func (r *Registry) Counter(name, help string, labels ...string) *Vec {
+	return r.register(name, help, COUNTER, labels, nil)
+}
+
+func (r *Registry) Gauge(name, help string, labels ...string) *Vec {
+	return r.register(name, help, GAUGE, labels, nil)
+}
+
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Vec {
+	return r.register(name, help, HISTOGRAM, labels, buckets)
+}
+
+func (r *Registry) register(name, help, kind string, labels []string, buckets []float64) *Vec {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	vec := &Vec{
+		registry: r,
+		name:     name,
+		help:     help,
+		kind:     kind,
+		labels:   labels,
+		buckets:  buckets,
+		series:   make(map[string]*series),
+	}
+	r.families = append(r.families, vec)
+	return vec
+}
+
+// Add adds delta to a counter or gauge.
+func (v *Vec) Add(delta float64, labelValues ...string) {
+	v.registry.mx.Lock()
+	defer v.registry.mx.Unlock()
+
+	v.get(labelValues).value += delta
+}
+
+func (v *Vec) Inc(labelValues ...string) {
+	v.Add(1, labelValues...)
+}
+
+func (v *Vec) Set(value float64, labelValues ...string) {
+	v.registry.mx.Lock()
+	defer v.registry.mx.Unlock()
+
+	v.get(labelValues).value = value
+}
+
+// Observe records a histogram sample.
+func (v *Vec) Observe(sample float64, labelValues ...string) {
+	v.registry.mx.Lock()
+	defer v.registry.mx.Unlock()
+
+	s := v.get(labelValues)
+	for i, bound := range v.buckets {
+		if sample <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += sample
+}
+
+// Value returns the current value of a counter or gauge series.
+func (v *Vec) Value(labelValues ...string) float64 {
+	v.registry.mx.Lock()
+	defer v.registry.mx.Unlock()
+
+	if s, ok := v.series[strings.Join(labelValues, "\xff")]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (v *Vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(v.buckets)),
+		}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	var b strings.Builder
+	for _, vec := range r.families {
+		fmt.Fprintf(&b, "# HELP %s %s\n", vec.name, vec.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", vec.name, vec.kind)
+
+		keys := make([]string, 0, len(vec.series))
+		for key := range vec.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := vec.series[key]
+			if vec.kind != HISTOGRAM {
+				fmt.Fprintf(&b, "%s%s %s\n", vec.name, formatLabels(vec.labels, s.labelValues, "", ""), formatValue(s.value))
+				continue
+			}
+			for i, bound := range vec.buckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", vec.name, formatLabels(vec.labels, s.labelValues, "le", formatValue(bound)), s.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", vec.name, formatLabels(vec.labels, s.labelValues, "le", "+Inf"), s.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", vec.name, formatLabels(vec.labels, s.labelValues, "", ""), formatValue(s.value))
+			fmt.Fprintf(&b, "%s_count%s %d\n", vec.name, formatLabels(vec.labels, s.labelValues, "", ""), s.count)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+labelEscaper.Replace(extraValue)+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/service"
+)
+
+// ServiceMetrics follows pull request events of PrReviewerService and keeps
+// the domain gauges and counters up to date.
+type ServiceMetrics struct {
+	openPRs       *Vec
+	openReviews   *Vec
+	created       *Vec
+	reassignments *Vec
+	merges        *Vec
+	closes        *Vec
+	overdue       *Vec
+	escalations   *Vec
+	domainErrors  *Vec
+}
+
+func NewServiceMetrics(registry *Registry) *ServiceMetrics {
+	return &ServiceMetrics{
+		openPRs:       registry.Gauge("pr_open", "Number of open pull requests."),
+		openReviews:   registry.Gauge("pr_open_reviews", "Number of open pull requests a user is assigned to review.", "tenant", "user_id"),
+		created:       registry.Counter("pr_created_total", "Number of created pull requests."),
+		reassignments: registry.Counter("pr_reassignments_total", "Number of reviewer reassignments."),
+		merges:        registry.Counter("pr_merges_total", "Number of merged pull requests."),
+		closes:        registry.Counter("pr_closes_total", "Number of pull requests closed without merge."),
+		overdue:       registry.Counter("pr_reviews_overdue_total", "Number of reviews that outlived the SLA of their team."),
+		escalations:   registry.Counter("pr_reviews_escalated_total", "Number of stale reviews escalated to the team lead."),
+		domainErrors:  registry.Counter("pr_domain_errors_total", "Number of operations rejected by domain rules, NO_CANDIDATE among them.", "code"),
+	}
+}
+
+func (m *ServiceMetrics) OnPullRequestEvents(ctx context.Context, pr models.PullRequest, events []models.PullRequestEvent) {
+	// user ids are only unique within a tenant
+	tenantId := service.TenantFromContext(ctx)
+	for _, event := range events {
+		switch event.Type {
+		case models.EVENT_PR_CREATED:
+			m.created.Inc()
+			m.openPRs.Add(1)
+		case models.EVENT_REVIEWER_ASSIGNED:
+			m.openReviews.Add(1, tenantId, event.ReviewerId)
+		case models.EVENT_REVIEWER_REPLACED:
+			m.reassignments.Inc()
+			m.openReviews.Add(-1, tenantId, event.OldReviewerId)
+			m.openReviews.Add(1, tenantId, event.ReviewerId)
+		case models.EVENT_PR_MERGED, models.EVENT_PR_CLOSED:
+			if event.Type == models.EVENT_PR_MERGED {
+				m.merges.Inc()
+			} else {
+				m.closes.Inc()
+			}
+			m.openPRs.Add(-1)
+			for _, reviewer := range pr.AssignedReviewers {
+				m.openReviews.Add(-1, tenantId, reviewer)
+			}
+		case models.EVENT_REVIEW_OVERDUE:
+			m.overdue.Inc()
+		case models.EVENT_REVIEW_ESCALATED:
+			m.escalations.Inc()
+		}
+	}
+}
+
+func (m *ServiceMetrics) OnDomainError(ctx context.Context, code models.ErrorDetailCode) {
+	m.domainErrors.Inc(string(code))
+}
@@ -1,7 +1,10 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -10,6 +13,7 @@ type PullRequestStatus string
 const (
 	OPEN   PullRequestStatus = "OPEN"
 	MERGED PullRequestStatus = "MERGED"
+	CLOSED PullRequestStatus = "CLOSED"
 )
 
 type ErrorDetailCode string
@@ -18,38 +22,206 @@ const (
 	TEAM_EXISTS  ErrorDetailCode = "TEAM_EXISTS"
 	PR_EXISTS    ErrorDetailCode = "PR_EXISTS"
 	PR_MERGED    ErrorDetailCode = "PR_MERGED"
+	PR_CLOSED    ErrorDetailCode = "PR_CLOSED"
 	NOT_ASSIGNED ErrorDetailCode = "NOT_ASSIGNED"
 	NO_CANDIDATE ErrorDetailCode = "NO_CANDIDATE"
 	NOT_FOUND    ErrorDetailCode = "NOT_FOUND"
 	FATAL_ERROR  ErrorDetailCode = "FATAL_ERROR"
+	UNAUTHORIZED ErrorDetailCode = "UNAUTHORIZED"
+	FORBIDDEN    ErrorDetailCode = "FORBIDDEN"
+
+	NOT_EMPTY        ErrorDetailCode = "NOT_EMPTY"
+	INVALID_SNAPSHOT ErrorDetailCode = "INVALID_SNAPSHOT"
+	BAD_REQUEST      ErrorDetailCode = "BAD_REQUEST"
+	VALIDATION_ERROR ErrorDetailCode = "VALIDATION_ERROR"
+
+	METHOD_NOT_ALLOWED ErrorDetailCode = "METHOD_NOT_ALLOWED"
+
+	TENANT_EXISTS    ErrorDetailCode = "TENANT_EXISTS"
+	TENANT_NOT_FOUND ErrorDetailCode = "TENANT_NOT_FOUND"
+
+	CANDIDATE_IS_AUTHOR ErrorDetailCode = "CANDIDATE_IS_AUTHOR"
+	CANDIDATE_INACTIVE  ErrorDetailCode = "CANDIDATE_INACTIVE"
+	ALREADY_ASSIGNED    ErrorDetailCode = "ALREADY_ASSIGNED"
+	WRONG_TEAM          ErrorDetailCode = "WRONG_TEAM"
+)
+
+// Role is what an authenticated caller is allowed to do.
+type Role string
+
+const (
+	// ROLE_ADMIN manages teams and users and may call every endpoint.
+	ROLE_ADMIN Role = "admin"
+	// ROLE_BOT creates, merges and closes pull requests, e.g. a CI job.
+	ROLE_BOT Role = "bot"
+	// ROLE_USER reads and may only take itself off a review.
+	ROLE_USER Role = "user"
+)
+
+type AuditAction string
+
+const (
+	TEAM_ADD         AuditAction = "TEAM_ADD"
+	USER_SET_ACTIVE  AuditAction = "USER_SET_ACTIVE"
+	USER_SET_PRIMARY AuditAction = "USER_SET_PRIMARY"
+	PR_CREATE        AuditAction = "PR_CREATE"
+	PR_MERGE         AuditAction = "PR_MERGE"
+	PR_CLOSE         AuditAction = "PR_CLOSE"
+	PR_REASSIGN      AuditAction = "PR_REASSIGN"
+	REPAIR           AuditAction = "REPAIR"
+	IMPORT           AuditAction = "IMPORT"
+	TENANT_CREATE    AuditAction = "TENANT_CREATE"
+	TEAM_SET_ROLE    AuditAction = "TEAM_SET_ROLE"
+	TEAM_SET_POLICY  AuditAction = "TEAM_SET_POLICY"
+	TEAM_SET_SLA     AuditAction = "TEAM_SET_SLA"
+
+	WEBHOOK_SUBSCRIBE   AuditAction = "WEBHOOK_SUBSCRIBE"
+	WEBHOOK_UNSUBSCRIBE AuditAction = "WEBHOOK_UNSUBSCRIBE"
+)
+
+// TeamRole is the seniority of a member within a team. An empty role is
+// TEAM_MEMBER.
+type TeamRole string
+
+const (
+	TEAM_LEAD   TeamRole = "LEAD"
+	TEAM_SENIOR TeamRole = "SENIOR"
+	TEAM_MEMBER TeamRole = "MEMBER"
+	TEAM_JUNIOR TeamRole = "JUNIOR"
 )
 
+var TEAM_ROLES = []TeamRole{TEAM_LEAD, TEAM_SENIOR, TEAM_MEMBER, TEAM_JUNIOR}
+
+// IsSenior tells whether the role counts as a senior reviewer.
+func (r TeamRole) IsSenior() bool {
+	return r == TEAM_LEAD || r == TEAM_SENIOR
+}
+
+type AuditEntity string
+
+const (
+	TEAM_ENTITY     AuditEntity = "team"
+	USER_ENTITY     AuditEntity = "user"
+	PR_ENTITY       AuditEntity = "pull_request"
+	SNAPSHOT_ENTITY AuditEntity = "snapshot"
+	TENANT_ENTITY   AuditEntity = "tenant"
+	WEBHOOK_ENTITY  AuditEntity = "webhook"
+)
+
+type PullRequestEventType string
+
+const (
+	EVENT_PR_CREATED        PullRequestEventType = "PR_CREATED"
+	EVENT_REVIEWER_ASSIGNED PullRequestEventType = "REVIEWER_ASSIGNED"
+	EVENT_REVIEWER_REPLACED PullRequestEventType = "REVIEWER_REPLACED"
+	EVENT_PR_MERGED         PullRequestEventType = "PR_MERGED"
+	EVENT_PR_CLOSED         PullRequestEventType = "PR_CLOSED"
+	// EVENT_REVIEW_OVERDUE is recorded once per assignment when the review
+	// outlives the SLA of the team.
+	EVENT_REVIEW_OVERDUE PullRequestEventType = "REVIEW_OVERDUE"
+	// EVENT_REVIEW_ESCALATED notifies the team lead, in LeadId, that a review
+	// the scheduler already reassigned went stale again or could not be
+	// reassigned.
+	EVENT_REVIEW_ESCALATED PullRequestEventType = "REVIEW_ESCALATED"
+)
+
+type ConsistencyRule string
+
+const (
+	REVIEWER_MISSING    ConsistencyRule = "REVIEWER_MISSING"
+	REVIEWER_IS_AUTHOR  ConsistencyRule = "REVIEWER_IS_AUTHOR"
+	INDEX_MISSING       ConsistencyRule = "INDEX_MISSING"
+	INDEX_DANGLING      ConsistencyRule = "INDEX_DANGLING"
+	MEMBER_NO_USER      ConsistencyRule = "MEMBER_NO_USER"
+	MEMBER_MISMATCH     ConsistencyRule = "MEMBER_MISMATCH"
+	USER_NOT_MEMBER     ConsistencyRule = "USER_NOT_MEMBER"
+	USER_TEAM_MISSING   ConsistencyRule = "USER_TEAM_MISSING"
+	USER_PRIMARY_TEAM   ConsistencyRule = "USER_PRIMARY_TEAM"
+	TEAM_PARENT_MISSING ConsistencyRule = "TEAM_PARENT_MISSING"
+	TEAM_PARENT_CYCLE   ConsistencyRule = "TEAM_PARENT_CYCLE"
+)
+
+// DEFAULT_TENANT always exists and serves requests that name no tenant.
+const DEFAULT_TENANT = "default"
+
+// Tenant is an organization with its own teams, users and pull requests:
+// ids and names only have to be unique within a tenant.
+type Tenant struct {
+	TenantId  string    `json:"tenant_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// User is a member of one or more teams. TeamName is the primary team, the
+// one reviewers of the user's pull requests are picked from by default; it
+// is the first team the user joined unless changed.
 type User struct {
-	UserId   string `json:"user_id"`
-	Username string `json:"username"`
-	TeamName string `json:"team_name"`
-	IsActive bool   `json:"is_active"`
+	UserId   string   `json:"user_id"`
+	Username string   `json:"username"`
+	TeamName string   `json:"team_name"`
+	Teams    []string `json:"teams"`
+	IsActive bool     `json:"is_active"`
 }
 
 type TeamMember struct {
-	UserId   string `json:"user_id"`
-	Username string `json:"username"`
-	IsActive bool   `json:"is_active"`
+	UserId   string   `json:"user_id"`
+	Username string   `json:"username"`
+	IsActive bool     `json:"is_active"`
+	Role     TeamRole `json:"role,omitempty"`
+}
+
+// TeamPolicy constrains the reviewers picked for the pull requests of a team.
+type TeamPolicy struct {
+	// RequireSenior asks for at least one LEAD or SENIOR reviewer.
+	RequireSenior bool `json:"require_senior"`
+	// NoJuniorOnly forbids reviewer sets made of juniors only.
+	NoJuniorOnly bool `json:"no_junior_only"`
 }
 
+// PolicyResult tells whether the reviewers of a pull request satisfy the
+// policy of its team, Violations lists the unmet rules.
+type PolicyResult struct {
+	Satisfied  bool     `json:"satisfied"`
+	Violations []string `json:"violations"`
+}
+
+// Team may have a parent team, so teams form a tree (department, group,
+// squad). Only direct members are listed in Members.
 type Team struct {
-	TeamName string       `json:"team_name"`
-	Members  []TeamMember `json:"members"`
+	TeamName   string       `json:"team_name"`
+	ParentTeam string       `json:"parent_team,omitempty"`
+	Members    []TeamMember `json:"members"`
+	Policy     *TeamPolicy  `json:"policy,omitempty"`
+	// ReviewSLA is how long a review may take, a Go duration like "24h".
+	// Without it the SLA of the nearest ancestor applies.
+	ReviewSLA string `json:"review_sla,omitempty"`
+}
+
+// TeamTree is a team with its sub-teams. AllMembers aggregates the members
+// of the whole subtree, every user once.
+type TeamTree struct {
+	Team
+	Subteams   []TeamTree   `json:"subteams"`
+	AllMembers []TeamMember `json:"all_members"`
 }
 
+// PullRequest keeps the team its reviewers are picked from in TeamName,
+// empty for pull requests created before users could be in several teams.
+// Policy checks the reviewers against the team's policy, nil when the team
+// has none; it is not part of the event stream. AssignedAt keeps when each
+// of the assigned reviewers got the review.
 type PullRequest struct {
-	PullRequestId     string            `json:"pull_request_id"`
-	PullRequestName   string            `json:"pull_request_name"`
-	AuthorId          string            `json:"author_id"`
-	Status            PullRequestStatus `json:"status"`
-	AssignedReviewers []string          `json:"assigned_reviewers"`
-	CreatedAt         *time.Time        `json:"createdAt,omitempty"`
-	MergedAt          *time.Time        `json:"mergedAt,omitempty"`
+	PullRequestId     string               `json:"pull_request_id"`
+	PullRequestName   string               `json:"pull_request_name"`
+	AuthorId          string               `json:"author_id"`
+	Status            PullRequestStatus    `json:"status"`
+	AssignedReviewers []string             `json:"assigned_reviewers"`
+	TeamName          string               `json:"team_name,omitempty"`
+	Policy            *PolicyResult        `json:"policy,omitempty"`
+	AssignedAt        map[string]time.Time `json:"assigned_at,omitempty"`
+	CreatedAt         *time.Time           `json:"createdAt,omitempty"`
+	MergedAt          *time.Time           `json:"mergedAt,omitempty"`
+	ClosedAt          *time.Time           `json:"closedAt,omitempty"`
 }
 
 type PullRequestShort struct {
@@ -57,11 +229,188 @@ type PullRequestShort struct {
 	PullRequestName string            `json:"pull_request_name"`
 	AuthorId        string            `json:"author_id"`
 	Status          PullRequestStatus `json:"status"`
+	// Overdue marks reviews past their SLA in /users/getReview.
+	Overdue bool `json:"overdue,omitempty"`
+}
+
+// OverdueReview is an open review that outlived the SLA of its team.
+type OverdueReview struct {
+	PullRequestId   string    `json:"pull_request_id"`
+	PullRequestName string    `json:"pull_request_name"`
+	AuthorId        string    `json:"author_id"`
+	TeamName        string    `json:"team_name"`
+	ReviewerId      string    `json:"reviewer_id"`
+	AssignedAt      time.Time `json:"assigned_at"`
+	DueAt           time.Time `json:"due_at"`
+}
+
+type AuditEvent struct {
+	Id         int64           `json:"id"`
+	Timestamp  time.Time       `json:"timestamp"`
+	Actor      string          `json:"actor"`
+	ActorRole  Role            `json:"actor_role,omitempty"`
+	RequestId  string          `json:"request_id"`
+	Action     AuditAction     `json:"action"`
+	EntityType AuditEntity     `json:"entity_type"`
+	EntityId   string          `json:"entity_id"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+}
+
+// PullRequestEvent is one change of a pull request. Automatic marks a
+// REVIEWER_REPLACED made by the stale review scheduler, LeadId is the lead a
+// REVIEW_ESCALATED notifies.
+type PullRequestEvent struct {
+	Seq             int64                `json:"seq"`
+	Type            PullRequestEventType `json:"type"`
+	PullRequestId   string               `json:"pull_request_id"`
+	Timestamp       time.Time            `json:"timestamp"`
+	PullRequestName string               `json:"pull_request_name,omitempty"`
+	AuthorId        string               `json:"author_id,omitempty"`
+	TeamName        string               `json:"team_name,omitempty"`
+	ReviewerId      string               `json:"reviewer_id,omitempty"`
+	OldReviewerId   string               `json:"old_reviewer_id,omitempty"`
+	Automatic       bool                 `json:"automatic,omitempty"`
+	LeadId          string               `json:"lead_id,omitempty"`
+}
+
+type PullRequestHistory struct {
+	PullRequestId string             `json:"pull_request_id"`
+	Events        []PullRequestEvent `json:"events"`
+	PR            PullRequest        `json:"pr"`
+}
+
+type WebhookSubscription struct {
+	Id         string                 `json:"id"`
+	TenantId   string                 `json:"tenant_id"`
+	Url        string                 `json:"url"`
+	EventTypes []PullRequestEventType `json:"event_types,omitempty"`
+	Secret     string                 `json:"secret,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
+
+type WebhookPayload struct {
+	DeliveryId string               `json:"delivery_id"`
+	TenantId   string               `json:"tenant_id"`
+	EventType  PullRequestEventType `json:"event_type"`
+	Event      PullRequestEvent     `json:"event"`
+	PR         PullRequest          `json:"pr"`
+}
+
+type WebhookDelivery struct {
+	DeliveryId     string               `json:"delivery_id"`
+	SubscriptionId string               `json:"subscription_id"`
+	EventType      PullRequestEventType `json:"event_type"`
+	Attempt        int                  `json:"attempt"`
+	Timestamp      time.Time            `json:"timestamp"`
+	StatusCode     int                  `json:"status_code,omitempty"`
+	Error          string               `json:"error,omitempty"`
+	Delivered      bool                 `json:"delivered"`
+}
+
+type ConsistencyViolation struct {
+	Rule       ConsistencyRule `json:"rule"`
+	EntityType AuditEntity     `json:"entity_type"`
+	EntityId   string          `json:"entity_id"`
+	Message    string          `json:"message"`
+	Repaired   bool            `json:"repaired"`
+}
+
+type ConsistencyReport struct {
+	Consistent bool                   `json:"consistent"`
+	Violations []ConsistencyViolation `json:"violations"`
+}
+
+// Snapshot is the full service state. Assignments mirror the reviewer index
+// (user_id -> pull_request_ids) and must match assigned_reviewers.
+type Snapshot struct {
+	Version      int                 `json:"version"`
+	ExportedAt   time.Time           `json:"exported_at"`
+	Teams        []Team              `json:"teams"`
+	Users        []User              `json:"users"`
+	PullRequests []PullRequest       `json:"pull_requests"`
+	Assignments  map[string][]string `json:"assignments"`
+}
+
+type SnapshotImportResult struct {
+	Teams        int `json:"teams"`
+	Users        int `json:"users"`
+	PullRequests int `json:"pull_requests"`
+}
+
+// TeamResponse, TenantResponse, UserResponse and PullRequestResponse wrap
+// the entity a successful mutation returns, as openapi.yml describes.
+type TeamResponse struct {
+	Team Team `json:"team"`
+}
+
+type TenantResponse struct {
+	Tenant Tenant `json:"tenant"`
+}
+
+type TenantsResponse struct {
+	Tenants []Tenant `json:"tenants"`
+}
+
+type UserResponse struct {
+	User User `json:"user"`
+}
+
+type PullRequestResponse struct {
+	PR PullRequest `json:"pr"`
+}
+
+// UserReviewsResponse is the body of /users/getReview.
+type UserReviewsResponse struct {
+	UserId       string             `json:"user_id"`
+	PullRequests []PullRequestShort `json:"pull_requests"`
+	OverdueCount int                `json:"overdue_count"`
+}
+
+// OverdueResponse is the body of /pullRequest/overdue.
+type OverdueResponse struct {
+	Reviews []OverdueReview `json:"reviews"`
+}
+
+// ReassignResponse is the body of a successful /pullRequest/reassign.
+type ReassignResponse struct {
+	PR         PullRequest `json:"pr"`
+	ReplacedBy string      `json:"replaced_by"`
+}
+
+// IngestResult tells what an ingested provider webhook did: created, merged,
+// closed or ignored.
+type IngestResult struct {
+	Action string       `json:"action"`
+	PR     *PullRequest `json:"pr,omitempty"`
+}
+
+type HealthReport struct {
+	Status        string            `json:"status"`
+	Version       string            `json:"version"`
+	UptimeSeconds int64             `json:"uptime_seconds"`
+	Checks        map[string]string `json:"checks,omitempty"`
+}
+
+type AuditFilter struct {
+	EntityType AuditEntity
+	EntityId   string
+	Actor      string
+	From       *time.Time
+	To         *time.Time
 }
 
 type ErrorDetail struct {
 	Code    ErrorDetailCode `json:"code"`
 	Message string          `json:"message"`
+	// Details lists the invalid fields of a VALIDATION_ERROR.
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// FieldError is one invalid field of a request, e.g. "members[1].user_id".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
 
 type ErrorResponse struct {
@@ -73,10 +422,16 @@ func NewUser(userId string, username string, teamName string, isActive bool) Use
 		UserId:   userId,
 		Username: username,
 		TeamName: teamName,
+		Teams:    []string{teamName},
 		IsActive: isActive,
 	}
 }
 
+// InTeam tells whether the user is a member of teamName.
+func (u *User) InTeam(teamName string) bool {
+	return slices.Contains(u.Teams, teamName)
+}
+
 func NewTeamMember(user *User) TeamMember {
 	return TeamMember{
 		UserId:   user.UserId,
@@ -105,6 +460,100 @@ func NewPRShort(pr *PullRequest) PullRequestShort {
 	}
 }
 
+func NewAuditEvent(timestamp time.Time, actor, requestId string, action AuditAction, entityType AuditEntity, entityId string, before, after json.RawMessage) AuditEvent {
+	return AuditEvent{
+		Timestamp:  timestamp,
+		Actor:      actor,
+		RequestId:  requestId,
+		Action:     action,
+		EntityType: entityType,
+		EntityId:   entityId,
+		Before:     before,
+		After:      after,
+	}
+}
+
+func NewPRCreatedEvent(pr *PullRequest, timestamp time.Time) PullRequestEvent {
+	return PullRequestEvent{
+		Type:            EVENT_PR_CREATED,
+		PullRequestId:   pr.PullRequestId,
+		Timestamp:       timestamp,
+		PullRequestName: pr.PullRequestName,
+		AuthorId:        pr.AuthorId,
+		TeamName:        pr.TeamName,
+	}
+}
+
+func NewReviewerAssignedEvent(prId, reviewerId string, timestamp time.Time) PullRequestEvent {
+	return PullRequestEvent{
+		Type:          EVENT_REVIEWER_ASSIGNED,
+		PullRequestId: prId,
+		Timestamp:     timestamp,
+		ReviewerId:    reviewerId,
+	}
+}
+
+func NewReviewerReplacedEvent(prId, oldReviewerId, reviewerId string, timestamp time.Time) PullRequestEvent {
+	return PullRequestEvent{
+		Type:          EVENT_REVIEWER_REPLACED,
+		PullRequestId: prId,
+		Timestamp:     timestamp,
+		ReviewerId:    reviewerId,
+		OldReviewerId: oldReviewerId,
+	}
+}
+
+func NewPRMergedEvent(prId string, timestamp time.Time) PullRequestEvent {
+	return PullRequestEvent{
+		Type:          EVENT_PR_MERGED,
+		PullRequestId: prId,
+		Timestamp:     timestamp,
+	}
+}
+
+func NewPRClosedEvent(prId string, timestamp time.Time) PullRequestEvent {
+	return PullRequestEvent{
+		Type:          EVENT_PR_CLOSED,
+		PullRequestId: prId,
+		Timestamp:     timestamp,
+	}
+}
+
+// Accepts reports whether the subscription wants events of the given type.
+// A subscription without event types receives everything.
+func (s *WebhookSubscription) Accepts(eventType PullRequestEventType) bool {
+	if len(s.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range s.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether the event passes the filter. Empty fields match everything,
+// From and To bounds are inclusive.
+func (f AuditFilter) Match(e *AuditEvent) bool {
+	if f.EntityType != "" && f.EntityType != e.EntityType {
+		return false
+	}
+	if f.EntityId != "" && f.EntityId != e.EntityId {
+		return false
+	}
+	if f.Actor != "" && f.Actor != e.Actor {
+		return false
+	}
+	if f.From != nil && e.Timestamp.Before(*f.From) {
+		return false
+	}
+	if f.To != nil && e.Timestamp.After(*f.To) {
+		return false
+	}
+	return true
+}
+
 func NewErrorDetail(code ErrorDetailCode, message string) ErrorDetail {
 	return ErrorDetail{
 		Code:    code,
@@ -118,6 +567,27 @@ func NewErrorResponse(code ErrorDetailCode, message string) ErrorResponse {
 	}
 }
 
+// NewValidationErrorDetail is a VALIDATION_ERROR listing every invalid field.
+func NewValidationErrorDetail(details []FieldError) ErrorDetail {
+	var fields []string
+	for i, detail := range details {
+		if i == 0 || details[i-1].Field != detail.Field {
+			fields = append(fields, detail.Field)
+		}
+	}
+	return ErrorDetail{
+		Code:    VALIDATION_ERROR,
+		Message: "invalid fields: " + strings.Join(fields, ", "),
+		Details: details,
+	}
+}
+
+func NewValidationErrorResponse(details []FieldError) ErrorResponse {
+	return ErrorResponse{
+		Detail: NewValidationErrorDetail(details),
+	}
+}
+
 func (e ErrorResponse) Error() string {
 	return fmt.Sprintf("%s: %s", e.Detail.Code, e.Detail.Message)
 }
@@ -0,0 +1,264 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+// ResponseMode is what the Validator does with responses that do not match
+// the spec.
+type ResponseMode string
+
+const (
+	// RESPONSES_OFF skips response validation.
+	RESPONSES_OFF ResponseMode = "off"
+	// RESPONSES_LOG logs mismatches and sends the response unchanged.
+	RESPONSES_LOG ResponseMode = "log"
+	// RESPONSES_STRICT replaces a mismatching response with a 500, so tests
+	// fail on drift.
+	RESPONSES_STRICT ResponseMode = "strict"
+)
+
+// ResponseModeFromEnv reads OPENAPI_RESPONSE_VALIDATION, RESPONSES_LOG by default.
+func ResponseModeFromEnv() (ResponseMode, error) {
+	switch mode := ResponseMode(os.Getenv("OPENAPI_RESPONSE_VALIDATION")); mode {
+	case "":
+		return RESPONSES_LOG, nil
+	case RESPONSES_OFF, RESPONSES_LOG, RESPONSES_STRICT:
+		return mode, nil
+	default:
+		return RESPONSES_LOG, fmt.Errorf("wrong OPENAPI_RESPONSE_VALIDATION %q, expected off, log or strict", mode)
+	}
+}
+
+// MAX_REQUEST_BODY is the largest request body the Validator reads, room
+// for the snapshot of a large instance.
+const MAX_REQUEST_BODY = 32 << 20
+
+// Validator rejects requests that do not match the spec with a 400 before
+// they reach the handlers: BAD_REQUEST when the body cannot be read as JSON
+// or is larger than MAX_REQUEST_BODY, VALIDATION_ERROR with every invalid
+// field otherwise. It checks the responses of the handlers according to its
+// ResponseMode. Paths and methods missing from the spec are passed through
+// untouched.
+type Validator struct {
+	spec *Spec
+	mode ResponseMode
+}
+
+func NewValidator(spec *Spec, mode ResponseMode) *Validator {
+	return &Validator{spec: spec, mode: mode}
+}
+
+// Middleware checks the responses and can sit between the metrics middleware
+// and the mux. Requests are checked by Request, per route.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operation := v.spec.Operation(r.Method, r.URL.Path)
+		if operation == nil || v.mode == RESPONSES_OFF {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		if violations := operation.validateResponse(recorder.status, w.Header(), recorder.body.Bytes()); len(violations) > 0 {
+			err := fmt.Errorf("response of %s %s with status %d does not match openapi.yml: %w", r.Method, operation.Path, recorder.status, joinViolations(violations))
+			log.Println(err)
+			if v.mode == RESPONSES_STRICT {
+				w.Header().Del("Content-Length")
+				writeResponse(w, http.StatusInternalServerError, models.NewErrorResponse(models.FATAL_ERROR, err.Error()))
+				return
+			}
+		}
+		recorder.flush()
+	})
+}
+
+// Request validates the request of a route before next handles it. It goes
+// after the authorization of the route, so callers who may not use the route
+// learn nothing from the validation and cannot make the server read bodies.
+// The body it has read is handed on to next.
+func (v *Validator) Request(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		operation := v.spec.Operation(r.Method, r.URL.Path)
+		if operation == nil {
+			next(w, r)
+			return
+		}
+
+		violations, err := v.validateRequest(operation, w, r)
+		if err != nil {
+			writeResponse(w, http.StatusBadRequest, models.NewErrorResponse(models.BAD_REQUEST, err.Error()))
+			return
+		}
+		if len(violations) > 0 {
+			writeResponse(w, http.StatusBadRequest, models.NewValidationErrorResponse(fieldErrors(violations)))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (v *Validator) validateRequest(operation *Operation, w http.ResponseWriter, r *http.Request) ([]Violation, error) {
+	var violations []Violation
+	query := r.URL.Query()
+	for _, parameter := range operation.Parameters {
+		if parameter.In != "query" {
+			continue
+		}
+		raw := query.Get(parameter.Name)
+		if raw == "" {
+			if parameter.Required {
+				violations = append(violations, Violation{Field: parameter.Name, Message: "is required"})
+			}
+			continue
+		}
+		value, ok := parseParameter(parameter.Schema, raw)
+		if !ok {
+			violations = append(violations, Violation{Field: parameter.Name, Message: "must be " + article(parameter.Schema.Type)})
+			continue
+		}
+		for _, violation := range parameter.Schema.Validate(value, REQUEST) {
+			violation.Field = joinField(parameter.Name, violation.Field)
+			violations = append(violations, violation)
+		}
+	}
+
+	if operation.RequestBody == nil {
+		return violations, nil
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MAX_REQUEST_BODY))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, fmt.Errorf("request body is larger than %d bytes", tooLarge.Limit)
+		}
+		return nil, fmt.Errorf("read request body: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if len(bytes.TrimSpace(body)) == 0 {
+		if operation.RequestBody.Required {
+			return nil, fmt.Errorf("request body is required")
+		}
+		return violations, nil
+	}
+
+	schema, ok := operation.RequestBody.Content[JSON_CONTENT_TYPE]
+	if !ok {
+		return violations, nil
+	}
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, fmt.Errorf("request body is not valid JSON: %w", err)
+	}
+	return append(violations, schema.Validate(value, REQUEST)...), nil
+}
+
+func (o *Operation) validateResponse(status int, header http.Header, body []byte) []Violation {
+	response, ok := o.Responses[strconv.Itoa(status)]
+	if !ok {
+		if response, ok = o.Responses["default"]; !ok {
+			return []Violation{{Message: "status is not documented"}}
+		}
+	}
+
+	if len(response.Content) == 0 {
+		if len(bytes.TrimSpace(body)) > 0 {
+			return []Violation{{Message: "body is not documented"}}
+		}
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return []Violation{{Message: "missing or wrong Content-Type"}}
+	}
+	schema, ok := response.Content[mediaType]
+	if !ok {
+		return []Violation{{Message: "Content-Type " + mediaType + " is not documented"}}
+	}
+	if mediaType != JSON_CONTENT_TYPE {
+		return nil
+	}
+
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return []Violation{{Message: "body is not valid JSON"}}
+	}
+	return schema.Validate(value, RESPONSE)
+}
+
+type violationsError []Violation
+
+func (e violationsError) Error() string {
+	messages := make([]string, len(e))
+	for i, violation := range e {
+		messages[i] = violation.String()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func joinViolations(violations []Violation) error {
+	return violationsError(violations)
+}
+
+func article(typ string) string {
+	switch typ {
+	case "integer":
+		return "an integer"
+	case "":
+		return "a value"
+	}
+	return "a " + typ
+}
+
+func fieldErrors(violations []Violation) []models.FieldError {
+	details := make([]models.FieldError, len(violations))
+	for i, violation := range violations {
+		details[i] = models.FieldError{Field: violation.Field, Message: violation.Message}
+	}
+	return details
+}
+
+func writeResponse(w http.ResponseWriter, status int, response models.ErrorResponse) {
+	w.Header().Set("Content-Type", JSON_CONTENT_TYPE)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// responseRecorder holds the response back until it has been validated.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.body.Write(b)
+}
+
+func (r *responseRecorder) flush() {
+	r.ResponseWriter.WriteHeader(r.status)
+	_, _ = r.ResponseWriter.Write(r.body.Bytes())
+}
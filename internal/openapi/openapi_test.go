@@ -0,0 +1,208 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	prreviewer "github.com/Dowtai/pr-reviewer-service"
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+func TestParseYAML(t *testing.T) {
+	document := `# comment
+name: 'it''s'   # trailing comment
+url: http://example.com/#anchor
+count: 3
+flags: [true, "a, b", { k: v }]
+'200':
+  text: >
+    folded
+    lines
+  raw: |
+    kept
+    lines
+items:
+- id: 1
+  tags:
+    - x
+- plain
+`
+	expected := map[string]any{
+		"name":  "it's",
+		"url":   "http://example.com/#anchor",
+		"count": float64(3),
+		"flags": []any{true, "a, b", map[string]any{"k": "v"}},
+		"200":   map[string]any{"text": "folded lines\n", "raw": "kept\nlines\n"},
+		"items": []any{map[string]any{"id": float64(1), "tags": []any{"x"}}, "plain"},
+	}
+	value, err := parseYAML([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Fatalf("Expected %#v, got %#v", expected, value)
+	}
+
+	if _, err := parseYAML([]byte("a: 1\na: 2\n")); err == nil {
+		t.Fatal("Expected an error for a duplicate key")
+	}
+}
+
+func TestLoadEmbeddedSpec(t *testing.T) {
+	spec, err := Load(prreviewer.OpenAPISpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	operation := spec.Operation(http.MethodPost, "/team/add")
+	if operation == nil || operation.RequestBody == nil || !operation.RequestBody.Required {
+		t.Fatalf("Expected POST /team/add with a required body, got %+v", operation)
+	}
+	errorSchema := operation.Responses["500"].Content[JSON_CONTENT_TYPE]
+	value := map[string]any{"error": map[string]any{"code": string(models.FATAL_ERROR), "message": "boom"}}
+	if violations := errorSchema.Validate(value, RESPONSE); len(violations) > 0 {
+		t.Fatalf("Expected FATAL_ERROR to be a documented code, got %v", violations)
+	}
+}
+
+const testSpec = `
+paths:
+  /items:
+    get:
+      parameters:
+        - name: limit
+          in: query
+          required: true
+          schema: { type: integer }
+      responses:
+        '200':
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [ id ]
+                properties:
+                  id: { type: string }
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [ id, tags ]
+              properties:
+                id: { type: string, minLength: 1 }
+                tags: { type: array, items: { type: string, enum: [a, b] } }
+      responses:
+        '204':
+          description: Created
+`
+
+func testServer(t *testing.T, mode ResponseMode, handler http.HandlerFunc) *httptest.Server {
+	spec, err := Load([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator := NewValidator(spec, mode)
+	server := httptest.NewServer(validator.Middleware(validator.Request(handler)))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func errorResponse(t *testing.T, resp *http.Response) models.ErrorResponse {
+	t.Helper()
+	defer resp.Body.Close()
+	var response models.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Expected a JSON error body: %v", err)
+	}
+	return response
+}
+
+func TestRequestValidation(t *testing.T) {
+	var received string
+	server := testServer(t, RESPONSES_OFF, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	for _, tc := range []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		expected models.ErrorResponse
+	}{
+		{"AllViolations", http.MethodPost, "/items", `{"id": "", "tags": ["a", "c", 1]}`, models.NewValidationErrorResponse([]models.FieldError{
+			{Field: "id", Message: "must not be empty"},
+			{Field: "tags[1]", Message: "must be one of a, b"},
+			{Field: "tags[2]", Message: "must be a string"},
+		})},
+		{"Required", http.MethodPost, "/items", `{}`, models.NewValidationErrorResponse([]models.FieldError{
+			{Field: "id", Message: "is required"},
+			{Field: "tags", Message: "is required"},
+		})},
+		{"InvalidJSON", http.MethodPost, "/items", `{`, models.NewErrorResponse(models.BAD_REQUEST, "request body is not valid JSON: unexpected end of JSON input")},
+		{"TooLarge", http.MethodPost, "/items", `{"id": "` + strings.Repeat("x", MAX_REQUEST_BODY) + `"}`, models.NewErrorResponse(models.BAD_REQUEST, fmt.Sprintf("request body is larger than %d bytes", MAX_REQUEST_BODY))},
+		{"MissingQuery", http.MethodGet, "/items", "", models.NewValidationErrorResponse([]models.FieldError{{Field: "limit", Message: "is required"}})},
+		{"WrongQuery", http.MethodGet, "/items?limit=ten", "", models.NewValidationErrorResponse([]models.FieldError{{Field: "limit", Message: "must be an integer"}})},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, server.URL+tc.path, strings.NewReader(tc.body))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response := errorResponse(t, resp)
+			if resp.StatusCode != http.StatusBadRequest || !reflect.DeepEqual(response, tc.expected) {
+				t.Fatalf("Expected 400 %+v, got %d %+v", tc.expected, resp.StatusCode, response)
+			}
+		})
+	}
+
+	// a valid body reaches the handler intact
+	body := `{"id": "i1", "tags": ["a"], "extra": 1}`
+	resp, err := http.Post(server.URL+"/items", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || received != body {
+		t.Fatalf("Expected the body to be passed on, got %d %q", resp.StatusCode, received)
+	}
+}
+
+func TestResponseValidation(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"id": 42}`))
+	}
+
+	resp, err := http.Get(testServer(t, RESPONSES_STRICT, handler).URL + "/items?limit=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := errorResponse(t, resp)
+	if resp.StatusCode != http.StatusInternalServerError || response.Detail.Code != models.FATAL_ERROR ||
+		!strings.HasSuffix(response.Detail.Message, "does not match openapi.yml: id: must be a string") {
+		t.Fatalf("Expected the drift to be reported, got %d %+v", resp.StatusCode, response)
+	}
+
+	resp, err = http.Get(testServer(t, RESPONSES_LOG, handler).URL + "/items?limit=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != `{"id": 42}` {
+		t.Fatalf("Expected the response to be sent unchanged, got %d %s", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,313 @@
+// Package openapi loads openapi.yml and checks HTTP traffic against it, so
+// the handlers and the published contract cannot drift apart unnoticed.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const JSON_CONTENT_TYPE = "application/json"
+
+// Spec is the part of an OpenAPI 3.0 document needed for validation.
+type Spec struct {
+	// Paths maps a path and an upper-case method to its operation.
+	Paths map[string]map[string]*Operation
+}
+
+type Operation struct {
+	Path        string
+	Method      string
+	Parameters  []Parameter
+	RequestBody *RequestBody
+	// Responses is keyed by status code ("200") or "default".
+	Responses map[string]*Response
+}
+
+type Parameter struct {
+	Name     string
+	In       string
+	Required bool
+	Schema   *Schema
+}
+
+type RequestBody struct {
+	Required bool
+	// Content maps a media type to the schema of the body, nil for any.
+	Content map[string]*Schema
+}
+
+type Response struct {
+	Content map[string]*Schema
+}
+
+type Schema struct {
+	Type                 string
+	Format               string
+	Enum                 []any
+	MinLength            int
+	Required             []string
+	Properties           map[string]*Schema
+	Items                *Schema
+	AdditionalProperties *Schema
+	Nullable             bool
+	ReadOnly             bool
+	WriteOnly            bool
+}
+
+// Load parses an OpenAPI document and resolves its local $refs.
+func Load(data []byte) (*Spec, error) {
+	document, err := parseYAML(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+	root, ok := document.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("document is not a mapping")
+	}
+
+	l := &loader{root: root, schemas: map[string]*Schema{}}
+	spec := &Spec{Paths: map[string]map[string]*Operation{}}
+	paths, err := l.mapping(root["paths"], "paths")
+	if err != nil {
+		return nil, err
+	}
+	for path, item := range paths {
+		operations, err := l.mapping(item, "paths."+path)
+		if err != nil {
+			return nil, err
+		}
+		spec.Paths[path] = map[string]*Operation{}
+		for method, node := range operations {
+			method = strings.ToUpper(method)
+			if !isMethod(method) {
+				continue
+			}
+			operation, err := l.operation(path, method, node)
+			if err != nil {
+				return nil, err
+			}
+			spec.Paths[path][method] = operation
+		}
+	}
+	return spec, nil
+}
+
+// Operation returns the operation for a request path and method, nil if the
+// spec does not describe it.
+func (s *Spec) Operation(method, path string) *Operation {
+	return s.Paths[path][method]
+}
+
+func isMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+type loader struct {
+	root    map[string]any
+	schemas map[string]*Schema
+}
+
+func (l *loader) mapping(node any, where string) (map[string]any, error) {
+	if node == nil {
+		return map[string]any{}, nil
+	}
+	mapping, ok := node.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected a mapping", where)
+	}
+	return mapping, nil
+}
+
+// resolve follows a {$ref: '#/...'} to the node it points to.
+func (l *loader) resolve(node any, where string) (any, error) {
+	mapping, ok := node.(map[string]any)
+	if !ok {
+		return node, nil
+	}
+	ref, ok := mapping["$ref"].(string)
+	if !ok {
+		return node, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("%s: only local $refs are supported, got %q", where, ref)
+	}
+	var current any = l.root
+	for _, part := range strings.Split(ref[2:], "/") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: unresolved $ref %q", where, ref)
+		}
+		if current, ok = m[part]; !ok {
+			return nil, fmt.Errorf("%s: unresolved $ref %q", where, ref)
+		}
+	}
+	return current, nil
+}
+
+func (l *loader) operation(path, method string, node any) (*Operation, error) {
+	where := method + " " + path
+	fields, err := l.mapping(node, where)
+	if err != nil {
+		return nil, err
+	}
+	operation := &Operation{Path: path, Method: method, Responses: map[string]*Response{}}
+
+	parameters, _ := fields["parameters"].([]any)
+	for i, item := range parameters {
+		parameter, err := l.parameter(item, fmt.Sprintf("%s parameters[%d]", where, i))
+		if err != nil {
+			return nil, err
+		}
+		operation.Parameters = append(operation.Parameters, parameter)
+	}
+
+	if fields["requestBody"] != nil {
+		body, err := l.resolve(fields["requestBody"], where+" requestBody")
+		if err != nil {
+			return nil, err
+		}
+		bodyFields, err := l.mapping(body, where+" requestBody")
+		if err != nil {
+			return nil, err
+		}
+		content, err := l.content(bodyFields["content"], where+" requestBody")
+		if err != nil {
+			return nil, err
+		}
+		required, _ := bodyFields["required"].(bool)
+		operation.RequestBody = &RequestBody{Required: required, Content: content}
+	}
+
+	responses, err := l.mapping(fields["responses"], where+" responses")
+	if err != nil {
+		return nil, err
+	}
+	for status, item := range responses {
+		response, err := l.resolve(item, where+" "+status)
+		if err != nil {
+			return nil, err
+		}
+		responseFields, err := l.mapping(response, where+" "+status)
+		if err != nil {
+			return nil, err
+		}
+		content, err := l.content(responseFields["content"], where+" "+status)
+		if err != nil {
+			return nil, err
+		}
+		operation.Responses[status] = &Response{Content: content}
+	}
+	return operation, nil
+}
+
+func (l *loader) parameter(node any, where string) (Parameter, error) {
+	node, err := l.resolve(node, where)
+	if err != nil {
+		return Parameter{}, err
+	}
+	fields, err := l.mapping(node, where)
+	if err != nil {
+		return Parameter{}, err
+	}
+	name, _ := fields["name"].(string)
+	in, _ := fields["in"].(string)
+	required, _ := fields["required"].(bool)
+	if name == "" || in == "" {
+		return Parameter{}, fmt.Errorf("%s: name and in are required", where)
+	}
+	schema, err := l.schema(fields["schema"], where+" "+name)
+	if err != nil {
+		return Parameter{}, err
+	}
+	return Parameter{Name: name, In: in, Required: required, Schema: schema}, nil
+}
+
+func (l *loader) content(node any, where string) (map[string]*Schema, error) {
+	media, err := l.mapping(node, where+" content")
+	if err != nil {
+		return nil, err
+	}
+	content := map[string]*Schema{}
+	for mediaType, item := range media {
+		fields, err := l.mapping(item, where+" "+mediaType)
+		if err != nil {
+			return nil, err
+		}
+		schema, err := l.schema(fields["schema"], where+" "+mediaType)
+		if err != nil {
+			return nil, err
+		}
+		content[mediaType] = schema
+	}
+	return content, nil
+}
+
+func (l *loader) schema(node any, where string) (*Schema, error) {
+	if node == nil {
+		return nil, nil
+	}
+	ref := ""
+	if mapping, ok := node.(map[string]any); ok {
+		ref, _ = mapping["$ref"].(string)
+		if schema, ok := l.schemas[ref]; ok && ref != "" {
+			return schema, nil
+		}
+	}
+	node, err := l.resolve(node, where)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := l.mapping(node, where)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := &Schema{}
+	if ref != "" {
+		// registered before the fields, so recursive schemas terminate
+		l.schemas[ref] = schema
+	}
+	schema.Type, _ = fields["type"].(string)
+	schema.Format, _ = fields["format"].(string)
+	schema.Nullable, _ = fields["nullable"].(bool)
+	schema.ReadOnly, _ = fields["readOnly"].(bool)
+	schema.WriteOnly, _ = fields["writeOnly"].(bool)
+	schema.Enum, _ = fields["enum"].([]any)
+	if minLength, ok := fields["minLength"].(float64); ok {
+		schema.MinLength = int(minLength)
+	}
+	required, _ := fields["required"].([]any)
+	for _, name := range required {
+		if name, ok := name.(string); ok {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	if fields["properties"] != nil {
+		properties, err := l.mapping(fields["properties"], where+" properties")
+		if err != nil {
+			return nil, err
+		}
+		schema.Properties = map[string]*Schema{}
+		for name, item := range properties {
+			if schema.Properties[name], err = l.schema(item, where+"."+name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if schema.Items, err = l.schema(fields["items"], where+"[]"); err != nil {
+		return nil, err
+	}
+	if additional, ok := fields["additionalProperties"].(map[string]any); ok {
+		if schema.AdditionalProperties, err = l.schema(additional, where+".*"); err != nil {
+			return nil, err
+		}
+	}
+	return schema, nil
+}
@@ -0,0 +1,195 @@
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Direction tells readOnly and writeOnly properties apart: a readOnly property
+// is only required in responses, a writeOnly one only in requests.
+type Direction int
+
+const (
+	REQUEST Direction = iota
+	RESPONSE
+)
+
+// Violation is one mismatch between a value and its schema. Field is the
+// path to the value, e.g. "members[1].user_id", empty for the value itself.
+type Violation struct {
+	Field   string
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Field == "" {
+		return v.Message
+	}
+	return v.Field + ": " + v.Message
+}
+
+// Validate checks a value decoded by encoding/json against the schema and
+// returns every violation found, sorted by field.
+func (s *Schema) Validate(value any, direction Direction) []Violation {
+	var violations []Violation
+	s.validate(value, "", direction, &violations)
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Field < violations[j].Field
+	})
+	return violations
+}
+
+func (s *Schema) validate(value any, field string, direction Direction, violations *[]Violation) {
+	if s == nil {
+		return
+	}
+	report := func(format string, args ...any) {
+		*violations = append(*violations, Violation{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if value == nil {
+		if !s.Nullable && s.Type != "" {
+			report("must not be null")
+		}
+		return
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			report("must be an object")
+			return
+		}
+		for _, name := range s.Required {
+			property := s.Properties[name]
+			if property != nil && ((property.ReadOnly && direction == REQUEST) || (property.WriteOnly && direction == RESPONSE)) {
+				continue
+			}
+			if _, ok := object[name]; !ok {
+				*violations = append(*violations, Violation{Field: joinField(field, name), Message: "is required"})
+			}
+		}
+		for name, item := range object {
+			if property, ok := s.Properties[name]; ok {
+				property.validate(item, joinField(field, name), direction, violations)
+			} else {
+				s.AdditionalProperties.validate(item, joinField(field, name), direction, violations)
+			}
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			report("must be an array")
+			return
+		}
+		for i, item := range array {
+			s.Items.validate(item, fmt.Sprintf("%s[%d]", field, i), direction, violations)
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			report("must be a string")
+			return
+		}
+		if s.MinLength > 0 && utf8.RuneCountInString(text) < s.MinLength {
+			if s.MinLength == 1 {
+				report("must not be empty")
+			} else {
+				report("must be at least %d characters", s.MinLength)
+			}
+			return
+		}
+		if err := checkFormat(s.Format, text); err != nil {
+			report("%v", err)
+			return
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) {
+			report("must be an integer")
+			return
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			report("must be a number")
+			return
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			report("must be a boolean")
+			return
+		}
+	}
+
+	if len(s.Enum) > 0 && !contains(s.Enum, value) {
+		report("must be one of %s", formatEnum(s.Enum))
+	}
+}
+
+func joinField(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	if name == "" {
+		return parent
+	}
+	return parent + "." + name
+}
+
+func checkFormat(format, text string) error {
+	switch format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, text); err != nil {
+			return fmt.Errorf("must be an RFC 3339 date-time")
+		}
+	case "uri":
+		if u, err := url.Parse(text); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("must be an absolute URI")
+		}
+	}
+	return nil
+}
+
+func contains(enum []any, value any) bool {
+	for _, item := range enum {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func formatEnum(enum []any) string {
+	items := make([]string, len(enum))
+	for i, item := range enum {
+		items[i] = fmt.Sprint(item)
+	}
+	return strings.Join(items, ", ")
+}
+
+// parseParameter converts a query string value to the JSON type of its
+// schema, so it can be validated like a body field.
+func parseParameter(schema *Schema, raw string) (any, bool) {
+	if schema == nil {
+		return raw, true
+	}
+	switch schema.Type {
+	case "integer":
+		n, err := strconv.ParseInt(raw, 10, 64)
+		return float64(n), err == nil
+	case "number":
+		n, err := strconv.ParseFloat(raw, 64)
+		return n, err == nil
+	case "boolean":
+		b, err := strconv.ParseBool(raw)
+		return b, err == nil
+	}
+	return raw, true
+}
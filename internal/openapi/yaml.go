@@ -0,0 +1,71 @@
+package openapi
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseYAML parses a YAML document into the values encoding/json produces:
+// mappings become map[string]any, sequences []any, numbers float64 and any
+// other scalar, a date for example, its text. Decoded JSON can then be
+// compared with values from the spec.
+func parseYAML(data []byte) (any, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 {
+		return nil, nil
+	}
+	return jsonValue(document.Content[0])
+}
+
+func jsonValue(node *yaml.Node) (any, error) {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return jsonValue(node.Alias)
+	case yaml.MappingNode:
+		mapping := make(map[string]any, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if _, ok := mapping[key.Value]; ok {
+				return nil, fmt.Errorf("line %d: duplicate key %q", key.Line, key.Value)
+			}
+			value, err := jsonValue(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			mapping[key.Value] = value
+		}
+		return mapping, nil
+	case yaml.SequenceNode:
+		sequence := make([]any, 0, len(node.Content))
+		for _, item := range node.Content {
+			value, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			sequence = append(sequence, value)
+		}
+		return sequence, nil
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!null":
+			return nil, nil
+		case "!!bool":
+			var b bool
+			err := node.Decode(&b)
+			return b, err
+		case "!!int", "!!float":
+			var f float64
+			if err := node.Decode(&f); err != nil {
+				return strconv.ParseFloat(node.Value, 64)
+			}
+			return f, nil
+		}
+		return node.Value, nil
+	}
+	return nil, fmt.Errorf("line %d: unexpected YAML node", node.Line)
+}
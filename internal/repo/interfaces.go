@@ -1,6 +1,11 @@
 package repo
 
-import "github.com/Dowtai/pr-reviewer-service/internal/models"
+import (
+	"context"
+	"errors"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
 
 type Repo interface {
 	TeamExists(teamName string) bool
@@ -13,7 +18,76 @@ type Repo interface {
 	UpdatePR(pr *models.PullRequest) error
 	CreateUser(user models.User) error
 	CreateTeam(team models.Team) error
+	UpdateTeam(team models.Team) error
 	CreatePR(pr models.PullRequest) error
+	// CreateIndexedPR atomically stores a new pull request and adds it to
+	// the review index of each of its reviewers. Nothing is stored when the
+	// pull request exists already or a reviewer does not.
+	CreateIndexedPR(pr models.PullRequest) error
 	AddPRToUser(userId string, prId string) error
 	RemovePRFromUser(userId string, prId string) error
+	// ModifyPR atomically applies modify to a copy of the pull request and
+	// stores it, moving the reviewers it added or removed in the review
+	// index as well. Nothing is stored when modify fails; an unknown pull
+	// request returns nil without calling modify.
+	ModifyPR(prId string, modify func(pr *models.PullRequest) error) (*models.PullRequest, error)
+	// ModifyTeam is ModifyPR for teams.
+	ModifyTeam(teamName string, modify func(team *models.Team) error) (*models.Team, error)
+
+	GetTeams() []models.Team
+	GetUsers() []models.User
+	GetPullRequests() []models.PullRequest
+	// GetReviewIndex returns the raw user_id -> pull_request_ids index,
+	// entries may point to missing users or pull requests.
+	GetReviewIndex() map[string][]string
+	AddTeamMember(teamName string, member models.TeamMember) error
+	DeleteReviewIndexEntry(userId string, prId string) error
+}
+
+// HealthChecker can optionally be implemented by a Repo to report whether
+// the storage backend is usable; it is used by the readiness probe.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// AuditRepo is an append-only store of audit events.
+type AuditRepo interface {
+	AppendAuditEvent(event models.AuditEvent) (models.AuditEvent, error)
+	GetAuditEvents(filter models.AuditFilter) []models.AuditEvent
+}
+
+// EventRepo is an append-only stream of pull request lifecycle events.
+// Events of one pull request are returned in the order they were appended.
+type EventRepo interface {
+	AppendPullRequestEvents(events ...models.PullRequestEvent) ([]models.PullRequestEvent, error)
+	GetPullRequestEvents(prId string) []models.PullRequestEvent
+	GetAllPullRequestEvents() []models.PullRequestEvent
+}
+
+type WebhookRepo interface {
+	CreateSubscription(subscription models.WebhookSubscription) error
+	DeleteSubscription(subscriptionId string) error
+	GetSubscriptions() []models.WebhookSubscription
+	AppendDelivery(delivery models.WebhookDelivery) error
+	GetDeliveries(subscriptionId string) []models.WebhookDelivery
+}
+
+// Store is the storage of one tenant.
+type Store struct {
+	Repo      Repo
+	AuditRepo AuditRepo
+	EventRepo EventRepo
+}
+
+// ErrTenantExists is returned by CreateTenant for a taken tenant id.
+var ErrTenantExists = errors.New("tenant already exists")
+
+// TenantRepo keeps the tenants and a separate Store for each of them.
+// models.DEFAULT_TENANT always exists.
+type TenantRepo interface {
+	CreateTenant(tenant models.Tenant) error
+	GetTenant(tenantId string) *models.Tenant
+	GetTenants() []models.Tenant
+	// Store returns the storage of a tenant, nil for an unknown one.
+	Store(tenantId string) *Store
 }
@@ -0,0 +1,40 @@
+package memory_repo
+
+import (
+	"sync"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+type MemoryAuditRepo struct {
+	mx     sync.RWMutex
+	events []models.AuditEvent
+}
+
+func NewMemoryAuditRepo() *MemoryAuditRepo {
+	return &MemoryAuditRepo{
+		events: make([]models.AuditEvent, 0),
+	}
+}
+
+func (r *MemoryAuditRepo) AppendAuditEvent(event models.AuditEvent) (models.AuditEvent, error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	event.Id = int64(len(r.events) + 1)
+	r.events = append(r.events, event)
+	return event, nil
+}
+
+func (r *MemoryAuditRepo) GetAuditEvents(filter models.AuditFilter) []models.AuditEvent {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	events := make([]models.AuditEvent, 0)
+	for i := range r.events {
+		if filter.Match(&r.events[i]) {
+			events = append(events, r.events[i])
+		}
+	}
+	return events
+}
@@ -0,0 +1,54 @@
+package memory_repo
+
+import (
+	"sync"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+type MemoryEventRepo struct {
+	mx       sync.RWMutex
+	events   []models.PullRequestEvent
+	eventsBy map[string][]int
+}
+
+func NewMemoryEventRepo() *MemoryEventRepo {
+	return &MemoryEventRepo{
+		events:   make([]models.PullRequestEvent, 0),
+		eventsBy: make(map[string][]int),
+	}
+}
+
+func (r *MemoryEventRepo) AppendPullRequestEvents(events ...models.PullRequestEvent) ([]models.PullRequestEvent, error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	appended := make([]models.PullRequestEvent, 0, len(events))
+	for _, event := range events {
+		event.Seq = int64(len(r.events) + 1)
+		r.eventsBy[event.PullRequestId] = append(r.eventsBy[event.PullRequestId], len(r.events))
+		r.events = append(r.events, event)
+		appended = append(appended, event)
+	}
+	return appended, nil
+}
+
+func (r *MemoryEventRepo) GetPullRequestEvents(prId string) []models.PullRequestEvent {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	events := make([]models.PullRequestEvent, 0, len(r.eventsBy[prId]))
+	for _, i := range r.eventsBy[prId] {
+		events = append(events, r.events[i])
+	}
+	return events
+}
+
+func (r *MemoryEventRepo) GetAllPullRequestEvents() []models.PullRequestEvent {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	events := make([]models.PullRequestEvent, len(r.events))
+	copy(events, r.events)
+	return events
+}
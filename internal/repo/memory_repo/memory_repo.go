@@ -1,114 +1,158 @@
 package memory_repo
 
 import (
+	"context"
 	"errors"
-	"sync"
+	"maps"
+	"slices"
 
 	"github.com/Dowtai/pr-reviewer-service/internal/models"
 )
 
+// MemoryRepo keeps every map in shards with their own locks. Stored entities
+// are copied on the way in and out, callers never share slices or maps with
+// the store.
+//
+// Methods that hold a shard lock while taking another take them in the
+// order prs, teams, users, prsByUser, so they cannot deadlock.
 type MemoryRepo struct {
-	mx        sync.RWMutex
-	teams     map[string]models.Team
-	users     map[string]models.User
-	prs       map[string]models.PullRequest
-	prsByUser map[string]map[string]struct{}
+	teams     *shardedMap[models.Team]
+	users     *shardedMap[models.User]
+	prs       *shardedMap[models.PullRequest]
+	prsByUser *shardedMap[map[string]struct{}]
 }
 
 func NewMemoryRepo() *MemoryRepo {
 	return &MemoryRepo{
-		teams:     make(map[string]models.Team),
-		users:     make(map[string]models.User),
-		prs:       make(map[string]models.PullRequest),
-		prsByUser: make(map[string]map[string]struct{}),
+		teams:     newShardedMap[models.Team](),
+		users:     newShardedMap[models.User](),
+		prs:       newShardedMap[models.PullRequest](),
+		prsByUser: newShardedMap[map[string]struct{}](),
 	}
 }
 
-func (r *MemoryRepo) TeamExists(teamName string) bool {
-	r.mx.RLock()
-	defer r.mx.RUnlock()
+func cloneTeam(team models.Team) models.Team {
+	team.Members = slices.Clone(team.Members)
+	if team.Policy != nil {
+		policy := *team.Policy
+		team.Policy = &policy
+	}
+	return team
+}
 
-	_, ok := r.teams[teamName]
-	return ok
+func cloneUser(user models.User) models.User {
+	user.Teams = slices.Clone(user.Teams)
+	return user
 }
 
-func (r *MemoryRepo) GetTeamByName(teamName string) *models.Team {
-	r.mx.RLock()
-	defer r.mx.RUnlock()
+func clonePR(pr models.PullRequest) models.PullRequest {
+	pr.AssignedReviewers = slices.Clone(pr.AssignedReviewers)
+	pr.AssignedAt = maps.Clone(pr.AssignedAt)
+	if pr.Policy != nil {
+		policy := *pr.Policy
+		policy.Violations = slices.Clone(policy.Violations)
+		pr.Policy = &policy
+	}
+	return pr
+}
 
-	if team, ok := r.teams[teamName]; ok {
+// HealthCheck makes sure every store lock can be taken in time,
+// a stuck writer would otherwise block every request.
+func (r *MemoryRepo) HealthCheck(ctx context.Context) error {
+	if !r.prs.lockable(ctx) || !r.teams.lockable(ctx) || !r.users.lockable(ctx) || !r.prsByUser.lockable(ctx) {
+		return errors.New("memory repo lock is not available")
+	}
+	return nil
+}
+
+func (r *MemoryRepo) TeamExists(teamName string) bool {
+	return r.teams.has(teamName)
+}
+
+func (r *MemoryRepo) GetTeamByName(teamName string) *models.Team {
+	if team, ok := r.teams.get(teamName); ok {
+		team = cloneTeam(team)
 		return &team
 	}
 	return nil
 }
 
 func (r *MemoryRepo) GetUserById(userId string) *models.User {
-	r.mx.RLock()
-	defer r.mx.RUnlock()
-
-	if user, ok := r.users[userId]; ok {
+	if user, ok := r.users.get(userId); ok {
+		user = cloneUser(user)
 		return &user
 	}
 	return nil
 }
 
 func (r *MemoryRepo) GetPullRequestById(prId string) *models.PullRequest {
-	r.mx.RLock()
-	defer r.mx.RUnlock()
-
-	if pr, ok := r.prs[prId]; ok {
+	if pr, ok := r.prs.get(prId); ok {
+		pr = clonePR(pr)
 		return &pr
 	}
 	return nil
 }
 
 func (r *MemoryRepo) GetPullRequestsByUserId(userId string) []*models.PullRequest {
-	r.mx.RLock()
-	defer r.mx.RUnlock()
-
-	if prs, ok := r.prsByUser[userId]; ok {
-		prModels := make([]*models.PullRequest, len(prs))
-		i := 0
-		for pr, _ := range prs {
-			prModels[i] = r.GetPullRequestById(pr)
-			if prModels[i] == nil {
-				return nil
-			}
-			i++
+	sh := r.prsByUser.shard(userId)
+	sh.mx.RLock()
+	prIds := slices.Collect(maps.Keys(sh.items[userId]))
+	indexed := sh.items[userId] != nil
+	sh.mx.RUnlock()
+	if !indexed {
+		return nil
+	}
+
+	prModels := make([]*models.PullRequest, 0, len(prIds))
+	for _, prId := range prIds {
+		// dangling index entries are reported by the consistency checker
+		if pr, ok := r.prs.get(prId); ok {
+			pr = clonePR(pr)
+			prModels = append(prModels, &pr)
 		}
-		return prModels
 	}
-	return nil
+	return prModels
 }
 
 func (r *MemoryRepo) UpdateUser(user *models.User) error {
-	r.mx.Lock()
-	defer r.mx.Unlock()
+	sh := r.users.shard(user.UserId)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
 
-	if _, ok := r.users[user.UserId]; !ok {
+	if _, ok := sh.items[user.UserId]; !ok {
 		return errors.New("updating non-existing user")
 	}
 
-	r.users[user.UserId] = *user
+	sh.items[user.UserId] = cloneUser(*user)
 	return nil
 }
 
 func (r *MemoryRepo) UpdateTeamMember(team *models.Team, user *models.User) error {
-	r.mx.Lock()
-	defer r.mx.Unlock()
-
-	if _, ok := r.users[user.UserId]; !ok {
+	teamShard := r.teams.shard(team.TeamName)
+	teamShard.mx.Lock()
+	defer teamShard.mx.Unlock()
+	userShard := r.users.shard(user.UserId)
+	userShard.mx.Lock()
+	defer userShard.mx.Unlock()
+
+	if _, ok := userShard.items[user.UserId]; !ok {
 		return errors.New("updating non-existing user")
 	}
 
-	if _, ok := r.teams[team.TeamName]; !ok {
+	stored, ok := teamShard.items[team.TeamName]
+	if !ok {
 		return errors.New("updating non-existing team")
 	}
 
-	for i, member := range r.teams[team.TeamName].Members {
+	for i, member := range stored.Members {
 		if member.UserId == user.UserId {
-			r.users[user.UserId] = *user
-			r.teams[team.TeamName].Members[i] = models.NewTeamMember(user)
+			userShard.items[user.UserId] = cloneUser(*user)
+			updated := models.NewTeamMember(user)
+			updated.Role = member.Role
+			// readers may still hold the old members, never write into them
+			stored.Members = slices.Clone(stored.Members)
+			stored.Members[i] = updated
+			teamShard.items[team.TeamName] = stored
 			return nil
 		}
 	}
@@ -116,87 +160,269 @@ func (r *MemoryRepo) UpdateTeamMember(team *models.Team, user *models.User) erro
 }
 
 func (r *MemoryRepo) UpdatePR(pr *models.PullRequest) error {
-	r.mx.Lock()
-	defer r.mx.Unlock()
+	sh := r.prs.shard(pr.PullRequestId)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
 
-	if _, ok := r.prs[pr.PullRequestId]; !ok {
+	if _, ok := sh.items[pr.PullRequestId]; !ok {
 		return errors.New("updating non-existing pull_request")
 	}
 
-	r.prs[pr.PullRequestId] = *pr
+	sh.items[pr.PullRequestId] = clonePR(*pr)
 	return nil
 }
 
+// ModifyPR calls modify with a copy of the stored pull request and stores
+// the result, adding and removing the reviewers it changed in the review
+// index. The pull request is locked meanwhile, concurrent writers of it
+// wait and readers see either the old or the new version.
+func (r *MemoryRepo) ModifyPR(prId string, modify func(pr *models.PullRequest) error) (*models.PullRequest, error) {
+	sh := r.prs.shard(prId)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+
+	stored, ok := sh.items[prId]
+	if !ok {
+		return nil, nil
+	}
+	pr := clonePR(stored)
+	if err := modify(&pr); err != nil {
+		return nil, err
+	}
+	if pr.PullRequestId != prId {
+		return nil, errors.New("modify changed the pull_request id")
+	}
+
+	added := slices.DeleteFunc(slices.Clone(pr.AssignedReviewers), func(userId string) bool {
+		return slices.Contains(stored.AssignedReviewers, userId)
+	})
+	removed := slices.DeleteFunc(slices.Clone(stored.AssignedReviewers), func(userId string) bool {
+		return slices.Contains(pr.AssignedReviewers, userId)
+	})
+	for _, userId := range added {
+		if !r.users.has(userId) {
+			return nil, errors.New("adding pr to non-existing user")
+		}
+	}
+
+	sh.items[prId] = clonePR(pr)
+	for _, userId := range removed {
+		r.unindex(userId, prId)
+	}
+	for _, userId := range added {
+		r.index(userId, prId)
+	}
+	return &pr, nil
+}
+
+func (r *MemoryRepo) index(userId string, prId string) {
+	sh := r.prsByUser.shard(userId)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+
+	if sh.items[userId] == nil {
+		sh.items[userId] = make(map[string]struct{})
+	}
+	sh.items[userId][prId] = struct{}{}
+}
+
+// unindex reports whether the entry existed.
+func (r *MemoryRepo) unindex(userId string, prId string) bool {
+	sh := r.prsByUser.shard(userId)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+
+	if _, ok := sh.items[userId][prId]; !ok {
+		return false
+	}
+	delete(sh.items[userId], prId)
+	return true
+}
+
 func (r *MemoryRepo) CreateUser(user models.User) error {
-	r.mx.Lock()
-	defer r.mx.Unlock()
+	sh := r.users.shard(user.UserId)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
 
-	if _, ok := r.users[user.UserId]; ok {
+	if _, ok := sh.items[user.UserId]; ok {
 		return errors.New("creating already existing user")
 	}
 
-	r.users[user.UserId] = user
+	sh.items[user.UserId] = cloneUser(user)
 	return nil
 }
 
 func (r *MemoryRepo) CreateTeam(team models.Team) error {
-	r.mx.Lock()
-	defer r.mx.Unlock()
+	sh := r.teams.shard(team.TeamName)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
 
-	if _, ok := r.teams[team.TeamName]; ok {
+	if _, ok := sh.items[team.TeamName]; ok {
 		return errors.New("creating already existing team")
 	}
 
-	r.teams[team.TeamName] = team
+	sh.items[team.TeamName] = cloneTeam(team)
 	return nil
 }
 
+func (r *MemoryRepo) UpdateTeam(team models.Team) error {
+	sh := r.teams.shard(team.TeamName)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+
+	if _, ok := sh.items[team.TeamName]; !ok {
+		return errors.New("updating non-existing team")
+	}
+
+	sh.items[team.TeamName] = cloneTeam(team)
+	return nil
+}
+
+// ModifyTeam is ModifyPR for teams, there is no index to keep up.
+func (r *MemoryRepo) ModifyTeam(teamName string, modify func(team *models.Team) error) (*models.Team, error) {
+	sh := r.teams.shard(teamName)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+
+	stored, ok := sh.items[teamName]
+	if !ok {
+		return nil, nil
+	}
+	team := cloneTeam(stored)
+	if err := modify(&team); err != nil {
+		return nil, err
+	}
+	if team.TeamName != teamName {
+		return nil, errors.New("modify changed the team name")
+	}
+
+	sh.items[teamName] = cloneTeam(team)
+	return &team, nil
+}
+
 func (r *MemoryRepo) CreatePR(pr models.PullRequest) error {
-	r.mx.Lock()
-	defer r.mx.Unlock()
+	sh := r.prs.shard(pr.PullRequestId)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
 
-	if _, ok := r.prs[pr.PullRequestId]; ok {
+	if _, ok := sh.items[pr.PullRequestId]; ok {
 		return errors.New("creating already existing pr")
 	}
 
-	r.prs[pr.PullRequestId] = pr
+	sh.items[pr.PullRequestId] = clonePR(pr)
 	return nil
 }
 
-func (r *MemoryRepo) AddPRToUser(userId string, prId string) error {
-	r.mx.Lock()
-	defer r.mx.Unlock()
+func (r *MemoryRepo) CreateIndexedPR(pr models.PullRequest) error {
+	sh := r.prs.shard(pr.PullRequestId)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
 
-	if _, ok := r.users[userId]; !ok {
-		return errors.New("adding pr to non-existing user")
+	if _, ok := sh.items[pr.PullRequestId]; ok {
+		return errors.New("creating already existing pr")
 	}
-	if _, ok := r.prs[prId]; !ok {
-		return errors.New("adding non-existing pr to user")
+	for _, userId := range pr.AssignedReviewers {
+		if !r.users.has(userId) {
+			return errors.New("adding pr to non-existing user")
+		}
 	}
 
-	if r.prsByUser[userId] == nil {
-		r.prsByUser[userId] = make(map[string]struct{})
+	sh.items[pr.PullRequestId] = clonePR(pr)
+	for _, userId := range pr.AssignedReviewers {
+		r.index(userId, pr.PullRequestId)
 	}
+	return nil
+}
 
-	r.prsByUser[userId][prId] = struct{}{}
+func (r *MemoryRepo) AddPRToUser(userId string, prId string) error {
+	if !r.users.has(userId) {
+		return errors.New("adding pr to non-existing user")
+	}
+	if !r.prs.has(prId) {
+		return errors.New("adding non-existing pr to user")
+	}
+
+	r.index(userId, prId)
 	return nil
 }
 
 func (r *MemoryRepo) RemovePRFromUser(userId string, prId string) error {
-	r.mx.Lock()
-	defer r.mx.Unlock()
-
-	if _, ok := r.users[userId]; !ok {
+	if !r.users.has(userId) {
 		return errors.New("removing pr from non-existing user")
 	}
-	if _, ok := r.prs[prId]; !ok {
+	if !r.prs.has(prId) {
 		return errors.New("removing non-existing pr from user")
 	}
 
-	if r.prsByUser[userId] == nil {
+	sh := r.prsByUser.shard(userId)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+
+	if sh.items[userId] == nil {
 		return errors.New("user is not reviewer of this pr")
 	}
 
-	delete(r.prsByUser[userId], prId)
+	delete(sh.items[userId], prId)
+	return nil
+}
+
+func (r *MemoryRepo) GetTeams() []models.Team {
+	teams := make([]models.Team, 0, r.teams.len())
+	r.teams.each(func(_ string, team models.Team) {
+		teams = append(teams, cloneTeam(team))
+	})
+	return teams
+}
+
+func (r *MemoryRepo) GetUsers() []models.User {
+	users := make([]models.User, 0, r.users.len())
+	r.users.each(func(_ string, user models.User) {
+		users = append(users, cloneUser(user))
+	})
+	return users
+}
+
+func (r *MemoryRepo) GetPullRequests() []models.PullRequest {
+	prs := make([]models.PullRequest, 0, r.prs.len())
+	r.prs.each(func(_ string, pr models.PullRequest) {
+		prs = append(prs, clonePR(pr))
+	})
+	return prs
+}
+
+func (r *MemoryRepo) GetReviewIndex() map[string][]string {
+	index := make(map[string][]string)
+	r.prsByUser.each(func(userId string, prs map[string]struct{}) {
+		for prId := range prs {
+			index[userId] = append(index[userId], prId)
+		}
+	})
+	return index
+}
+
+func (r *MemoryRepo) AddTeamMember(teamName string, member models.TeamMember) error {
+	sh := r.teams.shard(teamName)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+
+	team, ok := sh.items[teamName]
+	if !ok {
+		return errors.New("adding member to non-existing team")
+	}
+	for _, m := range team.Members {
+		if m.UserId == member.UserId {
+			return errors.New("user is already member of team")
+		}
+	}
+
+	team.Members = append(slices.Clone(team.Members), member)
+	sh.items[teamName] = team
+	return nil
+}
+
+func (r *MemoryRepo) DeleteReviewIndexEntry(userId string, prId string) error {
+	if !r.unindex(userId, prId) {
+		return errors.New("deleting non-existing index entry")
+	}
 	return nil
 }
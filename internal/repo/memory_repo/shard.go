@@ -0,0 +1,99 @@
+package memory_repo
+
+import (
+	"context"
+	"sync"
+)
+
+// SHARD_COUNT is how many independently locked parts every map of
+// MemoryRepo is split into, so writes to different entities rarely wait for
+// each other.
+const SHARD_COUNT = 32
+
+type shard[V any] struct {
+	mx    sync.RWMutex
+	items map[string]V
+}
+
+// shardedMap spreads its keys over SHARD_COUNT maps, each with its own lock.
+// Operations that need several keys at once lock the shards one by one, see
+// MemoryRepo for the lock order.
+type shardedMap[V any] struct {
+	shards [SHARD_COUNT]shard[V]
+}
+
+func newShardedMap[V any]() *shardedMap[V] {
+	m := &shardedMap[V]{}
+	for i := range m.shards {
+		m.shards[i].items = make(map[string]V)
+	}
+	return m
+}
+
+// shard returns the part holding key, picked by the FNV-1a hash of the key.
+func (m *shardedMap[V]) shard(key string) *shard[V] {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return &m.shards[hash%SHARD_COUNT]
+}
+
+func (m *shardedMap[V]) get(key string) (V, bool) {
+	sh := m.shard(key)
+	sh.mx.RLock()
+	defer sh.mx.RUnlock()
+
+	value, ok := sh.items[key]
+	return value, ok
+}
+
+func (m *shardedMap[V]) has(key string) bool {
+	_, ok := m.get(key)
+	return ok
+}
+
+// each calls fn for every item, one shard locked at a time. The items are
+// not a snapshot of a single moment.
+func (m *shardedMap[V]) each(fn func(key string, value V)) {
+	for i := range m.shards {
+		sh := &m.shards[i]
+		sh.mx.RLock()
+		for key, value := range sh.items {
+			fn(key, value)
+		}
+		sh.mx.RUnlock()
+	}
+}
+
+func (m *shardedMap[V]) len() int {
+	n := 0
+	for i := range m.shards {
+		sh := &m.shards[i]
+		sh.mx.RLock()
+		n += len(sh.items)
+		sh.mx.RUnlock()
+	}
+	return n
+}
+
+// lockable waits for every shard lock in turn, a shard held for too long
+// makes ctx expire first.
+func (m *shardedMap[V]) lockable(ctx context.Context) bool {
+	locked := make(chan struct{})
+	go func() {
+		for i := range m.shards {
+			m.shards[i].mx.RLock()
+			m.shards[i].mx.RUnlock()
+		}
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,100 @@
+package memory_repo
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/clock"
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/repo"
+)
+
+type MemoryTenantRepo struct {
+	mx      sync.RWMutex
+	tenants map[string]models.Tenant
+	order   []string
+	stores  map[string]*repo.Store
+}
+
+// NewMemoryTenantRepo starts with models.DEFAULT_TENANT backed by
+// defaultStore and created at the current time of clock, tenants created
+// later get a new in-memory store.
+func NewMemoryTenantRepo(defaultStore repo.Store, clock clock.Clock) *MemoryTenantRepo {
+	return &MemoryTenantRepo{
+		tenants: map[string]models.Tenant{
+			models.DEFAULT_TENANT: {TenantId: models.DEFAULT_TENANT, Name: "Default", CreatedAt: clock.Now()},
+		},
+		order:  []string{models.DEFAULT_TENANT},
+		stores: map[string]*repo.Store{models.DEFAULT_TENANT: &defaultStore},
+	}
+}
+
+func NewMemoryStore() repo.Store {
+	return repo.Store{
+		Repo:      NewMemoryRepo(),
+		AuditRepo: NewMemoryAuditRepo(),
+		EventRepo: NewMemoryEventRepo(),
+	}
+}
+
+// HealthCheck checks the stores that can report their health.
+func (r *MemoryTenantRepo) HealthCheck(ctx context.Context) error {
+	r.mx.RLock()
+	stores := make([]*repo.Store, 0, len(r.stores))
+	for _, store := range r.stores {
+		stores = append(stores, store)
+	}
+	r.mx.RUnlock()
+
+	for _, store := range stores {
+		if checker, ok := store.Repo.(repo.HealthChecker); ok {
+			if err := checker.HealthCheck(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *MemoryTenantRepo) CreateTenant(tenant models.Tenant) error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if _, ok := r.tenants[tenant.TenantId]; ok {
+		return repo.ErrTenantExists
+	}
+
+	store := NewMemoryStore()
+	r.tenants[tenant.TenantId] = tenant
+	r.order = append(r.order, tenant.TenantId)
+	r.stores[tenant.TenantId] = &store
+	return nil
+}
+
+func (r *MemoryTenantRepo) GetTenant(tenantId string) *models.Tenant {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	if tenant, ok := r.tenants[tenantId]; ok {
+		return &tenant
+	}
+	return nil
+}
+
+func (r *MemoryTenantRepo) GetTenants() []models.Tenant {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	tenants := make([]models.Tenant, 0, len(r.order))
+	for _, id := range r.order {
+		tenants = append(tenants, r.tenants[id])
+	}
+	return tenants
+}
+
+func (r *MemoryTenantRepo) Store(tenantId string) *repo.Store {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	return r.stores[tenantId]
+}
@@ -0,0 +1,99 @@
+package memory_repo
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+// DEFAULT_DELIVERY_LIMIT is how many attempts the delivery log keeps per
+// subscription.
+const DEFAULT_DELIVERY_LIMIT = 1000
+
+// MemoryWebhookRepo keeps the last deliveryLimit attempts of each
+// subscription, older ones are dropped. The log of a subscription is removed
+// with it.
+type MemoryWebhookRepo struct {
+	mx            sync.RWMutex
+	subscriptions map[string]models.WebhookSubscription
+	order         []string
+	deliveries    map[string][]models.WebhookDelivery
+	deliveryLimit int
+}
+
+// NewMemoryWebhookRepo keeps deliveryLimit attempts per subscription, it must
+// be positive.
+func NewMemoryWebhookRepo(deliveryLimit int) *MemoryWebhookRepo {
+	return &MemoryWebhookRepo{
+		subscriptions: make(map[string]models.WebhookSubscription),
+		order:         make([]string, 0),
+		deliveries:    make(map[string][]models.WebhookDelivery),
+		deliveryLimit: deliveryLimit,
+	}
+}
+
+func (r *MemoryWebhookRepo) CreateSubscription(subscription models.WebhookSubscription) error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if _, ok := r.subscriptions[subscription.Id]; ok {
+		return errors.New("creating already existing subscription")
+	}
+
+	r.subscriptions[subscription.Id] = subscription
+	r.order = append(r.order, subscription.Id)
+	return nil
+}
+
+func (r *MemoryWebhookRepo) DeleteSubscription(subscriptionId string) error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if _, ok := r.subscriptions[subscriptionId]; !ok {
+		return errors.New("deleting non-existing subscription")
+	}
+
+	delete(r.subscriptions, subscriptionId)
+	delete(r.deliveries, subscriptionId)
+	for i, id := range r.order {
+		if id == subscriptionId {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (r *MemoryWebhookRepo) GetSubscriptions() []models.WebhookSubscription {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	subscriptions := make([]models.WebhookSubscription, 0, len(r.order))
+	for _, id := range r.order {
+		subscriptions = append(subscriptions, r.subscriptions[id])
+	}
+	return subscriptions
+}
+
+func (r *MemoryWebhookRepo) AppendDelivery(delivery models.WebhookDelivery) error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	deliveries := r.deliveries[delivery.SubscriptionId]
+	if len(deliveries) >= r.deliveryLimit {
+		n := copy(deliveries, deliveries[len(deliveries)-r.deliveryLimit+1:])
+		deliveries = deliveries[:n]
+	}
+	r.deliveries[delivery.SubscriptionId] = append(deliveries, delivery)
+	return nil
+}
+
+func (r *MemoryWebhookRepo) GetDeliveries(subscriptionId string) []models.WebhookDelivery {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	deliveries := make([]models.WebhookDelivery, len(r.deliveries[subscriptionId]))
+	copy(deliveries, r.deliveries[subscriptionId])
+	return deliveries
+}
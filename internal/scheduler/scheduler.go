@@ -0,0 +1,76 @@
+// Package scheduler runs the periodic jobs of the service, such as the SLA
+// checks, in the background of the server process.
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/clock"
+)
+
+// Job is run every Interval until the scheduler is closed, with the time of
+// the tick. A failed run is logged and retried on the next tick.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context, now time.Time) error
+}
+
+// Scheduler runs its jobs on their own tickers, one run of a job at a time.
+type Scheduler struct {
+	clock clock.Clock
+	jobs  []Job
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(clock clock.Clock) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{clock: clock, ctx: ctx, cancel: cancel}
+}
+
+// Add registers a job, it is not safe to call after Start. Jobs without a
+// positive interval are disabled.
+func (s *Scheduler) Add(job Job) {
+	if job.Interval > 0 {
+		s.jobs = append(s.jobs, job)
+	}
+}
+
+// Start runs every job in its own goroutine. The tickers are created before
+// Start returns, so a tick of the clock right after it is not lost.
+func (s *Scheduler) Start() {
+	for _, job := range s.jobs {
+		ticker := s.clock.NewTicker(job.Interval)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer ticker.Stop()
+			s.loop(job, ticker)
+		}()
+	}
+}
+
+// Close stops the jobs and waits for the running ones to return.
+func (s *Scheduler) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(job Job, ticker clock.Ticker) {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-ticker.C():
+			if err := job.Run(s.ctx, now); err != nil && s.ctx.Err() == nil {
+				log.Printf("Scheduled job %s failed: %v", job.Name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/clock"
+)
+
+func TestSchedulerRunsOnTicks(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	runs := make(chan time.Time)
+
+	s := New(fake)
+	s.Add(Job{Name: "tick", Interval: time.Minute, Run: func(ctx context.Context, now time.Time) error {
+		select {
+		case runs <- now:
+		case <-ctx.Done():
+		}
+		return errors.New("failures are only logged")
+	}})
+	s.Add(Job{Name: "disabled", Run: func(context.Context, time.Time) error {
+		t.Error("Expected a job without an interval not to run")
+		return nil
+	}})
+	s.Start()
+
+	fake.Advance(30 * time.Second)
+	select {
+	case now := <-runs:
+		t.Fatalf("Expected no run before the interval, got one at %v", now)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	for i := 1; i <= 2; i++ {
+		fake.Advance(time.Minute)
+		select {
+		case now := <-runs:
+			if expected := start.Add(time.Duration(i) * time.Minute); !now.Equal(expected) {
+				t.Fatalf("Expected the run at %v, got %v", expected, now)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected run %d", i)
+		}
+	}
+
+	// a job blocked in its run is cancelled by Close
+	fake.Advance(time.Minute)
+	done := make(chan struct{})
+	go func() {
+		s.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Close to stop the jobs")
+	}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+// benchScale is the size of the store a benchmark runs against. The pull
+// requests are spread over the users round robin, reviewed by the next two
+// members of the author's team.
+type benchScale struct {
+	users, prs int
+}
+
+func (s benchScale) String() string {
+	return fmt.Sprintf("users=%d/prs=%d", s.users, s.prs)
+}
+
+var benchScales = []benchScale{
+	{users: 1_000, prs: 10_000},
+	{users: 10_000, prs: 1_000_000},
+}
+
+const benchTeamSize = 100
+
+var (
+	benchMx       sync.Mutex
+	benchServices = map[benchScale]*PrReviewerService{}
+)
+
+// benchService returns the seeded service of the scale. A million pull
+// requests take seconds to seed, so the service is shared by the benchmarks
+// of one run; they only add to it.
+func benchService(b *testing.B, scale benchScale) *PrReviewerService {
+	b.Helper()
+	benchMx.Lock()
+	defer benchMx.Unlock()
+	if svc, ok := benchServices[scale]; ok {
+		return svc
+	}
+
+	ctx := context.Background()
+	svc := newMemoryService()
+	for t := 0; t < scale.users/benchTeamSize; t++ {
+		team := models.Team{TeamName: fmt.Sprintf("team-%d", t), Members: make([]models.TeamMember, 0, benchTeamSize)}
+		for m := 0; m < benchTeamSize; m++ {
+			id := fmt.Sprintf("u-%d", t*benchTeamSize+m)
+			team.Members = append(team.Members, models.TeamMember{UserId: id, Username: id, IsActive: true})
+		}
+		if _, err := svc.TeamAdd(ctx, team); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	// the pull requests go straight into the repo, the service would also
+	// record a million events and audit entries
+	r := defaultStore(svc).Repo
+	now := fakeClock(svc).Now()
+	for i := 0; i < scale.prs; i++ {
+		author := i % scale.users
+		team := author / benchTeamSize
+		reviewers := []string{
+			fmt.Sprintf("u-%d", team*benchTeamSize+(author+1)%benchTeamSize),
+			fmt.Sprintf("u-%d", team*benchTeamSize+(author+2)%benchTeamSize),
+		}
+		pr := models.PullRequest{
+			PullRequestId:     fmt.Sprintf("pr-%d", i),
+			PullRequestName:   "seeded",
+			AuthorId:          fmt.Sprintf("u-%d", author),
+			Status:            models.OPEN,
+			AssignedReviewers: reviewers,
+			TeamName:          fmt.Sprintf("team-%d", team),
+			CreatedAt:         &now,
+		}
+		if err := r.CreateIndexedPR(pr); err != nil {
+			b.Fatal(err)
+		}
+	}
+	benchServices[scale] = svc
+	return svc
+}
+
+// benchRun runs op serially and from GOMAXPROCS goroutines, the parallel
+// numbers show how much the store lock costs.
+func benchRun(b *testing.B, op func(rnd *rand.Rand) error) {
+	b.Run("serial", func(b *testing.B) {
+		rnd := rand.New(rand.NewPCG(1, 2))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := op(rnd); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		var seed atomic.Uint64
+		b.RunParallel(func(pb *testing.PB) {
+			rnd := rand.New(rand.NewPCG(seed.Add(1), 2))
+			for pb.Next() {
+				if err := op(rnd); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
+
+func BenchmarkPullRequestCreate(b *testing.B) {
+	ctx := context.Background()
+	for _, scale := range benchScales {
+		b.Run(scale.String(), func(b *testing.B) {
+			svc := benchService(b, scale)
+			var seq atomic.Int64
+			benchRun(b, func(rnd *rand.Rand) error {
+				id := fmt.Sprintf("bench-create-%d", seq.Add(1))
+				_, err := svc.PullRequestCreate(ctx, id, id, fmt.Sprintf("u-%d", rnd.IntN(scale.users)), "")
+				return err
+			})
+		})
+	}
+}
+
+func BenchmarkPullRequestReassign(b *testing.B) {
+	ctx := context.Background()
+	for _, scale := range benchScales {
+		b.Run(scale.String(), func(b *testing.B) {
+			svc := benchService(b, scale)
+			benchRun(b, func(rnd *rand.Rand) error {
+				prId := fmt.Sprintf("pr-%d", rnd.IntN(scale.prs))
+				for {
+					pr := defaultStore(svc).Repo.GetPullRequestById(prId)
+					_, _, err := svc.PullRequestReassign(ctx, prId, pr.AssignedReviewers[rnd.IntN(len(pr.AssignedReviewers))], "")
+					// a parallel reassignment of the same review got there first
+					var svcErr ErrorService
+					if errors.As(err, &svcErr) && svcErr.ApiCode == models.NOT_ASSIGNED {
+						continue
+					}
+					return err
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkUsersGetReview(b *testing.B) {
+	ctx := context.Background()
+	for _, scale := range benchScales {
+		b.Run(scale.String(), func(b *testing.B) {
+			svc := benchService(b, scale)
+			benchRun(b, func(rnd *rand.Rand) error {
+				_, err := svc.UsersGetReview(ctx, fmt.Sprintf("u-%d", rnd.IntN(scale.users)))
+				return err
+			})
+		})
+	}
+}
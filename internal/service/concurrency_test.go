@@ -0,0 +1,387 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+// The tests of this file hammer one service from many goroutines and check
+// the invariants afterwards; run them with -race.
+
+// parallel runs fn(g) on n goroutines at once and waits for them.
+func parallel(n int, fn func(g int)) {
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for g := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			fn(g)
+		}()
+	}
+	close(start)
+	wg.Wait()
+}
+
+// expectNoInternalError fails on errors other than the rejections of the
+// domain and input rules, which concurrent requests cause legitimately.
+func expectNoInternalError(t *testing.T, op string, err error) {
+	t.Helper()
+	var svcErr ErrorService
+	if err != nil && (!errors.As(err, &svcErr) || svcErr.Code == INTERNAL_ERROR) {
+		t.Errorf("%s: %v", op, err)
+	}
+}
+
+// checkInvariants verifies the state a service must be in whatever the
+// interleaving of the requests was.
+func checkInvariants(t *testing.T, svc *PrReviewerService) {
+	t.Helper()
+	ctx := context.Background()
+	store := defaultStore(svc)
+
+	report, err := svc.CheckConsistency(ctx, false)
+	mustNil(t, err)
+	if !report.Consistent {
+		t.Errorf("Expected a consistent store, got %+v", report.Violations)
+	}
+
+	events := store.EventRepo.GetAllPullRequestEvents()
+	replayed := ReplayPullRequests(events)
+	replaced := 0
+	for _, event := range events {
+		if event.Type == models.EVENT_REVIEWER_REPLACED {
+			replaced++
+		}
+	}
+	for _, pr := range store.Repo.GetPullRequests() {
+		reviewers := pr.AssignedReviewers
+		if len(reviewers) > 2 || len(slices.Compact(slices.Sorted(slices.Values(reviewers)))) != len(reviewers) || slices.Contains(reviewers, pr.AuthorId) {
+			t.Errorf("%s: wrong reviewers %v of author %s", pr.PullRequestId, reviewers, pr.AuthorId)
+		}
+		if assigned := slices.Sorted(maps.Keys(pr.AssignedAt)); !slices.Equal(assigned, slices.Sorted(slices.Values(reviewers))) {
+			t.Errorf("%s: assignment times of %v for reviewers %v", pr.PullRequestId, assigned, reviewers)
+		}
+		replay := replayed[pr.PullRequestId]
+		if replay == nil || replay.Status != pr.Status || !slices.Equal(replay.AssignedReviewers, reviewers) {
+			t.Errorf("%s: the events replay to %+v, stored %+v", pr.PullRequestId, replay, pr)
+		}
+	}
+	if len(replayed) != len(store.Repo.GetPullRequests()) {
+		t.Errorf("Expected %d pull requests in the events, got %d", len(store.Repo.GetPullRequests()), len(replayed))
+	}
+
+	audited := 0
+	for _, event := range store.AuditRepo.GetAuditEvents(models.AuditFilter{EntityType: models.PR_ENTITY}) {
+		if event.Action == models.PR_REASSIGN {
+			audited++
+		}
+	}
+	if audited != replaced {
+		t.Errorf("Expected an audited reassign per replacement, got %d for %d", audited, replaced)
+	}
+
+	// every reviewer is active when assigned, deactivating a reviewer later
+	// leaves the review with them; the changes are audited under their locks,
+	// the audit log has them in the order they happened
+	active := make(map[string]bool)
+	for _, event := range store.AuditRepo.GetAuditEvents(models.AuditFilter{}) {
+		switch event.Action {
+		case models.TEAM_ADD:
+			var team models.Team
+			mustNil(t, json.Unmarshal(event.After, &team))
+			for _, member := range team.Members {
+				active[member.UserId] = member.IsActive
+			}
+		case models.USER_SET_ACTIVE:
+			var user models.User
+			mustNil(t, json.Unmarshal(event.After, &user))
+			active[user.UserId] = user.IsActive
+		case models.PR_CREATE, models.PR_REASSIGN:
+			var before, after models.PullRequest
+			if event.Before != nil {
+				mustNil(t, json.Unmarshal(event.Before, &before))
+			}
+			mustNil(t, json.Unmarshal(event.After, &after))
+			for _, reviewer := range after.AssignedReviewers {
+				if !slices.Contains(before.AssignedReviewers, reviewer) && !active[reviewer] {
+					t.Errorf("%s: %s was assigned while inactive", event.EntityId, reviewer)
+				}
+			}
+		}
+	}
+}
+
+func TestConcurrentOperations(t *testing.T) {
+	ctx := context.Background()
+	svc := newMemoryService()
+	members := make([]models.TeamMember, 10)
+	for i := range members {
+		members[i] = models.TeamMember{UserId: fmt.Sprintf("u%d", i), Username: fmt.Sprintf("User %d", i), IsActive: true}
+	}
+	_, err := svc.TeamAdd(ctx, models.Team{TeamName: "backend", Members: members})
+	mustNil(t, err)
+	_, err = svc.TeamSetSLA(ctx, "backend", "1h")
+	mustNil(t, err)
+	const shared = 6
+	for i := range shared {
+		_, err := svc.PullRequestCreate(ctx, fmt.Sprintf("p%d", i), "shared", fmt.Sprintf("u%d", i), "")
+		mustNil(t, err)
+	}
+
+	store := defaultStore(svc)
+	later := testEpoch.Add(48 * time.Hour)
+	iterations := 300
+	if testing.Short() {
+		iterations = 50
+	}
+	parallel(16, func(g int) {
+		rng := rand.New(rand.NewPCG(uint64(g), 50))
+		user := func() string { return fmt.Sprintf("u%d", rng.IntN(len(members))) }
+		for n := range iterations {
+			prId := fmt.Sprintf("p%d", rng.IntN(shared))
+			switch op := rng.IntN(100); {
+			case op < 40:
+				pr := store.Repo.GetPullRequestById(prId)
+				if len(pr.AssignedReviewers) == 0 {
+					continue
+				}
+				_, _, err := svc.PullRequestReassign(ctx, prId, pr.AssignedReviewers[rng.IntN(len(pr.AssignedReviewers))], "")
+				expectNoInternalError(t, "reassign", err)
+			case op < 45:
+				_, _, err := svc.PullRequestReassign(ctx, prId, user(), user())
+				expectNoInternalError(t, "reassign to", err)
+			case op < 47:
+				_, err := svc.PullRequestMerge(ctx, prId)
+				expectNoInternalError(t, "merge", err)
+			case op < 49:
+				_, err := svc.PullRequestClose(ctx, prId)
+				expectNoInternalError(t, "close", err)
+			case op < 60:
+				// a few ids are created by several goroutines at once
+				_, err := svc.PullRequestCreate(ctx, fmt.Sprintf("c%d-%d", g%4, n), "new", user(), "")
+				expectNoInternalError(t, "create", err)
+			case op < 75:
+				_, err := svc.UsersSetIsActive(ctx, user(), rng.IntN(3) > 0)
+				expectNoInternalError(t, "set active", err)
+			case op < 85:
+				_, err := svc.UsersGetReview(ctx, user())
+				expectNoInternalError(t, "get review", err)
+			case op < 90:
+				_, err := svc.TeamSetMemberRole(ctx, "backend", user(), []models.TeamRole{models.TEAM_LEAD, models.TEAM_SENIOR, models.TEAM_JUNIOR}[rng.IntN(3)])
+				expectNoInternalError(t, "set role", err)
+			case op < 92:
+				_, _, err := svc.EscalateStaleReviews(ctx, later, time.Hour)
+				expectNoInternalError(t, "escalate", err)
+			case op < 94:
+				_, err := svc.RecordOverdueReviews(ctx, later)
+				expectNoInternalError(t, "overdue", err)
+			default:
+				_, err := svc.CheckConsistency(ctx, false)
+				expectNoInternalError(t, "check", err)
+			}
+		}
+	})
+
+	checkInvariants(t, svc)
+	// a review goes overdue once per assignment however many runs saw it
+	for _, pr := range store.Repo.GetPullRequests() {
+		for _, reviewer := range pr.AssignedReviewers {
+			overdue := 0
+			for _, event := range store.EventRepo.GetPullRequestEvents(pr.PullRequestId) {
+				switch {
+				case event.ReviewerId != reviewer:
+				case event.Type == models.EVENT_REVIEWER_ASSIGNED || event.Type == models.EVENT_REVIEWER_REPLACED:
+					overdue = 0
+				case event.Type == models.EVENT_REVIEW_OVERDUE:
+					overdue++
+				}
+			}
+			if overdue > 1 {
+				t.Errorf("%s: the review of %s went overdue %d times", pr.PullRequestId, reviewer, overdue)
+			}
+		}
+	}
+}
+
+func TestConcurrentReassignIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	svc := newBackendService(t)
+	_, err := svc.PullRequestCreate(ctx, "r1", "req1", "u1", "")
+	mustNil(t, err)
+
+	// everybody tries to hand the review of u2 over, only one may succeed
+	var succeeded atomic.Int32
+	parallel(32, func(g int) {
+		_, candidate, err := svc.PullRequestReassign(ctx, "r1", "u2", "")
+		if err == nil {
+			succeeded.Add(1)
+			if candidate != "u4" {
+				t.Errorf("Expected u4 to take over, got %s", candidate)
+			}
+			return
+		}
+		var svcErr ErrorService
+		if !errors.As(err, &svcErr) || svcErr.ApiCode != models.NOT_ASSIGNED {
+			t.Errorf("Expected NOT_ASSIGNED, got %v", err)
+		}
+	})
+
+	if succeeded.Load() != 1 {
+		t.Fatalf("Expected exactly one reassign, got %d", succeeded.Load())
+	}
+	checkInvariants(t, svc)
+	if prs, err := svc.UsersGetReview(ctx, "u2"); err != nil || len(prs) != 0 {
+		t.Fatalf("Expected u2 to have no review, got %v, %v", prs, err)
+	}
+}
+
+func TestConcurrentCreateOfOneId(t *testing.T) {
+	ctx := context.Background()
+	svc := newBackendService(t)
+
+	var succeeded atomic.Int32
+	parallel(16, func(g int) {
+		_, err := svc.PullRequestCreate(ctx, "r1", "req1", fmt.Sprintf("u%d", g%4+1), "")
+		if err == nil {
+			succeeded.Add(1)
+			return
+		}
+		var svcErr ErrorService
+		if !errors.As(err, &svcErr) || svcErr.ApiCode != models.PR_EXISTS {
+			t.Errorf("Expected PR_EXISTS, got %v", err)
+		}
+	})
+
+	if succeeded.Load() != 1 {
+		t.Fatalf("Expected exactly one create, got %d", succeeded.Load())
+	}
+	checkInvariants(t, svc)
+	if events := defaultStore(svc).EventRepo.GetPullRequestEvents("r1"); events[0].Type != models.EVENT_PR_CREATED || len(events) != 3 {
+		t.Fatalf("Expected the events of one create, got %+v", events)
+	}
+}
+
+// TestConcurrentTeamUpdates changes the members of one team from every side,
+// no update may overwrite another.
+func TestConcurrentTeamUpdates(t *testing.T) {
+	ctx := context.Background()
+	svc := newMemoryService()
+	members := make([]models.TeamMember, 8)
+	for i := range members {
+		members[i] = models.TeamMember{UserId: fmt.Sprintf("u%d", i), Username: fmt.Sprintf("User %d", i), IsActive: true}
+	}
+	_, err := svc.TeamAdd(ctx, models.Team{TeamName: "backend", Members: members})
+	mustNil(t, err)
+
+	roles := []models.TeamRole{models.TEAM_LEAD, models.TEAM_SENIOR, models.TEAM_JUNIOR}
+	parallel(len(members)+4, func(g int) {
+		for n := range 100 {
+			if g >= len(members) {
+				// other writers of the team in between
+				_, err := svc.TeamSetPolicy(ctx, "backend", &models.TeamPolicy{RequireSenior: n%2 == 0, NoJuniorOnly: true})
+				expectNoInternalError(t, "set policy", err)
+				_, err = svc.TeamSetSLA(ctx, "backend", fmt.Sprintf("%dh", n+1))
+				expectNoInternalError(t, "set sla", err)
+				continue
+			}
+			userId := members[g].UserId
+			_, err := svc.UsersSetIsActive(ctx, userId, n%2 == 1)
+			expectNoInternalError(t, "set active", err)
+			_, err = svc.TeamSetMemberRole(ctx, "backend", userId, roles[(g+n)%len(roles)])
+			expectNoInternalError(t, "set role", err)
+		}
+	})
+
+	checkInvariants(t, svc)
+	team, err := svc.TeamGet(ctx, "backend")
+	mustNil(t, err)
+	for g, member := range team.Members {
+		if !member.IsActive || member.Role != roles[(g+99)%len(roles)] {
+			t.Errorf("Expected the last updates of %s to stick, got %+v", member.UserId, member)
+		}
+	}
+	if team.ReviewSLA != "100h" || team.Policy == nil || team.Policy.RequireSenior {
+		t.Errorf("Expected the last policy and SLA, got %+v", team)
+	}
+}
+
+// TestCreateLocksCandidates holds the lock of a candidate reviewer: creates
+// picking from its team wait for it, so a reviewer deactivated meanwhile is
+// never assigned, while creates in other teams go on.
+func TestCreateLocksPickedReviewers(t *testing.T) {
+	ctx := context.Background()
+	svc := newBackendService(t)
+	_, err := svc.TeamAdd(ctx, models.Team{TeamName: "frontend", ParentTeam: "backend", Members: []models.TeamMember{
+		{UserId: "f1", Username: "Frank", IsActive: true},
+		{UserId: "f2", Username: "Grace", IsActive: true},
+		{UserId: "f3", Username: "Heidi", IsActive: true},
+	}})
+	mustNil(t, err)
+	scoped, err := svc.scope(ctx)
+	mustNil(t, err)
+
+	held := scoped.userKey("u2")
+	keys := []string{scoped.prKey("f"), scoped.teamKey("frontend"), scoped.teamKey("backend")}
+	for _, userId := range []string{"f1", "f2", "f3"} {
+		keys = append(keys, scoped.userKey(userId))
+	}
+	for _, key := range keys {
+		if stripe(key) == stripe(held) {
+			t.Fatalf("%s shares the stripe of %s, pick other ids", key, held)
+		}
+	}
+
+	unlock := svc.locks.lock(held)
+	created := make(chan error)
+	go func() {
+		_, err := svc.PullRequestCreate(ctx, "b", "backend", "u1", "")
+		created <- err
+	}()
+
+	// the sub-team picks its own members, the pool of its parent is not
+	// locked and does not hold it up
+	done := make(chan error)
+	go func() {
+		_, err := svc.PullRequestCreate(ctx, "f", "frontend", "f1", "")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		mustNil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a create in the sub-team to finish")
+	}
+
+	select {
+	case err := <-created:
+		t.Fatalf("Expected the create to wait for the lock of a picked reviewer, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// u2 is deactivated while the lock is held, as UsersSetIsActive would
+	user := defaultStore(svc).Repo.GetUserById("u2")
+	user.IsActive = false
+	mustNil(t, defaultStore(svc).Repo.UpdateUser(user))
+	team := defaultStore(svc).Repo.GetTeamByName("backend")
+	mustNil(t, defaultStore(svc).Repo.UpdateTeamMember(team, user))
+	unlock()
+
+	mustNil(t, <-created)
+	pr := defaultStore(svc).Repo.GetPullRequestById("b")
+	if slices.Contains(pr.AssignedReviewers, "u2") {
+		t.Fatalf("Expected the inactive u2 not to be assigned, got %v", pr.AssignedReviewers)
+	}
+}
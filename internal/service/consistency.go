@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+type finding struct {
+	violation models.ConsistencyViolation
+	// repair is nil for violations that need a manual fix
+	repair func() error
+}
+
+// locked makes a repair run under the entity locks of keys. The findings are
+// collected unlocked, so a repair reads its entities again and does nothing
+// when the violation is gone meanwhile.
+func (s *PrReviewerService) locked(repair func() error, keys ...string) func() error {
+	return func() error {
+		defer s.locks.lock(keys...)()
+		return repair()
+	}
+}
+
+// CheckConsistency verifies the invariants between teams, users, pull requests
+// and the reviewer index. With repair it also fixes what can be fixed safely:
+// users are the source of truth for team members, and pull requests are the
+// source of truth for the reviewer index.
+func (s *PrReviewerService) CheckConsistency(ctx context.Context, repair bool) (models.ConsistencyReport, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return models.ConsistencyReport{}, err
+	}
+
+	findings := s.findInconsistencies()
+
+	report := models.ConsistencyReport{
+		Consistent: len(findings) == 0,
+		Violations: make([]models.ConsistencyViolation, 0, len(findings)),
+	}
+	for _, f := range findings {
+		if repair && f.repair != nil {
+			if err := f.repair(); err != nil {
+				return report, NewErrorService(INTERNAL_ERROR, err.Error())
+			}
+			f.violation.Repaired = true
+			if err := s.audit(ctx, models.REPAIR, f.violation.EntityType, f.violation.EntityId, nil, f.violation); err != nil {
+				return report, err
+			}
+		}
+		report.Violations = append(report.Violations, f.violation)
+	}
+	return report, nil
+}
+
+func (s *PrReviewerService) findInconsistencies() []finding {
+	return s.inspect(s.repo.GetTeams(), s.repo.GetUsers(), s.repo.GetPullRequests(), s.repo.GetReviewIndex())
+}
+
+// inspect runs the checks over the given state. Repairs of the returned
+// findings act on the repo, so they only make sense for the repo's own state.
+func (s *PrReviewerService) inspect(teamList []models.Team, userList []models.User, prList []models.PullRequest, index map[string][]string) []finding {
+	teams := make(map[string]models.Team, len(teamList))
+	for _, team := range teamList {
+		teams[team.TeamName] = team
+	}
+	users := make(map[string]models.User, len(userList))
+	for _, user := range userList {
+		users[user.UserId] = user
+	}
+	prs := make(map[string]models.PullRequest, len(prList))
+	for _, pr := range prList {
+		prs[pr.PullRequestId] = pr
+	}
+
+	findings := make([]finding, 0)
+	add := func(rule models.ConsistencyRule, entityType models.AuditEntity, entityId, message string, repair func() error) {
+		findings = append(findings, finding{
+			violation: models.ConsistencyViolation{
+				Rule:       rule,
+				EntityType: entityType,
+				EntityId:   entityId,
+				Message:    message,
+			},
+			repair: repair,
+		})
+	}
+
+	for _, user := range users {
+		switch {
+		case user.TeamName == "" && len(user.Teams) > 0:
+			add(models.USER_PRIMARY_TEAM, models.USER_ENTITY, user.UserId, "user has no primary team",
+				s.locked(func() error {
+					user := s.repo.GetUserById(user.UserId)
+					if user == nil || user.TeamName != "" || len(user.Teams) == 0 {
+						return nil
+					}
+					user.TeamName = user.Teams[0]
+					return s.repo.UpdateUser(user)
+				}, s.userKey(user.UserId)))
+		case user.TeamName == "":
+			add(models.USER_PRIMARY_TEAM, models.USER_ENTITY, user.UserId, "user is in no team, needs a manual fix", nil)
+		case !user.InTeam(user.TeamName):
+			add(models.USER_PRIMARY_TEAM, models.USER_ENTITY, user.UserId,
+				fmt.Sprintf("primary team %q is not one of the user's teams", user.TeamName),
+				s.locked(func() error {
+					user := s.repo.GetUserById(user.UserId)
+					if user == nil || user.TeamName == "" || user.InTeam(user.TeamName) {
+						return nil
+					}
+					user.Teams = append(user.Teams, user.TeamName)
+					return s.repo.UpdateUser(user)
+				}, s.userKey(user.UserId)))
+		}
+
+		for _, teamName := range user.Teams {
+			team, ok := teams[teamName]
+			if !ok {
+				add(models.USER_TEAM_MISSING, models.USER_ENTITY, user.UserId,
+					fmt.Sprintf("team %q does not exist", teamName),
+					s.locked(func() error {
+						user := s.repo.GetUserById(user.UserId)
+						if user == nil || !user.InTeam(teamName) {
+							return nil
+						}
+						// several users may point to the same missing team
+						team := s.repo.GetTeamByName(teamName)
+						if team == nil {
+							return s.repo.CreateTeam(models.Team{TeamName: teamName, Members: []models.TeamMember{models.NewTeamMember(user)}})
+						}
+						if hasMember(team, user.UserId) {
+							return nil
+						}
+						return s.repo.AddTeamMember(teamName, models.NewTeamMember(user))
+					}, s.teamKey(teamName), s.userKey(user.UserId)))
+				continue
+			}
+			if !hasMember(&team, user.UserId) {
+				add(models.USER_NOT_MEMBER, models.USER_ENTITY, user.UserId,
+					fmt.Sprintf("user is not listed in members of team %q", team.TeamName),
+					s.locked(func() error {
+						user, team := s.repo.GetUserById(user.UserId), s.repo.GetTeamByName(team.TeamName)
+						if user == nil || team == nil || !user.InTeam(team.TeamName) || hasMember(team, user.UserId) {
+							return nil
+						}
+						return s.repo.AddTeamMember(team.TeamName, models.NewTeamMember(user))
+					}, s.teamKey(team.TeamName), s.userKey(user.UserId)))
+			}
+		}
+	}
+
+	for _, team := range teams {
+		if _, ok := teams[team.ParentTeam]; team.ParentTeam != "" && !ok {
+			add(models.TEAM_PARENT_MISSING, models.TEAM_ENTITY, team.TeamName,
+				fmt.Sprintf("parent team %q does not exist, needs a manual fix", team.ParentTeam), nil)
+		}
+		for parent, seen := team.ParentTeam, map[string]bool{}; parent != "" && !seen[parent]; parent = teams[parent].ParentTeam {
+			if parent == team.TeamName {
+				add(models.TEAM_PARENT_CYCLE, models.TEAM_ENTITY, team.TeamName, "team is its own ancestor, needs a manual fix", nil)
+				break
+			}
+			seen[parent] = true
+		}
+		for _, member := range team.Members {
+			user, ok := users[member.UserId]
+			switch {
+			case !ok:
+				add(models.MEMBER_NO_USER, models.TEAM_ENTITY, team.TeamName,
+					fmt.Sprintf("member %q has no user", member.UserId),
+					s.locked(func() error {
+						team := s.repo.GetTeamByName(team.TeamName)
+						if team == nil || !hasMember(team, member.UserId) {
+							return nil
+						}
+						// the member may be missing its user in several teams
+						if existing := s.repo.GetUserById(member.UserId); existing != nil {
+							if existing.InTeam(team.TeamName) {
+								return nil
+							}
+							existing.Teams = append(existing.Teams, team.TeamName)
+							return s.repo.UpdateUser(existing)
+						}
+						return s.repo.CreateUser(models.NewUser(member.UserId, member.Username, team.TeamName, member.IsActive))
+					}, s.teamKey(team.TeamName), s.userKey(member.UserId)))
+			case !user.InTeam(team.TeamName):
+				add(models.MEMBER_MISMATCH, models.TEAM_ENTITY, team.TeamName,
+					fmt.Sprintf("member %q belongs to teams %q, needs a manual fix", member.UserId, user.Teams), nil)
+			case member != withRole(models.NewTeamMember(&user), member.Role):
+				add(models.MEMBER_MISMATCH, models.TEAM_ENTITY, team.TeamName,
+					fmt.Sprintf("member %q differs from its user", member.UserId),
+					s.locked(func() error {
+						user, team := s.repo.GetUserById(user.UserId), s.repo.GetTeamByName(team.TeamName)
+						if user == nil || team == nil || !user.InTeam(team.TeamName) || !hasMember(team, user.UserId) {
+							return nil
+						}
+						return s.repo.UpdateTeamMember(team, user)
+					}, s.teamKey(team.TeamName), s.userKey(user.UserId)))
+			}
+		}
+	}
+
+	indexed := make(map[string]map[string]struct{}, len(index))
+	for userId, prIds := range index {
+		indexed[userId] = make(map[string]struct{}, len(prIds))
+		for _, prId := range prIds {
+			indexed[userId][prId] = struct{}{}
+		}
+	}
+
+	for _, pr := range prs {
+		for _, reviewer := range pr.AssignedReviewers {
+			_, userExists := users[reviewer]
+			_, isIndexed := indexed[reviewer][pr.PullRequestId]
+			switch {
+			case !userExists:
+				add(models.REVIEWER_MISSING, models.PR_ENTITY, pr.PullRequestId,
+					fmt.Sprintf("reviewer %q does not exist", reviewer),
+					s.locked(func() error {
+						return s.unassign(pr.PullRequestId, reviewer, func(pr *models.PullRequest) bool {
+							return s.repo.GetUserById(reviewer) == nil
+						})
+					}, s.prKey(pr.PullRequestId), s.userKey(reviewer)))
+			case reviewer == pr.AuthorId:
+				add(models.REVIEWER_IS_AUTHOR, models.PR_ENTITY, pr.PullRequestId,
+					fmt.Sprintf("author %q is assigned as reviewer", reviewer),
+					s.locked(func() error {
+						return s.unassign(pr.PullRequestId, reviewer, func(pr *models.PullRequest) bool {
+							return pr.AuthorId == reviewer
+						})
+					}, s.prKey(pr.PullRequestId), s.userKey(reviewer)))
+			case !isIndexed:
+				add(models.INDEX_MISSING, models.PR_ENTITY, pr.PullRequestId,
+					fmt.Sprintf("reviewer %q has no index entry", reviewer),
+					s.locked(func() error {
+						pr := s.repo.GetPullRequestById(pr.PullRequestId)
+						if pr == nil || pr.AuthorId == reviewer || !isAssigned(pr, reviewer) || s.repo.GetUserById(reviewer) == nil {
+							return nil
+						}
+						return s.repo.AddPRToUser(reviewer, pr.PullRequestId)
+					}, s.prKey(pr.PullRequestId), s.userKey(reviewer)))
+			}
+		}
+	}
+
+	for userId, prIds := range indexed {
+		_, userExists := users[userId]
+		for prId := range prIds {
+			pr, prExists := prs[prId]
+			if userExists && prExists && pr.AuthorId != userId && isAssigned(&pr, userId) {
+				continue
+			}
+			add(models.INDEX_DANGLING, models.USER_ENTITY, userId,
+				fmt.Sprintf("index entry for pull request %q does not match assigned reviewers", prId),
+				s.locked(func() error {
+					// unassigning a reviewer above drops its entry as well
+					if !slices.Contains(s.repo.GetReviewIndex()[userId], prId) {
+						return nil
+					}
+					if pr := s.repo.GetPullRequestById(prId); pr != nil && s.repo.GetUserById(userId) != nil && pr.AuthorId != userId && isAssigned(pr, userId) {
+						return nil
+					}
+					return s.repo.DeleteReviewIndexEntry(userId, prId)
+				}, s.prKey(prId), s.userKey(userId)))
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i].violation, findings[j].violation
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.EntityId < b.EntityId
+	})
+	return findings
+}
+
+// unassign drops a reviewer, and its index entry, from the pull request if
+// the reviewer is still assigned and wrong holds for the stored pull request.
+func (s *PrReviewerService) unassign(prId, reviewer string, wrong func(pr *models.PullRequest) bool) error {
+	_, err := s.repo.ModifyPR(prId, func(pr *models.PullRequest) error {
+		if !isAssigned(pr, reviewer) || !wrong(pr) {
+			return nil
+		}
+		pr.AssignedReviewers = slices.DeleteFunc(pr.AssignedReviewers, func(r string) bool { return r == reviewer })
+		delete(pr.AssignedAt, reviewer)
+		return nil
+	})
+	return err
+}
+
+func hasMember(team *models.Team, userId string) bool {
+	for _, member := range team.Members {
+		if member.UserId == userId {
+			return true
+		}
+	}
+	return false
+}
+
+func withRole(member models.TeamMember, role models.TeamRole) models.TeamMember {
+	member.Role = role
+	return member
+}
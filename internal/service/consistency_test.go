@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/repo/memory_repo"
+)
+
+func mustNil(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// corruptedRepo breaks every invariant the checker knows about once.
+func corruptedRepo(t *testing.T) *memory_repo.MemoryRepo {
+	repo := memory_repo.NewMemoryRepo()
+
+	u1 := models.NewUser("u1", "Alice", "backend", true)
+	u2 := models.NewUser("u2", "Bob", "backend", true)
+	u3 := models.NewUser("u3", "Carol", "backend", true)
+	for _, u := range []models.User{u1, u2, u3} {
+		mustNil(t, repo.CreateUser(u))
+	}
+	mustNil(t, repo.CreateTeam(models.Team{TeamName: "backend", Members: []models.TeamMember{
+		models.NewTeamMember(&u1), models.NewTeamMember(&u2), models.NewTeamMember(&u3),
+		{UserId: "u9", Username: "Ghost", IsActive: true},
+	}}))
+
+	u2.IsActive = false
+	mustNil(t, repo.UpdateUser(&u2))
+	mustNil(t, repo.CreateUser(models.NewUser("u5", "Eve", "backend", true)))
+	mustNil(t, repo.CreateUser(models.NewUser("u6", "Frank", "ghosts", true)))
+
+	mustNil(t, repo.CreatePR(models.NewPR("r1", "req1", "u1", models.OPEN, []string{"u2", "nobody"}, nil)))
+	mustNil(t, repo.CreatePR(models.NewPR("r2", "req2", "u3", models.OPEN, []string{"u3"}, nil)))
+	mustNil(t, repo.AddPRToUser("u3", "r2"))
+	mustNil(t, repo.AddPRToUser("u3", "r1"))
+	return repo
+}
+
+func TestCheckConsistency(t *testing.T) {
+	repo := corruptedRepo(t)
+	svc := newServiceWithRepo(repo)
+
+	report, err := svc.CheckConsistency(context.Background(), false)
+	mustNil(t, err)
+	if report.Consistent {
+		t.Fatal("Expected violations")
+	}
+
+	found := make(map[models.ConsistencyRule]int)
+	for _, v := range report.Violations {
+		found[v.Rule]++
+		if v.Repaired {
+			t.Fatalf("Nothing should be repaired without repair: %+v", v)
+		}
+	}
+	expected := map[models.ConsistencyRule]int{
+		models.REVIEWER_MISSING:   1,
+		models.REVIEWER_IS_AUTHOR: 1,
+		models.INDEX_MISSING:      1,
+		models.INDEX_DANGLING:     2,
+		models.MEMBER_NO_USER:     1,
+		models.MEMBER_MISMATCH:    1,
+		models.USER_NOT_MEMBER:    1,
+		models.USER_TEAM_MISSING:  1,
+	}
+	for rule, n := range expected {
+		if found[rule] != n {
+			t.Errorf("%s: expected %d violations, got %d (%+v)", rule, n, found[rule], report.Violations)
+		}
+	}
+
+	if prs := repo.GetPullRequestsByUserId("u3"); len(prs) != 2 {
+		t.Fatalf("Expected both indexed pull requests, got %d", len(prs))
+	}
+}
+
+func TestRepairConsistency(t *testing.T) {
+	repo := corruptedRepo(t)
+	svc := newServiceWithRepo(repo)
+
+	repaired, err := svc.CheckConsistency(context.Background(), true)
+	mustNil(t, err)
+	for _, v := range repaired.Violations {
+		if !v.Repaired {
+			t.Fatalf("Expected every violation to be repaired: %+v", v)
+		}
+	}
+	if events := defaultStore(svc).AuditRepo.GetAuditEvents(models.AuditFilter{}); len(events) != len(repaired.Violations) {
+		t.Fatalf("Expected %d audited repairs, got %d", len(repaired.Violations), len(events))
+	}
+
+	report, err := svc.CheckConsistency(context.Background(), false)
+	mustNil(t, err)
+	if !report.Consistent {
+		t.Fatalf("Expected consistent state after repair: %+v", report.Violations)
+	}
+
+	if pr := repo.GetPullRequestById("r1"); len(pr.AssignedReviewers) != 1 || pr.AssignedReviewers[0] != "u2" {
+		t.Fatalf("Unexpected reviewers: %v", pr.AssignedReviewers)
+	}
+	if team := repo.GetTeamByName("ghosts"); team == nil || len(team.Members) != 1 {
+		t.Fatalf("Expected recreated team, got %+v", team)
+	}
+}
+
+// TestRepairAfterLaterWrites changes the store between finding the
+// violations and repairing them, the repairs must not write back what they
+// saw when checking.
+func TestRepairAfterLaterWrites(t *testing.T) {
+	ctx := context.Background()
+	repo := corruptedRepo(t)
+	svc := newServiceWithRepo(repo)
+	scoped, err := svc.scope(ctx)
+	mustNil(t, err)
+	findings := scoped.findInconsistencies()
+
+	// u2 differs from its member entry; it is activated meanwhile
+	_, err = svc.UsersSetIsActive(ctx, "u2", true)
+	mustNil(t, err)
+	// the missing team of u6 is created meanwhile
+	_, err = svc.TeamAdd(ctx, models.Team{TeamName: "ghosts", Members: []models.TeamMember{{UserId: "u6", Username: "Frank", IsActive: true}}})
+	mustNil(t, err)
+	// the dangling entry of r2 goes away with the fixed author
+	mustNil(t, repo.DeleteReviewIndexEntry("u3", "r2"))
+
+	for _, f := range findings {
+		if f.repair != nil {
+			if err := f.repair(); err != nil {
+				t.Fatalf("%s: %v", f.violation.Rule, err)
+			}
+		}
+	}
+
+	if user := repo.GetUserById("u2"); !user.IsActive {
+		t.Fatalf("Expected u2 to stay active, got %+v", user)
+	}
+	if team := repo.GetTeamByName("ghosts"); len(team.Members) != 1 {
+		t.Fatalf("Expected u6 to be listed once, got %+v", team)
+	}
+	report, err := svc.CheckConsistency(ctx, false)
+	mustNil(t, err)
+	if !report.Consistent {
+		t.Fatalf("Expected consistent state after repair: %+v", report.Violations)
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+const ANONYMOUS_ACTOR = "anonymous"
+
+type contextKey int
+
+const (
+	actorKey contextKey = iota
+	requestIdKey
+	tenantKey
+)
+
+// Actor is who makes a request. Role is empty for a caller that has not been
+// authenticated; the service itself only restricts ROLE_USER. Tenant is the
+// tenant the credentials are bound to, empty if they work for every tenant.
+type Actor struct {
+	Name   string
+	Role   models.Role
+	Tenant string
+}
+
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey, requestId)
+}
+
+func ActorFromContext(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey).(Actor)
+	if actor.Name == "" {
+		actor.Name = ANONYMOUS_ACTOR
+	}
+	return actor
+}
+
+// WithTenant selects the tenant whose data a request works with.
+func WithTenant(ctx context.Context, tenantId string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenantId)
+}
+
+// TenantFromContext returns the tenant of the request, models.DEFAULT_TENANT
+// when none was selected.
+func TenantFromContext(ctx context.Context) string {
+	if tenantId, ok := ctx.Value(tenantKey).(string); ok && tenantId != "" {
+		return tenantId
+	}
+	return models.DEFAULT_TENANT
+}
+
+func RequestIdFromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey).(string)
+	return requestId
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+// TeamGetSubtree returns the team with all its sub-teams and the members of
+// the whole subtree.
+func (s *PrReviewerService) TeamGetSubtree(ctx context.Context, teamName string) (models.TeamTree, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return models.TeamTree{}, err
+	}
+
+	var rules inputRules
+	rules.name("team_name", teamName)
+	if err := rules.err(); err != nil {
+		return models.TeamTree{}, err
+	}
+
+	team := s.repo.GetTeamByName(teamName)
+	if team == nil {
+		return models.TeamTree{}, NewErrorApi(OBJECT_NOT_FOUND, models.NOT_FOUND, "Team not found")
+	}
+	return s.subtree(*team), nil
+}
+
+// subtree builds the tree below team, sub-teams ordered by name.
+func (s *PrReviewerService) subtree(team models.Team) models.TeamTree {
+	return buildSubtree(team, s.children())
+}
+
+// children returns the sub-teams of every team, ordered by name.
+func (s *PrReviewerService) children() map[string][]models.Team {
+	children := make(map[string][]models.Team)
+	for _, t := range s.repo.GetTeams() {
+		if t.ParentTeam != "" {
+			children[t.ParentTeam] = append(children[t.ParentTeam], t)
+		}
+	}
+	for _, teams := range children {
+		slices.SortFunc(teams, func(a, b models.Team) int { return strings.Compare(a.TeamName, b.TeamName) })
+	}
+	return children
+}
+
+func buildSubtree(team models.Team, children map[string][]models.Team) models.TeamTree {
+	// visited guards against cycles left by a broken snapshot
+	visited := make(map[string]bool)
+	var build func(team models.Team) models.TeamTree
+	build = func(team models.Team) models.TeamTree {
+		visited[team.TeamName] = true
+		tree := models.TeamTree{Team: team, Subteams: []models.TeamTree{}}
+		tree.AllMembers = slices.Clone(team.Members)
+		for _, child := range children[team.TeamName] {
+			if visited[child.TeamName] {
+				continue
+			}
+			subtree := build(child)
+			tree.Subteams = append(tree.Subteams, subtree)
+			for _, member := range subtree.AllMembers {
+				if !slices.ContainsFunc(tree.AllMembers, func(m models.TeamMember) bool { return m.UserId == member.UserId }) {
+					tree.AllMembers = append(tree.AllMembers, member)
+				}
+			}
+		}
+		if tree.AllMembers == nil {
+			tree.AllMembers = []models.TeamMember{}
+		}
+		return tree
+	}
+	return build(team)
+}
+
+// ancestors returns the parent of the team, its parent and so on up to the
+// root.
+func (s *PrReviewerService) ancestors(teamName string) []string {
+	var result []string
+	visited := map[string]bool{teamName: true}
+	for team := s.repo.GetTeamByName(teamName); team != nil && team.ParentTeam != ""; team = s.repo.GetTeamByName(team.ParentTeam) {
+		if visited[team.ParentTeam] {
+			break
+		}
+		visited[team.ParentTeam] = true
+		result = append(result, team.ParentTeam)
+	}
+	return result
+}
+
+// escalationPools returns the members of the subtrees of the team's
+// ancestors, the nearest first: the pools reviewers are picked from when the
+// team itself has nobody eligible.
+func (s *PrReviewerService) escalationPools(teamName string) [][]models.TeamMember {
+	ancestors := s.ancestors(teamName)
+	if len(ancestors) == 0 {
+		return nil
+	}
+	children := s.children()
+	pools := make([][]models.TeamMember, 0, len(ancestors))
+	for _, ancestor := range ancestors {
+		if team := s.repo.GetTeamByName(ancestor); team != nil {
+			pools = append(pools, buildSubtree(*team, children).AllMembers)
+		}
+	}
+	return pools
+}
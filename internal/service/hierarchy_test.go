@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/repo/memory_repo"
+)
+
+func TestTeamHierarchy(t *testing.T) {
+	ctx := context.Background()
+	svc := newMemoryService()
+	for _, team := range []models.Team{
+		{TeamName: "dept", Members: []models.TeamMember{{UserId: "u1", Username: "Lead", IsActive: true}}},
+		{TeamName: "group", ParentTeam: "dept", Members: []models.TeamMember{{UserId: "u2", Username: "Bob", IsActive: true}}},
+		{TeamName: "squad-a", ParentTeam: "group", Members: []models.TeamMember{
+			{UserId: "u3", Username: "Carol", IsActive: true},
+			{UserId: "u4", Username: "Dave", IsActive: false},
+		}},
+		{TeamName: "squad-b", ParentTeam: "group", Members: []models.TeamMember{{UserId: "u5", Username: "Eve", IsActive: true}}},
+	} {
+		_, err := svc.TeamAdd(ctx, team)
+		mustNil(t, err)
+	}
+
+	var svcErr ErrorService
+	if _, err := svc.TeamAdd(ctx, models.Team{TeamName: "squad-c", ParentTeam: "nope", Members: []models.TeamMember{}}); !errors.As(err, &svcErr) || svcErr.Code != OBJECT_NOT_FOUND {
+		t.Fatalf("Expected a missing parent to be rejected, got %v", err)
+	}
+
+	tree, err := svc.TeamGetSubtree(ctx, "dept")
+	mustNil(t, err)
+	if len(tree.Subteams) != 1 || len(tree.Subteams[0].Subteams) != 2 || tree.Subteams[0].Subteams[1].TeamName != "squad-b" {
+		t.Fatalf("Unexpected subtree %+v", tree)
+	}
+	var all []string
+	for _, member := range tree.AllMembers {
+		all = append(all, member.UserId)
+	}
+	if !reflect.DeepEqual(all, []string{"u1", "u2", "u3", "u4", "u5"}) {
+		t.Fatalf("Expected the members of the whole subtree, got %v", all)
+	}
+
+	// nobody in squad-a can review, the group's subtree can
+	pr, err := svc.PullRequestCreate(ctx, "r1", "req1", "u3", "")
+	mustNil(t, err)
+	if pr.TeamName != "squad-a" || !reflect.DeepEqual(pr.AssignedReviewers, []string{"u2", "u5"}) {
+		t.Fatalf("Expected reviewers from the parent's pool, got %+v", pr)
+	}
+
+	// the group has nobody left either, the department has
+	_, replacedBy, err := svc.PullRequestReassign(ctx, "r1", "u2", "")
+	mustNil(t, err)
+	if replacedBy != "u1" {
+		t.Fatalf("Expected u1 from the department, got %q", replacedBy)
+	}
+	if _, _, err = svc.PullRequestReassign(ctx, "r1", "u1", "u2"); err != nil {
+		t.Fatalf("Expected a member of an ancestor's pool to be accepted, got %v", err)
+	}
+}
+
+func TestTeamHierarchyConsistency(t *testing.T) {
+	repo := memory_repo.NewMemoryRepo()
+	for _, team := range []models.Team{
+		{TeamName: "a", ParentTeam: "b", Members: []models.TeamMember{}},
+		{TeamName: "b", ParentTeam: "a", Members: []models.TeamMember{}},
+		{TeamName: "c", ParentTeam: "gone", Members: []models.TeamMember{}},
+	} {
+		mustNil(t, repo.CreateTeam(team))
+	}
+	svc := newServiceWithRepo(repo)
+
+	report, err := svc.CheckConsistency(context.Background(), true)
+	mustNil(t, err)
+	found := make(map[models.ConsistencyRule][]string)
+	for _, v := range report.Violations {
+		found[v.Rule] = append(found[v.Rule], v.EntityId)
+		if v.Repaired {
+			t.Fatalf("Expected a manual fix, got %+v", v)
+		}
+	}
+	expected := map[models.ConsistencyRule][]string{
+		models.TEAM_PARENT_CYCLE:   {"a", "b"},
+		models.TEAM_PARENT_MISSING: {"c"},
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Fatalf("Expected %v, got %v", expected, found)
+	}
+
+	// the tree of a broken hierarchy still ends
+	tree, err := svc.TeamGetSubtree(context.Background(), "a")
+	mustNil(t, err)
+	if len(tree.Subteams) != 1 || len(tree.Subteams[0].Subteams) != 0 {
+		t.Fatalf("Unexpected subtree %+v", tree)
+	}
+}
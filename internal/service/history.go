@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+// ReplayPullRequest rebuilds a pull request from its events.
+// It returns nil when the stream does not start with PR_CREATED.
+func ReplayPullRequest(events []models.PullRequestEvent) *models.PullRequest {
+	var pr *models.PullRequest
+	for _, event := range events {
+		if event.Type == models.EVENT_PR_CREATED {
+			createdAt := event.Timestamp
+			created := models.NewPR(event.PullRequestId, event.PullRequestName, event.AuthorId, models.OPEN, []string{}, &createdAt)
+			created.TeamName = event.TeamName
+			pr = &created
+			continue
+		}
+		if pr == nil {
+			return nil
+		}
+		applyEvent(pr, event)
+	}
+	return pr
+}
+
+func setAssignedAt(pr *models.PullRequest, reviewer string, timestamp time.Time) {
+	if pr.AssignedAt == nil {
+		pr.AssignedAt = make(map[string]time.Time)
+	}
+	pr.AssignedAt[reviewer] = timestamp
+}
+
+func applyEvent(pr *models.PullRequest, event models.PullRequestEvent) {
+	switch event.Type {
+	case models.EVENT_REVIEWER_ASSIGNED:
+		pr.AssignedReviewers = append(pr.AssignedReviewers, event.ReviewerId)
+		setAssignedAt(pr, event.ReviewerId, event.Timestamp)
+	case models.EVENT_REVIEWER_REPLACED:
+		for i, reviewer := range pr.AssignedReviewers {
+			if reviewer == event.OldReviewerId {
+				pr.AssignedReviewers[i] = event.ReviewerId
+				delete(pr.AssignedAt, event.OldReviewerId)
+				setAssignedAt(pr, event.ReviewerId, event.Timestamp)
+				break
+			}
+		}
+	case models.EVENT_PR_MERGED:
+		mergedAt := event.Timestamp
+		pr.Status = models.MERGED
+		pr.MergedAt = &mergedAt
+	case models.EVENT_PR_CLOSED:
+		closedAt := event.Timestamp
+		pr.Status = models.CLOSED
+		pr.ClosedAt = &closedAt
+	}
+}
+
+// ReplayPullRequests rebuilds every pull request found in the stream.
+func ReplayPullRequests(events []models.PullRequestEvent) map[string]*models.PullRequest {
+	byPR := make(map[string][]models.PullRequestEvent)
+	for _, event := range events {
+		byPR[event.PullRequestId] = append(byPR[event.PullRequestId], event)
+	}
+
+	prs := make(map[string]*models.PullRequest, len(byPR))
+	for prId, prEvents := range byPR {
+		if pr := ReplayPullRequest(prEvents); pr != nil {
+			prs[prId] = pr
+		}
+	}
+	return prs
+}
+
+// ReplayReviewIndex rebuilds the user -> assigned pull requests read model
+// (the same shape MemoryRepo keeps in prsByUser).
+func ReplayReviewIndex(events []models.PullRequestEvent) map[string]map[string]struct{} {
+	index := make(map[string]map[string]struct{})
+	for _, pr := range ReplayPullRequests(events) {
+		for _, reviewer := range pr.AssignedReviewers {
+			if index[reviewer] == nil {
+				index[reviewer] = make(map[string]struct{})
+			}
+			index[reviewer][pr.PullRequestId] = struct{}{}
+		}
+	}
+	return index
+}
+
+func (s *PrReviewerService) PullRequestHistory(ctx context.Context, pullRequestId string) (models.PullRequestHistory, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return models.PullRequestHistory{}, err
+	}
+
+	var rules inputRules
+	rules.id("pull_request_id", pullRequestId)
+	if err := rules.err(); err != nil {
+		return models.PullRequestHistory{}, err
+	}
+
+	events := s.eventRepo.GetPullRequestEvents(pullRequestId)
+	pr := ReplayPullRequest(events)
+	if pr == nil {
+		return models.PullRequestHistory{}, NewErrorApi(OBJECT_NOT_FOUND, models.NOT_FOUND, "Pull request not found")
+	}
+
+	return models.PullRequestHistory{
+		PullRequestId: pullRequestId,
+		Events:        events,
+		PR:            *pr,
+	}, nil
+}
+
+// recordEvents appends events of pr to the stream and notifies listeners.
+func (s *PrReviewerService) recordEvents(ctx context.Context, pr *models.PullRequest, events ...models.PullRequestEvent) error {
+	events, err := s.eventRepo.AppendPullRequestEvents(events...)
+	if err != nil {
+		return NewErrorService(INTERNAL_ERROR, err.Error())
+	}
+
+	snapshot := *pr
+	snapshot.AssignedReviewers = append([]string{}, pr.AssignedReviewers...)
+	for _, l := range s.listeners {
+		l.OnPullRequestEvents(ctx, snapshot, events)
+	}
+	return nil
+}
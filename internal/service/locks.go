@@ -0,0 +1,142 @@
+package service
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+// LOCK_STRIPES is how many mutexes the entity locks of a service share.
+const LOCK_STRIPES = 256
+
+// entityLocks serialises the operations on one entity, e.g. a reassign and
+// a merge of the same pull request, from their first read to their last
+// recorded event, while operations on other entities run in parallel. The
+// keys are hashed onto a fixed set of mutexes, two entities may share one.
+type entityLocks struct {
+	stripes [LOCK_STRIPES]sync.Mutex
+}
+
+func newEntityLocks() *entityLocks {
+	return &entityLocks{}
+}
+
+func stripe(key string) int {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return int(hash % LOCK_STRIPES)
+}
+
+// lock takes the locks of every key, always in stripe order so callers
+// locking overlapping keys cannot deadlock, and returns the unlock.
+func (l *entityLocks) lock(keys ...string) func() {
+	stripes := make([]int, 0, len(keys))
+	for _, key := range keys {
+		stripes = append(stripes, stripe(key))
+	}
+	slices.Sort(stripes)
+	stripes = slices.Compact(stripes)
+
+	for _, i := range stripes {
+		l.stripes[i].Lock()
+	}
+	return func() {
+		for _, i := range slices.Backward(stripes) {
+			l.stripes[i].Unlock()
+		}
+	}
+}
+
+// lockAll takes every stripe, shutting out all entity operations of all
+// tenants, and returns the unlock.
+func (l *entityLocks) lockAll() func() {
+	for i := range l.stripes {
+		l.stripes[i].Lock()
+	}
+	return func() {
+		for i := len(l.stripes) - 1; i >= 0; i-- {
+			l.stripes[i].Unlock()
+		}
+	}
+}
+
+// The lock keys of the entities; they include the tenant, the stores of
+// different tenants never conflict.
+
+func (s *PrReviewerService) prKey(pullRequestId string) string {
+	return s.tenantId + "/pr/" + pullRequestId
+}
+
+func (s *PrReviewerService) userKey(userId string) string {
+	return s.tenantId + "/user/" + userId
+}
+
+func (s *PrReviewerService) teamKey(teamName string) string {
+	return s.tenantId + "/team/" + teamName
+}
+
+// lockReviewers locks a pull request about to be created together with its
+// author, its team, the ancestors of the team and the reviewers picked for
+// it, see lockPicked; the other members of the team and of the escalation
+// pools stay unlocked. It returns the reviewers picked under the locks.
+func (s *PrReviewerService) lockReviewers(pullRequestId, authorId, teamName string) ([]models.TeamMember, func()) {
+	keys := []string{s.prKey(pullRequestId), s.userKey(authorId), s.teamKey(teamName)}
+	for _, ancestor := range s.ancestors(teamName) {
+		keys = append(keys, s.teamKey(ancestor))
+	}
+
+	var reviewers []models.TeamMember
+	_, unlock := s.lockPicked(keys, func() []string {
+		reviewers = nil
+		if team := s.repo.GetTeamByName(teamName); team != nil {
+			reviewers = s.selectReviewers(team, authorId)
+		}
+		ids := make([]string, 0, len(reviewers))
+		for _, reviewer := range reviewers {
+			ids = append(ids, reviewer.UserId)
+		}
+		return ids
+	})
+	return reviewers, unlock
+}
+
+// lockPicked locks keys together with the users pick chooses, so nobody is
+// deactivated or moved while being picked. pick reads the stored state, it
+// runs again once everything is locked; when it chooses other users then,
+// the locks are dropped and taken anew. It returns the users of the last
+// pick, the one made under the locks, and the unlock.
+func (s *PrReviewerService) lockPicked(keys []string, pick func() []string) ([]string, func()) {
+	picked := pick()
+	for {
+		locked := slices.Clone(keys)
+		for _, userId := range picked {
+			locked = append(locked, s.userKey(userId))
+		}
+		unlock := s.locks.lock(locked...)
+		repicked := pick()
+		if slices.Equal(picked, repicked) {
+			return picked, unlock
+		}
+		unlock()
+		picked = repicked
+	}
+}
+
+// lockReplacement locks a pull request together with the reviewer pick
+// chooses to take over one of its reviews, "" for nobody, see lockPicked.
+func (s *PrReviewerService) lockReplacement(pullRequestId string, pick func() string) (string, func()) {
+	picked, unlock := s.lockPicked([]string{s.prKey(pullRequestId)}, func() []string {
+		if candidateId := pick(); candidateId != "" {
+			return []string{candidateId}
+		}
+		return nil
+	})
+	if len(picked) == 0 {
+		return "", unlock
+	}
+	return picked[0], unlock
+}
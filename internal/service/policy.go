@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+const (
+	POLICY_NO_SENIOR   = "no senior reviewer"
+	POLICY_JUNIOR_ONLY = "only junior reviewers"
+)
+
+// TeamSetMemberRole changes the role of a member within the team.
+func (s *PrReviewerService) TeamSetMemberRole(ctx context.Context, teamName, userId string, role models.TeamRole) (models.Team, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return models.Team{}, err
+	}
+
+	var rules inputRules
+	rules.name("team_name", teamName)
+	rules.id("user_id", userId)
+	rules.role("role", role)
+	if err := rules.err(); err != nil {
+		return models.Team{}, err
+	}
+	defer s.locks.lock(s.teamKey(teamName))()
+
+	team := s.repo.GetTeamByName(teamName)
+	if team == nil {
+		return models.Team{}, NewErrorApi(OBJECT_NOT_FOUND, models.NOT_FOUND, "Team not found")
+	}
+	i := slices.IndexFunc(team.Members, func(m models.TeamMember) bool { return m.UserId == userId })
+	if i < 0 {
+		return *team, NewErrorApi(OBJECT_NOT_FOUND, models.NOT_FOUND, "member not found")
+	}
+	if team.Members[i].Role == role {
+		return *team, nil
+	}
+
+	before := *team
+	// users changing their activity update the members without the team
+	// lock, so the role is set on the stored members
+	team, err = s.repo.ModifyTeam(teamName, func(team *models.Team) error {
+		i := slices.IndexFunc(team.Members, func(m models.TeamMember) bool { return m.UserId == userId })
+		if i < 0 {
+			return errors.New("user is not member of team")
+		}
+		team.Members[i].Role = role
+		return nil
+	})
+	if err != nil || team == nil {
+		return before, modifyTeamError(err)
+	}
+	if err := s.audit(ctx, models.TEAM_SET_ROLE, models.TEAM_ENTITY, teamName, before, *team); err != nil {
+		return *team, err
+	}
+	return *team, nil
+}
+
+// TeamSetPolicy replaces the reviewer policy of the team, nil removes it.
+// Pull requests created before keep their reviewers.
+func (s *PrReviewerService) TeamSetPolicy(ctx context.Context, teamName string, policy *models.TeamPolicy) (models.Team, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return models.Team{}, err
+	}
+
+	var rules inputRules
+	rules.name("team_name", teamName)
+	if err := rules.err(); err != nil {
+		return models.Team{}, err
+	}
+	defer s.locks.lock(s.teamKey(teamName))()
+
+	team := s.repo.GetTeamByName(teamName)
+	if team == nil {
+		return models.Team{}, NewErrorApi(OBJECT_NOT_FOUND, models.NOT_FOUND, "Team not found")
+	}
+	if policy != nil && *policy == (models.TeamPolicy{}) {
+		policy = nil
+	}
+
+	before := *team
+	team, err = s.repo.ModifyTeam(teamName, func(team *models.Team) error {
+		team.Policy = policy
+		return nil
+	})
+	if err != nil || team == nil {
+		return before, modifyTeamError(err)
+	}
+	if err := s.audit(ctx, models.TEAM_SET_POLICY, models.TEAM_ENTITY, teamName, before, *team); err != nil {
+		return *team, err
+	}
+	return *team, nil
+}
+
+// modifyTeamError is the error of a failed ModifyTeam, err is nil when the
+// team was not found.
+func modifyTeamError(err error) error {
+	if err == nil {
+		return NewErrorService(INTERNAL_ERROR, "updating non-existing team")
+	}
+	return NewErrorService(INTERNAL_ERROR, err.Error())
+}
+
+// pickReviewers returns up to two active members other than the author, in
+// the order of candidates. With a policy it first takes a senior, and a
+// non-junior when juniors may not review alone, if there are any.
+func pickReviewers(candidates []models.TeamMember, authorId string, policy *models.TeamPolicy) []models.TeamMember {
+	reviewers := make([]models.TeamMember, 0, 2)
+	pick := func(accept func(models.TeamMember) bool) {
+		for _, candidate := range candidates {
+			if len(reviewers) == 2 {
+				return
+			}
+			if candidate.UserId == authorId || !candidate.IsActive || !accept(candidate) ||
+				slices.ContainsFunc(reviewers, func(r models.TeamMember) bool { return r.UserId == candidate.UserId }) {
+				continue
+			}
+			reviewers = append(reviewers, candidate)
+			return
+		}
+	}
+
+	if policy != nil && policy.RequireSenior {
+		pick(func(m models.TeamMember) bool { return m.Role.IsSenior() })
+	}
+	if policy != nil && policy.NoJuniorOnly && len(reviewers) == 0 {
+		pick(func(m models.TeamMember) bool { return m.Role != models.TEAM_JUNIOR })
+	}
+	for len(reviewers) < 2 {
+		n := len(reviewers)
+		pick(func(models.TeamMember) bool { return true })
+		if len(reviewers) == n {
+			break
+		}
+	}
+	return reviewers
+}
+
+// checkPolicy returns the result of the policy for the reviewers, nil
+// without a policy.
+func checkPolicy(policy *models.TeamPolicy, reviewers []models.TeamMember) *models.PolicyResult {
+	if policy == nil {
+		return nil
+	}
+	result := &models.PolicyResult{Satisfied: true, Violations: []string{}}
+	if policy.RequireSenior && !slices.ContainsFunc(reviewers, func(m models.TeamMember) bool { return m.Role.IsSenior() }) {
+		result.Violations = append(result.Violations, POLICY_NO_SENIOR)
+	}
+	if policy.NoJuniorOnly && len(reviewers) > 0 && !slices.ContainsFunc(reviewers, func(m models.TeamMember) bool { return m.Role != models.TEAM_JUNIOR }) {
+		result.Violations = append(result.Violations, POLICY_JUNIOR_ONLY)
+	}
+	result.Satisfied = len(result.Violations) == 0
+	return result
+}
+
+// selectReviewers picks the reviewers of a new pull request from the team.
+// When nobody there is eligible, or the team cannot satisfy its policy, the
+// pools of the ancestors are added, the nearest first, until they can.
+func (s *PrReviewerService) selectReviewers(team *models.Team, authorId string) []models.TeamMember {
+	reviewers := pickReviewers(team.Members, authorId, team.Policy)
+	if len(reviewers) > 0 && satisfies(team.Policy, reviewers) {
+		return reviewers
+	}
+	for _, pool := range s.escalationPools(team.TeamName) {
+		if len(reviewers) > 0 && satisfies(team.Policy, reviewers) {
+			break
+		}
+		candidates := pickReviewers(append(slices.Clone(team.Members), pool...), authorId, team.Policy)
+		if len(reviewers) == 0 || satisfies(team.Policy, candidates) {
+			reviewers = candidates
+		}
+	}
+	return reviewers
+}
+
+func satisfies(policy *models.TeamPolicy, reviewers []models.TeamMember) bool {
+	result := checkPolicy(policy, reviewers)
+	return result == nil || result.Satisfied
+}
+
+// reviewerMembers looks the reviewers of pr up in its team and the pools of
+// its ancestors, so their roles are known; reviewers found nowhere count as
+// TEAM_MEMBER.
+func (s *PrReviewerService) reviewerMembers(pr *models.PullRequest, team *models.Team) []models.TeamMember {
+	pools := append([][]models.TeamMember{team.Members}, s.escalationPools(team.TeamName)...)
+	reviewers := make([]models.TeamMember, 0, len(pr.AssignedReviewers))
+	for _, reviewer := range pr.AssignedReviewers {
+		member := models.TeamMember{UserId: reviewer, IsActive: true}
+		for _, pool := range pools {
+			if i := slices.IndexFunc(pool, func(m models.TeamMember) bool { return m.UserId == reviewer }); i >= 0 {
+				member = pool[i]
+				break
+			}
+		}
+		reviewers = append(reviewers, member)
+	}
+	return reviewers
+}
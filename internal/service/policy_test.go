@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+func TestTeamPolicy(t *testing.T) {
+	ctx := context.Background()
+	svc := newMemoryService()
+	for _, team := range []models.Team{
+		{TeamName: "dept", Members: []models.TeamMember{{UserId: "u5", Username: "Lead", IsActive: true, Role: models.TEAM_LEAD}}},
+		{TeamName: "backend", ParentTeam: "dept", Members: []models.TeamMember{
+			{UserId: "u1", Username: "Alice", IsActive: true},
+			{UserId: "u2", Username: "Bob", IsActive: true, Role: models.TEAM_JUNIOR},
+			{UserId: "u3", Username: "Carol", IsActive: true, Role: models.TEAM_JUNIOR},
+			{UserId: "u4", Username: "Dave", IsActive: true, Role: models.TEAM_SENIOR},
+		}},
+	} {
+		_, err := svc.TeamAdd(ctx, team)
+		mustNil(t, err)
+	}
+
+	expectReviewers := func(prId string, reviewers []string, policy *models.PolicyResult) {
+		t.Helper()
+		pr, err := svc.PullRequestCreate(ctx, prId, prId, "u1", "")
+		mustNil(t, err)
+		if !reflect.DeepEqual(pr.AssignedReviewers, reviewers) || !reflect.DeepEqual(pr.Policy, policy) {
+			t.Fatalf("Expected %v with %+v, got %v with %+v", reviewers, policy, pr.AssignedReviewers, pr.Policy)
+		}
+	}
+	satisfied := &models.PolicyResult{Satisfied: true, Violations: []string{}}
+
+	expectReviewers("r1", []string{"u2", "u3"}, nil)
+
+	_, err := svc.TeamSetPolicy(ctx, "backend", &models.TeamPolicy{RequireSenior: true, NoJuniorOnly: true})
+	mustNil(t, err)
+	expectReviewers("r2", []string{"u4", "u2"}, satisfied)
+
+	// without a senior in the team the lead of the department steps in
+	_, err = svc.TeamSetMemberRole(ctx, "backend", "u4", models.TEAM_JUNIOR)
+	mustNil(t, err)
+	expectReviewers("r3", []string{"u5", "u2"}, satisfied)
+
+	pr, _, err := svc.PullRequestReassign(ctx, "r3", "u5", "u3")
+	mustNil(t, err)
+	expected := &models.PolicyResult{Violations: []string{POLICY_NO_SENIOR, POLICY_JUNIOR_ONLY}}
+	if !reflect.DeepEqual(pr.Policy, expected) {
+		t.Fatalf("Expected the reassignment to break the policy, got %+v", pr.Policy)
+	}
+
+	var svcErr ErrorService
+	if _, err = svc.TeamSetMemberRole(ctx, "backend", "u4", "BOSS"); !errors.As(err, &svcErr) || svcErr.ApiCode != models.VALIDATION_ERROR {
+		t.Fatalf("Expected an unknown role to be rejected, got %v", err)
+	}
+	if _, err = svc.TeamSetMemberRole(ctx, "backend", "u5", models.TEAM_SENIOR); !errors.As(err, &svcErr) || svcErr.Code != OBJECT_NOT_FOUND {
+		t.Fatalf("Expected a non-member to be rejected, got %v", err)
+	}
+
+	team, err := svc.TeamSetPolicy(ctx, "backend", &models.TeamPolicy{})
+	mustNil(t, err)
+	if team.Policy != nil {
+		t.Fatalf("Expected an empty policy to be removed, got %+v", team.Policy)
+	}
+
+	// roles belong to the team, joining another one or deactivation keep them
+	frontend, err := svc.TeamAdd(ctx, models.Team{TeamName: "frontend", Members: []models.TeamMember{
+		{UserId: "u2", Username: "Bob", IsActive: true, Role: models.TEAM_SENIOR},
+	}})
+	mustNil(t, err)
+	if frontend.Members[0].Role != models.TEAM_SENIOR {
+		t.Fatalf("Expected u2 to be senior in frontend, got %+v", frontend.Members[0])
+	}
+	_, err = svc.UsersSetIsActive(ctx, "u2", false)
+	mustNil(t, err)
+	for teamName, role := range map[string]models.TeamRole{"backend": models.TEAM_JUNIOR, "frontend": models.TEAM_SENIOR} {
+		team, err := svc.TeamGet(ctx, teamName)
+		mustNil(t, err)
+		for _, member := range team.Members {
+			if member.UserId == "u2" && member.Role != role {
+				t.Fatalf("Expected u2 to stay %s in %s, got %s", role, teamName, member.Role)
+			}
+		}
+	}
+
+	report, err := svc.CheckConsistency(ctx, false)
+	mustNil(t, err)
+	if !report.Consistent {
+		t.Fatalf("Expected no violations, got %+v", report.Violations)
+	}
+}
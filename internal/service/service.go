@@ -1,17 +1,29 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"time"
 
+	"github.com/Dowtai/pr-reviewer-service/internal/clock"
+	"github.com/Dowtai/pr-reviewer-service/internal/ids"
 	"github.com/Dowtai/pr-reviewer-service/internal/models"
 	"github.com/Dowtai/pr-reviewer-service/internal/repo"
 )
 
+// The statuses of the errors; OBJECT_EXISTS and INVALID_FIELDS share one,
+// their api codes tell them apart.
 const (
 	OBJECT_EXISTS    int = 400
+	INVALID_FIELDS   int = 400
+	UNAUTHENTICATED  int = 401
+	FORBIDDEN        int = 403
 	OBJECT_NOT_FOUND int = 404
 	DOMAIN_ERROR     int = 409
+	INVALID_INPUT    int = 422
 	INTERNAL_ERROR   int = 500
 )
 
@@ -19,6 +31,8 @@ type ErrorService struct {
 	Code    int
 	ApiCode models.ErrorDetailCode
 	Message string
+	// Details lists the invalid fields of an INVALID_FIELDS.
+	Details []models.FieldError
 }
 
 func (e ErrorService) Error() string {
@@ -41,29 +55,110 @@ func NewErrorApi(code int, apiCode models.ErrorDetailCode, message string) Error
 	}
 }
 
+// Listener is notified after pull request events are recorded.
+// It is called synchronously, so slow work should be moved to a goroutine.
+type Listener interface {
+	OnPullRequestEvents(ctx context.Context, pr models.PullRequest, events []models.PullRequestEvent)
+}
+
+// DomainErrorListener is an optional extension of Listener, notified when an
+// operation is rejected by a domain rule (NO_CANDIDATE, PR_MERGED...).
+type DomainErrorListener interface {
+	OnDomainError(ctx context.Context, code models.ErrorDetailCode)
+}
+
 type PrReviewerService struct {
-	repo repo.Repo
+	tenants   repo.TenantRepo
+	clock     clock.Clock
+	ids       ids.Generator
+	listeners []Listener
+	// locks are shared by the scoped copies, see entityLocks.
+	locks *entityLocks
+
+	// tenantId, repo, auditRepo and eventRepo are only set on the copies
+	// made by scope.
+	tenantId  string
+	repo      repo.Repo
+	auditRepo repo.AuditRepo
+	eventRepo repo.EventRepo
 }
 
-func NewService(repo repo.Repo) *PrReviewerService {
+// NewService serves the tenants of the repo. Every timestamp the service
+// sets comes from clock, and the ids it makes up, such as the request ids of
+// background work, from ids.
+func NewService(tenants repo.TenantRepo, clock clock.Clock, ids ids.Generator) *PrReviewerService {
 	return &PrReviewerService{
-		repo: repo,
+		tenants: tenants,
+		clock:   clock,
+		ids:     ids,
+		locks:   newEntityLocks(),
 	}
 }
 
-func (s *PrReviewerService) TeamAdd(team models.Team) (models.Team, error) {
+// scope returns the service bound to the storage of the request's tenant.
+// Every exported method starts with it, so a method cannot reach the data of
+// another tenant, and the service it is called on has no storage at all.
+func (s *PrReviewerService) scope(ctx context.Context) (*PrReviewerService, error) {
+	tenantId := TenantFromContext(ctx)
+	if actor := ActorFromContext(ctx); actor.Tenant != "" && actor.Tenant != tenantId {
+		return nil, NewErrorApi(FORBIDDEN, models.FORBIDDEN, fmt.Sprintf("actor %s belongs to tenant %s", actor.Name, actor.Tenant))
+	}
+	store := s.tenants.Store(tenantId)
+	if store == nil {
+		return nil, NewErrorApi(OBJECT_NOT_FOUND, models.TENANT_NOT_FOUND, fmt.Sprintf("tenant %s not found", tenantId))
+	}
+
+	scoped := *s
+	scoped.tenantId = tenantId
+	scoped.repo, scoped.auditRepo, scoped.eventRepo = store.Repo, store.AuditRepo, store.EventRepo
+	return &scoped, nil
+}
+
+// AddListener registers l for pull request events. It is not safe to call
+// concurrently with requests, listeners should be added on startup.
+func (s *PrReviewerService) AddListener(l Listener) {
+	s.listeners = append(s.listeners, l)
+}
+
+func (s *PrReviewerService) TeamAdd(ctx context.Context, team models.Team) (models.Team, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return team, err
+	}
+
+	var rules inputRules
+	rules.team("", team)
+	if err := rules.err(); err != nil {
+		return team, err
+	}
+
+	// the members are locked as well, their teams change
+	keys := []string{s.teamKey(team.TeamName)}
+	for _, member := range team.Members {
+		keys = append(keys, s.userKey(member.UserId))
+	}
+	defer s.locks.lock(keys...)()
+
 	if s.repo.TeamExists(team.TeamName) {
 		return team, NewErrorApi(OBJECT_EXISTS, models.TEAM_EXISTS, "Team already exists")
 	}
+	// the parent has to exist already, so the teams cannot form a cycle
+	if team.ParentTeam != "" && !s.repo.TeamExists(team.ParentTeam) {
+		return team, NewErrorApi(OBJECT_NOT_FOUND, models.NOT_FOUND, "parent team not found")
+	}
 
-	var err error
-	for _, member := range team.Members {
+	// existing users join the team as they are, keeping their primary team;
+	// new users get this team as the primary one
+	team.Members = slices.Clone(team.Members)
+	for i, member := range team.Members {
 		if user := s.repo.GetUserById(member.UserId); user != nil {
-			return team, NewErrorService(INTERNAL_ERROR, "user already exists")
+			user.Teams = append(user.Teams, team.TeamName)
+			err = s.repo.UpdateUser(user)
+			team.Members[i] = models.NewTeamMember(user)
+			team.Members[i].Role = member.Role
 		} else {
 			newUser := models.NewUser(member.UserId, member.Username, team.TeamName, member.IsActive)
 			err = s.repo.CreateUser(newUser)
-
 		}
 
 		if err != nil {
@@ -76,10 +171,25 @@ func (s *PrReviewerService) TeamAdd(team models.Team) (models.Team, error) {
 		return team, NewErrorService(INTERNAL_ERROR, err.Error())
 	}
 
+	if err = s.audit(ctx, models.TEAM_ADD, models.TEAM_ENTITY, team.TeamName, nil, team); err != nil {
+		return team, err
+	}
+
 	return team, nil
 }
 
-func (s *PrReviewerService) TeamGet(teamName string) (models.Team, error) {
+func (s *PrReviewerService) TeamGet(ctx context.Context, teamName string) (models.Team, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return models.Team{}, err
+	}
+
+	var rules inputRules
+	rules.name("team_name", teamName)
+	if err := rules.err(); err != nil {
+		return models.Team{}, err
+	}
+
 	if t := s.repo.GetTeamByName(teamName); t != nil {
 		return *t, nil
 	}
@@ -87,142 +197,453 @@ func (s *PrReviewerService) TeamGet(teamName string) (models.Team, error) {
 	return models.Team{}, NewErrorApi(OBJECT_NOT_FOUND, models.NOT_FOUND, "Team not found")
 }
 
-func (s *PrReviewerService) UsersSetIsActive(userId string, isActive bool) (models.User, error) {
+func (s *PrReviewerService) UsersSetIsActive(ctx context.Context, userId string, isActive bool) (models.User, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	var rules inputRules
+	rules.id("user_id", userId)
+	if err := rules.err(); err != nil {
+		return models.User{}, err
+	}
+	defer s.locks.lock(s.userKey(userId))()
+
 	if user := s.repo.GetUserById(userId); user != nil {
+		before := *user
 		user.IsActive = isActive
 		err := s.repo.UpdateUser(user)
 		if err != nil {
 			return *user, NewErrorService(INTERNAL_ERROR, err.Error())
 		}
-		team := s.repo.GetTeamByName(user.TeamName)
-		if team == nil {
-			return *user, NewErrorApi(INTERNAL_ERROR, models.FATAL_ERROR, "Team not found")
+		for _, teamName := range user.Teams {
+			team := s.repo.GetTeamByName(teamName)
+			if team == nil {
+				return *user, NewErrorApi(INTERNAL_ERROR, models.FATAL_ERROR, "Team not found")
+			}
+			err = s.repo.UpdateTeamMember(team, user)
+			if err != nil {
+				return *user, NewErrorService(INTERNAL_ERROR, err.Error())
+			}
 		}
-		err = s.repo.UpdateTeamMember(team, user)
-		if err != nil {
-			return *user, NewErrorService(INTERNAL_ERROR, err.Error())
+		if err = s.audit(ctx, models.USER_SET_ACTIVE, models.USER_ENTITY, userId, before, *user); err != nil {
+			return *user, err
 		}
 		return *user, nil
 	}
 	return models.User{}, NewErrorApi(OBJECT_NOT_FOUND, models.NOT_FOUND, "User not found")
 }
 
-func (s *PrReviewerService) PullRequestCreate(pullRequestId, pullRequestName, authorId string) (models.PullRequest, error) {
+// UsersSetPrimaryTeam makes one of the user's teams the primary one.
+func (s *PrReviewerService) UsersSetPrimaryTeam(ctx context.Context, userId, teamName string) (models.User, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	var rules inputRules
+	rules.id("user_id", userId)
+	rules.name("team_name", teamName)
+	if err := rules.err(); err != nil {
+		return models.User{}, err
+	}
+	defer s.locks.lock(s.userKey(userId))()
+
+	user := s.repo.GetUserById(userId)
+	if user == nil {
+		return models.User{}, NewErrorApi(OBJECT_NOT_FOUND, models.NOT_FOUND, "User not found")
+	}
+	if !user.InTeam(teamName) {
+		return *user, s.domainError(ctx, models.WRONG_TEAM, fmt.Sprintf("user is not a member of team %s", teamName))
+	}
+	if user.TeamName == teamName {
+		return *user, nil
+	}
+
+	before := *user
+	user.TeamName = teamName
+	if err := s.repo.UpdateUser(user); err != nil {
+		return *user, NewErrorService(INTERNAL_ERROR, err.Error())
+	}
+	if err := s.audit(ctx, models.USER_SET_PRIMARY, models.USER_ENTITY, userId, before, *user); err != nil {
+		return *user, err
+	}
+	return *user, nil
+}
+
+// PullRequestCreate assigns up to two reviewers from teamName, which has to
+// be one of the author's teams, or from the author's primary team when
+// teamName is empty.
+func (s *PrReviewerService) PullRequestCreate(ctx context.Context, pullRequestId, pullRequestName, authorId, teamName string) (models.PullRequest, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return models.PullRequest{}, err
+	}
+
+	var rules inputRules
+	rules.id("pull_request_id", pullRequestId)
+	rules.name("pull_request_name", pullRequestName)
+	rules.id("author_id", authorId)
+	if teamName != "" {
+		rules.name("team_name", teamName)
+	}
+	if err := rules.err(); err != nil {
+		return models.PullRequest{}, err
+	}
+	// the primary team is read before locking; should it change meanwhile,
+	// the create counts as done before the change, the team is checked again
+	if user := s.repo.GetUserById(authorId); user != nil && teamName == "" {
+		teamName = user.TeamName
+	}
+	picked, unlock := s.lockReviewers(pullRequestId, authorId, teamName)
+	defer unlock()
+
 	if pr := s.repo.GetPullRequestById(pullRequestId); pr != nil {
-		return *pr, NewErrorApi(DOMAIN_ERROR, models.PR_EXISTS, "Pull request already exists")
+		return *pr, s.domainError(ctx, models.PR_EXISTS, "Pull request already exists")
 	}
 
 	user := s.repo.GetUserById(authorId)
 	if user == nil {
 		return models.PullRequest{}, NewErrorApi(OBJECT_NOT_FOUND, models.NOT_FOUND, "author not found")
 	}
-	team := s.repo.GetTeamByName(user.TeamName)
+	team := s.repo.GetTeamByName(teamName)
 	if team == nil {
 		return models.PullRequest{}, NewErrorApi(OBJECT_NOT_FOUND, models.NOT_FOUND, "team not found")
 	}
+	if !user.InTeam(teamName) {
+		return models.PullRequest{}, s.domainError(ctx, models.WRONG_TEAM, fmt.Sprintf("author is not a member of team %s", teamName))
+	}
 
-	reviewers := make([]string, 0, 2)
-
-	for _, member := range team.Members {
-		if member.UserId == authorId {
-			continue
-		}
-		if member.IsActive {
-			reviewers = append(reviewers, member.UserId)
-		}
-		if len(reviewers) == 2 {
-			break
-		}
+	reviewers := make([]string, 0, len(picked))
+	for _, reviewer := range picked {
+		reviewers = append(reviewers, reviewer.UserId)
 	}
 
-	now := time.Now()
+	now := s.clock.Now()
 	pr := models.NewPR(pullRequestId, pullRequestName, authorId, models.OPEN, reviewers, &now)
+	pr.TeamName = teamName
+	pr.Policy = checkPolicy(team.Policy, picked)
+	if len(reviewers) > 0 {
+		pr.AssignedAt = make(map[string]time.Time, len(reviewers))
+		for _, reviewer := range reviewers {
+			pr.AssignedAt[reviewer] = now
+		}
+	}
 
-	if err := s.repo.CreatePR(pr); err != nil {
+	if err := s.repo.CreateIndexedPR(pr); err != nil {
 		return pr, NewErrorService(INTERNAL_ERROR, err.Error())
 	}
 
+	events := []models.PullRequestEvent{models.NewPRCreatedEvent(&pr, now)}
 	for _, reviewer := range reviewers {
-		err := s.repo.AddPRToUser(reviewer, pullRequestId)
-		if err != nil {
-			fmt.Println(err.Error(), reviewer)
-			return models.PullRequest{}, NewErrorService(INTERNAL_ERROR, err.Error())
-		}
+		events = append(events, models.NewReviewerAssignedEvent(pullRequestId, reviewer, now))
+	}
+	if err := s.recordEvents(ctx, &pr, events...); err != nil {
+		return pr, err
+	}
+
+	if err := s.audit(ctx, models.PR_CREATE, models.PR_ENTITY, pullRequestId, nil, pr); err != nil {
+		return pr, err
 	}
 
 	return pr, nil
 }
 
-func (s *PrReviewerService) PullRequestMerge(pullRequestId string) (models.PullRequest, error) {
+func (s *PrReviewerService) PullRequestMerge(ctx context.Context, pullRequestId string) (models.PullRequest, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return models.PullRequest{}, err
+	}
+
+	var rules inputRules
+	rules.id("pull_request_id", pullRequestId)
+	if err := rules.err(); err != nil {
+		return models.PullRequest{}, err
+	}
+	defer s.locks.lock(s.prKey(pullRequestId))()
+
 	if pr := s.repo.GetPullRequestById(pullRequestId); pr != nil {
-		if pr.Status != models.MERGED {
-			now := time.Now()
-			pr.Status = models.MERGED
-			pr.MergedAt = &now
+		if pr.Status == models.MERGED {
+			return *pr, nil
 		}
+		if pr.Status == models.CLOSED {
+			return *pr, s.domainError(ctx, models.PR_CLOSED, "cannot merge closed PR")
+		}
+
+		before := *pr
+		now := s.clock.Now()
+		pr.Status = models.MERGED
+		pr.MergedAt = &now
 		if err := s.repo.UpdatePR(pr); err != nil {
 			return *pr, NewErrorService(INTERNAL_ERROR, err.Error())
 		}
+		if err := s.recordEvents(ctx, pr, models.NewPRMergedEvent(pullRequestId, now)); err != nil {
+			return *pr, err
+		}
+		if err := s.audit(ctx, models.PR_MERGE, models.PR_ENTITY, pullRequestId, before, *pr); err != nil {
+			return *pr, err
+		}
 		return *pr, nil
 	}
 
 	return models.PullRequest{}, NewErrorApi(OBJECT_NOT_FOUND, models.NOT_FOUND, "Pull request not found")
 }
 
-func (s *PrReviewerService) PullRequestReassign(pullRequestId, oldUserId string) (models.PullRequest, string, error) {
+func (s *PrReviewerService) PullRequestClose(ctx context.Context, pullRequestId string) (models.PullRequest, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return models.PullRequest{}, err
+	}
+
+	var rules inputRules
+	rules.id("pull_request_id", pullRequestId)
+	if err := rules.err(); err != nil {
+		return models.PullRequest{}, err
+	}
+	defer s.locks.lock(s.prKey(pullRequestId))()
+
+	if pr := s.repo.GetPullRequestById(pullRequestId); pr != nil {
+		if pr.Status == models.CLOSED {
+			return *pr, nil
+		}
+		if pr.Status == models.MERGED {
+			return *pr, s.domainError(ctx, models.PR_MERGED, "cannot close merged PR")
+		}
+
+		before := *pr
+		now := s.clock.Now()
+		pr.Status = models.CLOSED
+		pr.ClosedAt = &now
+		if err := s.repo.UpdatePR(pr); err != nil {
+			return *pr, NewErrorService(INTERNAL_ERROR, err.Error())
+		}
+		if err := s.recordEvents(ctx, pr, models.NewPRClosedEvent(pullRequestId, now)); err != nil {
+			return *pr, err
+		}
+		if err := s.audit(ctx, models.PR_CLOSE, models.PR_ENTITY, pullRequestId, before, *pr); err != nil {
+			return *pr, err
+		}
+		return *pr, nil
+	}
+
+	return models.PullRequest{}, NewErrorApi(OBJECT_NOT_FOUND, models.NOT_FOUND, "Pull request not found")
+}
+
+func (s *PrReviewerService) PullRequestReassign(ctx context.Context, pullRequestId, oldUserId, newUserId string) (models.PullRequest, string, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return models.PullRequest{}, "", err
+	}
+
+	var rules inputRules
+	rules.id("pull_request_id", pullRequestId)
+	rules.id("old_user_id", oldUserId)
+	if newUserId != "" {
+		rules.id("new_user_id", newUserId)
+	}
+	if err := rules.err(); err != nil {
+		return models.PullRequest{}, "", err
+	}
+	if actor := ActorFromContext(ctx); actor.Role == models.ROLE_USER && actor.Name != oldUserId {
+		return models.PullRequest{}, "", NewErrorApi(FORBIDDEN, models.FORBIDDEN, "users may only reassign themselves")
+	}
+	// the replacement is locked with the pull request and checked again
+	// under the lock, nobody deactivates or moves them meanwhile
+	candidateId, unlock := s.lockReplacement(pullRequestId, func() string {
+		if newUserId != "" {
+			return newUserId
+		}
+		pr, user := s.repo.GetPullRequestById(pullRequestId), s.repo.GetUserById(oldUserId)
+		if pr == nil || user == nil {
+			return ""
+		}
+		return s.findReplacement(pr, user)
+	})
+	defer unlock()
+
 	pr, user := s.repo.GetPullRequestById(pullRequestId), s.repo.GetUserById(oldUserId)
 	if pr == nil || user == nil {
 		return models.PullRequest{}, "", NewErrorApi(OBJECT_NOT_FOUND, models.NOT_FOUND, "Pull request or user not found")
 	}
 	if pr.Status == models.MERGED {
-		return *pr, "", NewErrorApi(DOMAIN_ERROR, models.PR_MERGED, "cannot reassign on merged PR")
+		return *pr, "", s.domainError(ctx, models.PR_MERGED, "cannot reassign on merged PR")
+	}
+	if pr.Status == models.CLOSED {
+		return *pr, "", s.domainError(ctx, models.PR_CLOSED, "cannot reassign on closed PR")
 	}
 
-	for i, reviewer := range pr.AssignedReviewers {
+	for _, reviewer := range pr.AssignedReviewers {
 		if reviewer == oldUserId {
-			team := s.repo.GetTeamByName(user.TeamName)
-			for _, candidate := range team.Members {
-				if candidate.UserId != pr.AuthorId && candidate.UserId != reviewer && candidate.IsActive {
-					// I see 2 solutions here: hash map or just for iterating
-					// number of reviewers of PR - only 2
-					// I can hardcode with ifs, but I think code with simple extension will be better
-					// there are no real reasons to use hash map instead of iterating on such small numbers
-					collision := false
-					for _, r := range pr.AssignedReviewers {
-						if candidate.UserId == r {
-							collision = true
-						}
-					}
-					if !collision {
-						pr.AssignedReviewers[i] = candidate.UserId
-
-						err := s.repo.UpdatePR(pr)
-						if err != nil {
-							return *pr, candidate.UserId, NewErrorService(INTERNAL_ERROR, err.Error())
-						}
-
-						err = s.repo.AddPRToUser(candidate.UserId, pullRequestId)
-						if err != nil {
-							return *pr, candidate.UserId, NewErrorService(INTERNAL_ERROR, err.Error())
-						}
-
-						err = s.repo.RemovePRFromUser(oldUserId, pullRequestId)
-						if err != nil {
-							return *pr, candidate.UserId, NewErrorService(INTERNAL_ERROR, err.Error())
-						}
-
-						return *pr, candidate.UserId, nil
-					}
+			if newUserId != "" {
+				if err := s.checkReplacement(ctx, pr, user, newUserId); err != nil {
+					return *pr, "", err
 				}
+			} else if candidateId == "" {
+				return *pr, "", s.domainError(ctx, models.NO_CANDIDATE, "no active replacement candidate in team")
 			}
-			return *pr, "", NewErrorApi(DOMAIN_ERROR, models.NO_CANDIDATE, "no active replacement candidate in team")
+
+			err := s.replaceReviewer(ctx, pr, oldUserId, candidateId, s.clock.Now(), false)
+			return *pr, candidateId, err
 		}
 	}
 
-	return *pr, "", NewErrorApi(DOMAIN_ERROR, models.NOT_ASSIGNED, "reviewer is not assigned to this PR")
+	return *pr, "", s.domainError(ctx, models.NOT_ASSIGNED, "reviewer is not assigned to this PR")
 }
 
-func (s *PrReviewerService) UsersGetReview(userId string) ([]models.PullRequestShort, error) {
+// replaceReviewer gives the review of oldUserId on pr to candidateId at now
+// and records it, automatic when the stale review scheduler does it. The
+// caller holds the locks of pr and candidateId; the pull request and its review index are
+// changed together, and pr is updated to what was stored.
+func (s *PrReviewerService) replaceReviewer(ctx context.Context, pr *models.PullRequest, oldUserId, candidateId string, now time.Time, automatic bool) error {
+	before := *pr
+	team := s.repo.GetTeamByName(pr.TeamName)
+	updated, err := s.repo.ModifyPR(pr.PullRequestId, func(stored *models.PullRequest) error {
+		i := slices.Index(stored.AssignedReviewers, oldUserId)
+		if stored.Status != models.OPEN || i < 0 || slices.Contains(stored.AssignedReviewers, candidateId) {
+			return errors.New("pull_request changed during reassign")
+		}
+		stored.AssignedReviewers[i] = candidateId
+		if stored.AssignedAt == nil {
+			stored.AssignedAt = make(map[string]time.Time, 1)
+		}
+		delete(stored.AssignedAt, oldUserId)
+		stored.AssignedAt[candidateId] = now
+		if team != nil {
+			stored.Policy = checkPolicy(team.Policy, s.reviewerMembers(stored, team))
+		}
+		return nil
+	})
+	if err != nil {
+		return NewErrorService(INTERNAL_ERROR, err.Error())
+	}
+	if updated == nil {
+		return NewErrorService(INTERNAL_ERROR, "reassigning non-existing pull_request")
+	}
+	*pr = *updated
+
+	event := models.NewReviewerReplacedEvent(pr.PullRequestId, oldUserId, candidateId, now)
+	event.Automatic = automatic
+	if err := s.recordEvents(ctx, pr, event); err != nil {
+		return err
+	}
+	return s.audit(ctx, models.PR_REASSIGN, models.PR_ENTITY, pr.PullRequestId, before, *pr)
+}
+
+// findReplacement returns the first active member who can take over the
+// review, or "" when there is nobody. The pull request's team is searched
+// first, then the teams of the old reviewer, the primary one first, and at
+// last the ancestors of the pull request's team. The excluded users are
+// skipped.
+func (s *PrReviewerService) findReplacement(pr *models.PullRequest, oldReviewer *models.User, excluded ...string) string {
+	teamNames := make([]string, 0, len(oldReviewer.Teams)+2)
+	for _, teamName := range append([]string{pr.TeamName, oldReviewer.TeamName}, oldReviewer.Teams...) {
+		if teamName != "" && !slices.Contains(teamNames, teamName) {
+			teamNames = append(teamNames, teamName)
+		}
+	}
+
+	for _, teamName := range teamNames {
+		team := s.repo.GetTeamByName(teamName)
+		if team == nil {
+			continue
+		}
+		for _, candidate := range team.Members {
+			if canReplace(pr, candidate) && !slices.Contains(excluded, candidate.UserId) {
+				return candidate.UserId
+			}
+		}
+	}
+
+	for _, pool := range s.escalationPools(escalationTeam(pr, oldReviewer)) {
+		for _, candidate := range pool {
+			if canReplace(pr, candidate) && !slices.Contains(excluded, candidate.UserId) {
+				return candidate.UserId
+			}
+		}
+	}
+	return ""
+}
+
+func canReplace(pr *models.PullRequest, candidate models.TeamMember) bool {
+	return candidate.UserId != pr.AuthorId && candidate.IsActive && !isAssigned(pr, candidate.UserId)
+}
+
+// escalationTeam is the team whose ancestors are searched for a replacement:
+// the pull request's one, or the old reviewer's primary team for pull
+// requests that do not know their team.
+func escalationTeam(pr *models.PullRequest, oldReviewer *models.User) string {
+	if pr.TeamName != "" {
+		return pr.TeamName
+	}
+	return oldReviewer.TeamName
+}
+
+// checkReplacement validates an explicitly requested replacement reviewer.
+// The candidate has to share a team with the old reviewer or, as a
+// fallback, with the author, or come from the subtree of an ancestor of the
+// pull request's team.
+func (s *PrReviewerService) checkReplacement(ctx context.Context, pr *models.PullRequest, oldReviewer *models.User, newUserId string) error {
+	candidate := s.repo.GetUserById(newUserId)
+	if candidate == nil {
+		return NewErrorApi(OBJECT_NOT_FOUND, models.NOT_FOUND, "new reviewer not found")
+	}
+	if candidate.UserId == pr.AuthorId {
+		return s.domainError(ctx, models.CANDIDATE_IS_AUTHOR, "author cannot review own PR")
+	}
+	if isAssigned(pr, candidate.UserId) {
+		return s.domainError(ctx, models.ALREADY_ASSIGNED, "new reviewer is already assigned to this PR")
+	}
+	if !candidate.IsActive {
+		return s.domainError(ctx, models.CANDIDATE_INACTIVE, "new reviewer is not active")
+	}
+
+	if slices.ContainsFunc(candidate.Teams, oldReviewer.InTeam) {
+		return nil
+	}
+	if author := s.repo.GetUserById(pr.AuthorId); author != nil && slices.ContainsFunc(candidate.Teams, author.InTeam) {
+		return nil
+	}
+	for _, pool := range s.escalationPools(escalationTeam(pr, oldReviewer)) {
+		if slices.ContainsFunc(pool, func(m models.TeamMember) bool { return m.UserId == newUserId }) {
+			return nil
+		}
+	}
+	return s.domainError(ctx, models.WRONG_TEAM, "new reviewer is not in reviewer's or author's team")
+}
+
+func (s *PrReviewerService) domainError(ctx context.Context, code models.ErrorDetailCode, message string) error {
+	for _, l := range s.listeners {
+		if el, ok := l.(DomainErrorListener); ok {
+			el.OnDomainError(ctx, code)
+		}
+	}
+	return NewErrorApi(DOMAIN_ERROR, code, message)
+}
+
+func isAssigned(pr *models.PullRequest, userId string) bool {
+	// number of reviewers of PR - only 2
+	// there are no real reasons to use hash map instead of iterating on such small numbers
+	for _, r := range pr.AssignedReviewers {
+		if r == userId {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *PrReviewerService) UsersGetReview(ctx context.Context, userId string) ([]models.PullRequestShort, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules inputRules
+	rules.id("user_id", userId)
+	if err := rules.err(); err != nil {
+		return nil, err
+	}
+
 	if user := s.repo.GetUserById(userId); user == nil {
 		return nil, NewErrorApi(404, models.NOT_FOUND, "user not found")
 	}
@@ -231,12 +652,72 @@ func (s *PrReviewerService) UsersGetReview(userId string) ([]models.PullRequestS
 	if prs == nil {
 		return make([]models.PullRequestShort, 0), nil
 	}
-	fmt.Println(userId, prs)
+
+	assigned := make([]models.PullRequest, 0, len(prs))
+	for _, pr := range prs {
+		assigned = append(assigned, *pr)
+	}
+	overdue := make(map[string]bool)
+	for _, review := range s.overdueReviews(assigned, s.clock.Now()) {
+		if review.ReviewerId == userId {
+			overdue[review.PullRequestId] = true
+		}
+	}
 
 	prsShort := make([]models.PullRequestShort, 0, len(prs))
 	for _, pr := range prs {
-		prsShort = append(prsShort, models.NewPRShort(pr))
+		short := models.NewPRShort(pr)
+		short.Overdue = overdue[pr.PullRequestId]
+		prsShort = append(prsShort, short)
 	}
 
 	return prsShort, nil
 }
+
+func (s *PrReviewerService) AuditQuery(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.auditRepo.GetAuditEvents(filter), nil
+}
+
+// RecordAudit appends an event about a mutation made outside the service,
+// such as a webhook subscription, to the audit log of the request's tenant.
+func (s *PrReviewerService) RecordAudit(ctx context.Context, action models.AuditAction, entityType models.AuditEntity, entityId string, before, after any) error {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.audit(ctx, action, entityType, entityId, before, after)
+}
+
+// audit appends an event about a successful mutation. before and after are
+// snapshots of the entity; nil means the entity did not exist (or was removed).
+func (s *PrReviewerService) audit(ctx context.Context, action models.AuditAction, entityType models.AuditEntity, entityId string, before, after any) error {
+	beforeJson, err := marshalSnapshot(before)
+	if err != nil {
+		return NewErrorService(INTERNAL_ERROR, err.Error())
+	}
+	afterJson, err := marshalSnapshot(after)
+	if err != nil {
+		return NewErrorService(INTERNAL_ERROR, err.Error())
+	}
+
+	actor := ActorFromContext(ctx)
+	event := models.NewAuditEvent(s.clock.Now(), actor.Name, RequestIdFromContext(ctx), action, entityType, entityId, beforeJson, afterJson)
+	event.ActorRole = actor.Role
+	if _, err = s.auditRepo.AppendAuditEvent(event); err != nil {
+		return NewErrorService(INTERNAL_ERROR, err.Error())
+	}
+	return nil
+}
+
+func marshalSnapshot(snapshot any) (json.RawMessage, error) {
+	if snapshot == nil {
+		return nil, nil
+	}
+	return json.Marshal(snapshot)
+}
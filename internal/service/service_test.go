@@ -0,0 +1,382 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/clock"
+	"github.com/Dowtai/pr-reviewer-service/internal/ids"
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/repo"
+	"github.com/Dowtai/pr-reviewer-service/internal/repo/memory_repo"
+)
+
+// testEpoch is where the fake clock of the test services starts.
+var testEpoch = time.Date(2025, time.March, 3, 9, 0, 0, 0, time.UTC)
+
+func newMemoryService() *PrReviewerService {
+	return newServiceWithRepo(memory_repo.NewMemoryRepo())
+}
+
+// newServiceWithRepo serves the default tenant from r, on a fake clock
+// standing at testEpoch and with ids bg-1, bg-2...
+func newServiceWithRepo(r repo.Repo) *PrReviewerService {
+	store := memory_repo.NewMemoryStore()
+	store.Repo = r
+	clk := clock.NewFake(testEpoch)
+	return NewService(memory_repo.NewMemoryTenantRepo(store, clk), clk, ids.NewSequence("bg-"))
+}
+
+func defaultStore(svc *PrReviewerService) *repo.Store {
+	return svc.tenants.Store(models.DEFAULT_TENANT)
+}
+
+func fakeClock(svc *PrReviewerService) *clock.Fake {
+	return svc.clock.(*clock.Fake)
+}
+
+// expectError fails unless err is an ErrorService with the code and apiCode.
+func expectError(t *testing.T, err error, code int, apiCode models.ErrorDetailCode) {
+	t.Helper()
+	var svcErr ErrorService
+	if !errors.As(err, &svcErr) || svcErr.Code != code || svcErr.ApiCode != apiCode {
+		t.Fatalf("Expected %d %s, got %v", code, apiCode, err)
+	}
+}
+
+// newBackendService has team backend with u1..u4 active and u5 inactive.
+func newBackendService(t *testing.T) *PrReviewerService {
+	t.Helper()
+	svc := newMemoryService()
+	_, err := svc.TeamAdd(context.Background(), models.Team{TeamName: "backend", Members: []models.TeamMember{
+		{UserId: "u1", Username: "Alice", IsActive: true},
+		{UserId: "u2", Username: "Bob", IsActive: true},
+		{UserId: "u3", Username: "Carol", IsActive: true},
+		{UserId: "u4", Username: "Dave", IsActive: true},
+		{UserId: "u5", Username: "Eve", IsActive: false},
+	}})
+	mustNil(t, err)
+	return svc
+}
+
+func TestTeamAddAndGet(t *testing.T) {
+	ctx := WithRequestId(WithActor(context.Background(), Actor{Name: "admin", Role: models.ROLE_ADMIN}), "req-1")
+	svc := newBackendService(t)
+
+	team, err := svc.TeamGet(ctx, "backend")
+	mustNil(t, err)
+	if len(team.Members) != 5 || team.Members[4] != (models.TeamMember{UserId: "u5", Username: "Eve", IsActive: false}) {
+		t.Fatalf("Unexpected team %+v", team)
+	}
+	user := defaultStore(svc).Repo.GetUserById("u1")
+	if user == nil || user.TeamName != "backend" || !reflect.DeepEqual(user.Teams, []string{"backend"}) {
+		t.Fatalf("Expected u1 to be created in backend, got %+v", user)
+	}
+
+	_, err = svc.TeamAdd(ctx, models.Team{TeamName: "backend", Members: []models.TeamMember{}})
+	expectError(t, err, OBJECT_EXISTS, models.TEAM_EXISTS)
+	_, err = svc.TeamGet(ctx, "frontend")
+	expectError(t, err, OBJECT_NOT_FOUND, models.NOT_FOUND)
+	_, err = svc.TeamGet(ctx, "")
+	expectError(t, err, INVALID_FIELDS, models.VALIDATION_ERROR)
+
+	fakeClock(svc).Advance(time.Minute)
+	_, err = svc.TeamAdd(ctx, models.Team{TeamName: "frontend", Members: []models.TeamMember{}})
+	mustNil(t, err)
+	events, err := svc.AuditQuery(ctx, models.AuditFilter{EntityId: "frontend"})
+	mustNil(t, err)
+	if len(events) != 1 {
+		t.Fatalf("Expected one audit event, got %+v", events)
+	}
+	event := events[0]
+	if event.Action != models.TEAM_ADD || event.Actor != "admin" || event.ActorRole != models.ROLE_ADMIN ||
+		event.RequestId != "req-1" || !event.Timestamp.Equal(testEpoch.Add(time.Minute)) || event.Before != nil {
+		t.Fatalf("Unexpected audit event %+v", event)
+	}
+}
+
+func TestUsersSetIsActive(t *testing.T) {
+	ctx := context.Background()
+	svc := newBackendService(t)
+
+	user, err := svc.UsersSetIsActive(ctx, "u2", false)
+	mustNil(t, err)
+	if user.IsActive {
+		t.Fatalf("Expected u2 to be inactive, got %+v", user)
+	}
+	team, err := svc.TeamGet(ctx, "backend")
+	mustNil(t, err)
+	if team.Members[1].IsActive {
+		t.Fatalf("Expected the membership to follow, got %+v", team.Members[1])
+	}
+
+	// inactive users are not picked as reviewers
+	pr, err := svc.PullRequestCreate(ctx, "r1", "req1", "u1", "")
+	mustNil(t, err)
+	if !reflect.DeepEqual(pr.AssignedReviewers, []string{"u3", "u4"}) {
+		t.Fatalf("Expected u3 and u4, got %v", pr.AssignedReviewers)
+	}
+
+	_, err = svc.UsersSetIsActive(ctx, "u9", true)
+	expectError(t, err, OBJECT_NOT_FOUND, models.NOT_FOUND)
+	_, err = svc.UsersSetIsActive(ctx, "u 9", true)
+	expectError(t, err, INVALID_FIELDS, models.VALIDATION_ERROR)
+}
+
+func TestPullRequestCreate(t *testing.T) {
+	ctx := context.Background()
+	svc := newBackendService(t)
+	fakeClock(svc).Advance(time.Hour)
+	createdAt := testEpoch.Add(time.Hour)
+
+	pr, err := svc.PullRequestCreate(ctx, "r1", "Add search", "u2", "")
+	mustNil(t, err)
+	expected := models.PullRequest{
+		PullRequestId:     "r1",
+		PullRequestName:   "Add search",
+		AuthorId:          "u2",
+		Status:            models.OPEN,
+		AssignedReviewers: []string{"u1", "u3"},
+		TeamName:          "backend",
+		AssignedAt:        map[string]time.Time{"u1": createdAt, "u3": createdAt},
+		CreatedAt:         &createdAt,
+	}
+	if !reflect.DeepEqual(pr, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, pr)
+	}
+
+	history, err := svc.PullRequestHistory(ctx, "r1")
+	mustNil(t, err)
+	types := make([]models.PullRequestEventType, 0, len(history.Events))
+	for _, event := range history.Events {
+		types = append(types, event.Type)
+		if !event.Timestamp.Equal(createdAt) {
+			t.Fatalf("Expected every event at %v, got %+v", createdAt, event)
+		}
+	}
+	if !reflect.DeepEqual(types, []models.PullRequestEventType{models.EVENT_PR_CREATED, models.EVENT_REVIEWER_ASSIGNED, models.EVENT_REVIEWER_ASSIGNED}) {
+		t.Fatalf("Unexpected events %v", types)
+	}
+	if !reflect.DeepEqual(history.PR, pr) {
+		t.Fatalf("Expected the history to rebuild %+v, got %+v", pr, history.PR)
+	}
+
+	// a team with only the author gets no reviewers
+	_, err = svc.TeamAdd(ctx, models.Team{TeamName: "solo", Members: []models.TeamMember{{UserId: "u6", Username: "Frank", IsActive: true}}})
+	mustNil(t, err)
+	pr, err = svc.PullRequestCreate(ctx, "r2", "Solo", "u6", "")
+	mustNil(t, err)
+	if len(pr.AssignedReviewers) != 0 || pr.AssignedAt != nil {
+		t.Fatalf("Expected no reviewers, got %+v", pr)
+	}
+
+	for _, tc := range []struct {
+		name                   string
+		prId, authorId, teamId string
+		code                   int
+		apiCode                models.ErrorDetailCode
+	}{
+		{"Exists", "r1", "u2", "", DOMAIN_ERROR, models.PR_EXISTS},
+		{"NoAuthor", "r3", "u9", "", OBJECT_NOT_FOUND, models.NOT_FOUND},
+		{"NoTeam", "r3", "u2", "frontend", OBJECT_NOT_FOUND, models.NOT_FOUND},
+		{"WrongTeam", "r3", "u2", "solo", DOMAIN_ERROR, models.WRONG_TEAM},
+		{"Invalid", "r 3", "u2", "", INVALID_FIELDS, models.VALIDATION_ERROR},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := svc.PullRequestCreate(ctx, tc.prId, "name", tc.authorId, tc.teamId)
+			expectError(t, err, tc.code, tc.apiCode)
+		})
+	}
+}
+
+func TestPullRequestMergeAndClose(t *testing.T) {
+	ctx := context.Background()
+	svc := newBackendService(t)
+	for _, id := range []string{"r1", "r2"} {
+		_, err := svc.PullRequestCreate(ctx, id, id, "u1", "")
+		mustNil(t, err)
+	}
+
+	fakeClock(svc).Advance(2 * time.Hour)
+	mergedAt := testEpoch.Add(2 * time.Hour)
+	pr, err := svc.PullRequestMerge(ctx, "r1")
+	mustNil(t, err)
+	if pr.Status != models.MERGED || !pr.MergedAt.Equal(mergedAt) || !pr.CreatedAt.Equal(testEpoch) {
+		t.Fatalf("Expected r1 merged at %v, got %+v", mergedAt, pr)
+	}
+
+	// merging again changes nothing, not even the time
+	fakeClock(svc).Advance(time.Hour)
+	pr, err = svc.PullRequestMerge(ctx, "r1")
+	mustNil(t, err)
+	if !pr.MergedAt.Equal(mergedAt) {
+		t.Fatalf("Expected the merge to be idempotent, got %+v", pr)
+	}
+
+	pr, err = svc.PullRequestClose(ctx, "r2")
+	mustNil(t, err)
+	if pr.Status != models.CLOSED || !pr.ClosedAt.Equal(mergedAt.Add(time.Hour)) {
+		t.Fatalf("Expected r2 closed, got %+v", pr)
+	}
+	if _, err = svc.PullRequestClose(ctx, "r2"); err != nil {
+		t.Fatalf("Expected closing again to succeed, got %v", err)
+	}
+
+	_, err = svc.PullRequestMerge(ctx, "r2")
+	expectError(t, err, DOMAIN_ERROR, models.PR_CLOSED)
+	_, err = svc.PullRequestClose(ctx, "r1")
+	expectError(t, err, DOMAIN_ERROR, models.PR_MERGED)
+	_, err = svc.PullRequestMerge(ctx, "r9")
+	expectError(t, err, OBJECT_NOT_FOUND, models.NOT_FOUND)
+	_, err = svc.PullRequestClose(ctx, "r9")
+	expectError(t, err, OBJECT_NOT_FOUND, models.NOT_FOUND)
+
+	// finished pull requests leave the review queues
+	prs, err := svc.UsersGetReview(ctx, "u2")
+	mustNil(t, err)
+	for _, short := range prs {
+		if short.Status == models.OPEN {
+			t.Fatalf("Expected no open reviews, got %+v", prs)
+		}
+	}
+}
+
+func TestPullRequestReassign(t *testing.T) {
+	ctx := context.Background()
+	svc := newBackendService(t)
+	_, err := svc.PullRequestCreate(ctx, "r1", "req1", "u1", "")
+	mustNil(t, err)
+
+	fakeClock(svc).Advance(time.Minute)
+	pr, replacedBy, err := svc.PullRequestReassign(ctx, "r1", "u2", "")
+	mustNil(t, err)
+	if replacedBy != "u4" || !reflect.DeepEqual(pr.AssignedReviewers, []string{"u4", "u3"}) {
+		t.Fatalf("Expected u4 to replace u2, got %q in %+v", replacedBy, pr)
+	}
+	expectedAt := map[string]time.Time{"u3": testEpoch, "u4": testEpoch.Add(time.Minute)}
+	if !reflect.DeepEqual(pr.AssignedAt, expectedAt) {
+		t.Fatalf("Expected the assignment times %v, got %v", expectedAt, pr.AssignedAt)
+	}
+	for userId, count := range map[string]int{"u2": 0, "u3": 1, "u4": 1} {
+		prs, err := svc.UsersGetReview(ctx, userId)
+		mustNil(t, err)
+		if len(prs) != count {
+			t.Fatalf("Expected %d reviews for %s, got %+v", count, userId, prs)
+		}
+	}
+
+	pr, _, err = svc.PullRequestReassign(ctx, "r1", "u4", "u2")
+	mustNil(t, err)
+	if !reflect.DeepEqual(pr.AssignedReviewers, []string{"u2", "u3"}) {
+		t.Fatalf("Expected u2 back, got %+v", pr)
+	}
+
+	_, err = svc.TeamAdd(ctx, models.Team{TeamName: "frontend", Members: []models.TeamMember{{UserId: "u6", Username: "Frank", IsActive: true}}})
+	mustNil(t, err)
+	_, err = svc.PullRequestCreate(ctx, "r2", "req2", "u1", "")
+	mustNil(t, err)
+	_, err = svc.PullRequestMerge(ctx, "r2")
+	mustNil(t, err)
+	_, err = svc.TeamAdd(ctx, models.Team{TeamName: "pair", Members: []models.TeamMember{
+		{UserId: "u7", Username: "Grace", IsActive: true},
+		{UserId: "u8", Username: "Heidi", IsActive: true},
+	}})
+	mustNil(t, err)
+	_, err = svc.PullRequestCreate(ctx, "r3", "req3", "u7", "")
+	mustNil(t, err)
+
+	user := WithActor(ctx, Actor{Name: "u3", Role: models.ROLE_USER})
+	for _, tc := range []struct {
+		name                   string
+		ctx                    context.Context
+		prId, oldUser, newUser string
+		code                   int
+		apiCode                models.ErrorDetailCode
+	}{
+		{"NotAssigned", ctx, "r1", "u4", "", DOMAIN_ERROR, models.NOT_ASSIGNED},
+		{"NoCandidate", ctx, "r3", "u8", "", DOMAIN_ERROR, models.NO_CANDIDATE},
+		{"Merged", ctx, "r2", "u2", "", DOMAIN_ERROR, models.PR_MERGED},
+		{"AlreadyAssigned", ctx, "r1", "u2", "u3", DOMAIN_ERROR, models.ALREADY_ASSIGNED},
+		{"Inactive", ctx, "r1", "u2", "u5", DOMAIN_ERROR, models.CANDIDATE_INACTIVE},
+		{"WrongTeam", ctx, "r1", "u2", "u6", DOMAIN_ERROR, models.WRONG_TEAM},
+		{"NoPR", ctx, "r9", "u2", "", OBJECT_NOT_FOUND, models.NOT_FOUND},
+		{"NoUser", ctx, "r1", "u9", "", OBJECT_NOT_FOUND, models.NOT_FOUND},
+		{"Invalid", ctx, "r1", "", "", INVALID_FIELDS, models.VALIDATION_ERROR},
+		{"SomebodyElse", user, "r1", "u2", "", FORBIDDEN, models.FORBIDDEN},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := svc.PullRequestReassign(tc.ctx, tc.prId, tc.oldUser, tc.newUser)
+			expectError(t, err, tc.code, tc.apiCode)
+		})
+	}
+
+	// users may hand their own reviews over
+	if _, _, err = svc.PullRequestReassign(user, "r1", "u3", ""); err != nil {
+		t.Fatalf("Expected u3 to reassign itself, got %v", err)
+	}
+}
+
+func TestUsersGetReview(t *testing.T) {
+	ctx := context.Background()
+	svc := newBackendService(t)
+
+	prs, err := svc.UsersGetReview(ctx, "u2")
+	mustNil(t, err)
+	if prs == nil || len(prs) != 0 {
+		t.Fatalf("Expected an empty queue, got %#v", prs)
+	}
+
+	for _, id := range []string{"r1", "r2"} {
+		_, err := svc.PullRequestCreate(ctx, id, id, "u1", "")
+		mustNil(t, err)
+	}
+	prs, err = svc.UsersGetReview(ctx, "u2")
+	mustNil(t, err)
+	expected := []models.PullRequestShort{
+		{PullRequestId: "r1", PullRequestName: "r1", AuthorId: "u1", Status: models.OPEN},
+		{PullRequestId: "r2", PullRequestName: "r2", AuthorId: "u1", Status: models.OPEN},
+	}
+	if !slicesEqualById(prs, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, prs)
+	}
+
+	_, err = svc.UsersGetReview(ctx, "u9")
+	expectError(t, err, OBJECT_NOT_FOUND, models.NOT_FOUND)
+}
+
+func slicesEqualById(a, b []models.PullRequestShort) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	byId := make(map[string]models.PullRequestShort, len(a))
+	for _, pr := range a {
+		byId[pr.PullRequestId] = pr
+	}
+	for _, pr := range b {
+		if byId[pr.PullRequestId] != pr {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTenantCreateUsesClock(t *testing.T) {
+	ctx := context.Background()
+	svc := newMemoryService()
+	fakeClock(svc).Advance(24 * time.Hour)
+
+	tenant, err := svc.TenantCreate(ctx, models.Tenant{TenantId: "acme", Name: "Acme"})
+	mustNil(t, err)
+	if !tenant.CreatedAt.Equal(testEpoch.Add(24 * time.Hour)) {
+		t.Fatalf("Expected the tenant created at the fake time, got %v", tenant.CreatedAt)
+	}
+
+	snapshot, err := svc.SnapshotExport(WithTenant(ctx, "acme"))
+	mustNil(t, err)
+	if !snapshot.ExportedAt.Equal(tenant.CreatedAt) {
+		t.Fatalf("Expected the snapshot taken at the fake time, got %v", snapshot.ExportedAt)
+	}
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+// TeamSetSLA sets how long the reviews of the team's pull requests may take,
+// an empty sla removes it.
+func (s *PrReviewerService) TeamSetSLA(ctx context.Context, teamName, sla string) (models.Team, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return models.Team{}, err
+	}
+
+	var rules inputRules
+	rules.name("team_name", teamName)
+	if sla != "" {
+		rules.duration("review_sla", sla)
+	}
+	if err := rules.err(); err != nil {
+		return models.Team{}, err
+	}
+	defer s.locks.lock(s.teamKey(teamName))()
+
+	team := s.repo.GetTeamByName(teamName)
+	if team == nil {
+		return models.Team{}, NewErrorApi(OBJECT_NOT_FOUND, models.NOT_FOUND, "Team not found")
+	}
+
+	before := *team
+	team, err = s.repo.ModifyTeam(teamName, func(team *models.Team) error {
+		team.ReviewSLA = sla
+		return nil
+	})
+	if err != nil || team == nil {
+		return before, modifyTeamError(err)
+	}
+	if err := s.audit(ctx, models.TEAM_SET_SLA, models.TEAM_ENTITY, teamName, before, *team); err != nil {
+		return *team, err
+	}
+	return *team, nil
+}
+
+// PullRequestOverdue lists the open reviews past their SLA, the most overdue
+// first. Empty userId and teamName match every reviewer and team.
+func (s *PrReviewerService) PullRequestOverdue(ctx context.Context, userId, teamName string) ([]models.OverdueReview, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules inputRules
+	if userId != "" {
+		rules.id("user_id", userId)
+	}
+	if teamName != "" {
+		rules.name("team_name", teamName)
+	}
+	if err := rules.err(); err != nil {
+		return nil, err
+	}
+
+	overdue := make([]models.OverdueReview, 0)
+	for _, review := range s.overdueReviews(s.repo.GetPullRequests(), s.clock.Now()) {
+		if (userId == "" || review.ReviewerId == userId) && (teamName == "" || review.TeamName == teamName) {
+			overdue = append(overdue, review)
+		}
+	}
+	return overdue, nil
+}
+
+// RecordOverdueReviews records a REVIEW_OVERDUE event for every review that
+// crossed its SLA by now since the last run, once per assignment, and returns
+// how many it recorded.
+func (s *PrReviewerService) RecordOverdueReviews(ctx context.Context, now time.Time) (int, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	recorded := 0
+	for _, review := range s.overdueReviews(s.repo.GetPullRequests(), now) {
+		ok, err := s.recordOverdueReview(ctx, review, now)
+		if err != nil {
+			return recorded, err
+		}
+		if ok {
+			recorded++
+		}
+	}
+	return recorded, nil
+}
+
+// recordOverdueReview records the REVIEW_OVERDUE event of review with the
+// pull request locked, unless it is recorded already or the review moved on.
+func (s *PrReviewerService) recordOverdueReview(ctx context.Context, review models.OverdueReview, now time.Time) (bool, error) {
+	defer s.locks.lock(s.prKey(review.PullRequestId))()
+
+	if s.recordedForAssignment(review.PullRequestId, review.ReviewerId, models.EVENT_REVIEW_OVERDUE) {
+		return false, nil
+	}
+	pr := s.repo.GetPullRequestById(review.PullRequestId)
+	if pr == nil || pr.Status != models.OPEN || !slices.Contains(pr.AssignedReviewers, review.ReviewerId) {
+		return false, nil
+	}
+	event := models.PullRequestEvent{
+		Type:          models.EVENT_REVIEW_OVERDUE,
+		PullRequestId: review.PullRequestId,
+		Timestamp:     now,
+		ReviewerId:    review.ReviewerId,
+	}
+	if err := s.recordEvents(ctx, pr, event); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// recordedForAssignment tells whether the current assignment of the reviewer
+// already has an event of eventType.
+func (s *PrReviewerService) recordedForAssignment(pullRequestId, reviewerId string, eventType models.PullRequestEventType) bool {
+	recorded := false
+	for _, event := range s.eventRepo.GetPullRequestEvents(pullRequestId) {
+		if event.ReviewerId != reviewerId {
+			continue
+		}
+		switch event.Type {
+		case models.EVENT_REVIEWER_ASSIGNED, models.EVENT_REVIEWER_REPLACED:
+			recorded = false
+		case eventType:
+			recorded = true
+		}
+	}
+	return recorded
+}
+
+// overdueReviews returns the reviews of open pull requests assigned longer
+// than the SLA of their team ago, the most overdue first.
+func (s *PrReviewerService) overdueReviews(prs []models.PullRequest, now time.Time) []models.OverdueReview {
+	slas := make(map[string]time.Duration)
+	overdue := make([]models.OverdueReview, 0)
+	for _, pr := range prs {
+		if pr.Status != models.OPEN {
+			continue
+		}
+		teamName := s.prTeam(&pr)
+		sla, ok := slas[teamName]
+		if !ok {
+			sla = s.reviewSLA(teamName)
+			slas[teamName] = sla
+		}
+		if sla == 0 {
+			continue
+		}
+		for _, reviewer := range pr.AssignedReviewers {
+			assignedAt := assignedAt(&pr, reviewer)
+			if assignedAt.IsZero() || now.Sub(assignedAt) <= sla {
+				continue
+			}
+			overdue = append(overdue, models.OverdueReview{
+				PullRequestId:   pr.PullRequestId,
+				PullRequestName: pr.PullRequestName,
+				AuthorId:        pr.AuthorId,
+				TeamName:        teamName,
+				ReviewerId:      reviewer,
+				AssignedAt:      assignedAt,
+				DueAt:           assignedAt.Add(sla),
+			})
+		}
+	}
+	slices.SortFunc(overdue, func(a, b models.OverdueReview) int {
+		if c := a.DueAt.Compare(b.DueAt); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.PullRequestId, b.PullRequestId); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ReviewerId, b.ReviewerId)
+	})
+	return overdue
+}
+
+// assignedAt is when the reviewer got the review, the creation of the pull
+// request for pull requests created before assignments were timed.
+func assignedAt(pr *models.PullRequest, reviewer string) time.Time {
+	if at, ok := pr.AssignedAt[reviewer]; ok {
+		return at
+	}
+	if pr.CreatedAt != nil {
+		return *pr.CreatedAt
+	}
+	return time.Time{}
+}
+
+// prTeam is the team of the pull request, the author's primary team for
+// pull requests that do not know it.
+func (s *PrReviewerService) prTeam(pr *models.PullRequest) string {
+	if pr.TeamName != "" {
+		return pr.TeamName
+	}
+	if author := s.repo.GetUserById(pr.AuthorId); author != nil {
+		return author.TeamName
+	}
+	return ""
+}
+
+// reviewSLA returns the SLA of the team or of its nearest ancestor that has
+// one, 0 when none does.
+func (s *PrReviewerService) reviewSLA(teamName string) time.Duration {
+	for _, name := range append([]string{teamName}, s.ancestors(teamName)...) {
+		if team := s.repo.GetTeamByName(name); team != nil && team.ReviewSLA != "" {
+			// stored SLAs were validated, a broken one counts as none
+			sla, _ := time.ParseDuration(team.ReviewSLA)
+			return sla
+		}
+	}
+	return 0
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+func TestReviewSLA(t *testing.T) {
+	ctx := context.Background()
+	svc := newMemoryService()
+	for _, team := range []models.Team{
+		{TeamName: "dept", Members: []models.TeamMember{{UserId: "u1", Username: "Alice", IsActive: true}}},
+		{TeamName: "backend", ParentTeam: "dept", Members: []models.TeamMember{
+			{UserId: "u2", Username: "Bob", IsActive: true},
+			{UserId: "u3", Username: "Carol", IsActive: true},
+			{UserId: "u4", Username: "Dave", IsActive: true},
+		}},
+		{TeamName: "frontend", Members: []models.TeamMember{
+			{UserId: "u5", Username: "Eve", IsActive: true},
+			{UserId: "u6", Username: "Frank", IsActive: true},
+		}},
+	} {
+		_, err := svc.TeamAdd(ctx, team)
+		mustNil(t, err)
+	}
+
+	var svcErr ErrorService
+	if _, err := svc.TeamSetSLA(ctx, "dept", "soon"); !errors.As(err, &svcErr) || svcErr.ApiCode != models.VALIDATION_ERROR {
+		t.Fatalf("Expected a wrong duration to be rejected, got %v", err)
+	}
+
+	// backend inherits the SLA of the department, frontend has a long one
+	_, err := svc.TeamSetSLA(ctx, "dept", "1h")
+	mustNil(t, err)
+	_, err = svc.TeamSetSLA(ctx, "frontend", "24h")
+	mustNil(t, err)
+
+	pr, err := svc.PullRequestCreate(ctx, "r1", "req1", "u2", "")
+	mustNil(t, err)
+	if len(pr.AssignedAt) != 2 || !pr.AssignedAt["u3"].Equal(*pr.CreatedAt) {
+		t.Fatalf("Expected the assignment times, got %+v", pr.AssignedAt)
+	}
+	_, err = svc.PullRequestCreate(ctx, "r2", "req2", "u5", "")
+	mustNil(t, err)
+	clock := fakeClock(svc)
+	clock.Advance(2 * time.Hour)
+
+	overdue, err := svc.PullRequestOverdue(ctx, "", "")
+	mustNil(t, err)
+	if len(overdue) != 2 || overdue[0].ReviewerId != "u3" || overdue[1].ReviewerId != "u4" || overdue[0].TeamName != "backend" {
+		t.Fatalf("Expected the reviews of r1 only, got %+v", overdue)
+	}
+	if overdue, err = svc.PullRequestOverdue(ctx, "u4", ""); err != nil || len(overdue) != 1 {
+		t.Fatalf("Expected one review of u4, got %+v, %v", overdue, err)
+	}
+	if overdue, err = svc.PullRequestOverdue(ctx, "", "frontend"); err != nil || len(overdue) != 0 {
+		t.Fatalf("Expected nothing overdue in frontend, got %+v, %v", overdue, err)
+	}
+
+	prs, err := svc.UsersGetReview(ctx, "u3")
+	mustNil(t, err)
+	if len(prs) != 1 || !prs[0].Overdue {
+		t.Fatalf("Expected r1 to be overdue for u3, got %+v", prs)
+	}
+	prs, err = svc.UsersGetReview(ctx, "u6")
+	mustNil(t, err)
+	if len(prs) != 1 || prs[0].Overdue {
+		t.Fatalf("Expected r2 to be in time for u6, got %+v", prs)
+	}
+
+	// every assignment is reported once
+	recorded, err := svc.RecordOverdueReviews(ctx, clock.Now())
+	mustNil(t, err)
+	if recorded != 2 {
+		t.Fatalf("Expected 2 overdue reviews recorded, got %d", recorded)
+	}
+	if recorded, err = svc.RecordOverdueReviews(ctx, clock.Now()); err != nil || recorded != 0 {
+		t.Fatalf("Expected nothing new, got %d, %v", recorded, err)
+	}
+	_, _, err = svc.PullRequestReassign(ctx, "r1", "u3", "u1")
+	mustNil(t, err)
+	if recorded, err = svc.RecordOverdueReviews(ctx, clock.Now()); err != nil || recorded != 0 {
+		t.Fatalf("Expected the new assignment to be in time, got %d, %v", recorded, err)
+	}
+	clock.Advance(2 * time.Hour)
+	if recorded, err = svc.RecordOverdueReviews(ctx, clock.Now()); err != nil || recorded != 1 {
+		t.Fatalf("Expected the new assignment to be recorded, got %d, %v", recorded, err)
+	}
+
+	history, err := svc.PullRequestHistory(ctx, "r1")
+	mustNil(t, err)
+	var events []string
+	for _, event := range history.Events {
+		if event.Type == models.EVENT_REVIEW_OVERDUE {
+			events = append(events, event.ReviewerId)
+		}
+	}
+	if len(events) != 3 || events[2] != "u1" {
+		t.Fatalf("Expected REVIEW_OVERDUE for u3, u4 and u1, got %v", events)
+	}
+	if _, ok := history.PR.AssignedAt["u3"]; ok || history.PR.AssignedAt["u1"].IsZero() {
+		t.Fatalf("Expected the rebuilt assignment times to follow the reassignment, got %+v", history.PR.AssignedAt)
+	}
+
+	team, err := svc.TeamSetSLA(ctx, "frontend", "")
+	mustNil(t, err)
+	if team.ReviewSLA != "" {
+		t.Fatalf("Expected the SLA to be removed, got %q", team.ReviewSLA)
+	}
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+const SNAPSHOT_VERSION = 1
+
+// SnapshotExport returns the whole state as one document, sorted by ids so
+// that exports of the same state are identical.
+func (s *PrReviewerService) SnapshotExport(ctx context.Context) (models.Snapshot, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return models.Snapshot{}, err
+	}
+
+	teams := s.repo.GetTeams()
+	sort.Slice(teams, func(i, j int) bool { return teams[i].TeamName < teams[j].TeamName })
+	users := s.repo.GetUsers()
+	sort.Slice(users, func(i, j int) bool { return users[i].UserId < users[j].UserId })
+	prs := s.repo.GetPullRequests()
+	sort.Slice(prs, func(i, j int) bool { return prs[i].PullRequestId < prs[j].PullRequestId })
+
+	assignments := s.repo.GetReviewIndex()
+	for userId, prIds := range assignments {
+		if len(prIds) == 0 {
+			delete(assignments, userId)
+			continue
+		}
+		sort.Strings(prIds)
+	}
+
+	return models.Snapshot{
+		Version:      SNAPSHOT_VERSION,
+		ExportedAt:   s.clock.Now(),
+		Teams:        teams,
+		Users:        users,
+		PullRequests: prs,
+		Assignments:  assignments,
+	}, nil
+}
+
+// SnapshotImport loads a snapshot into an empty instance. The snapshot is
+// validated as a whole before anything is written: every problem is reported
+// in one INVALID_SNAPSHOT error. Pull request events are recorded with the
+// original timestamps, so the history of imported PRs is kept; listeners are
+// not notified, the PRs are not new and must not fire webhooks or count in
+// the metrics again. The import shuts out every other write while it runs,
+// nothing may sneak in between the emptiness check and the import.
+func (s *PrReviewerService) SnapshotImport(ctx context.Context, snapshot models.Snapshot) (models.SnapshotImportResult, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return models.SnapshotImportResult{}, err
+	}
+
+	// snapshots taken before users could be in several teams only name the
+	// primary team
+	for i, user := range snapshot.Users {
+		if len(user.Teams) == 0 && user.TeamName != "" {
+			snapshot.Users[i].Teams = []string{user.TeamName}
+		}
+	}
+
+	var result models.SnapshotImportResult
+	if problems := s.validateSnapshot(&snapshot); len(problems) > 0 {
+		return result, NewErrorApi(INVALID_INPUT, models.INVALID_SNAPSHOT, strings.Join(problems, "; "))
+	}
+	defer s.locks.lockAll()()
+	if len(s.repo.GetTeams()) > 0 || len(s.repo.GetUsers()) > 0 || len(s.repo.GetPullRequests()) > 0 {
+		return result, NewErrorApi(DOMAIN_ERROR, models.NOT_EMPTY, "Snapshot can only be imported into an empty instance")
+	}
+
+	for _, user := range snapshot.Users {
+		if err := s.repo.CreateUser(user); err != nil {
+			return result, NewErrorService(INTERNAL_ERROR, err.Error())
+		}
+	}
+	for _, team := range snapshot.Teams {
+		if err := s.repo.CreateTeam(team); err != nil {
+			return result, NewErrorService(INTERNAL_ERROR, err.Error())
+		}
+	}
+
+	now := s.clock.Now()
+	for _, pr := range snapshot.PullRequests {
+		if err := s.repo.CreateIndexedPR(pr); err != nil {
+			return result, NewErrorService(INTERNAL_ERROR, err.Error())
+		}
+		if _, err := s.eventRepo.AppendPullRequestEvents(importedEvents(&pr, now)...); err != nil {
+			return result, NewErrorService(INTERNAL_ERROR, err.Error())
+		}
+	}
+
+	result = models.SnapshotImportResult{
+		Teams:        len(snapshot.Teams),
+		Users:        len(snapshot.Users),
+		PullRequests: len(snapshot.PullRequests),
+	}
+	return result, s.audit(ctx, models.IMPORT, models.SNAPSHOT_ENTITY, snapshot.ExportedAt.Format(time.RFC3339), nil, result)
+}
+
+func (s *PrReviewerService) validateSnapshot(snapshot *models.Snapshot) []string {
+	if snapshot.Version != SNAPSHOT_VERSION {
+		return []string{fmt.Sprintf("unsupported snapshot version %d, expected %d", snapshot.Version, SNAPSHOT_VERSION)}
+	}
+
+	problems := make([]string, 0)
+	duplicate := func(kind string, ids []string) {
+		seen := make(map[string]struct{}, len(ids))
+		for _, id := range ids {
+			if _, ok := seen[id]; ok {
+				problems = append(problems, fmt.Sprintf("duplicate %s %q", kind, id))
+			}
+			seen[id] = struct{}{}
+		}
+	}
+
+	teamNames := make([]string, 0, len(snapshot.Teams))
+	for _, team := range snapshot.Teams {
+		teamNames = append(teamNames, team.TeamName)
+	}
+	duplicate("team", teamNames)
+
+	userIds := make([]string, 0, len(snapshot.Users))
+	users := make(map[string]struct{}, len(snapshot.Users))
+	for _, user := range snapshot.Users {
+		userIds = append(userIds, user.UserId)
+		users[user.UserId] = struct{}{}
+	}
+	duplicate("user", userIds)
+
+	prIds := make([]string, 0, len(snapshot.PullRequests))
+	for _, pr := range snapshot.PullRequests {
+		prIds = append(prIds, pr.PullRequestId)
+		switch pr.Status {
+		case models.OPEN, models.MERGED, models.CLOSED:
+		default:
+			problems = append(problems, fmt.Sprintf("pull request %q has unknown status %q", pr.PullRequestId, pr.Status))
+		}
+		if _, ok := users[pr.AuthorId]; !ok {
+			problems = append(problems, fmt.Sprintf("pull request %q: author %q does not exist", pr.PullRequestId, pr.AuthorId))
+		}
+	}
+	duplicate("pull request", prIds)
+
+	var rules inputRules
+	for i, team := range snapshot.Teams {
+		rules.team(fmt.Sprintf("teams[%d].", i), team)
+	}
+	for i, user := range snapshot.Users {
+		rules.id(fmt.Sprintf("users[%d].user_id", i), user.UserId)
+		rules.name(fmt.Sprintf("users[%d].username", i), user.Username)
+	}
+	for i, pr := range snapshot.PullRequests {
+		rules.id(fmt.Sprintf("pull_requests[%d].pull_request_id", i), pr.PullRequestId)
+		rules.name(fmt.Sprintf("pull_requests[%d].pull_request_name", i), pr.PullRequestName)
+	}
+	for _, detail := range rules.details {
+		problems = append(problems, detail.Field+": "+detail.Message)
+	}
+
+	for _, f := range s.inspect(snapshot.Teams, snapshot.Users, snapshot.PullRequests, snapshot.Assignments) {
+		v := f.violation
+		problems = append(problems, fmt.Sprintf("%s %s %q: %s", v.Rule, v.EntityType, v.EntityId, v.Message))
+	}
+	return problems
+}
+
+// importedEvents describes an imported pull request as the events that would
+// have produced it; a reviewer is assigned when its AssignedAt says, if it is
+// known.
+func importedEvents(pr *models.PullRequest, now time.Time) []models.PullRequestEvent {
+	createdAt := now
+	if pr.CreatedAt != nil {
+		createdAt = *pr.CreatedAt
+	}
+
+	events := []models.PullRequestEvent{models.NewPRCreatedEvent(pr, createdAt)}
+	for _, reviewer := range pr.AssignedReviewers {
+		assignedAt, ok := pr.AssignedAt[reviewer]
+		if !ok {
+			assignedAt = createdAt
+		}
+		events = append(events, models.NewReviewerAssignedEvent(pr.PullRequestId, reviewer, assignedAt))
+	}
+	switch {
+	case pr.Status == models.MERGED && pr.MergedAt != nil:
+		events = append(events, models.NewPRMergedEvent(pr.PullRequestId, *pr.MergedAt))
+	case pr.Status == models.MERGED:
+		events = append(events, models.NewPRMergedEvent(pr.PullRequestId, now))
+	case pr.Status == models.CLOSED && pr.ClosedAt != nil:
+		events = append(events, models.NewPRClosedEvent(pr.PullRequestId, *pr.ClosedAt))
+	case pr.Status == models.CLOSED:
+		events = append(events, models.NewPRClosedEvent(pr.PullRequestId, now))
+	}
+	return events
+}
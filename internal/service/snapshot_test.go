@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := newMemoryService()
+	_, err := src.TeamAdd(ctx, models.Team{TeamName: "backend", Members: []models.TeamMember{
+		{UserId: "u1", Username: "Alice", IsActive: true},
+		{UserId: "u2", Username: "Bob", IsActive: true},
+		{UserId: "u3", Username: "Carol", IsActive: true},
+	}})
+	mustNil(t, err)
+	_, err = src.PullRequestCreate(ctx, "r1", "req1", "u1", "")
+	mustNil(t, err)
+	_, err = src.PullRequestCreate(ctx, "r2", "req2", "u2", "")
+	mustNil(t, err)
+	_, err = src.PullRequestMerge(ctx, "r2")
+	mustNil(t, err)
+	_, err = src.UsersSetIsActive(ctx, "u3", false)
+	mustNil(t, err)
+
+	exported, err := src.SnapshotExport(ctx)
+	mustNil(t, err)
+
+	dst := newMemoryService()
+	listener := &recordingListener{}
+	dst.AddListener(listener)
+	result, err := dst.SnapshotImport(ctx, exported)
+	mustNil(t, err)
+	if result.PullRequests != 2 {
+		t.Fatalf("Expected 2 imported pull requests, got %+v", result)
+	}
+	if len(listener.events) != 0 {
+		t.Fatalf("Expected imported pull requests not to notify listeners, got %+v", listener.events)
+	}
+
+	reimported, err := dst.SnapshotExport(ctx)
+	mustNil(t, err)
+	reimported.ExportedAt = exported.ExportedAt
+	if !reflect.DeepEqual(exported, reimported) {
+		t.Fatalf("Snapshots differ:\n%+v\n%+v", exported, reimported)
+	}
+
+	history, err := dst.PullRequestHistory(ctx, "r2")
+	mustNil(t, err)
+	if history.PR.Status != models.MERGED || !reflect.DeepEqual(history.PR.AssignedReviewers, exported.PullRequests[1].AssignedReviewers) {
+		t.Fatalf("Unexpected replayed pull request: %+v", history.PR)
+	}
+
+	var svcErr ErrorService
+	if _, err = dst.SnapshotImport(ctx, exported); !errors.As(err, &svcErr) || svcErr.ApiCode != models.NOT_EMPTY {
+		t.Fatalf("Expected NOT_EMPTY, got %v", err)
+	}
+}
+
+func TestSnapshotImportInvalid(t *testing.T) {
+	ctx := context.Background()
+	src := newServiceWithRepo(corruptedRepo(t))
+	snapshot, err := src.SnapshotExport(ctx)
+	mustNil(t, err)
+	snapshot.Users = append(snapshot.Users, snapshot.Users[0])
+
+	dst := newMemoryService()
+	var svcErr ErrorService
+	if _, err = dst.SnapshotImport(ctx, snapshot); !errors.As(err, &svcErr) || svcErr.ApiCode != models.INVALID_SNAPSHOT {
+		t.Fatalf("Expected INVALID_SNAPSHOT, got %v", err)
+	}
+	if len(defaultStore(dst).Repo.GetUsers()) != 0 {
+		t.Fatal("Nothing should be imported from an invalid snapshot")
+	}
+
+	snapshot.Version = 2
+	if _, err = dst.SnapshotImport(ctx, snapshot); !errors.As(err, &svcErr) || svcErr.ApiCode != models.INVALID_SNAPSHOT {
+		t.Fatalf("Expected INVALID_SNAPSHOT for unknown version, got %v", err)
+	}
+}
+
+type recordingListener struct {
+	events []models.PullRequestEvent
+}
+
+func (l *recordingListener) OnPullRequestEvents(_ context.Context, _ models.PullRequest, events []models.PullRequestEvent) {
+	l.events = append(l.events, events...)
+}
+
+func TestSnapshotImportAssignmentTimes(t *testing.T) {
+	ctx := context.Background()
+	src := newBackendService(t)
+	_, err := src.PullRequestCreate(ctx, "r1", "req1", "u1", "")
+	mustNil(t, err)
+	fakeClock(src).Advance(time.Hour)
+	_, replacedBy, err := src.PullRequestReassign(ctx, "r1", "u2", "")
+	mustNil(t, err)
+
+	exported, err := src.SnapshotExport(ctx)
+	mustNil(t, err)
+	dst := newMemoryService()
+	_, err = dst.SnapshotImport(ctx, exported)
+	mustNil(t, err)
+
+	pr := exported.PullRequests[0]
+	for _, event := range defaultStore(dst).EventRepo.GetPullRequestEvents("r1") {
+		if event.Type == models.EVENT_REVIEWER_ASSIGNED && !event.Timestamp.Equal(pr.AssignedAt[event.ReviewerId]) {
+			t.Errorf("Expected %s to be assigned at %s, got %s", event.ReviewerId, pr.AssignedAt[event.ReviewerId], event.Timestamp)
+		}
+	}
+	if assignedAt := pr.AssignedAt[replacedBy]; !assignedAt.Equal(testEpoch.Add(time.Hour)) {
+		t.Fatalf("Expected %s to be assigned an hour later, got %s", replacedBy, assignedAt)
+	}
+}
+
+// TestSnapshotImportConcurrently races imports into one empty instance,
+// exactly one may land and the others find the instance filled.
+func TestSnapshotImportConcurrently(t *testing.T) {
+	ctx := context.Background()
+	src := newBackendService(t)
+	_, err := src.PullRequestCreate(ctx, "r1", "req1", "u1", "")
+	mustNil(t, err)
+	exported, err := src.SnapshotExport(ctx)
+	mustNil(t, err)
+
+	for range 20 {
+		dst := newMemoryService()
+		var succeeded atomic.Int32
+		parallel(4, func(g int) {
+			_, err := dst.SnapshotImport(ctx, exported)
+			if err == nil {
+				succeeded.Add(1)
+				return
+			}
+			var svcErr ErrorService
+			if !errors.As(err, &svcErr) || svcErr.ApiCode != models.NOT_EMPTY {
+				t.Errorf("Expected NOT_EMPTY, got %v", err)
+			}
+		})
+		if succeeded.Load() != 1 {
+			t.Fatalf("Expected exactly one import, got %d", succeeded.Load())
+		}
+		if events := defaultStore(dst).EventRepo.GetPullRequestEvents("r1"); len(events) != 3 {
+			t.Fatalf("Expected the events of one import, got %+v", events)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+// SCHEDULER_ACTOR is the actor of the changes the background jobs make.
+const SCHEDULER_ACTOR = "scheduler"
+
+// EscalateStaleReviews handles the reviews of open pull requests untouched
+// for longer than after by now. A stale review is reassigned like
+// /pullRequest/reassign without new_user_id does. When the stale reviewer got
+// it from such a reassignment, or nobody can take it over, the team lead is
+// notified instead with a REVIEW_ESCALATED event, once per assignment. It
+// returns how many reviews were reassigned and escalated.
+func (s *PrReviewerService) EscalateStaleReviews(ctx context.Context, now time.Time, after time.Duration) (int, int, error) {
+	s, err := s.scope(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	if after <= 0 {
+		return 0, 0, nil
+	}
+	ctx = s.backgroundContext(ctx)
+
+	type staleReview struct{ pullRequestId, reviewerId string }
+	var stale []staleReview
+	for _, pr := range s.repo.GetPullRequests() {
+		if pr.Status != models.OPEN {
+			continue
+		}
+		for _, reviewer := range pr.AssignedReviewers {
+			if at := assignedAt(&pr, reviewer); !at.IsZero() && now.Sub(at) > after {
+				stale = append(stale, staleReview{pr.PullRequestId, reviewer})
+			}
+		}
+	}
+
+	reassigned, escalated := 0, 0
+	for _, review := range stale {
+		wasReassigned, wasEscalated, err := s.handleStaleReview(ctx, review.pullRequestId, review.reviewerId, now)
+		if err != nil {
+			return reassigned, escalated, err
+		}
+		if wasReassigned {
+			reassigned++
+		}
+		if wasEscalated {
+			escalated++
+		}
+	}
+	return reassigned, escalated, nil
+}
+
+// handleStaleReview reassigns or escalates one stale review with the pull
+// request and the replacement locked.
+func (s *PrReviewerService) handleStaleReview(ctx context.Context, pullRequestId, reviewerId string, now time.Time) (bool, bool, error) {
+	candidateId, unlock := s.lockReplacement(pullRequestId, func() string {
+		pr, user := s.repo.GetPullRequestById(pullRequestId), s.repo.GetUserById(reviewerId)
+		if pr == nil || user == nil || s.assignedAutomatically(pullRequestId, reviewerId) {
+			return ""
+		}
+		// reviewers the review already went stale with do not get it back
+		return s.findReplacement(pr, user, s.staleReviewers(pullRequestId)...)
+	})
+	defer unlock()
+
+	// an earlier reassignment or a request may have changed the pull request
+	pr := s.repo.GetPullRequestById(pullRequestId)
+	if pr == nil || pr.Status != models.OPEN || !slices.Contains(pr.AssignedReviewers, reviewerId) {
+		return false, false, nil
+	}
+
+	if candidateId != "" {
+		if err := s.replaceReviewer(ctx, pr, reviewerId, candidateId, now, true); err != nil {
+			return false, false, err
+		}
+		return true, false, nil
+	}
+
+	if s.recordedForAssignment(pullRequestId, reviewerId, models.EVENT_REVIEW_ESCALATED) {
+		return false, false, nil
+	}
+	event := models.PullRequestEvent{
+		Type:          models.EVENT_REVIEW_ESCALATED,
+		PullRequestId: pullRequestId,
+		Timestamp:     now,
+		ReviewerId:    reviewerId,
+		LeadId:        s.teamLead(s.prTeam(pr), reviewerId),
+	}
+	if err := s.recordEvents(ctx, pr, event); err != nil {
+		return false, false, err
+	}
+	return false, true, nil
+}
+
+// backgroundContext makes the changes of a background run look like one
+// request of SCHEDULER_ACTOR in the audit log.
+func (s *PrReviewerService) backgroundContext(ctx context.Context) context.Context {
+	ctx = WithActor(ctx, Actor{Name: SCHEDULER_ACTOR})
+	if RequestIdFromContext(ctx) == "" {
+		ctx = WithRequestId(ctx, s.ids.NewId())
+	}
+	return ctx
+}
+
+// assignedAutomatically tells whether the reviewer got the review from the
+// stale review scheduler.
+func (s *PrReviewerService) assignedAutomatically(pullRequestId, reviewerId string) bool {
+	automatic := false
+	for _, event := range s.eventRepo.GetPullRequestEvents(pullRequestId) {
+		switch {
+		case event.Type == models.EVENT_REVIEWER_ASSIGNED && event.ReviewerId == reviewerId:
+			automatic = false
+		case event.Type == models.EVENT_REVIEWER_REPLACED && event.ReviewerId == reviewerId:
+			automatic = event.Automatic
+		}
+	}
+	return automatic
+}
+
+// staleReviewers returns the reviewers the scheduler took the review away
+// from.
+func (s *PrReviewerService) staleReviewers(pullRequestId string) []string {
+	var reviewers []string
+	for _, event := range s.eventRepo.GetPullRequestEvents(pullRequestId) {
+		if event.Type == models.EVENT_REVIEWER_REPLACED && event.Automatic {
+			reviewers = append(reviewers, event.OldReviewerId)
+		}
+	}
+	return reviewers
+}
+
+// teamLead returns the first active lead of the team other than the stale
+// reviewer, looking into the ancestors when the team has none, or "".
+func (s *PrReviewerService) teamLead(teamName, reviewerId string) string {
+	for _, name := range append([]string{teamName}, s.ancestors(teamName)...) {
+		team := s.repo.GetTeamByName(name)
+		if team == nil {
+			continue
+		}
+		for _, member := range team.Members {
+			if member.Role == models.TEAM_LEAD && member.IsActive && member.UserId != reviewerId {
+				return member.UserId
+			}
+		}
+	}
+	return ""
+}
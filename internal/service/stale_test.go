@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+func TestEscalateStaleReviews(t *testing.T) {
+	ctx := context.Background()
+	svc := newMemoryService()
+	for _, team := range []models.Team{
+		{TeamName: "dept", Members: []models.TeamMember{{UserId: "u6", Username: "Lead", IsActive: true, Role: models.TEAM_LEAD}}},
+		{TeamName: "backend", ParentTeam: "dept", Members: []models.TeamMember{
+			{UserId: "u1", Username: "Alice", IsActive: true},
+			{UserId: "u2", Username: "Bob", IsActive: true},
+			{UserId: "u3", Username: "Carol", IsActive: true},
+			{UserId: "u4", Username: "Dave", IsActive: true},
+			{UserId: "u5", Username: "Eve", IsActive: true},
+		}},
+	} {
+		_, err := svc.TeamAdd(ctx, team)
+		mustNil(t, err)
+	}
+	_, err := svc.PullRequestCreate(ctx, "r1", "req1", "u1", "")
+	mustNil(t, err)
+
+	escalate := func(now time.Time, reassigned, escalated int) {
+		t.Helper()
+		r, e, err := svc.EscalateStaleReviews(ctx, now, time.Hour)
+		mustNil(t, err)
+		if r != reassigned || e != escalated {
+			t.Fatalf("Expected %d reassigned and %d escalated, got %d and %d", reassigned, escalated, r, e)
+		}
+	}
+	now := fakeClock(svc).Now()
+
+	escalate(now, 0, 0)
+	escalate(now.Add(2*time.Hour), 2, 0)
+	pr, err := svc.PullRequestHistory(ctx, "r1")
+	mustNil(t, err)
+	if !reflect.DeepEqual(pr.PR.AssignedReviewers, []string{"u4", "u5"}) {
+		t.Fatalf("Expected u4 and u5 to take over, got %v", pr.PR.AssignedReviewers)
+	}
+	for _, event := range pr.Events[len(pr.Events)-2:] {
+		if event.Type != models.EVENT_REVIEWER_REPLACED || !event.Automatic {
+			t.Fatalf("Expected an automatic replacement, got %+v", event)
+		}
+	}
+
+	// a manual reassignment is not automatic, the scheduler takes it over again
+	_, _, err = svc.PullRequestReassign(ctx, "r1", "u5", "u3")
+	mustNil(t, err)
+	later := now.Add(4 * time.Hour)
+	escalate(later, 1, 1)
+	escalate(later.Add(30*time.Minute), 0, 0)
+
+	// the replacements timed out as well, the lead of the department hears of each once
+	escalate(later.Add(2*time.Hour), 0, 1)
+	escalate(later.Add(3*time.Hour), 0, 0)
+	history, err := svc.PullRequestHistory(ctx, "r1")
+	mustNil(t, err)
+	var escalated []string
+	for _, event := range history.Events {
+		if event.Type == models.EVENT_REVIEW_ESCALATED {
+			if event.LeadId != "u6" {
+				t.Fatalf("Expected u6 to be notified, got %+v", event)
+			}
+			escalated = append(escalated, event.ReviewerId)
+		}
+	}
+	if !reflect.DeepEqual(escalated, []string{"u4", "u5"}) {
+		t.Fatalf("Expected u4 and u5 to be escalated, got %v", escalated)
+	}
+	if !reflect.DeepEqual(history.PR.AssignedReviewers, []string{"u4", "u5"}) {
+		t.Fatalf("Expected u5 to replace u3 again, got %v", history.PR.AssignedReviewers)
+	}
+
+	audit, err := svc.AuditQuery(ctx, models.AuditFilter{Actor: SCHEDULER_ACTOR})
+	mustNil(t, err)
+	if len(audit) != 3 {
+		t.Fatalf("Expected 3 reassignments by the scheduler in the audit log, got %d", len(audit))
+	}
+	// the changes of one run share a request id
+	if audit[0].RequestId != "bg-2" || audit[1].RequestId != "bg-2" || audit[2].RequestId != "bg-3" {
+		t.Fatalf("Expected the request ids of the runs, got %+v", audit)
+	}
+}
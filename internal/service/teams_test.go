@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+func TestMultipleTeams(t *testing.T) {
+	ctx := context.Background()
+	svc := newMemoryService()
+	_, err := svc.TeamAdd(ctx, models.Team{TeamName: "backend", Members: []models.TeamMember{
+		{UserId: "u1", Username: "Alice", IsActive: true},
+		{UserId: "u2", Username: "Bob", IsActive: true},
+		{UserId: "u3", Username: "Carol", IsActive: true},
+	}})
+	mustNil(t, err)
+
+	// an existing user joins as they are
+	frontend, err := svc.TeamAdd(ctx, models.Team{TeamName: "frontend", Members: []models.TeamMember{
+		{UserId: "u2", Username: "Robert", IsActive: false},
+		{UserId: "u4", Username: "Dave", IsActive: true},
+	}})
+	mustNil(t, err)
+	if frontend.Members[0] != (models.TeamMember{UserId: "u2", Username: "Bob", IsActive: true}) {
+		t.Fatalf("Expected u2 to join unchanged, got %+v", frontend.Members[0])
+	}
+	bob := *defaultStore(svc).Repo.GetUserById("u2")
+	if bob.TeamName != "backend" || !reflect.DeepEqual(bob.Teams, []string{"backend", "frontend"}) {
+		t.Fatalf("Expected backend to stay the primary team, got %+v", bob)
+	}
+
+	var svcErr ErrorService
+	pr, err := svc.PullRequestCreate(ctx, "r1", "req1", "u2", "")
+	mustNil(t, err)
+	if pr.TeamName != "backend" || !reflect.DeepEqual(pr.AssignedReviewers, []string{"u1", "u3"}) {
+		t.Fatalf("Expected the reviewers of the primary team, got %+v", pr)
+	}
+	pr, err = svc.PullRequestCreate(ctx, "r2", "req2", "u2", "frontend")
+	mustNil(t, err)
+	if pr.TeamName != "frontend" || !reflect.DeepEqual(pr.AssignedReviewers, []string{"u4"}) {
+		t.Fatalf("Expected the reviewers of the given team, got %+v", pr)
+	}
+	if _, err = svc.PullRequestCreate(ctx, "r3", "req3", "u1", "frontend"); !errors.As(err, &svcErr) || svcErr.ApiCode != models.WRONG_TEAM {
+		t.Fatalf("Expected WRONG_TEAM for a team of somebody else, got %v", err)
+	}
+
+	// the pull request's team has nobody left, the old reviewer's teams do
+	pr, err = svc.PullRequestCreate(ctx, "r4", "req4", "u4", "")
+	mustNil(t, err)
+	if !reflect.DeepEqual(pr.AssignedReviewers, []string{"u2"}) {
+		t.Fatalf("Expected u2 to review, got %+v", pr)
+	}
+	_, replacedBy, err := svc.PullRequestReassign(ctx, "r4", "u2", "")
+	mustNil(t, err)
+	if replacedBy != "u1" {
+		t.Fatalf("Expected u1 from the old reviewer's team, got %q", replacedBy)
+	}
+	// u2 shares frontend with the author
+	_, _, err = svc.PullRequestReassign(ctx, "r4", "u1", "u2")
+	mustNil(t, err)
+
+	if _, err = svc.UsersSetPrimaryTeam(ctx, "u1", "frontend"); !errors.As(err, &svcErr) || svcErr.ApiCode != models.WRONG_TEAM {
+		t.Fatalf("Expected WRONG_TEAM for a team the user is not in, got %v", err)
+	}
+	bob, err = svc.UsersSetPrimaryTeam(ctx, "u2", "frontend")
+	mustNil(t, err)
+	if bob.TeamName != "frontend" {
+		t.Fatalf("Expected frontend to be the primary team, got %+v", bob)
+	}
+	pr, err = svc.PullRequestCreate(ctx, "r5", "req5", "u2", "")
+	mustNil(t, err)
+	if pr.TeamName != "frontend" {
+		t.Fatalf("Expected the new primary team, got %+v", pr)
+	}
+
+	_, err = svc.UsersSetIsActive(ctx, "u2", false)
+	mustNil(t, err)
+	for _, teamName := range []string{"backend", "frontend"} {
+		team, err := svc.TeamGet(ctx, teamName)
+		mustNil(t, err)
+		for _, member := range team.Members {
+			if member.UserId == "u2" && member.IsActive {
+				t.Fatalf("Expected u2 to be inactive in %s", teamName)
+			}
+		}
+	}
+
+	report, err := svc.CheckConsistency(ctx, false)
+	mustNil(t, err)
+	if len(report.Violations) != 0 {
+		t.Fatalf("Expected no violations, got %+v", report.Violations)
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/repo"
+)
+
+// TenantExists tells whether requests may select tenantId.
+func (s *PrReviewerService) TenantExists(tenantId string) bool {
+	return s.tenants.GetTenant(tenantId) != nil
+}
+
+// TenantCreate adds a tenant with empty storage. Only actors that are not
+// bound to a tenant may manage tenants. The creation is the first event in
+// the audit log of the new tenant.
+func (s *PrReviewerService) TenantCreate(ctx context.Context, tenant models.Tenant) (models.Tenant, error) {
+	if err := checkGlobalActor(ctx); err != nil {
+		return tenant, err
+	}
+	var rules inputRules
+	rules.id("tenant_id", tenant.TenantId)
+	rules.name("name", tenant.Name)
+	if err := rules.err(); err != nil {
+		return tenant, err
+	}
+	// the repo decides, two creates of one id may both get this far
+	tenant.CreatedAt = s.clock.Now()
+	if err := s.tenants.CreateTenant(tenant); errors.Is(err, repo.ErrTenantExists) {
+		return tenant, NewErrorApi(OBJECT_EXISTS, models.TENANT_EXISTS, "Tenant already exists")
+	} else if err != nil {
+		return tenant, NewErrorService(INTERNAL_ERROR, err.Error())
+	}
+
+	scoped, err := s.scope(WithTenant(ctx, tenant.TenantId))
+	if err != nil {
+		return tenant, err
+	}
+	if err = scoped.audit(ctx, models.TENANT_CREATE, models.TENANT_ENTITY, tenant.TenantId, nil, tenant); err != nil {
+		return tenant, err
+	}
+	return tenant, nil
+}
+
+func (s *PrReviewerService) Tenants(ctx context.Context) ([]models.Tenant, error) {
+	if err := checkGlobalActor(ctx); err != nil {
+		return nil, err
+	}
+	return s.tenants.GetTenants(), nil
+}
+
+// ForEachTenant calls fn with a context selecting each tenant in turn, for
+// background work of the service. A failing tenant does not keep the others
+// from their turn, the errors are joined naming their tenants. It stops when
+// ctx is done.
+func (s *PrReviewerService) ForEachTenant(ctx context.Context, fn func(ctx context.Context) error) error {
+	var errs []error
+	for _, tenant := range s.tenants.GetTenants() {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		if err := fn(WithTenant(ctx, tenant.TenantId)); err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", tenant.TenantId, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func checkGlobalActor(ctx context.Context) error {
+	if actor := ActorFromContext(ctx); actor.Tenant != "" {
+		return NewErrorApi(FORBIDDEN, models.FORBIDDEN, "actors bound to a tenant cannot manage tenants")
+	}
+	return nil
+}
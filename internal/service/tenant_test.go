@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	svc := newMemoryService()
+	ctx := context.Background()
+	acme := WithTenant(ctx, "acme")
+
+	_, err := svc.TeamAdd(acme, models.Team{TeamName: "backend"})
+	var svcErr ErrorService
+	if !errors.As(err, &svcErr) || svcErr.ApiCode != models.TENANT_NOT_FOUND {
+		t.Fatalf("Expected TENANT_NOT_FOUND, got %v", err)
+	}
+
+	_, err = svc.TenantCreate(ctx, models.Tenant{TenantId: "acme", Name: "Acme"})
+	mustNil(t, err)
+	if _, err = svc.TenantCreate(ctx, models.Tenant{TenantId: "acme", Name: "Acme"}); !errors.As(err, &svcErr) || svcErr.ApiCode != models.TENANT_EXISTS {
+		t.Fatalf("Expected TENANT_EXISTS, got %v", err)
+	}
+
+	// the same team and user ids live independently in both tenants
+	for _, c := range []context.Context{ctx, acme} {
+		_, err = svc.TeamAdd(c, models.Team{TeamName: "backend", Members: []models.TeamMember{
+			{UserId: "u1", Username: "Alice", IsActive: true},
+			{UserId: "u2", Username: "Bob", IsActive: true},
+		}})
+		mustNil(t, err)
+	}
+	_, err = svc.PullRequestCreate(acme, "pr-1", "Add search", "u1", "")
+	mustNil(t, err)
+	if _, err = svc.PullRequestMerge(ctx, "pr-1"); !errors.As(err, &svcErr) || svcErr.Code != OBJECT_NOT_FOUND {
+		t.Fatalf("Expected the pull request to be invisible in the default tenant, got %v", err)
+	}
+	reviews, err := svc.UsersGetReview(ctx, "u2")
+	mustNil(t, err)
+	if len(reviews) != 0 {
+		t.Fatalf("Expected no reviews in the default tenant, got %+v", reviews)
+	}
+
+	bound := WithActor(ctx, Actor{Name: "ci", Role: models.ROLE_ADMIN, Tenant: "acme"})
+	if _, err = svc.TeamGet(bound, "backend"); !errors.As(err, &svcErr) || svcErr.Code != FORBIDDEN {
+		t.Fatalf("Expected a bound actor to be kept out of the default tenant, got %v", err)
+	}
+	if _, err = svc.TenantCreate(WithTenant(bound, "acme"), models.Tenant{TenantId: "other", Name: "Other"}); !errors.As(err, &svcErr) || svcErr.Code != FORBIDDEN {
+		t.Fatalf("Expected a bound actor not to create tenants, got %v", err)
+	}
+
+	events, err := svc.AuditQuery(acme, models.AuditFilter{})
+	mustNil(t, err)
+	if len(events) == 0 || events[0].Action != models.TENANT_CREATE {
+		t.Fatalf("Expected the tenant creation to open the audit log, got %+v", events)
+	}
+}
+
+func TestConcurrentTenantCreate(t *testing.T) {
+	svc := newMemoryService()
+	ctx := context.Background()
+
+	var succeeded atomic.Int32
+	parallel(16, func(g int) {
+		_, err := svc.TenantCreate(ctx, models.Tenant{TenantId: "acme", Name: "Acme"})
+		if err == nil {
+			succeeded.Add(1)
+			return
+		}
+		var svcErr ErrorService
+		if !errors.As(err, &svcErr) || svcErr.ApiCode != models.TENANT_EXISTS {
+			t.Errorf("Expected TENANT_EXISTS, got %v", err)
+		}
+	})
+	if succeeded.Load() != 1 {
+		t.Fatalf("Expected exactly one create, got %d", succeeded.Load())
+	}
+}
+
+func TestForEachTenantGoesOnAfterErrors(t *testing.T) {
+	svc := newMemoryService()
+	ctx := context.Background()
+	for _, tenantId := range []string{"acme", "globex"} {
+		_, err := svc.TenantCreate(ctx, models.Tenant{TenantId: tenantId, Name: tenantId})
+		mustNil(t, err)
+	}
+
+	failure := errors.New("storage is down")
+	var visited []string
+	err := svc.ForEachTenant(ctx, func(ctx context.Context) error {
+		tenantId := TenantFromContext(ctx)
+		visited = append(visited, tenantId)
+		if tenantId != "globex" {
+			return failure
+		}
+		return nil
+	})
+	if !slices.Equal(visited, []string{models.DEFAULT_TENANT, "acme", "globex"}) {
+		t.Fatalf("Expected every tenant to be visited, got %v", visited)
+	}
+	if !errors.Is(err, failure) || !strings.Contains(err.Error(), "tenant acme: storage is down") || !strings.Contains(err.Error(), "tenant "+models.DEFAULT_TENANT+": ") {
+		t.Fatalf("Expected the errors of both failing tenants, got %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := svc.ForEachTenant(cancelled, func(ctx context.Context) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected a done context to stop the loop, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+const (
+	MAX_ID_LENGTH   = 200
+	MAX_NAME_LENGTH = 256
+
+	// ID_SPECIAL_CHARS may appear in an id besides letters and digits; "/",
+	// "#" and "!" are needed for ingested ids like "org/repo#12".
+	ID_SPECIAL_CHARS = "._-:/#!@"
+)
+
+// NewValidationError is an INVALID_FIELDS listing every invalid field, the
+// API sends it as a VALIDATION_ERROR with the fields in details, with the
+// status of the requests the openapi.yml validator rejects.
+func NewValidationError(details []models.FieldError) ErrorService {
+	detail := models.NewValidationErrorDetail(details)
+	return ErrorService{
+		Code:    INVALID_FIELDS,
+		ApiCode: detail.Code,
+		Message: detail.Message,
+		Details: detail.Details,
+	}
+}
+
+// inputRules collects the violations of the input rules, so a request is
+// rejected with all of them before anything is read from or written to the
+// repo.
+type inputRules struct {
+	details []models.FieldError
+}
+
+func (v *inputRules) add(field, format string, args ...any) {
+	v.details = append(v.details, models.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// id checks a user, team member or pull request id: not empty, at most
+// MAX_ID_LENGTH characters, letters, digits and ID_SPECIAL_CHARS only.
+func (v *inputRules) id(field, value string) {
+	if value == "" {
+		v.add(field, "must not be empty")
+		return
+	}
+	if utf8.RuneCountInString(value) > MAX_ID_LENGTH {
+		v.add(field, "must be at most %d characters", MAX_ID_LENGTH)
+		return
+	}
+	for _, r := range value {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(ID_SPECIAL_CHARS, r) {
+			v.add(field, "must contain only letters, digits and %s", ID_SPECIAL_CHARS)
+			return
+		}
+	}
+}
+
+// name checks a team, user or pull request name: not blank, at most
+// MAX_NAME_LENGTH characters, no control characters.
+func (v *inputRules) name(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, "must not be empty")
+		return
+	}
+	if utf8.RuneCountInString(value) > MAX_NAME_LENGTH {
+		v.add(field, "must be at most %d characters", MAX_NAME_LENGTH)
+		return
+	}
+	if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+		v.add(field, "must not contain control characters")
+	}
+}
+
+// team checks the team name and every member, and that no user id is listed
+// twice.
+func (v *inputRules) team(prefix string, team models.Team) {
+	v.name(prefix+"team_name", team.TeamName)
+	if team.ParentTeam != "" {
+		v.name(prefix+"parent_team", team.ParentTeam)
+	}
+	if team.ReviewSLA != "" {
+		v.duration(prefix+"review_sla", team.ReviewSLA)
+	}
+	seen := make(map[string]int, len(team.Members))
+	for i, member := range team.Members {
+		field := fmt.Sprintf("%smembers[%d]", prefix, i)
+		v.id(field+".user_id", member.UserId)
+		v.name(field+".username", member.Username)
+		if member.Role != "" {
+			v.role(field+".role", member.Role)
+		}
+		if first, ok := seen[member.UserId]; ok && member.UserId != "" {
+			v.add(field+".user_id", "duplicates %smembers[%d].user_id", prefix, first)
+			continue
+		}
+		seen[member.UserId] = i
+	}
+}
+
+// duration checks a positive Go duration like "24h".
+func (v *inputRules) duration(field, value string) {
+	if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+		v.add(field, "must be a positive duration like 24h or 90m")
+	}
+}
+
+// role checks a team role.
+func (v *inputRules) role(field string, role models.TeamRole) {
+	if !slices.Contains(models.TEAM_ROLES, role) {
+		v.add(field, "must be one of %v", models.TEAM_ROLES)
+	}
+}
+
+func (v *inputRules) err() error {
+	if len(v.details) == 0 {
+		return nil
+	}
+	return NewValidationError(v.details)
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+func TestInputValidation(t *testing.T) {
+	ctx := context.Background()
+	svc := newMemoryService()
+	_, err := svc.TeamAdd(ctx, models.Team{TeamName: "backend", Members: []models.TeamMember{
+		{UserId: "u1", Username: "Alice", IsActive: true},
+	}})
+	mustNil(t, err)
+
+	for _, tc := range []struct {
+		name     string
+		call     func() error
+		expected []models.FieldError
+	}{
+		{"TeamAdd", func() error {
+			_, err := svc.TeamAdd(ctx, models.Team{TeamName: " ", Members: []models.TeamMember{
+				{UserId: "u1", Username: "Alice"},
+				{UserId: "u2", Username: "Bob\n"},
+				{UserId: "u2", Username: "Bob"},
+				{UserId: strings.Repeat("x", MAX_ID_LENGTH+1), Username: "Carol"},
+			}})
+			return err
+		}, []models.FieldError{
+			{Field: "team_name", Message: "must not be empty"},
+			{Field: "members[1].username", Message: "must not contain control characters"},
+			{Field: "members[2].user_id", Message: "duplicates members[1].user_id"},
+			{Field: "members[3].user_id", Message: "must be at most 200 characters"},
+		}},
+		{"PullRequestCreate", func() error {
+			_, err := svc.PullRequestCreate(ctx, "pr 1", "", "u1", "")
+			return err
+		}, []models.FieldError{
+			{Field: "pull_request_id", Message: "must contain only letters, digits and ._-:/#!@"},
+			{Field: "pull_request_name", Message: "must not be empty"},
+		}},
+		{"PullRequestReassign", func() error {
+			_, _, err := svc.PullRequestReassign(ctx, "", "u\t1", "")
+			return err
+		}, []models.FieldError{
+			{Field: "pull_request_id", Message: "must not be empty"},
+			{Field: "old_user_id", Message: "must contain only letters, digits and ._-:/#!@"},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var svcErr ErrorService
+			if err := tc.call(); !errors.As(err, &svcErr) || svcErr.Code != INVALID_FIELDS || svcErr.ApiCode != models.VALIDATION_ERROR {
+				t.Fatalf("Expected a validation error, got %v", err)
+			}
+			if !reflect.DeepEqual(svcErr.Details, tc.expected) {
+				t.Fatalf("Expected %+v, got %+v", tc.expected, svcErr.Details)
+			}
+		})
+	}
+
+	if len(defaultStore(svc).Repo.GetUsers()) != 1 {
+		t.Fatal("Nothing should be written for a rejected request")
+	}
+}
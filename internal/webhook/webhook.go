@@ -0,0 +1,329 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/clock"
+	"github.com/Dowtai/pr-reviewer-service/internal/ids"
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/repo"
+	"github.com/Dowtai/pr-reviewer-service/internal/service"
+)
+
+const (
+	SIGNATURE_HEADER = "X-Webhook-Signature"
+	EVENT_HEADER     = "X-Webhook-Event"
+	DELIVERY_HEADER  = "X-Webhook-Delivery"
+
+	DEFAULT_MAX_ATTEMPTS = 5
+	DEFAULT_BACKOFF      = 500 * time.Millisecond
+)
+
+// Auditor records subscription changes in the audit log of the request's
+// tenant, service.PrReviewerService implements it.
+type Auditor interface {
+	RecordAudit(ctx context.Context, action models.AuditAction, entityType models.AuditEntity, entityId string, before, after any) error
+}
+
+// Dispatcher delivers pull request events to webhook subscribers.
+// Every subscription has a queue worked off by one goroutine, so a receiver
+// gets the events in the order they happened. A delivery is retried with
+// exponential backoff and holds back the later ones of its subscription until
+// it succeeds or gives up; each attempt is written to the delivery log. The
+// backoff waits for tickers of the clock, a fake clock drives the retries in
+// tests.
+type Dispatcher struct {
+	repo        repo.WebhookRepo
+	auditor     Auditor
+	client      *http.Client
+	clock       clock.Clock
+	ids         ids.Generator
+	maxAttempts int
+	baseBackoff time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// mx guards queues. Close cancels ctx under it, so no worker starts
+	// once Close waits for them.
+	mx     sync.Mutex
+	queues map[string]*queue
+}
+
+// queue holds the deliveries of one subscription that wait for its worker.
+// It exists while the worker runs.
+type queue struct {
+	pending []delivery
+}
+
+type delivery struct {
+	subscription models.WebhookSubscription
+	payload      models.WebhookPayload
+}
+
+func NewDispatcher(repo repo.WebhookRepo, auditor Auditor, client *http.Client, clock clock.Clock, ids ids.Generator, maxAttempts int, baseBackoff time.Duration) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		repo:        repo,
+		auditor:     auditor,
+		client:      client,
+		clock:       clock,
+		ids:         ids,
+		maxAttempts: maxAttempts,
+		baseBackoff: baseBackoff,
+		ctx:         ctx,
+		cancel:      cancel,
+		queues:      make(map[string]*queue),
+	}
+}
+
+// Sign returns the signature value a receiver should expect in SIGNATURE_HEADER.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func ValidateSubscription(subscription *models.WebhookSubscription) error {
+	u, err := url.Parse(subscription.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http(s) url")
+	}
+	if subscription.Secret == "" {
+		return errors.New("secret is required")
+	}
+	for _, eventType := range subscription.EventTypes {
+		switch eventType {
+		case models.EVENT_PR_CREATED, models.EVENT_REVIEWER_ASSIGNED, models.EVENT_REVIEWER_REPLACED, models.EVENT_REVIEW_OVERDUE, models.EVENT_REVIEW_ESCALATED, models.EVENT_PR_MERGED, models.EVENT_PR_CLOSED:
+		default:
+			return fmt.Errorf("unknown event type %q", eventType)
+		}
+	}
+	return nil
+}
+
+// Subscribe adds a subscription to the events of the request's tenant. The
+// other methods only see the subscriptions of the request's tenant too.
+// Subscribing and unsubscribing are audited like the service's mutations,
+// the secret is left out of the audit event.
+func (d *Dispatcher) Subscribe(ctx context.Context, subscription models.WebhookSubscription) (models.WebhookSubscription, error) {
+	subscription.Id = d.ids.NewId()
+	subscription.TenantId = service.TenantFromContext(ctx)
+	subscription.CreatedAt = d.clock.Now()
+	if subscription.EventTypes == nil {
+		subscription.EventTypes = []models.PullRequestEventType{}
+	}
+
+	if err := d.repo.CreateSubscription(subscription); err != nil {
+		return subscription, service.NewErrorService(service.INTERNAL_ERROR, err.Error())
+	}
+
+	subscription.Secret = ""
+	if err := d.auditor.RecordAudit(ctx, models.WEBHOOK_SUBSCRIBE, models.WEBHOOK_ENTITY, subscription.Id, nil, subscription); err != nil {
+		// a subscription nobody can find in the audit log is not kept
+		_ = d.repo.DeleteSubscription(subscription.Id)
+		return subscription, err
+	}
+	return subscription, nil
+}
+
+func (d *Dispatcher) Unsubscribe(ctx context.Context, subscriptionId string) error {
+	subscription, ok := d.find(ctx, subscriptionId)
+	if !ok {
+		return service.NewErrorApi(service.OBJECT_NOT_FOUND, models.NOT_FOUND, "Subscription not found")
+	}
+	if err := d.repo.DeleteSubscription(subscriptionId); err != nil {
+		return service.NewErrorService(service.INTERNAL_ERROR, err.Error())
+	}
+	d.mx.Lock()
+	if q, ok := d.queues[subscriptionId]; ok {
+		q.pending = nil
+	}
+	d.mx.Unlock()
+
+	subscription.Secret = ""
+	return d.auditor.RecordAudit(ctx, models.WEBHOOK_UNSUBSCRIBE, models.WEBHOOK_ENTITY, subscriptionId, subscription, nil)
+}
+
+// Subscriptions lists subscriptions without their secrets.
+func (d *Dispatcher) Subscriptions(ctx context.Context) []models.WebhookSubscription {
+	subscriptions := d.tenantSubscriptions(ctx)
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+	return subscriptions
+}
+
+func (d *Dispatcher) Deliveries(ctx context.Context, subscriptionId string) ([]models.WebhookDelivery, error) {
+	if _, ok := d.find(ctx, subscriptionId); !ok {
+		return nil, service.NewErrorApi(service.OBJECT_NOT_FOUND, models.NOT_FOUND, "Subscription not found")
+	}
+	return d.repo.GetDeliveries(subscriptionId), nil
+}
+
+func (d *Dispatcher) OnPullRequestEvents(ctx context.Context, pr models.PullRequest, events []models.PullRequestEvent) {
+	subscriptions := d.tenantSubscriptions(ctx)
+	for _, event := range events {
+		for _, subscription := range subscriptions {
+			if !subscription.Accepts(event.Type) {
+				continue
+			}
+			payload := models.WebhookPayload{
+				DeliveryId: d.ids.NewId(),
+				TenantId:   subscription.TenantId,
+				EventType:  event.Type,
+				Event:      event,
+				PR:         pr,
+			}
+			d.enqueue(delivery{subscription, payload})
+		}
+	}
+}
+
+// enqueue appends the delivery to the queue of its subscription and starts
+// the worker of an idle queue. Nothing is queued after Close.
+func (d *Dispatcher) enqueue(next delivery) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	if d.ctx.Err() != nil {
+		return
+	}
+
+	subscriptionId := next.subscription.Id
+	q, ok := d.queues[subscriptionId]
+	if !ok {
+		q = &queue{}
+		d.queues[subscriptionId] = q
+		d.wg.Add(1)
+		go d.work(subscriptionId, q)
+	}
+	q.pending = append(q.pending, next)
+}
+
+// work delivers the queued deliveries one by one and removes the queue once
+// it is empty.
+func (d *Dispatcher) work(subscriptionId string, q *queue) {
+	defer d.wg.Done()
+	for {
+		d.mx.Lock()
+		if len(q.pending) == 0 || d.ctx.Err() != nil {
+			delete(d.queues, subscriptionId)
+			d.mx.Unlock()
+			return
+		}
+		next := q.pending[0]
+		q.pending = q.pending[1:]
+		d.mx.Unlock()
+
+		d.deliver(next.subscription, next.payload)
+	}
+}
+
+func (d *Dispatcher) tenantSubscriptions(ctx context.Context) []models.WebhookSubscription {
+	tenantId := service.TenantFromContext(ctx)
+	subscriptions := make([]models.WebhookSubscription, 0)
+	for _, subscription := range d.repo.GetSubscriptions() {
+		if subscription.TenantId == tenantId {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	return subscriptions
+}
+
+// Close stops pending retries, drops the queued deliveries and waits for
+// running ones.
+func (d *Dispatcher) Close() {
+	d.mx.Lock()
+	d.cancel()
+	d.mx.Unlock()
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) deliver(subscription models.WebhookSubscription, payload models.WebhookPayload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		d.log(subscription, payload, 1, 0, err)
+		return
+	}
+
+	backoff := d.baseBackoff
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		statusCode, err := d.send(subscription, payload, body)
+		if err == nil || attempt == d.maxAttempts {
+			d.log(subscription, payload, attempt, statusCode, err)
+			return
+		}
+
+		// the wait starts before the attempt is logged, whoever sees the
+		// failure in the log can count the backoff from it
+		ticker := d.clock.NewTicker(backoff)
+		d.log(subscription, payload, attempt, statusCode, err)
+		select {
+		case <-d.ctx.Done():
+			ticker.Stop()
+			return
+		case <-ticker.C():
+			ticker.Stop()
+			backoff *= 2
+		}
+	}
+}
+
+func (d *Dispatcher) send(subscription models.WebhookSubscription, payload models.WebhookPayload, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, subscription.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SIGNATURE_HEADER, Sign(subscription.Secret, body))
+	req.Header.Set(EVENT_HEADER, string(payload.EventType))
+	req.Header.Set(DELIVERY_HEADER, payload.DeliveryId)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) log(subscription models.WebhookSubscription, payload models.WebhookPayload, attempt, statusCode int, err error) {
+	delivery := models.WebhookDelivery{
+		DeliveryId:     payload.DeliveryId,
+		SubscriptionId: subscription.Id,
+		EventType:      payload.EventType,
+		Attempt:        attempt,
+		Timestamp:      d.clock.Now(),
+		StatusCode:     statusCode,
+		Delivered:      err == nil,
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	_ = d.repo.AppendDelivery(delivery)
+}
+
+func (d *Dispatcher) find(ctx context.Context, subscriptionId string) (models.WebhookSubscription, bool) {
+	for _, subscription := range d.tenantSubscriptions(ctx) {
+		if subscription.Id == subscriptionId {
+			return subscription, true
+		}
+	}
+	return models.WebhookSubscription{}, false
+}
@@ -0,0 +1,369 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/clock"
+	"github.com/Dowtai/pr-reviewer-service/internal/ids"
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/repo/memory_repo"
+	"github.com/Dowtai/pr-reviewer-service/internal/service"
+)
+
+var testEpoch = time.Date(2025, time.March, 3, 9, 0, 0, 0, time.UTC)
+
+// receiver is an httptest server answering with the statuses in turn, the
+// last one for every request after them.
+type receiver struct {
+	*httptest.Server
+	mx       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mx.Lock()
+		status := r.statuses[min(len(r.requests), len(r.statuses)-1)]
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+		r.mx.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) received() int {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return len(r.requests)
+}
+
+type testDispatcher struct {
+	*Dispatcher
+	clock   *clock.Fake
+	repo    *memory_repo.MemoryWebhookRepo
+	service *service.PrReviewerService
+}
+
+func newTestDispatcher(t *testing.T, maxAttempts int, backoff time.Duration) testDispatcher {
+	repo := memory_repo.NewMemoryWebhookRepo(memory_repo.DEFAULT_DELIVERY_LIMIT)
+	clk := clock.NewFake(testEpoch)
+	svc := service.NewService(memory_repo.NewMemoryTenantRepo(memory_repo.NewMemoryStore(), clk), clk, ids.NewSequence("req-"))
+	d := NewDispatcher(repo, svc, &http.Client{Timeout: 5 * time.Second}, clk, ids.NewSequence("wh-"), maxAttempts, backoff)
+	t.Cleanup(d.Close)
+	return testDispatcher{Dispatcher: d, clock: clk, repo: repo, service: svc}
+}
+
+func (d testDispatcher) subscribe(t *testing.T, ctx context.Context, url string, eventTypes ...models.PullRequestEventType) models.WebhookSubscription {
+	t.Helper()
+	subscription, err := d.Subscribe(ctx, models.WebhookSubscription{Url: url, Secret: "s3cret", EventTypes: eventTypes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return subscription
+}
+
+// waitDeliveries waits for n attempts to be logged for the subscription.
+func (d testDispatcher) waitDeliveries(t *testing.T, subscriptionId string, n int) []models.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries := d.repo.GetDeliveries(subscriptionId)
+		if len(deliveries) >= n {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d logged attempts, got %+v", n, deliveries)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func testPR() models.PullRequest {
+	created := testEpoch
+	return models.NewPR("r1", "req1", "u1", models.OPEN, []string{"u2"}, &created)
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"delivery_id": "1"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	if expected := "sha256=" + hex.EncodeToString(mac.Sum(nil)); Sign("s3cret", body) != expected {
+		t.Fatalf("Expected %s, got %s", expected, Sign("s3cret", body))
+	}
+	if Sign("s3cret", body) == Sign("other", body) || Sign("s3cret", body) == Sign("s3cret", []byte(`{}`)) {
+		t.Fatal("Expected the signature to depend on the secret and the body")
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	ctx := context.Background()
+	receiver := newReceiver(t, http.StatusOK)
+	d := newTestDispatcher(t, 3, time.Second)
+	subscription := d.subscribe(t, ctx, receiver.URL)
+	if subscription.Id != "wh-1" || !subscription.CreatedAt.Equal(testEpoch) || subscription.Secret != "" {
+		t.Fatalf("Unexpected subscription %+v", subscription)
+	}
+
+	pr := testPR()
+	event := models.NewPRCreatedEvent(&pr, testEpoch)
+	d.OnPullRequestEvents(ctx, pr, []models.PullRequestEvent{event})
+	deliveries := d.waitDeliveries(t, subscription.Id, 1)
+
+	expected := models.WebhookDelivery{
+		DeliveryId:     "wh-2",
+		SubscriptionId: subscription.Id,
+		EventType:      models.EVENT_PR_CREATED,
+		Attempt:        1,
+		Timestamp:      testEpoch,
+		StatusCode:     http.StatusOK,
+		Delivered:      true,
+	}
+	if len(deliveries) != 1 || deliveries[0] != expected {
+		t.Fatalf("Expected the delivery %+v, got %+v", expected, deliveries)
+	}
+
+	req, body := receiver.requests[0], receiver.bodies[0]
+	if req.Header.Get(SIGNATURE_HEADER) != Sign("s3cret", body) {
+		t.Errorf("Expected the body to be signed, got %s", req.Header.Get(SIGNATURE_HEADER))
+	}
+	if req.Header.Get(EVENT_HEADER) != string(models.EVENT_PR_CREATED) || req.Header.Get(DELIVERY_HEADER) != "wh-2" {
+		t.Errorf("Unexpected headers %v", req.Header)
+	}
+	var payload models.WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.DeliveryId != "wh-2" || payload.TenantId != models.DEFAULT_TENANT || payload.Event.Type != models.EVENT_PR_CREATED || payload.PR.PullRequestId != "r1" {
+		t.Errorf("Unexpected payload %+v", payload)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	ctx := context.Background()
+	receiver := newReceiver(t, http.StatusInternalServerError)
+	d := newTestDispatcher(t, 4, time.Second)
+	subscription := d.subscribe(t, ctx, receiver.URL)
+
+	pr := testPR()
+	d.OnPullRequestEvents(ctx, pr, []models.PullRequestEvent{models.NewPRMergedEvent("r1", testEpoch)})
+
+	// the waits double: 1s, 2s, 4s
+	for attempt, backoff := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		d.waitDeliveries(t, subscription.Id, attempt+1)
+		d.clock.Advance(backoff - time.Millisecond)
+		time.Sleep(20 * time.Millisecond)
+		if n := receiver.received(); n != attempt+1 {
+			t.Fatalf("Expected no retry before %s, got %d requests", backoff, n)
+		}
+		d.clock.Advance(time.Millisecond)
+	}
+	deliveries := d.waitDeliveries(t, subscription.Id, 4)
+
+	// the last attempt gives up
+	d.clock.Advance(time.Hour)
+	time.Sleep(20 * time.Millisecond)
+	if n := receiver.received(); n != 4 {
+		t.Fatalf("Expected 4 attempts, got %d", n)
+	}
+
+	offsets := []time.Duration{0, time.Second, 3 * time.Second, 7 * time.Second}
+	for i, delivery := range deliveries {
+		if delivery.Attempt != i+1 || delivery.Delivered || delivery.StatusCode != http.StatusInternalServerError ||
+			delivery.Error != "receiver responded with 500" || !delivery.Timestamp.Equal(testEpoch.Add(offsets[i])) {
+			t.Errorf("Unexpected attempt %d: %+v", i+1, delivery)
+		}
+		if delivery.DeliveryId != deliveries[0].DeliveryId {
+			t.Errorf("Expected the retries to keep the delivery id, got %+v", delivery)
+		}
+	}
+}
+
+func TestRetryUntilDelivered(t *testing.T) {
+	ctx := context.Background()
+	receiver := newReceiver(t, http.StatusBadGateway, http.StatusAccepted)
+	d := newTestDispatcher(t, 5, time.Second)
+	subscription := d.subscribe(t, ctx, receiver.URL)
+
+	pr := testPR()
+	d.OnPullRequestEvents(ctx, pr, []models.PullRequestEvent{models.NewPRMergedEvent("r1", testEpoch)})
+	d.waitDeliveries(t, subscription.Id, 1)
+	d.clock.Advance(time.Second)
+	deliveries := d.waitDeliveries(t, subscription.Id, 2)
+
+	d.clock.Advance(time.Hour)
+	time.Sleep(20 * time.Millisecond)
+	if n := receiver.received(); n != 2 || len(d.repo.GetDeliveries(subscription.Id)) != 2 {
+		t.Fatalf("Expected no attempts after the delivery, got %d requests", n)
+	}
+	if deliveries[0].Delivered || deliveries[0].StatusCode != http.StatusBadGateway || !deliveries[1].Delivered || deliveries[1].StatusCode != http.StatusAccepted {
+		t.Fatalf("Unexpected delivery log %+v", deliveries)
+	}
+	if bodies := receiver.bodies; string(bodies[0]) != string(bodies[1]) || receiver.requests[1].Header.Get(SIGNATURE_HEADER) != Sign("s3cret", bodies[1]) {
+		t.Fatal("Expected the retry to send the same signed body")
+	}
+}
+
+func TestCloseStopsRetries(t *testing.T) {
+	ctx := context.Background()
+	receiver := newReceiver(t, http.StatusServiceUnavailable)
+	d := newTestDispatcher(t, 5, time.Second)
+	subscription := d.subscribe(t, ctx, receiver.URL)
+
+	pr := testPR()
+	d.OnPullRequestEvents(ctx, pr, []models.PullRequestEvent{models.NewPRMergedEvent("r1", testEpoch)})
+	d.waitDeliveries(t, subscription.Id, 1)
+
+	closed := make(chan struct{})
+	go func() {
+		d.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Close not to wait for the backoff")
+	}
+	if n := receiver.received(); n != 1 {
+		t.Fatalf("Expected a single attempt, got %d", n)
+	}
+}
+
+func TestDeliveryOrder(t *testing.T) {
+	ctx := context.Background()
+	receiver := newReceiver(t, http.StatusInternalServerError, http.StatusOK)
+	d := newTestDispatcher(t, 3, time.Second)
+	subscription := d.subscribe(t, ctx, receiver.URL)
+
+	pr := testPR()
+	d.OnPullRequestEvents(ctx, pr, []models.PullRequestEvent{models.NewPRCreatedEvent(&pr, testEpoch)})
+	d.OnPullRequestEvents(ctx, pr, []models.PullRequestEvent{models.NewPRMergedEvent("r1", testEpoch)})
+	d.waitDeliveries(t, subscription.Id, 1)
+
+	// the merge waits for the retry of the creation
+	time.Sleep(20 * time.Millisecond)
+	if n := receiver.received(); n != 1 {
+		t.Fatalf("Expected the merge to wait for the creation, got %d requests", n)
+	}
+	d.clock.Advance(time.Second)
+	d.waitDeliveries(t, subscription.Id, 3)
+
+	var types []models.PullRequestEventType
+	for _, req := range receiver.requests {
+		types = append(types, models.PullRequestEventType(req.Header.Get(EVENT_HEADER)))
+	}
+	expected := []models.PullRequestEventType{models.EVENT_PR_CREATED, models.EVENT_PR_CREATED, models.EVENT_PR_MERGED}
+	if !slices.Equal(types, expected) {
+		t.Fatalf("Expected the events in order %v, got %v", expected, types)
+	}
+}
+
+func TestDeliveryLogLimit(t *testing.T) {
+	repo := memory_repo.NewMemoryWebhookRepo(2)
+	if err := repo.CreateSubscription(models.WebhookSubscription{Id: "wh-1"}); err != nil {
+		t.Fatal(err)
+	}
+	for attempt := 1; attempt <= 3; attempt++ {
+		repo.AppendDelivery(models.WebhookDelivery{DeliveryId: "d1", SubscriptionId: "wh-1", Attempt: attempt})
+	}
+	if deliveries := repo.GetDeliveries("wh-1"); len(deliveries) != 2 || deliveries[0].Attempt != 2 || deliveries[1].Attempt != 3 {
+		t.Fatalf("Expected the last 2 attempts, got %+v", deliveries)
+	}
+
+	if err := repo.DeleteSubscription("wh-1"); err != nil {
+		t.Fatal(err)
+	}
+	if deliveries := repo.GetDeliveries("wh-1"); len(deliveries) != 0 {
+		t.Fatalf("Expected the log to be removed with the subscription, got %+v", deliveries)
+	}
+}
+
+func TestSubscriptionFilters(t *testing.T) {
+	ctx := context.Background()
+	var merged, other atomic.Int32
+	mergedReceiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { merged.Add(1) }))
+	t.Cleanup(mergedReceiver.Close)
+	otherReceiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { other.Add(1) }))
+	t.Cleanup(otherReceiver.Close)
+
+	d := newTestDispatcher(t, 1, time.Second)
+	onlyMerged := d.subscribe(t, ctx, mergedReceiver.URL, models.EVENT_PR_MERGED)
+	if _, err := d.service.TenantCreate(ctx, models.Tenant{TenantId: "acme", Name: "Acme"}); err != nil {
+		t.Fatal(err)
+	}
+	otherTenant := service.WithTenant(ctx, "acme")
+	d.subscribe(t, otherTenant, otherReceiver.URL)
+
+	pr := testPR()
+	d.OnPullRequestEvents(ctx, pr, []models.PullRequestEvent{models.NewPRCreatedEvent(&pr, testEpoch), models.NewPRMergedEvent("r1", testEpoch)})
+	d.waitDeliveries(t, onlyMerged.Id, 1)
+	d.Close()
+
+	if merged.Load() != 1 || other.Load() != 0 {
+		t.Fatalf("Expected only the merge of the default tenant to be delivered, got %d and %d", merged.Load(), other.Load())
+	}
+	if subscriptions := d.Subscriptions(otherTenant); len(subscriptions) != 1 || subscriptions[0].Secret != "" {
+		t.Fatalf("Expected the tenant's subscription without its secret, got %+v", subscriptions)
+	}
+	if _, err := d.Deliveries(otherTenant, onlyMerged.Id); err == nil {
+		t.Fatal("Expected the deliveries of another tenant to be hidden")
+	}
+}
+
+func TestSubscriptionAudit(t *testing.T) {
+	ctx := service.WithActor(context.Background(), service.Actor{Name: "alice", Role: models.ROLE_ADMIN})
+	d := newTestDispatcher(t, 1, time.Second)
+	subscription := d.subscribe(t, ctx, "https://bots.example.com/pr-events", models.EVENT_PR_MERGED)
+	if err := d.Unsubscribe(ctx, subscription.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := d.service.AuditQuery(ctx, models.AuditFilter{EntityType: models.WEBHOOK_ENTITY})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Action != models.WEBHOOK_SUBSCRIBE || events[1].Action != models.WEBHOOK_UNSUBSCRIBE {
+		t.Fatalf("Expected the subscribe and the unsubscribe to be audited, got %+v", events)
+	}
+	for _, event := range events {
+		if event.Actor != "alice" || event.ActorRole != models.ROLE_ADMIN || event.EntityId != subscription.Id {
+			t.Errorf("Unexpected audit event %+v", event)
+		}
+		if strings.Contains(string(event.Before)+string(event.After), "s3cret") {
+			t.Errorf("Expected the secret to be left out of the audit log, got %+v", event)
+		}
+	}
+	var created models.WebhookSubscription
+	if err := json.Unmarshal(events[0].After, &created); err != nil || created.Url != subscription.Url || created.TenantId != models.DEFAULT_TENANT {
+		t.Errorf("Expected the subscription as the state after subscribing, got %s", events[0].After)
+	}
+	if events[1].Before == nil || events[1].After != nil {
+		t.Errorf("Expected the subscription as the state before unsubscribing, got %+v", events[1])
+	}
+
+	// an unknown tenant gets no subscription
+	if _, err := d.Subscribe(service.WithTenant(ctx, "missing"), models.WebhookSubscription{Url: subscription.Url, Secret: "s3cret"}); err == nil {
+		t.Fatal("Expected the subscription of an unknown tenant to fail")
+	}
+	if subscriptions := d.repo.GetSubscriptions(); len(subscriptions) != 0 {
+		t.Fatalf("Expected no subscriptions left, got %+v", subscriptions)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/Dowtai/pr-reviewer-service/internal/auth"
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+)
+
+// runCommand runs a subcommand of the server binary and returns the process
+// exit code. Commands against a running server live in prctl.
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	switch args[0] {
+	case "token":
+		return runToken(args[1:], stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n", args[0])
+		return 2
+	}
+}
+
+// runToken signs a JWT with AUTH_JWT_SECRET, it needs no running server.
+func runToken(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("token", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	subject := flags.String("subject", "", "actor name, the user_id for the user role")
+	role := flags.String("role", string(models.ROLE_USER), "admin, bot or user")
+	ttl := flags.Duration("ttl", 24*time.Hour, "lifetime of the token")
+	tenant := flags.String("tenant", "", "bind the token to a tenant, any tenant when empty")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	secret := os.Getenv("AUTH_JWT_SECRET")
+	if *subject == "" || !slices.Contains(auth.ROLES, models.Role(*role)) || *ttl <= 0 || secret == "" {
+		fmt.Fprintln(stderr, "usage: token --subject NAME [--role admin|bot|user] [--ttl 24h] [--tenant ID], with AUTH_JWT_SECRET set")
+		return 2
+	}
+
+	now := time.Now()
+	claims := auth.Claims{Subject: *subject, Role: models.Role(*role), Tenant: *tenant, IssuedAt: now.Unix(), ExpiresAt: now.Add(*ttl).Unix()}
+	token, err := auth.SignJWT([]byte(secret), claims)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintln(stdout, token)
+	return 0
+}
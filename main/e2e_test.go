@@ -2,17 +2,34 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	prreviewer "github.com/Dowtai/pr-reviewer-service"
+	"github.com/Dowtai/pr-reviewer-service/client"
+	"github.com/Dowtai/pr-reviewer-service/internal/auth"
+	"github.com/Dowtai/pr-reviewer-service/internal/clock"
+	"github.com/Dowtai/pr-reviewer-service/internal/ingest"
 	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/openapi"
+	"github.com/Dowtai/pr-reviewer-service/internal/repo"
+	"github.com/Dowtai/pr-reviewer-service/internal/repo/memory_repo"
+	"github.com/Dowtai/pr-reviewer-service/internal/service"
+	"github.com/Dowtai/pr-reviewer-service/internal/webhook"
 )
 
-func doRequest(t *testing.T, method, url string, body interface{}) *http.Response {
+func doRequestWithHeaders(t *testing.T, method, url string, headers map[string]string, body interface{}) *http.Response {
 	var reader io.Reader
 	if body != nil {
 		data, err := json.Marshal(body)
@@ -26,6 +43,9 @@ func doRequest(t *testing.T, method, url string, body interface{}) *http.Respons
 		t.Fatalf("Failed to create request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		t.Fatalf("Request failed: %v", err)
@@ -33,17 +53,8 @@ func doRequest(t *testing.T, method, url string, body interface{}) *http.Respons
 	return resp
 }
 
-func assertJSONEqual[T any](t *testing.T, resp *http.Response, expected T) T {
-	defer resp.Body.Close()
-	var actual T
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		t.Fatalf("Failed to read body: %v", err)
-	}
-	if err := json.Unmarshal(body, &actual); err != nil {
-		t.Fatalf("Failed to unmarshal: %v\nBody: %s", err, string(body))
-	}
-
+func assertEqual[T any](t *testing.T, actual, expected T) T {
+	t.Helper()
 	if !reflect.DeepEqual(actual, expected) {
 		expBytes, _ := json.MarshalIndent(expected, "", "  ")
 		actBytes, _ := json.MarshalIndent(actual, "", "  ")
@@ -52,270 +63,148 @@ func assertJSONEqual[T any](t *testing.T, resp *http.Response, expected T) T {
 	return actual
 }
 
-var baseURL string
-var port string
-
-func init() {
-	port = "8080"
-	baseURL = "http://localhost:" + port
-}
-
-func createTeam(t *testing.T, teamName string, members []models.TeamMember) models.Team {
-	teamReq := map[string]interface{}{
-		"team_name": teamName,
-		"members":   members,
+func assertAPIError(t *testing.T, err error, expectedStatus int, code models.ErrorDetailCode, message string) {
+	t.Helper()
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected status %d, got %v", expectedStatus, err)
 	}
-	expected := models.Team{
-		TeamName: teamName,
-		Members:  members,
+	if apiErr.StatusCode != expectedStatus {
+		t.Fatalf("Expected status %d, got %d", expectedStatus, apiErr.StatusCode)
 	}
-
-	resp := doRequest(t, http.MethodPost, baseURL+"/team/add", teamReq)
-	if resp.StatusCode != 201 {
-		t.Fatalf("Expected 201, got %d", resp.StatusCode)
+	if apiErr.Code != code || apiErr.Message != message {
+		t.Fatalf("Expected error %s %q, got %s %q", code, message, apiErr.Code, apiErr.Message)
 	}
-	assertJSONEqual(t, resp, expected)
-	return expected
 }
 
-func createTeamExpectError(t *testing.T, teamName string, members []models.TeamMember, expectedStatus int, code models.ErrorDetailCode, message string) {
-	teamReq := map[string]interface{}{
-		"team_name": teamName,
-		"members":   members,
-	}
-
-	resp := doRequest(t, http.MethodPost, baseURL+"/team/add", teamReq)
-	if resp.StatusCode != expectedStatus {
-		t.Fatalf("Expected status %d, got %d", expectedStatus, resp.StatusCode)
-	}
-	expectedErr := models.ErrorResponse{
-		Detail: models.ErrorDetail{
-			Code:    code,
-			Message: message,
-		},
+func mustSucceed(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
 	}
-	assertJSONEqual(t, resp, expectedErr)
 }
 
-func getTeam(t *testing.T, teamName string, expected models.Team) models.Team {
-	url := baseURL + "/team/get?team_name=" + teamName
-	resp := doRequest(t, http.MethodGet, url, nil)
-
-	if resp.StatusCode != 200 {
-		t.Fatalf("Expected 200, got %d", resp.StatusCode)
-	}
-
-	return assertJSONEqual(t, resp, expected)
+// testServer is a server of one test with an empty store, on a port of its
+// own, so the tests do not depend on each other and can run in parallel.
+type testServer struct {
+	*Server
+	URL    string
+	client *client.Client
 }
 
-func getTeamExpectError(t *testing.T, teamName string, expectedStatus int, code models.ErrorDetailCode, message string) {
-	url := baseURL + "/team/get?team_name=" + teamName
-	resp := doRequest(t, http.MethodGet, url, nil)
-
-	if resp.StatusCode != expectedStatus {
-		t.Fatalf("Expected status %d, got %d", expectedStatus, resp.StatusCode)
+// newTestServer starts NewServer behind httptest and stops it when the test
+// ends. configure changes the config before the server is built.
+func newTestServer(t *testing.T, configure ...func(*Config)) *testServer {
+	t.Helper()
+	config := Config{
+		// any response that drifts from openapi.yml fails the test with a 500
+		ResponseMode:         openapi.RESPONSES_STRICT,
+		Auth:                 auth.Config{Disabled: true},
+		OverdueCheckInterval: DEFAULT_OVERDUE_CHECK_INTERVAL,
 	}
-
-	expectedErr := models.ErrorResponse{
-		Detail: models.ErrorDetail{
-			Code:    code,
-			Message: message,
-		},
+	for _, f := range configure {
+		f(&config)
 	}
-
-	assertJSONEqual(t, resp, expectedErr)
+	server := NewServer(config)
+	listener := httptest.NewServer(server.Handler)
+	t.Cleanup(func() {
+		listener.Close()
+		ShutdownServer(server)
+	})
+	return &testServer{Server: server, URL: listener.URL, client: client.New(listener.URL)}
 }
 
-func setUserIsActive(t *testing.T, userId string, isActive bool, expected models.User) models.User {
-	req := map[string]interface{}{
-		"user_id":   userId,
-		"is_active": isActive,
-	}
-
-	resp := doRequest(t, http.MethodPost, baseURL+"/users/setIsActive", req)
-	if resp.StatusCode != 200 {
-		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+func createTeam(t *testing.T, c *client.Client, teamName string, members []models.TeamMember) models.Team {
+	expected := models.Team{
+		TeamName: teamName,
+		Members:  members,
 	}
 
-	return assertJSONEqual(t, resp, expected)
+	team, err := c.TeamAdd(context.Background(), expected)
+	mustSucceed(t, err)
+	assertEqual(t, team, expected)
+	return expected
 }
 
-func setUserIsActiveExpectError(t *testing.T, userId string, isActive bool, expectedStatus int, code models.ErrorDetailCode, message string) {
-	req := map[string]interface{}{
-		"user_id":   userId,
-		"is_active": isActive,
-	}
-
-	resp := doRequest(t, http.MethodPost, baseURL+"/users/setIsActive", req)
-	if resp.StatusCode != expectedStatus {
-		t.Fatalf("Expected status %d, got %d", expectedStatus, resp.StatusCode)
-	}
-
-	expectedErr := models.ErrorResponse{
-		Detail: models.ErrorDetail{
-			Code:    code,
-			Message: message,
-		},
-	}
-
-	assertJSONEqual(t, resp, expectedErr)
+func createTeamExpectError(t *testing.T, c *client.Client, teamName string, members []models.TeamMember, expectedStatus int, code models.ErrorDetailCode, message string) {
+	_, err := c.TeamAdd(context.Background(), models.Team{TeamName: teamName, Members: members})
+	assertAPIError(t, err, expectedStatus, code, message)
 }
 
-func createPullRequest(t *testing.T, pullRequestId, pullRequestName, authorId string, expected *models.PullRequest) models.PullRequest {
-	prReq := map[string]interface{}{
-		"pull_request_id":   pullRequestId,
-		"pull_request_name": pullRequestName,
-		"author_id":         authorId,
-	}
-
-	resp := doRequest(t, http.MethodPost, baseURL+"/pullRequest/create", prReq)
-	if resp.StatusCode != 201 {
-		t.Fatalf("Expected 201, got %d", resp.StatusCode)
-	}
-
-	var actual models.PullRequest
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		t.Fatalf("Failed to read body: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if err := json.Unmarshal(body, &actual); err != nil {
-		t.Fatalf("Failed to unmarshal: %v\nBody: %s", err, string(body))
-	}
+func getTeam(t *testing.T, c *client.Client, teamName string, expected models.Team) models.Team {
+	team, err := c.TeamGet(context.Background(), teamName)
+	mustSucceed(t, err)
+	return assertEqual(t, team, expected)
+}
 
-	expected.CreatedAt = actual.CreatedAt
-	if !reflect.DeepEqual(actual, *expected) {
-		expBytes, _ := json.MarshalIndent(expected, "", "  ")
-		actBytes, _ := json.MarshalIndent(actual, "", "  ")
-		t.Fatalf("JSON not equal\nExpected:\n%s\nActual:\n%s", expBytes, actBytes)
-	}
-	return actual
+func getTeamExpectError(t *testing.T, c *client.Client, teamName string, expectedStatus int, code models.ErrorDetailCode, message string) {
+	_, err := c.TeamGet(context.Background(), teamName)
+	assertAPIError(t, err, expectedStatus, code, message)
 }
 
-func createPullRequestExpectError(t *testing.T, pullRequestId, pullRequestName, authorId string, expectedStatus int, code models.ErrorDetailCode, message string) {
-	prReq := map[string]interface{}{
-		"pull_request_id":   pullRequestId,
-		"pull_request_name": pullRequestName,
-		"author_id":         authorId,
-	}
+func setUserIsActive(t *testing.T, c *client.Client, userId string, isActive bool, expected models.User) models.User {
+	user, err := c.UsersSetIsActive(context.Background(), userId, isActive)
+	mustSucceed(t, err)
+	return assertEqual(t, user, expected)
+}
 
-	resp := doRequest(t, http.MethodPost, baseURL+"/pullRequest/create", prReq)
-	if resp.StatusCode != expectedStatus {
-		t.Fatalf("Expected status %d, got %d", expectedStatus, resp.StatusCode)
-	}
-	expectedErr := models.ErrorResponse{
-		Detail: models.ErrorDetail{
-			Code:    code,
-			Message: message,
-		},
-	}
-	assertJSONEqual(t, resp, expectedErr)
+func setUserIsActiveExpectError(t *testing.T, c *client.Client, userId string, isActive bool, expectedStatus int, code models.ErrorDetailCode, message string) {
+	_, err := c.UsersSetIsActive(context.Background(), userId, isActive)
+	assertAPIError(t, err, expectedStatus, code, message)
 }
 
-func mergePullRequest(t *testing.T, pullRequestId string, expected *models.PullRequest) {
-	prReq := map[string]interface{}{
-		"pull_request_id": pullRequestId,
-	}
+func createPullRequest(t *testing.T, c *client.Client, pullRequestId, pullRequestName, authorId string, expected *models.PullRequest) models.PullRequest {
+	actual, err := c.PullRequestCreate(context.Background(), pullRequestId, pullRequestName, authorId, "")
+	mustSucceed(t, err)
 
-	resp := doRequest(t, http.MethodPost, baseURL+"/pullRequest/merge", prReq)
-	if resp.StatusCode != 200 {
-		t.Fatalf("Expected 200, got %d", resp.StatusCode)
-	}
+	expected.CreatedAt, expected.AssignedAt = actual.CreatedAt, actual.AssignedAt
+	return assertEqual(t, actual, *expected)
+}
 
-	var actual models.PullRequest
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		t.Fatalf("Failed to read body: %v", err)
-	}
-	defer resp.Body.Close()
+func createPullRequestExpectError(t *testing.T, c *client.Client, pullRequestId, pullRequestName, authorId string, expectedStatus int, code models.ErrorDetailCode, message string) {
+	_, err := c.PullRequestCreate(context.Background(), pullRequestId, pullRequestName, authorId, "")
+	assertAPIError(t, err, expectedStatus, code, message)
+}
 
-	if err := json.Unmarshal(body, &actual); err != nil {
-		t.Fatalf("Failed to unmarshal: %v\nBody: %s", err, string(body))
-	}
+func mergePullRequest(t *testing.T, c *client.Client, pullRequestId string, expected *models.PullRequest) {
+	actual, err := c.PullRequestMerge(context.Background(), pullRequestId)
+	mustSucceed(t, err)
 
 	if expected.MergedAt == nil {
 		expected.MergedAt = actual.MergedAt
 	}
-	if !reflect.DeepEqual(actual, *expected) {
-		expBytes, _ := json.MarshalIndent(expected, "", "  ")
-		actBytes, _ := json.MarshalIndent(actual, "", "  ")
-		t.Fatalf("JSON not equal\nExpected:\n%s\nActual:\n%s", expBytes, actBytes)
-	}
+	assertEqual(t, actual, *expected)
 }
 
-func mergePullRequestExpectError(t *testing.T, pullRequestId string, expectedStatus int, code models.ErrorDetailCode, message string) {
-	prReq := map[string]interface{}{
-		"pull_request_id": pullRequestId,
-	}
-
-	resp := doRequest(t, http.MethodPost, baseURL+"/pullRequest/merge", prReq)
-	if resp.StatusCode != expectedStatus {
-		t.Fatalf("Expected status %d, got %d", expectedStatus, resp.StatusCode)
-	}
-	expectedErr := models.ErrorResponse{
-		Detail: models.ErrorDetail{
-			Code:    code,
-			Message: message,
-		},
-	}
-	assertJSONEqual(t, resp, expectedErr)
+func mergePullRequestExpectError(t *testing.T, c *client.Client, pullRequestId string, expectedStatus int, code models.ErrorDetailCode, message string) {
+	_, err := c.PullRequestMerge(context.Background(), pullRequestId)
+	assertAPIError(t, err, expectedStatus, code, message)
 }
 
-func reassignPullRequest(t *testing.T, pullRequestId, oldUserId string, expectedPR models.PullRequest, expectedUserId string) {
-	prReq := map[string]interface{}{
-		"pull_request_id": pullRequestId,
-		"old_user_id":     oldUserId,
-	}
+func reassignPullRequest(t *testing.T, c *client.Client, pullRequestId, oldUserId string, expectedPR models.PullRequest, expectedUserId string) models.PullRequest {
+	actual, err := c.PullRequestReassign(context.Background(), pullRequestId, oldUserId, "")
+	mustSucceed(t, err)
 
-	resp := doRequest(t, http.MethodPost, baseURL+"/pullRequest/reassign", prReq)
-	if resp.StatusCode != 200 {
-		t.Fatalf("Expected 200, got %d", resp.StatusCode)
-	}
+	expectedPR.AssignedAt = actual.PR.AssignedAt
+	return assertEqual(t, actual, models.ReassignResponse{PR: expectedPR, ReplacedBy: expectedUserId}).PR
+}
 
-	var actual struct {
-		PR         models.PullRequest `json:"pr"`
-		ReplacedBy string             `json:"replaced_by"`
-	}
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		t.Fatalf("Failed to read body: %v", err)
-	}
-	defer resp.Body.Close()
+func reassignPullRequestExpectError(t *testing.T, c *client.Client, pullRequestId, oldUserId string, expectedStatus int, code models.ErrorDetailCode, message string) {
+	_, err := c.PullRequestReassign(context.Background(), pullRequestId, oldUserId, "")
+	assertAPIError(t, err, expectedStatus, code, message)
+}
 
-	if err := json.Unmarshal(body, &actual); err != nil {
-		t.Fatalf("Failed to unmarshal: %v\nBody: %s", err, string(body))
-	}
+func reassignPullRequestTo(t *testing.T, c *client.Client, pullRequestId, oldUserId, newUserId string, expectedPR models.PullRequest) {
+	actual, err := c.PullRequestReassign(context.Background(), pullRequestId, oldUserId, newUserId)
+	mustSucceed(t, err)
 
-	if !reflect.DeepEqual(actual.PR, expectedPR) {
-		expBytes, _ := json.MarshalIndent(expectedPR, "", "  ")
-		actBytes, _ := json.MarshalIndent(actual, "", "  ")
-		t.Fatalf("JSON not equal\nExpected:\n%s\nActual:\n%s", expBytes, actBytes)
-	}
-	if !reflect.DeepEqual(actual.ReplacedBy, expectedUserId) {
-		expBytes, _ := json.MarshalIndent(expectedPR, "", "  ")
-		actBytes, _ := json.MarshalIndent(actual, "", "  ")
-		t.Fatalf("JSON not equal\nExpected:\n%s\nActual:\n%s", expBytes, actBytes)
-	}
+	expectedPR.CreatedAt, expectedPR.AssignedAt = actual.PR.CreatedAt, actual.PR.AssignedAt
+	assertEqual(t, actual, models.ReassignResponse{PR: expectedPR, ReplacedBy: newUserId})
 }
 
-func reassignPullRequestExpectError(t *testing.T, pullRequestId, oldUserId string, expectedStatus int, code models.ErrorDetailCode, message string) {
-	prReq := map[string]interface{}{
-		"pull_request_id": pullRequestId,
-		"old_user_id":     oldUserId,
-	}
-
-	resp := doRequest(t, http.MethodPost, baseURL+"/pullRequest/reassign", prReq)
-	if resp.StatusCode != expectedStatus {
-		t.Fatalf("Expected status %d, got %d", expectedStatus, resp.StatusCode)
-	}
-	expectedErr := models.ErrorResponse{
-		Detail: models.ErrorDetail{
-			Code:    code,
-			Message: message,
-		},
-	}
-	assertJSONEqual(t, resp, expectedErr)
+func reassignPullRequestToExpectError(t *testing.T, c *client.Client, pullRequestId, oldUserId, newUserId string, expectedStatus int, code models.ErrorDetailCode, message string) {
+	_, err := c.PullRequestReassign(context.Background(), pullRequestId, oldUserId, newUserId)
+	assertAPIError(t, err, expectedStatus, code, message)
 }
 
 func slicesEqualIgnoreOrder(a, b []models.PullRequestShort) bool {
@@ -336,25 +225,11 @@ func slicesEqualIgnoreOrder(a, b []models.PullRequestShort) bool {
 	return true
 }
 
-func getReview(t *testing.T, userId string, expected []models.PullRequestShort) {
-	url := baseURL + "/users/getReview?user_id=" + userId
-	resp := doRequest(t, http.MethodGet, url, nil)
-
-	if resp.StatusCode != 200 {
-		t.Fatalf("Expected 200, got %d", resp.StatusCode)
-	}
-
-	defer resp.Body.Close()
-	var actual []models.PullRequestShort
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		t.Fatalf("Failed to read body: %v", err)
-	}
-
-	if err := json.Unmarshal(body, &actual); err != nil {
-		t.Fatalf("Failed to unmarshal: %v\nBody: %s", err, string(body))
-	}
+func getReview(t *testing.T, c *client.Client, userId string, expected []models.PullRequestShort) {
+	response, err := c.UsersGetReview(context.Background(), userId)
+	mustSucceed(t, err)
 
+	actual := response.PullRequests
 	if !slicesEqualIgnoreOrder(actual, expected) {
 		expBytes, _ := json.MarshalIndent(expected, "", "  ")
 		actBytes, _ := json.MarshalIndent(actual, "", "  ")
@@ -362,28 +237,15 @@ func getReview(t *testing.T, userId string, expected []models.PullRequestShort)
 	}
 }
 
-func getReviewExpectError(t *testing.T, userId string, expectedStatus int, code models.ErrorDetailCode, message string) {
-	url := baseURL + "/users/getReview?user_id=" + userId
-	resp := doRequest(t, http.MethodGet, url, nil)
-
-	if resp.StatusCode != expectedStatus {
-		t.Fatalf("Expected status %d, got %d", expectedStatus, resp.StatusCode)
-	}
-
-	expectedErr := models.ErrorResponse{
-		Detail: models.ErrorDetail{
-			Code:    code,
-			Message: message,
-		},
-	}
-
-	assertJSONEqual(t, resp, expectedErr)
+func getReviewExpectError(t *testing.T, c *client.Client, userId string, expectedStatus int, code models.ErrorDetailCode, message string) {
+	_, err := c.UsersGetReview(context.Background(), userId)
+	assertAPIError(t, err, expectedStatus, code, message)
 }
 
 func TestTeam(t *testing.T) {
-	server := NewServer(port)
-	go func() { _ = server.ListenAndServe() }()
-	defer ShutdownServer(server)
+	t.Parallel()
+	server := newTestServer(t)
+	c := server.client
 	var team1, team2 models.Team
 
 	t.Run("AddUniqueTeams", func(t *testing.T) {
@@ -395,8 +257,8 @@ func TestTeam(t *testing.T) {
 			{UserId: "u3", Username: "Alice", IsActive: true},
 			{UserId: "u4", Username: "Bob", IsActive: true},
 		}
-		team1 = createTeam(t, "backend", members)
-		team2 = createTeam(t, "backend2", members2)
+		team1 = createTeam(t, c, "backend", members)
+		team2 = createTeam(t, c, "backend2", members2)
 	})
 
 	t.Run("AddDuplicate", func(t *testing.T) {
@@ -404,25 +266,136 @@ func TestTeam(t *testing.T) {
 			{UserId: "u3", Username: "Alice", IsActive: true},
 			{UserId: "u4", Username: "Bob", IsActive: true},
 		}
-		createTeamExpectError(t, "backend", members, 400, models.TEAM_EXISTS, "team_name already exists")
-		createTeamExpectError(t, "backend3", members, 500, models.FATAL_ERROR, "user already exists")
+		createTeamExpectError(t, c, "backend", members, 400, models.TEAM_EXISTS, "team_name already exists")
+	})
+
+	t.Run("JoinSecondTeam", func(t *testing.T) {
+		members := []models.TeamMember{
+			{UserId: "u3", Username: "Alice", IsActive: true},
+			{UserId: "u4", Username: "Bob", IsActive: true},
+		}
+		createTeam(t, c, "backend3", members)
+		getTeam(t, c, "backend2", team2)
+	})
+
+	t.Run("AddInvalid", func(t *testing.T) {
+		_, err := c.TeamAdd(context.Background(), models.Team{TeamName: "backend4", Members: []models.TeamMember{
+			{UserId: "u9", Username: "Alice", IsActive: true},
+			{UserId: "u 10", Username: strings.Repeat("x", 257), IsActive: true},
+			{UserId: "u9", Username: "Bob", IsActive: true},
+		}})
+		var apiErr *client.Error
+		if !errors.Is(err, client.ErrValidation) || !errors.As(err, &apiErr) || apiErr.StatusCode != 400 {
+			t.Fatalf("Expected a 400 validation error, got %v", err)
+		}
+		assertEqual(t, apiErr.Details, []models.FieldError{
+			{Field: "members[1].user_id", Message: "must contain only letters, digits and ._-:/#!@"},
+			{Field: "members[1].username", Message: "must be at most 256 characters"},
+			{Field: "members[2].user_id", Message: "duplicates members[0].user_id"},
+		})
+		getTeamExpectError(t, c, "backend4", 404, models.NOT_FOUND, "team_name not found")
 	})
 
 	t.Run("GetExistingTeam", func(t *testing.T) {
-		getTeam(t, "backend", team1)
-		getTeam(t, "backend2", team2)
+		getTeam(t, c, "backend", team1)
+		getTeam(t, c, "backend2", team2)
+	})
+
+	t.Run("Subtree", func(t *testing.T) {
+		ctx := context.Background()
+		squad := models.Team{TeamName: "backend-api", ParentTeam: "backend", Members: []models.TeamMember{
+			{UserId: "u6", Username: "Carol", IsActive: true},
+			{UserId: "u1", Username: "Alice", IsActive: true},
+		}}
+		created, err := c.TeamAdd(ctx, squad)
+		mustSucceed(t, err)
+		assertEqual(t, created, squad)
+
+		tree, err := c.TeamGetSubtree(ctx, "backend")
+		mustSucceed(t, err)
+		assertEqual(t, tree, models.TeamTree{
+			Team:       team1,
+			Subteams:   []models.TeamTree{{Team: squad, Subteams: []models.TeamTree{}, AllMembers: squad.Members}},
+			AllMembers: append(slices.Clone(team1.Members), squad.Members[0]),
+		})
+
+		_, err = c.TeamAdd(ctx, models.Team{TeamName: "backend-web", ParentTeam: "frontend", Members: []models.TeamMember{}})
+		assertAPIError(t, err, 404, models.NOT_FOUND, "parent team not found")
+	})
+
+	t.Run("Policy", func(t *testing.T) {
+		ctx := context.Background()
+		team, err := c.TeamSetMemberRole(ctx, "backend", "u2", models.TEAM_SENIOR)
+		mustSucceed(t, err)
+		expected := models.Team{TeamName: "backend", Members: slices.Clone(team1.Members)}
+		expected.Members[1].Role = models.TEAM_SENIOR
+		assertEqual(t, team, expected)
+
+		policy := &models.TeamPolicy{RequireSenior: true, NoJuniorOnly: true}
+		team, err = c.TeamSetPolicy(ctx, "backend", policy)
+		mustSucceed(t, err)
+		expected.Policy = policy
+		assertEqual(t, team, expected)
+		getTeam(t, c, "backend", expected)
+
+		pr, err := c.PullRequestCreate(ctx, "r1", "req1", "u1", "")
+		mustSucceed(t, err)
+		assertEqual(t, pr.Policy, &models.PolicyResult{Satisfied: true, Violations: []string{}})
+
+		_, err = c.TeamSetMemberRole(ctx, "backend", "u2", "BOSS")
+		assertAPIError(t, err, 400, models.VALIDATION_ERROR, "invalid fields: role")
+		_, err = c.TeamSetMemberRole(ctx, "backend", "u3", models.TEAM_JUNIOR)
+		assertAPIError(t, err, 404, models.NOT_FOUND, "team_name or user_id not found")
+	})
+
+	t.Run("ReviewSLA", func(t *testing.T) {
+		ctx := context.Background()
+		team, err := c.TeamSetSLA(ctx, "backend", "1ns")
+		mustSucceed(t, err)
+		if team.ReviewSLA != "1ns" {
+			t.Fatalf("Expected the SLA to be set, got %+v", team)
+		}
+		_, err = c.TeamSetSLA(ctx, "backend", "soon")
+		var apiErr *client.Error
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != 400 {
+			t.Fatalf("Expected a 400 validation error, got %v", err)
+		}
+		assertEqual(t, apiErr.Details, []models.FieldError{{Field: "review_sla", Message: "must be a positive duration like 24h or 90m"}})
+		_, err = c.TeamSetSLA(ctx, "backend5", "1h")
+		assertAPIError(t, err, 404, models.NOT_FOUND, "team_name not found")
+
+		history, err := c.PullRequestHistory(ctx, "r1")
+		mustSucceed(t, err)
+		overdue, err := c.PullRequestOverdue(ctx, "", "backend")
+		mustSucceed(t, err)
+		if len(overdue) != len(history.PR.AssignedReviewers) || overdue[0].PullRequestId != "r1" {
+			t.Fatalf("Expected the reviews of r1 to be overdue, got %+v", overdue)
+		}
+		reviews, err := c.UsersGetReview(ctx, overdue[0].ReviewerId)
+		mustSucceed(t, err)
+		if len(reviews.PullRequests) != 1 || !reviews.PullRequests[0].Overdue || reviews.OverdueCount != 1 {
+			t.Fatalf("Expected r1 to be overdue, got %+v", reviews)
+		}
+
+		_, err = c.TeamSetSLA(ctx, "backend", "")
+		mustSucceed(t, err)
+		overdue, err = c.PullRequestOverdue(ctx, "", "")
+		mustSucceed(t, err)
+		if len(overdue) != 0 {
+			t.Fatalf("Expected nothing overdue without an SLA, got %+v", overdue)
+		}
 	})
 
 	t.Run("GetNonExistingTeam", func(t *testing.T) {
-		getTeamExpectError(t, "backend3", 404, models.NOT_FOUND, "team_name not found")
+		getTeamExpectError(t, c, "backend5", 404, models.NOT_FOUND, "team_name not found")
 	})
 
 }
 
 func TestUsers(t *testing.T) {
-	server := NewServer(port)
-	go func() { _ = server.ListenAndServe() }()
-	defer ShutdownServer(server)
+	t.Parallel()
+	server := newTestServer(t)
+	c := server.client
 	var team1 models.Team
 
 	t.Run("SetIsActive", func(t *testing.T) {
@@ -434,33 +407,59 @@ func TestUsers(t *testing.T) {
 			{UserId: "u3", Username: "Alice", IsActive: true},
 			{UserId: "u4", Username: "Bob", IsActive: true},
 		}
-		team1 = createTeam(t, "backend", members)
-		createTeam(t, "backend2", members2)
+		team1 = createTeam(t, c, "backend", members)
+		createTeam(t, c, "backend2", members2)
 
 		expectedUser1 := models.User{
 			UserId:   "u1",
 			Username: "Alice",
 			TeamName: "backend",
+			Teams:    []string{"backend"},
 			IsActive: true,
 		}
 
-		setUserIsActive(t, "u1", true, expectedUser1)
-		getTeam(t, "backend", team1)
+		setUserIsActive(t, c, "u1", true, expectedUser1)
+		getTeam(t, c, "backend", team1)
 		expectedUser1.IsActive = false
-		setUserIsActive(t, "u1", false, expectedUser1)
+		setUserIsActive(t, c, "u1", false, expectedUser1)
 		team1.Members[0].IsActive = false
-		getTeam(t, "backend", team1)
+		getTeam(t, c, "backend", team1)
 	})
 
 	t.Run("SetIsActiveNonExisting", func(t *testing.T) {
-		setUserIsActiveExpectError(t, "u5", true, 404, models.NOT_FOUND, "user_id not found")
+		setUserIsActiveExpectError(t, c, "u5", true, 404, models.NOT_FOUND, "user_id not found")
+	})
+
+	t.Run("SetPrimaryTeam", func(t *testing.T) {
+		ctx := context.Background()
+		createTeam(t, c, "frontend", []models.TeamMember{{UserId: "u2", Username: "Bob", IsActive: true}})
+
+		user, err := c.UsersSetPrimaryTeam(ctx, "u2", "frontend")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, user, models.User{UserId: "u2", Username: "Bob", TeamName: "frontend", Teams: []string{"backend", "frontend"}, IsActive: true})
+
+		pr, err := c.PullRequestCreate(ctx, "r1", "req1", "u2", "backend")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pr.TeamName != "backend" {
+			t.Fatalf("Expected reviewers from backend, got %+v", pr)
+		}
+		if _, err = c.UsersSetPrimaryTeam(ctx, "u1", "frontend"); !errors.Is(err, client.ErrWrongTeam) {
+			t.Fatalf("Expected WRONG_TEAM, got %v", err)
+		}
+		if _, err = c.PullRequestCreate(ctx, "r2", "req2", "u1", "frontend"); !errors.Is(err, client.ErrWrongTeam) {
+			t.Fatalf("Expected WRONG_TEAM, got %v", err)
+		}
 	})
 }
 
 func TestPullRequest(t *testing.T) {
-	server := NewServer(port)
-	go func() { _ = server.ListenAndServe() }()
-	defer ShutdownServer(server)
+	t.Parallel()
+	server := newTestServer(t)
+	c := server.client
 	var pr, pr1, pr2 models.PullRequest
 
 	t.Run("Create", func(t *testing.T) {
@@ -472,8 +471,8 @@ func TestPullRequest(t *testing.T) {
 			{UserId: "u3", Username: "Alice", IsActive: true},
 			{UserId: "u4", Username: "Bob", IsActive: true},
 		}
-		createTeam(t, "backend", members)
-		createTeam(t, "backend2", members2)
+		createTeam(t, c, "backend", members)
+		createTeam(t, c, "backend2", members2)
 
 		expectedPR := models.PullRequest{
 			PullRequestId:     "r1",
@@ -481,16 +480,18 @@ func TestPullRequest(t *testing.T) {
 			AuthorId:          "u1",
 			Status:            models.OPEN,
 			AssignedReviewers: []string{"u2"},
+			TeamName:          "backend",
 		}
-		pr1 = createPullRequest(t, "r1", "req1", "u1", &expectedPR)
+		pr1 = createPullRequest(t, c, "r1", "req1", "u1", &expectedPR)
 
 		expectedUser3 := models.User{
 			UserId:   "u3",
 			Username: "Alice",
 			TeamName: "backend2",
+			Teams:    []string{"backend2"},
 			IsActive: false,
 		}
-		setUserIsActive(t, "u3", false, expectedUser3)
+		setUserIsActive(t, c, "u3", false, expectedUser3)
 
 		expectedPR2 := models.PullRequest{
 			PullRequestId:     "r2",
@@ -498,26 +499,27 @@ func TestPullRequest(t *testing.T) {
 			AuthorId:          "u4",
 			Status:            models.OPEN,
 			AssignedReviewers: []string{},
+			TeamName:          "backend2",
 		}
-		pr2 = createPullRequest(t, "r2", "req2", "u4", &expectedPR2)
+		pr2 = createPullRequest(t, c, "r2", "req2", "u4", &expectedPR2)
 	})
 
 	t.Run("CreateNotFound", func(t *testing.T) {
-		createPullRequestExpectError(t, "r3", "req3", "u5", 404, models.NOT_FOUND, "author or team not found")
+		createPullRequestExpectError(t, c, "r3", "req3", "u5", 404, models.NOT_FOUND, "author or team not found")
 	})
 
 	t.Run("CreateExistingPullRequest", func(t *testing.T) {
 		_ = pr2
-		createPullRequestExpectError(t, "r1", "req1", "u1", 409, models.PR_EXISTS, "pull_request already exists")
-		createPullRequestExpectError(t, "r1", "req3", "u4", 409, models.PR_EXISTS, "pull_request already exists")
+		createPullRequestExpectError(t, c, "r1", "req1", "u1", 409, models.PR_EXISTS, "pull_request already exists")
+		createPullRequestExpectError(t, c, "r1", "req3", "u4", 409, models.PR_EXISTS, "pull_request already exists")
 	})
 
 	t.Run("MergeIdempotency", func(t *testing.T) {
 		pr1.Status = models.MERGED
-		mergePullRequest(t, "r1", &pr1)
+		mergePullRequest(t, c, "r1", &pr1)
 		timestamp := pr1.MergedAt
 		for i := 0; i < 200; i++ {
-			mergePullRequest(t, "r1", &pr1)
+			mergePullRequest(t, c, "r1", &pr1)
 			if pr1.MergedAt != timestamp {
 				t.Fatal("Something went wrong with tests")
 			}
@@ -525,7 +527,7 @@ func TestPullRequest(t *testing.T) {
 	})
 
 	t.Run("MergeNonExisting", func(t *testing.T) {
-		mergePullRequestExpectError(t, "r3", 404, models.NOT_FOUND, "pull_request not found")
+		mergePullRequestExpectError(t, c, "r3", 404, models.NOT_FOUND, "pull_request not found")
 	})
 
 	t.Run("Reassign", func(t *testing.T) {
@@ -541,7 +543,7 @@ func TestPullRequest(t *testing.T) {
 			{UserId: "u13", Username: "user9", IsActive: true},
 			{UserId: "u14", Username: "user10", IsActive: true},
 		}
-		createTeam(t, "backend3", members)
+		createTeam(t, c, "backend3", members)
 
 		expectedPR := models.PullRequest{
 			PullRequestId:     "r3",
@@ -549,8 +551,9 @@ func TestPullRequest(t *testing.T) {
 			AuthorId:          "u5",
 			Status:            models.OPEN,
 			AssignedReviewers: []string{"u6", "u7"},
+			TeamName:          "backend3",
 		}
-		pr = createPullRequest(t, "r3", "req3", "u5", &expectedPR)
+		pr = createPullRequest(t, c, "r3", "req3", "u5", &expectedPR)
 
 		for i := 0; i < 2; i++ {
 			for j := 0; j < 10; j++ {
@@ -562,24 +565,24 @@ func TestPullRequest(t *testing.T) {
 						break
 					}
 				}
-				reassignPullRequest(t, "r3", old, pr, pr.AssignedReviewers[i])
+				reassignPullRequest(t, c, "r3", old, pr, pr.AssignedReviewers[i])
 			}
 		}
 	})
 
 	t.Run("ReassignNonExisting", func(t *testing.T) {
-		reassignPullRequestExpectError(t, "r4", "u1", 404, models.NOT_FOUND, "pull_request or user not found")
+		reassignPullRequestExpectError(t, c, "r4", "u1", 404, models.NOT_FOUND, "pull_request or user not found")
 	})
 
 	t.Run("ReassignMerged", func(t *testing.T) {
-		reassignPullRequestExpectError(t, "r1", "u2", 409, models.PR_MERGED, "cannot reassign on merged PR")
+		reassignPullRequestExpectError(t, c, "r1", "u2", 409, models.PR_MERGED, "cannot reassign on merged PR")
 	})
 
 	t.Run("ReassignNotAssigned", func(t *testing.T) {
 		for k := 6; k <= 14; k++ {
 			newId := fmt.Sprintf("u%d", k)
 			if pr.AssignedReviewers[0] != newId && pr.AssignedReviewers[1] != newId {
-				reassignPullRequestExpectError(t, "r3", newId, 409, models.NOT_ASSIGNED, "reviewer is not assigned to this PR")
+				reassignPullRequestExpectError(t, c, "r3", newId, 409, models.NOT_ASSIGNED, "reviewer is not assigned to this PR")
 				break
 			}
 		}
@@ -594,14 +597,15 @@ func TestPullRequest(t *testing.T) {
 				UserId:   id,
 				Username: name,
 				TeamName: "backend3",
+				Teams:    []string{"backend3"},
 				IsActive: false,
 			}
-			setUserIsActive(t, id, false, expectedUser)
+			setUserIsActive(t, c, id, false, expectedUser)
 			if id == pr.AssignedReviewers[0] || id == pr.AssignedReviewers[1] {
 				reviewer = id
 			}
 		}
-		reassignPullRequestExpectError(t, "r3", reviewer, 409, models.NO_CANDIDATE, "no active replacement candidate in team")
+		reassignPullRequestExpectError(t, c, "r3", reviewer, 409, models.NO_CANDIDATE, "no active replacement candidate in team")
 	})
 
 	t.Run("GetReview", func(t *testing.T) {
@@ -612,9 +616,10 @@ func TestPullRequest(t *testing.T) {
 				UserId:   id,
 				Username: name,
 				TeamName: "backend3",
+				Teams:    []string{"backend3"},
 				IsActive: true,
 			}
-			setUserIsActive(t, id, true, expectedUser)
+			setUserIsActive(t, c, id, true, expectedUser)
 		}
 		expectedPR := models.PullRequest{
 			PullRequestId:     "r4",
@@ -622,18 +627,1235 @@ func TestPullRequest(t *testing.T) {
 			AuthorId:          "u7",
 			Status:            models.OPEN,
 			AssignedReviewers: []string{"u5", "u6"},
+			TeamName:          "backend3",
 		}
-		createPullRequest(t, "r4", "req4", "u7", &expectedPR)
+		createPullRequest(t, c, "r4", "req4", "u7", &expectedPR)
 		fmt.Println(pr, pr1, pr2, expectedPR)
 
-		getReview(t, "u1", []models.PullRequestShort{})
-		getReview(t, "u2", []models.PullRequestShort{models.NewPRShort(&pr1)})
-		getReview(t, "u5", []models.PullRequestShort{models.NewPRShort(&expectedPR)})
-		getReview(t, "u6", []models.PullRequestShort{models.NewPRShort(&pr), models.NewPRShort(&expectedPR)})
-		getReview(t, "u7", []models.PullRequestShort{models.NewPRShort(&pr)})
+		getReview(t, c, "u1", []models.PullRequestShort{})
+		getReview(t, c, "u2", []models.PullRequestShort{models.NewPRShort(&pr1)})
+		getReview(t, c, "u5", []models.PullRequestShort{models.NewPRShort(&expectedPR)})
+		getReview(t, c, "u6", []models.PullRequestShort{models.NewPRShort(&pr), models.NewPRShort(&expectedPR)})
+		getReview(t, c, "u7", []models.PullRequestShort{models.NewPRShort(&pr)})
 	})
 
 	t.Run("GetReviewNotFound", func(t *testing.T) {
-		getReviewExpectError(t, "u23", 404, models.NOT_FOUND, "user not found")
+		getReviewExpectError(t, c, "u23", 404, models.NOT_FOUND, "user not found")
+	})
+}
+
+func TestReassignExplicit(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+	c := server.client
+
+	createTeam(t, c, "backend", []models.TeamMember{
+		{UserId: "u1", Username: "Alice", IsActive: true},
+		{UserId: "u2", Username: "Bob", IsActive: true},
+		{UserId: "u3", Username: "Carol", IsActive: true},
+		{UserId: "u4", Username: "Dave", IsActive: true},
+		{UserId: "u5", Username: "Eve", IsActive: false},
+	})
+	createTeam(t, c, "frontend", []models.TeamMember{
+		{UserId: "u6", Username: "Frank", IsActive: true},
+	})
+
+	pr := models.PullRequest{
+		PullRequestId:     "r1",
+		PullRequestName:   "req1",
+		AuthorId:          "u1",
+		Status:            models.OPEN,
+		AssignedReviewers: []string{"u2", "u3"},
+		TeamName:          "backend",
+	}
+	pr = createPullRequest(t, c, "r1", "req1", "u1", &pr)
+
+	t.Run("Chosen", func(t *testing.T) {
+		pr.AssignedReviewers = []string{"u4", "u3"}
+		reassignPullRequestTo(t, c, "r1", "u2", "u4", pr)
+		getReview(t, c, "u2", []models.PullRequestShort{})
+		getReview(t, c, "u4", []models.PullRequestShort{models.NewPRShort(&pr)})
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		reassignPullRequestToExpectError(t, c, "r1", "u4", "u7", 404, models.NOT_FOUND, "pull_request or user not found")
+		reassignPullRequestToExpectError(t, c, "r1", "u4", "u1", 409, models.CANDIDATE_IS_AUTHOR, "author cannot review own PR")
+		reassignPullRequestToExpectError(t, c, "r1", "u4", "u3", 409, models.ALREADY_ASSIGNED, "new reviewer is already assigned to this PR")
+		reassignPullRequestToExpectError(t, c, "r1", "u4", "u5", 409, models.CANDIDATE_INACTIVE, "new reviewer is not active")
+		reassignPullRequestToExpectError(t, c, "r1", "u4", "u6", 409, models.WRONG_TEAM, "new reviewer is not in reviewer's or author's team")
+	})
+}
+
+func getAudit(t *testing.T, c *client.Client, filter models.AuditFilter) []models.AuditEvent {
+	events, err := c.Audit(context.Background(), filter)
+	mustSucceed(t, err)
+	return events
+}
+
+func TestAudit(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+	c := server.client
+
+	bot := client.New(server.URL, client.WithHeader("X-Actor", "ci-bot"), client.WithHeader("X-Request-Id", "req-1"))
+	_, err := bot.TeamAdd(context.Background(), models.Team{
+		TeamName: "backend",
+		Members: []models.TeamMember{
+			{UserId: "u1", Username: "Alice", IsActive: true},
+			{UserId: "u2", Username: "Bob", IsActive: true},
+		},
+	})
+	mustSucceed(t, err)
+
+	// the request id is echoed back, which the client does not expose
+	resp := doRequestWithHeaders(t, http.MethodGet, server.URL+"/team/get?team_name=backend", map[string]string{"X-Request-Id": "req-2"}, nil)
+	if resp.StatusCode != 200 || resp.Header.Get("X-Request-Id") != "req-2" {
+		t.Fatalf("Expected 200 with request id, got %d %q", resp.StatusCode, resp.Header.Get("X-Request-Id"))
+	}
+	resp.Body.Close()
+
+	start := time.Now().UTC().Add(-time.Second)
+	pr := models.PullRequest{
+		PullRequestId:     "r1",
+		PullRequestName:   "req1",
+		AuthorId:          "u1",
+		Status:            models.OPEN,
+		AssignedReviewers: []string{"u2"},
+		TeamName:          "backend",
+	}
+	createPullRequest(t, c, "r1", "req1", "u1", &pr)
+	pr.Status = models.MERGED
+	mergePullRequest(t, c, "r1", &pr)
+	mergePullRequest(t, c, "r1", &pr)
+	createPullRequestExpectError(t, c, "r1", "req1", "u1", 409, models.PR_EXISTS, "pull_request already exists")
+
+	t.Run("All", func(t *testing.T) {
+		events := getAudit(t, c, models.AuditFilter{})
+		if len(events) != 3 {
+			t.Fatalf("Expected 3 events, got %d", len(events))
+		}
+		if events[0].Action != models.TEAM_ADD || events[0].Actor != "ci-bot" || events[0].RequestId != "req-1" || events[0].Before != nil {
+			t.Fatalf("Unexpected team event: %+v", events[0])
+		}
+	})
+
+	t.Run("ByEntity", func(t *testing.T) {
+		events := getAudit(t, c, models.AuditFilter{EntityType: models.PR_ENTITY, EntityId: "r1"})
+		if len(events) != 2 || events[0].Action != models.PR_CREATE || events[1].Action != models.PR_MERGE {
+			t.Fatalf("Unexpected pull_request events: %+v", events)
+		}
+
+		var before, after models.PullRequest
+		if err := json.Unmarshal(events[1].Before, &before); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(events[1].After, &after); err != nil {
+			t.Fatal(err)
+		}
+		if before.Status != models.OPEN || after.Status != models.MERGED {
+			t.Fatalf("Unexpected merge snapshots: %s -> %s", before.Status, after.Status)
+		}
+	})
+
+	t.Run("ByActorAndTime", func(t *testing.T) {
+		if events := getAudit(t, c, models.AuditFilter{Actor: "ci-bot"}); len(events) != 1 {
+			t.Fatalf("Expected 1 event, got %d", len(events))
+		}
+		if events := getAudit(t, c, models.AuditFilter{Actor: "anonymous", From: &start}); len(events) != 2 {
+			t.Fatalf("Expected 2 events, got %d", len(events))
+		}
+		longAgo := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		if events := getAudit(t, c, models.AuditFilter{To: &longAgo}); len(events) != 0 {
+			t.Fatalf("Expected 0 events, got %d", len(events))
+		}
+	})
+}
+
+func getHistory(t *testing.T, c *client.Client, pullRequestId string) models.PullRequestHistory {
+	history, err := c.PullRequestHistory(context.Background(), pullRequestId)
+	mustSucceed(t, err)
+	return history
+}
+
+func TestPullRequestHistory(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+	c := server.client
+
+	createTeam(t, c, "backend", []models.TeamMember{
+		{UserId: "u1", Username: "Alice", IsActive: true},
+		{UserId: "u2", Username: "Bob", IsActive: true},
+		{UserId: "u3", Username: "Carol", IsActive: true},
+		{UserId: "u4", Username: "Dave", IsActive: true},
+	})
+	pr1 := models.PullRequest{
+		PullRequestId:     "r1",
+		PullRequestName:   "req1",
+		AuthorId:          "u1",
+		Status:            models.OPEN,
+		AssignedReviewers: []string{"u2", "u3"},
+		TeamName:          "backend",
+	}
+	pr1 = createPullRequest(t, c, "r1", "req1", "u1", &pr1)
+	pr1.AssignedReviewers = []string{"u4", "u3"}
+	pr1 = reassignPullRequest(t, c, "r1", "u2", pr1, "u4")
+	pr1.Status = models.MERGED
+	mergePullRequest(t, c, "r1", &pr1)
+
+	pr2 := models.PullRequest{
+		PullRequestId:     "r2",
+		PullRequestName:   "req2",
+		AuthorId:          "u3",
+		Status:            models.OPEN,
+		AssignedReviewers: []string{"u1", "u2"},
+		TeamName:          "backend",
+	}
+	pr2 = createPullRequest(t, c, "r2", "req2", "u3", &pr2)
+
+	t.Run("Events", func(t *testing.T) {
+		history := getHistory(t, c, "r1")
+		expected := []models.PullRequestEventType{
+			models.EVENT_PR_CREATED,
+			models.EVENT_REVIEWER_ASSIGNED,
+			models.EVENT_REVIEWER_ASSIGNED,
+			models.EVENT_REVIEWER_REPLACED,
+			models.EVENT_PR_MERGED,
+		}
+		if len(history.Events) != len(expected) {
+			t.Fatalf("Expected %d events, got %d", len(expected), len(history.Events))
+		}
+		for i, event := range history.Events {
+			if event.Type != expected[i] {
+				t.Fatalf("Event %d: expected %s, got %s", i, expected[i], event.Type)
+			}
+		}
+		if replaced := history.Events[3]; replaced.OldReviewerId != "u2" || replaced.ReviewerId != "u4" {
+			t.Fatalf("Unexpected replace event: %+v", replaced)
+		}
+	})
+
+	t.Run("Rebuilt", func(t *testing.T) {
+		history := getHistory(t, c, "r1")
+		if !history.PR.CreatedAt.Equal(*pr1.CreatedAt) || !history.PR.MergedAt.Equal(*pr1.MergedAt) {
+			t.Fatalf("Timestamps differ: %+v vs %+v", history.PR, pr1)
+		}
+		history.PR.CreatedAt, history.PR.MergedAt = pr1.CreatedAt, pr1.MergedAt
+		if !reflect.DeepEqual(history.PR, pr1) {
+			t.Fatalf("Rebuilt PR differs: %+v vs %+v", history.PR, pr1)
+		}
+	})
+
+	t.Run("ReviewIndex", func(t *testing.T) {
+		events := append(getHistory(t, c, "r1").Events, getHistory(t, c, "r2").Events...)
+		index := service.ReplayReviewIndex(events)
+		for _, userId := range []string{"u1", "u2", "u3", "u4"} {
+			expected := make([]models.PullRequestShort, 0)
+			for _, pr := range []*models.PullRequest{&pr1, &pr2} {
+				if _, ok := index[userId][pr.PullRequestId]; ok {
+					expected = append(expected, models.NewPRShort(pr))
+				}
+			}
+			getReview(t, c, userId, expected)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		_, err := c.PullRequestHistory(context.Background(), "r3")
+		assertAPIError(t, err, 404, models.NOT_FOUND, "pull_request not found")
+	})
+}
+
+type webhookReceiver struct {
+	mx       sync.Mutex
+	failures int
+	payloads []models.WebhookPayload
+	server   *httptest.Server
+}
+
+// newWebhookReceiver answers 500 to the first failures requests and
+// records every correctly signed payload after that.
+func newWebhookReceiver(t *testing.T, secret string, failures int) *webhookReceiver {
+	receiver := &webhookReceiver{failures: failures}
+	receiver.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(webhook.SIGNATURE_HEADER) != webhook.Sign(secret, body) {
+			t.Errorf("Bad signature for %s", body)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		receiver.mx.Lock()
+		defer receiver.mx.Unlock()
+		if receiver.failures > 0 {
+			receiver.failures--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var payload models.WebhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("Failed to unmarshal: %v", err)
+		}
+		receiver.payloads = append(receiver.payloads, payload)
+	}))
+	return receiver
+}
+
+func (r *webhookReceiver) waitFor(t *testing.T, n int) []models.WebhookPayload {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mx.Lock()
+		if len(r.payloads) >= n {
+			payloads := append([]models.WebhookPayload{}, r.payloads...)
+			r.mx.Unlock()
+			return payloads
+		}
+		r.mx.Unlock()
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d payloads in time", n)
+	return nil
+}
+
+func subscribeWebhook(t *testing.T, c *client.Client, url, secret string, eventTypes []models.PullRequestEventType) models.WebhookSubscription {
+	subscription, err := c.WebhookSubscribe(context.Background(), models.WebhookSubscription{
+		Url:        url,
+		Secret:     secret,
+		EventTypes: eventTypes,
+	})
+	mustSucceed(t, err)
+	if subscription.Id == "" || subscription.Secret != "" {
+		t.Fatalf("Unexpected subscription: %+v", subscription)
+	}
+	return subscription
+}
+
+func TestWebhooks(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+	c := server.client
+
+	createTeam(t, c, "backend", []models.TeamMember{
+		{UserId: "u1", Username: "Alice", IsActive: true},
+		{UserId: "u2", Username: "Bob", IsActive: true},
+		{UserId: "u3", Username: "Carol", IsActive: true},
+	})
+
+	all := newWebhookReceiver(t, "s1", 0)
+	defer all.server.Close()
+	merges := newWebhookReceiver(t, "s2", 1)
+	defer merges.server.Close()
+
+	subscribeWebhook(t, c, all.server.URL, "s1", nil)
+	mergeSubscription := subscribeWebhook(t, c, merges.server.URL, "s2", []models.PullRequestEventType{models.EVENT_PR_MERGED})
+
+	pr := models.PullRequest{
+		PullRequestId:     "r1",
+		PullRequestName:   "req1",
+		AuthorId:          "u1",
+		Status:            models.OPEN,
+		AssignedReviewers: []string{"u2", "u3"},
+		TeamName:          "backend",
+	}
+	createPullRequest(t, c, "r1", "req1", "u1", &pr)
+	pr.Status = models.MERGED
+	mergePullRequest(t, c, "r1", &pr)
+
+	t.Run("AllEvents", func(t *testing.T) {
+		payloads := all.waitFor(t, 4)
+		count := make(map[models.PullRequestEventType]int)
+		for _, payload := range payloads {
+			count[payload.EventType]++
+			if payload.PR.PullRequestId != "r1" || payload.Event.Seq == 0 {
+				t.Fatalf("Unexpected payload: %+v", payload)
+			}
+		}
+		if count[models.EVENT_PR_CREATED] != 1 || count[models.EVENT_REVIEWER_ASSIGNED] != 2 || count[models.EVENT_PR_MERGED] != 1 {
+			t.Fatalf("Unexpected events: %v", count)
+		}
+	})
+
+	t.Run("RetriedMerge", func(t *testing.T) {
+		payloads := merges.waitFor(t, 1)
+		if len(payloads) != 1 || payloads[0].PR.Status != models.MERGED {
+			t.Fatalf("Unexpected payloads: %+v", payloads)
+		}
+
+		deliveries, err := c.WebhookDeliveries(context.Background(), mergeSubscription.Id)
+		mustSucceed(t, err)
+		if len(deliveries) != 2 || deliveries[0].Delivered || deliveries[0].StatusCode != 500 || !deliveries[1].Delivered || deliveries[1].Attempt != 2 {
+			t.Fatalf("Unexpected delivery log: %+v", deliveries)
+		}
+	})
+
+	t.Run("Unsubscribe", func(t *testing.T) {
+		mustSucceed(t, c.WebhookUnsubscribe(context.Background(), mergeSubscription.Id))
+		err := c.WebhookUnsubscribe(context.Background(), mergeSubscription.Id)
+		assertAPIError(t, err, 404, models.NOT_FOUND, "subscription not found")
+
+		events, err := c.Audit(context.Background(), models.AuditFilter{EntityType: models.WEBHOOK_ENTITY, EntityId: mergeSubscription.Id})
+		mustSucceed(t, err)
+		if len(events) != 2 || events[0].Action != models.WEBHOOK_SUBSCRIBE || events[1].Action != models.WEBHOOK_UNSUBSCRIBE {
+			t.Fatalf("Expected the subscription and its removal in the audit log, got %+v", events)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := c.WebhookSubscribe(context.Background(), models.WebhookSubscription{Url: "ftp://example.com", Secret: "s"})
+		if !errors.Is(err, client.ErrBadRequest) {
+			t.Fatalf("Expected 400, got %v", err)
+		}
+	})
+}
+
+// checkIngest returns the result of a successful ingest or checks the status
+// of a failed one.
+func checkIngest(t *testing.T, result models.IngestResult, err error, expectedStatus int) models.IngestResult {
+	t.Helper()
+	var apiErr *client.Error
+	switch {
+	case err == nil && expectedStatus != 200:
+		t.Fatalf("Expected status %d, got 200", expectedStatus)
+	case err != nil && !errors.As(err, &apiErr):
+		t.Fatalf("Request failed: %v", err)
+	case err != nil && apiErr.StatusCode != expectedStatus:
+		t.Fatalf("Expected status %d, got %v", expectedStatus, err)
+	}
+	return result
+}
+
+func postGithub(t *testing.T, c *client.Client, secret string, payload interface{}, expectedStatus int) models.IngestResult {
+	body, _ := json.Marshal(payload)
+	result, err := c.IngestGithub(context.Background(), "pull_request", body, secret)
+	return checkIngest(t, result, err, expectedStatus)
+}
+
+func postGitlab(t *testing.T, c *client.Client, token string, payload interface{}, expectedStatus int) models.IngestResult {
+	body, _ := json.Marshal(payload)
+	result, err := c.IngestGitlab(context.Background(), "Merge Request Hook", body, token)
+	return checkIngest(t, result, err, expectedStatus)
+}
+
+func githubPR(action string, number int, login string, merged bool) map[string]interface{} {
+	return map[string]interface{}{
+		"action": action,
+		"pull_request": map[string]interface{}{
+			"number": number,
+			"title":  fmt.Sprintf("PR %d", number),
+			"merged": merged,
+			"user":   map[string]string{"login": login},
+		},
+		"repository": map[string]string{"full_name": "org/repo"},
+		"sender":     map[string]string{"login": login},
+	}
+}
+
+func gitlabMR(action string, iid int, username string) map[string]interface{} {
+	return map[string]interface{}{
+		"object_kind":       "merge_request",
+		"user":              map[string]string{"username": username},
+		"project":           map[string]string{"path_with_namespace": "group/project"},
+		"object_attributes": map[string]interface{}{"iid": iid, "title": fmt.Sprintf("MR %d", iid), "action": action},
+	}
+}
+
+func TestIngest(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t, func(config *Config) {
+		config.Ingest = ingest.Config{Tenants: map[string]ingest.TenantConfig{
+			models.DEFAULT_TENANT: {
+				GithubSecret: "gh-secret",
+				GitlabToken:  "gl-token",
+				GithubLogins: map[string]string{"octocat": "u1"},
+				GitlabLogins: map[string]string{"tanuki": "u2"},
+			},
+			"acme": {
+				GithubSecret: "acme-secret",
+				GithubLogins: map[string]string{"octocat": "a1"},
+			},
+		}}
+	})
+	c := server.client
+
+	createTeam(t, c, "backend", []models.TeamMember{
+		{UserId: "u1", Username: "Alice", IsActive: true},
+		{UserId: "u2", Username: "Bob", IsActive: true},
+		{UserId: "u3", Username: "Carol", IsActive: true},
+	})
+	t.Run("Github", func(t *testing.T) {
+		result := postGithub(t, c, "gh-secret", githubPR("opened", 1, "octocat", false), 200)
+		if result.Action != ingest.CREATED || result.PR.PullRequestId != "org/repo#1" || result.PR.AuthorId != "u1" || len(result.PR.AssignedReviewers) != 2 {
+			t.Fatalf("Unexpected result: %+v", result.PR)
+		}
+		result = postGithub(t, c, "gh-secret", githubPR("synchronize", 1, "octocat", false), 200)
+		if result.Action != ingest.IGNORED {
+			t.Fatalf("Expected ignored, got %s", result.Action)
+		}
+		result = postGithub(t, c, "gh-secret", githubPR("closed", 1, "octocat", true), 200)
+		if result.Action != ingest.MERGED || result.PR.Status != models.MERGED {
+			t.Fatalf("Unexpected result: %+v", result)
+		}
+	})
+
+	t.Run("Gitlab", func(t *testing.T) {
+		result := postGitlab(t, c, "gl-token", gitlabMR("open", 7, "tanuki"), 200)
+		if result.Action != ingest.CREATED || result.PR.PullRequestId != "group/project!7" || result.PR.AuthorId != "u2" {
+			t.Fatalf("Unexpected result: %+v", result.PR)
+		}
+		result = postGitlab(t, c, "gl-token", gitlabMR("close", 7, "tanuki"), 200)
+		if result.Action != ingest.CLOSED || result.PR.Status != models.CLOSED || result.PR.ClosedAt == nil {
+			t.Fatalf("Unexpected result: %+v", result)
+		}
+		reassignPullRequestExpectError(t, c, "group/project!7", result.PR.AssignedReviewers[0], 409, models.PR_CLOSED, "cannot reassign on closed PR")
+		mergePullRequestExpectError(t, c, "group/project!7", 409, models.PR_CLOSED, "cannot merge closed PR")
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		postGithub(t, c, "wrong", githubPR("opened", 2, "octocat", false), 401)
+		postGitlab(t, c, "wrong", gitlabMR("open", 8, "tanuki"), 401)
+		postGithub(t, c, "gh-secret", githubPR("opened", 3, "stranger", false), 404)
+		postGitlab(t, c, "gl-token", gitlabMR("close", 7, "tanuki"), 200)
+		postGithub(t, c, "gh-secret", githubPR("closed", 1, "octocat", false), 409)
+	})
+
+	t.Run("Tenants", func(t *testing.T) {
+		for _, tenantId := range []string{"acme", "globex"} {
+			_, err := c.TenantCreate(context.Background(), models.Tenant{TenantId: tenantId, Name: tenantId})
+			mustSucceed(t, err)
+		}
+		acme := client.New(server.URL, client.WithTenant("acme"))
+		createTeam(t, acme, "backend", []models.TeamMember{
+			{UserId: "a1", Username: "Alice", IsActive: true},
+			{UserId: "a2", Username: "Bob", IsActive: true},
+		})
+
+		// the secret of a tenant does not open another one
+		postGithub(t, acme, "gh-secret", githubPR("opened", 5, "octocat", false), 401)
+		postGitlab(t, acme, "gl-token", gitlabMR("open", 9, "tanuki"), 401)
+		postGithub(t, client.New(server.URL, client.WithTenant("globex")), "gh-secret", githubPR("opened", 5, "octocat", false), 401)
+
+		// logins map to the tenant's own users
+		result := postGithub(t, acme, "acme-secret", githubPR("opened", 5, "octocat", false), 200)
+		if result.PR.AuthorId != "a1" || !reflect.DeepEqual(result.PR.AssignedReviewers, []string{"a2"}) {
+			t.Fatalf("Unexpected result: %+v", result.PR)
+		}
+		events, err := acme.Audit(context.Background(), models.AuditFilter{EntityId: "org/repo#5"})
+		mustSucceed(t, err)
+		if len(events) != 1 || events[0].Actor != "github:octocat" || events[0].ActorRole != models.ROLE_BOT {
+			t.Fatalf("Unexpected audit events: %+v", events)
+		}
+	})
+}
+
+func getMetrics(t *testing.T, c *client.Client) string {
+	body, err := c.Metrics(context.Background())
+	mustSucceed(t, err)
+	return body
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+	c := server.client
+
+	createTeam(t, c, "backend", []models.TeamMember{
+		{UserId: "u1", Username: "Alice", IsActive: true},
+		{UserId: "u2", Username: "Bob", IsActive: true},
+		{UserId: "u3", Username: "Carol", IsActive: true},
+		{UserId: "u4", Username: "Dave", IsActive: true},
+	})
+	prs := make(map[string]models.PullRequest)
+	for _, id := range []string{"r1", "r2"} {
+		pr := models.PullRequest{
+			PullRequestId:     id,
+			PullRequestName:   id,
+			AuthorId:          "u1",
+			Status:            models.OPEN,
+			AssignedReviewers: []string{"u2", "u3"},
+			TeamName:          "backend",
+		}
+		prs[id] = createPullRequest(t, c, id, id, "u1", &pr)
+	}
+	pr1 := prs["r1"]
+	pr1.AssignedReviewers = []string{"u4", "u3"}
+	reassignPullRequest(t, c, "r1", "u2", pr1, "u4")
+	setUserIsActive(t, c, "u2", false, models.User{UserId: "u2", Username: "Bob", TeamName: "backend", Teams: []string{"backend"}, IsActive: false})
+	reassignPullRequestExpectError(t, c, "r1", "u3", 409, models.NO_CANDIDATE, "no active replacement candidate in team")
+	pr2 := prs["r2"]
+	pr2.Status = models.MERGED
+	mergePullRequest(t, c, "r2", &pr2)
+	getTeamExpectError(t, c, "nope", 404, models.NOT_FOUND, "team_name not found")
+
+	body := getMetrics(t, c)
+	for _, line := range []string{
+		`pr_open 1`,
+		`pr_open_reviews{tenant="default",user_id="u2"} 0`,
+		`pr_open_reviews{tenant="default",user_id="u3"} 1`,
+		`pr_open_reviews{tenant="default",user_id="u4"} 1`,
+		`pr_created_total 2`,
+		`pr_reassignments_total 1`,
+		`pr_merges_total 1`,
+		`pr_domain_errors_total{code="NO_CANDIDATE"} 1`,
+		`http_requests_total{route="/pullRequest/create",method="POST",status="201"} 2`,
+		`http_requests_total{route="/team/get",method="GET",status="404"} 1`,
+		`http_request_duration_seconds_count{route="/pullRequest/reassign",method="POST",status="409"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Missing %q in metrics:\n%s", line, body)
+		}
+	}
+}
+
+func getHealth(t *testing.T, c *client.Client, ready bool, expectedStatus int) models.HealthReport {
+	var report models.HealthReport
+	var err error
+	if ready {
+		report, err = c.HealthReady(context.Background())
+	} else {
+		report, err = c.HealthLive(context.Background())
+	}
+
+	var apiErr *client.Error
+	switch {
+	case err == nil && expectedStatus != 200:
+		t.Fatalf("Expected status %d, got 200", expectedStatus)
+	case err != nil && (!errors.As(err, &apiErr) || apiErr.StatusCode != expectedStatus):
+		t.Fatalf("Expected status %d, got %v", expectedStatus, err)
+	}
+	return report
+}
+
+func TestHealth(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+	c := server.client
+
+	t.Run("Live", func(t *testing.T) {
+		report := getHealth(t, c, false, 200)
+		if report.Status != "ok" || report.Version != Version {
+			t.Fatalf("Unexpected report: %+v", report)
+		}
+	})
+
+	t.Run("Ready", func(t *testing.T) {
+		report := getHealth(t, c, true, 200)
+		if report.Status != "ok" || report.Checks["storage"] != "ok" {
+			t.Fatalf("Unexpected report: %+v", report)
+		}
+	})
+
+	t.Run("Draining", func(t *testing.T) {
+		server.Drain(0)
+		report := getHealth(t, c, true, 503)
+		if report.Status != "shutting_down" {
+			t.Fatalf("Unexpected report: %+v", report)
+		}
+		getHealth(t, c, false, 200)
+	})
+}
+
+func TestOpenAPI(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+	c := server.client
+
+	t.Run("Spec", func(t *testing.T) {
+		resp := doRequestWithHeaders(t, http.MethodGet, server.URL+"/openapi.yml", nil, nil)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != 200 || !bytes.Equal(body, prreviewer.OpenAPISpec) {
+			t.Fatalf("Expected the embedded spec, got %d: %.80s", resp.StatusCode, body)
+		}
+	})
+
+	for _, tc := range []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		expected models.ErrorResponse
+	}{
+		{"InvalidJSON", http.MethodPost, "/team/add", `{"team_name": `, models.NewErrorResponse(models.BAD_REQUEST, "request body is not valid JSON: unexpected end of JSON input")},
+		{"MissingBody", http.MethodPost, "/pullRequest/merge", "", models.NewErrorResponse(models.BAD_REQUEST, "request body is required")},
+		{"EmptyNames", http.MethodPost, "/team/add", `{"team_name": "", "members": [{"user_id": "u1", "username": "", "is_active": "yes"}]}`,
+			models.NewValidationErrorResponse([]models.FieldError{
+				{Field: "members[0].is_active", Message: "must be a boolean"},
+				{Field: "members[0].username", Message: "must not be empty"},
+				{Field: "team_name", Message: "must not be empty"},
+			})},
+		{"MissingIds", http.MethodPost, "/pullRequest/reassign", `{"pull_request_id": ""}`,
+			models.NewValidationErrorResponse([]models.FieldError{
+				{Field: "old_user_id", Message: "is required"},
+				{Field: "pull_request_id", Message: "must not be empty"},
+			})},
+		{"MissingQuery", http.MethodGet, "/users/getReview", "", models.NewValidationErrorResponse([]models.FieldError{{Field: "user_id", Message: "is required"}})},
+		{"WrongQuery", http.MethodGet, "/audit?from=yesterday", "", models.NewValidationErrorResponse([]models.FieldError{{Field: "from", Message: "must be an RFC 3339 date-time"}})},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, server.URL+tc.path, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			var response models.ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatalf("Expected a JSON error body: %v", err)
+			}
+			if resp.StatusCode != 400 || resp.Header.Get("Content-Type") != "application/json" {
+				t.Fatalf("Expected a 400 JSON response, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+			}
+			assertEqual(t, response, tc.expected)
+		})
+	}
+
+	t.Run("ClientDetails", func(t *testing.T) {
+		_, err := c.PullRequestMerge(context.Background(), "")
+		var apiErr *client.Error
+		if !errors.Is(err, client.ErrValidation) || !errors.As(err, &apiErr) {
+			t.Fatalf("Expected a validation error, got %v", err)
+		}
+		assertEqual(t, apiErr.Details, []models.FieldError{{Field: "pull_request_id", Message: "must not be empty"}})
+	})
+}
+
+func TestRouting(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+
+	for _, tc := range []struct {
+		name     string
+		method   string
+		path     string
+		status   int
+		allow    string
+		expected models.ErrorResponse
+	}{
+		{"GetOnPost", http.MethodGet, "/pullRequest/merge", 405, "POST", models.NewErrorResponse(models.METHOD_NOT_ALLOWED, "method GET is not allowed for /pullRequest/merge, allowed: POST")},
+		{"PostOnGet", http.MethodPost, "/team/get", 405, "GET, HEAD", models.NewErrorResponse(models.METHOD_NOT_ALLOWED, "method POST is not allowed for /team/get, allowed: GET, HEAD")},
+		{"UnknownRoute", http.MethodGet, "/team/remove", 404, "", models.NewErrorResponse(models.NOT_FOUND, "no route for GET /team/remove")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := doRequestWithHeaders(t, tc.method, server.URL+tc.path, nil, nil)
+			defer resp.Body.Close()
+
+			var response models.ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+				t.Fatalf("Expected a JSON error body: %v", err)
+			}
+			if resp.StatusCode != tc.status || resp.Header.Get("Allow") != tc.allow || resp.Header.Get("Content-Type") != "application/json" {
+				t.Fatalf("Expected %d with Allow %q, got %d %q %s", tc.status, tc.allow, resp.StatusCode, resp.Header.Get("Allow"), resp.Header.Get("Content-Type"))
+			}
+			assertEqual(t, response, tc.expected)
+		})
+	}
+}
+
+// TestAuth is not parallel: the token command reads AUTH_JWT_SECRET from the
+// environment.
+func TestAuth(t *testing.T) {
+	tokens, err := auth.ParseTokens("admin-token=admin:alice,bot-token=bot:ci")
+	mustSucceed(t, err)
+	server := newTestServer(t, func(config *Config) {
+		config.Auth = auth.Config{Tokens: tokens, JWTSecret: []byte("jwt-secret")}
+	})
+	c := server.client
+
+	sign := func(subject string, role models.Role, expiresAt time.Time) string {
+		token, err := auth.SignJWT([]byte("jwt-secret"), auth.Claims{Subject: subject, Role: role, ExpiresAt: expiresAt.Unix()})
+		mustSucceed(t, err)
+		return token
+	}
+	ctx := context.Background()
+	admin := client.New(server.URL, client.WithToken("admin-token"))
+	bot := client.New(server.URL, client.WithToken("bot-token"), client.WithHeader("X-Actor", "spoofed"))
+	u2 := client.New(server.URL, client.WithToken(sign("u2", models.ROLE_USER, time.Now().Add(time.Hour))))
+
+	_, err = admin.TeamAdd(ctx, models.Team{TeamName: "backend", Members: []models.TeamMember{
+		{UserId: "u1", Username: "Alice", IsActive: true},
+		{UserId: "u2", Username: "Bob", IsActive: true},
+		{UserId: "u3", Username: "Carol", IsActive: true},
+		{UserId: "u4", Username: "Dave", IsActive: true},
+	}})
+	mustSucceed(t, err)
+	pr, err := bot.PullRequestCreate(ctx, "r1", "req1", "u1", "")
+	mustSucceed(t, err)
+
+	t.Run("Public", func(t *testing.T) {
+		for _, path := range []string{"/health/live", "/metrics", "/openapi.yml"} {
+			resp := doRequestWithHeaders(t, http.MethodGet, server.URL+path, nil, nil)
+			resp.Body.Close()
+			if resp.StatusCode != 200 {
+				t.Fatalf("Expected %s to be public, got %d", path, resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		_, err := c.TeamGet(ctx, "backend")
+		assertAPIError(t, err, 401, models.UNAUTHORIZED, "authentication required")
+
+		_, err = client.New(server.URL, client.WithToken("nope")).TeamGet(ctx, "backend")
+		assertAPIError(t, err, 401, models.UNAUTHORIZED, "invalid token: unknown token")
+
+		expired := client.New(server.URL, client.WithToken(sign("u2", models.ROLE_USER, time.Now().Add(-time.Hour))))
+		_, err = expired.TeamGet(ctx, "backend")
+		assertAPIError(t, err, 401, models.UNAUTHORIZED, "token is expired")
+
+		forged := client.New(server.URL, client.WithToken(sign("u2", models.ROLE_ADMIN, time.Now().Add(time.Hour))+"x"))
+		_, err = forged.TeamGet(ctx, "backend")
+		if !errors.Is(err, client.ErrUnauthorized) {
+			t.Fatalf("Expected a tampered JWT to be rejected, got %v", err)
+		}
+
+		// the body is not looked at before the caller is known
+		resp := doRequestWithHeaders(t, http.MethodPost, server.URL+"/team/add", nil, map[string]any{"team_name": ""})
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("Expected 401 before validation, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Roles", func(t *testing.T) {
+		_, err := u2.TeamAdd(ctx, models.Team{TeamName: "frontend", Members: []models.TeamMember{}})
+		assertAPIError(t, err, 403, models.FORBIDDEN, "role user may not call POST /team/add")
+		_, err = u2.PullRequestMerge(ctx, "r1")
+		assertAPIError(t, err, 403, models.FORBIDDEN, "role user may not call POST /pullRequest/merge")
+		_, err = bot.UsersSetIsActive(ctx, "u3", false)
+		assertAPIError(t, err, 403, models.FORBIDDEN, "role bot may not call POST /users/setIsActive")
+		_, err = bot.PullRequestReassign(ctx, "r1", pr.AssignedReviewers[0], "")
+		assertAPIError(t, err, 403, models.FORBIDDEN, "role bot may not call POST /pullRequest/reassign")
+		_, err = bot.Audit(ctx, models.AuditFilter{})
+		if !errors.Is(err, client.ErrForbidden) {
+			t.Fatalf("Expected the audit log to be admin only, got %v", err)
+		}
+
+		_, err = u2.UsersGetReview(ctx, "u3")
+		mustSucceed(t, err)
+		_, err = u2.TeamGet(ctx, "backend")
+		mustSucceed(t, err)
+	})
+
+	t.Run("ReassignSelf", func(t *testing.T) {
+		other := pr.AssignedReviewers[0]
+		if other == "u2" {
+			other = pr.AssignedReviewers[1]
+		}
+		_, err := u2.PullRequestReassign(ctx, "r1", other, "")
+		assertAPIError(t, err, 403, models.FORBIDDEN, "users may only reassign themselves")
+
+		if !slices.Contains(pr.AssignedReviewers, "u2") {
+			_, err = admin.PullRequestReassign(ctx, "r1", other, "u2")
+			mustSucceed(t, err)
+		}
+		reassigned, err := u2.PullRequestReassign(ctx, "r1", "u2", "")
+		mustSucceed(t, err)
+		if reassigned.ReplacedBy == "u2" || slices.Contains(reassigned.PR.AssignedReviewers, "u2") {
+			t.Fatalf("Expected u2 to be replaced, got %+v", reassigned)
+		}
+	})
+
+	t.Run("AuditActor", func(t *testing.T) {
+		events, err := admin.Audit(ctx, models.AuditFilter{})
+		mustSucceed(t, err)
+		actors := map[models.AuditAction]models.AuditEvent{}
+		for _, event := range events {
+			actors[event.Action] = event
+		}
+		if event := actors[models.TEAM_ADD]; event.Actor != "alice" || event.ActorRole != models.ROLE_ADMIN {
+			t.Fatalf("Unexpected team event: %+v", event)
+		}
+		if event := actors[models.PR_CREATE]; event.Actor != "ci" || event.ActorRole != models.ROLE_BOT {
+			t.Fatalf("Expected X-Actor to be ignored, got %+v", event)
+		}
+		if event := actors[models.PR_REASSIGN]; event.Actor != "u2" || event.ActorRole != models.ROLE_USER {
+			t.Fatalf("Unexpected reassign event: %+v", event)
+		}
+	})
+
+	t.Run("TokenCommand", func(t *testing.T) {
+		t.Setenv("AUTH_JWT_SECRET", "jwt-secret")
+		var stdout, stderr bytes.Buffer
+		if code := runCommand([]string{"token", "--subject", "ops", "--role", "admin"}, &stdout, &stderr); code != 0 {
+			t.Fatalf("Exit code %d, stderr: %s", code, stderr.String())
+		}
+		token := strings.TrimSpace(stdout.String())
+
+		// tokens without expiry are not accepted, they are not made either
+		stdout.Reset()
+		if code := runCommand([]string{"token", "--subject", "ops", "--role", "admin", "--ttl", "0"}, &stdout, &stderr); code != 2 || stdout.Len() != 0 {
+			t.Fatalf("Expected a token without expiry to be refused, got %d and %q", code, stdout.String())
+		}
+
+		report, err := client.New(server.URL, client.WithToken(token)).ConsistencyCheck(context.Background(), false)
+		if err != nil || !report.Consistent {
+			t.Fatalf("Expected the token to be accepted, got %+v, %v", report, err)
+		}
+	})
+}
+
+func TestTenants(t *testing.T) {
+	t.Parallel()
+	tokens, err := auth.ParseTokens("admin-token=admin:alice,acme-token=admin:bob@acme")
+	mustSucceed(t, err)
+	server := newTestServer(t, func(config *Config) {
+		config.Auth = auth.Config{Tokens: tokens}
+	})
+
+	ctx := context.Background()
+	admin := client.New(server.URL, client.WithToken("admin-token"))
+	acme := client.New(server.URL, client.WithToken("acme-token"))
+
+	tenant, err := admin.TenantCreate(ctx, models.Tenant{TenantId: "acme", Name: "Acme Corp"})
+	mustSucceed(t, err)
+	if tenant.TenantId != "acme" || tenant.CreatedAt.IsZero() {
+		t.Fatalf("Unexpected tenant: %+v", tenant)
+	}
+	_, err = admin.TenantCreate(ctx, models.Tenant{TenantId: "a b", Name: "Spaced"})
+	var apiErr *client.Error
+	if !errors.Is(err, client.ErrValidation) || !errors.As(err, &apiErr) || apiErr.StatusCode != 400 || len(apiErr.Details) != 1 {
+		t.Fatalf("Expected a 400 validation error of tenant_id, got %v", err)
+	}
+
+	_, err = admin.TeamAdd(ctx, models.Team{TeamName: "backend", Members: []models.TeamMember{
+		{UserId: "u1", Username: "Alice", IsActive: true},
+		{UserId: "u2", Username: "Bob", IsActive: true},
+	}})
+	mustSucceed(t, err)
+	acmeTeam := models.Team{TeamName: "backend", Members: []models.TeamMember{
+		{UserId: "u1", Username: "Ann", IsActive: true},
+		{UserId: "u2", Username: "Ben", IsActive: true},
+		{UserId: "u3", Username: "Cid", IsActive: true},
+	}}
+	_, err = acme.TeamAdd(ctx, acmeTeam)
+	mustSucceed(t, err)
+
+	t.Run("Manage", func(t *testing.T) {
+		_, err := admin.TenantCreate(ctx, models.Tenant{TenantId: "acme", Name: "Acme again"})
+		assertAPIError(t, err, 400, models.TENANT_EXISTS, "tenant_id already exists")
+		_, err = acme.TenantCreate(ctx, models.Tenant{TenantId: "other", Name: "Other"})
+		assertAPIError(t, err, 403, models.FORBIDDEN, "actors bound to a tenant cannot manage tenants")
+
+		tenants, err := admin.Tenants(ctx)
+		mustSucceed(t, err)
+		if len(tenants) != 2 || tenants[0].TenantId != models.DEFAULT_TENANT || tenants[1].TenantId != "acme" {
+			t.Fatalf("Unexpected tenants: %+v", tenants)
+		}
+	})
+
+	t.Run("Isolation", func(t *testing.T) {
+		team, err := admin.TeamGet(ctx, "backend")
+		mustSucceed(t, err)
+		if len(team.Members) != 2 {
+			t.Fatalf("Expected the default team, got %+v", team)
+		}
+		team, err = acme.TeamGet(ctx, "backend")
+		mustSucceed(t, err)
+		assertEqual(t, team, acmeTeam)
+		team, err = client.New(server.URL, client.WithToken("admin-token"), client.WithTenant("acme")).TeamGet(ctx, "backend")
+		mustSucceed(t, err)
+		assertEqual(t, team, acmeTeam)
+
+		_, err = client.New(server.URL, client.WithToken("acme-token"), client.WithTenant(models.DEFAULT_TENANT)).TeamGet(ctx, "backend")
+		assertAPIError(t, err, 403, models.FORBIDDEN, "actor bob belongs to tenant acme")
+		_, err = client.New(server.URL, client.WithToken("admin-token"), client.WithTenant("nope")).TeamGet(ctx, "backend")
+		assertAPIError(t, err, 404, models.TENANT_NOT_FOUND, "tenant nope not found")
+	})
+
+	t.Run("Webhooks", func(t *testing.T) {
+		receiver := newWebhookReceiver(t, "s1", 0)
+		defer receiver.server.Close()
+		_, err := acme.WebhookSubscribe(ctx, models.WebhookSubscription{Url: receiver.server.URL, Secret: "s1"})
+		mustSucceed(t, err)
+		subscriptions, err := admin.WebhookList(ctx)
+		mustSucceed(t, err)
+		if len(subscriptions) != 0 {
+			t.Fatalf("Expected no subscriptions in the default tenant, got %+v", subscriptions)
+		}
+
+		_, err = admin.PullRequestCreate(ctx, "r1", "req1", "u1", "")
+		mustSucceed(t, err)
+		_, err = acme.PullRequestCreate(ctx, "r2", "req2", "u1", "")
+		mustSucceed(t, err)
+		for _, payload := range receiver.waitFor(t, 3) {
+			if payload.TenantId != "acme" || payload.PR.PullRequestId != "r2" {
+				t.Fatalf("Unexpected payload: %+v", payload)
+			}
+		}
+	})
+}
+
+func TestConsistency(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+	c := server.client
+
+	createTeam(t, c, "backend", []models.TeamMember{
+		{UserId: "u1", Username: "Alice", IsActive: true},
+		{UserId: "u2", Username: "Bob", IsActive: true},
+	})
+	pr := models.PullRequest{
+		PullRequestId:     "r1",
+		PullRequestName:   "req1",
+		AuthorId:          "u1",
+		Status:            models.OPEN,
+		AssignedReviewers: []string{"u2"},
+		TeamName:          "backend",
+	}
+	createPullRequest(t, c, "r1", "req1", "u1", &pr)
+
+	for _, repair := range []bool{false, true} {
+		report, err := c.ConsistencyCheck(context.Background(), repair)
+		if err != nil || !report.Consistent || len(report.Violations) != 0 {
+			t.Fatalf("repair %t: expected a consistent report, got %+v, %v", repair, report, err)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	server := newTestServer(t)
+	c := server.client
+	createTeam(t, c, "backend", []models.TeamMember{
+		{UserId: "u1", Username: "Alice", IsActive: true},
+		{UserId: "u2", Username: "Bob", IsActive: true},
+	})
+	pr := models.PullRequest{
+		PullRequestId:     "r1",
+		PullRequestName:   "req1",
+		AuthorId:          "u1",
+		Status:            models.OPEN,
+		AssignedReviewers: []string{"u2"},
+		TeamName:          "backend",
+	}
+	createPullRequest(t, c, "r1", "req1", "u1", &pr)
+
+	snapshot, err := c.SnapshotExport(ctx)
+	mustSucceed(t, err)
+
+	// a fresh instance to import into
+	c = newTestServer(t).client
+
+	result, err := c.SnapshotImport(ctx, snapshot)
+	mustSucceed(t, err)
+	if result.Teams != 1 || result.Users != 2 || result.PullRequests != 1 {
+		t.Fatalf("Unexpected import result %+v", result)
+	}
+	history := getHistory(t, c, "r1")
+	if !reflect.DeepEqual(history.PR.AssignedReviewers, pr.AssignedReviewers) {
+		t.Fatalf("Expected reviewers %v, got %v", pr.AssignedReviewers, history.PR.AssignedReviewers)
+	}
+
+	if _, err = c.SnapshotImport(ctx, snapshot); err == nil {
+		t.Fatal("Import into a non-empty instance should fail")
+	}
+}
+
+// rawRequest sends a request the client cannot make and returns the error
+// response like the client does.
+func rawRequest(t *testing.T, method, url, body string) error {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	mustSucceed(t, err)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	resp, err := http.DefaultClient.Do(req)
+	mustSucceed(t, err)
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	var response models.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode error: %v", err)
+	}
+	return &client.Error{StatusCode: resp.StatusCode, Code: response.Detail.Code, Message: response.Detail.Message}
+}
+
+// failingRepo fails every write, like a storage backend that went away.
+type failingRepo struct{ repo.Repo }
+
+func (failingRepo) CreateTeam(models.Team) error {
+	return errors.New("storage is unavailable")
+}
+
+type failingTenants struct{ repo.TenantRepo }
+
+func (f failingTenants) Store(tenantId string) *repo.Store {
+	store := f.TenantRepo.Store(tenantId)
+	if store == nil {
+		return nil
+	}
+	failing := *store
+	failing.Repo = failingRepo{store.Repo}
+	return &failing
+}
+
+func TestErrorCodes(t *testing.T) {
+	t.Parallel()
+	tokens, err := auth.ParseTokens("admin-token=admin:alice,bot-token=bot:ci,u2-token=user:u2")
+	mustSucceed(t, err)
+	server := newTestServer(t, func(config *Config) {
+		config.Auth = auth.Config{Tokens: tokens}
+	})
+	broken := newTestServer(t, func(config *Config) {
+		config.Tenants = failingTenants{memory_repo.NewMemoryTenantRepo(memory_repo.NewMemoryStore(), clock.System{})}
+	})
+
+	ctx := context.Background()
+	admin := client.New(server.URL, client.WithToken("admin-token"))
+	bot := client.New(server.URL, client.WithToken("bot-token"))
+	u2 := client.New(server.URL, client.WithToken("u2-token"))
+
+	for _, team := range []models.Team{
+		{TeamName: "backend", Members: []models.TeamMember{
+			{UserId: "u1", Username: "Alice", IsActive: true},
+			{UserId: "u2", Username: "Bob", IsActive: true},
+			{UserId: "u3", Username: "Carol", IsActive: true},
+			{UserId: "u4", Username: "Dave", IsActive: false},
+		}},
+		{TeamName: "frontend", Members: []models.TeamMember{
+			{UserId: "u5", Username: "Eve", IsActive: true},
+			{UserId: "u6", Username: "Frank", IsActive: true},
+		}},
+	} {
+		_, err := admin.TeamAdd(ctx, team)
+		mustSucceed(t, err)
+	}
+	// u2 and u3 review every pull request of backend
+	for _, id := range []string{"r-open", "r-merged", "r-closed"} {
+		_, err := admin.PullRequestCreate(ctx, id, id, "u1", "")
+		mustSucceed(t, err)
+	}
+	_, err = admin.PullRequestMerge(ctx, "r-merged")
+	mustSucceed(t, err)
+	_, err = admin.PullRequestClose(ctx, "r-closed")
+	mustSucceed(t, err)
+	_, err = admin.PullRequestCreate(ctx, "f1", "f1", "u5", "")
+	mustSucceed(t, err)
+	_, err = admin.TenantCreate(ctx, models.Tenant{TenantId: "acme", Name: "Acme"})
+	mustSucceed(t, err)
+
+	cases := []struct {
+		name    string
+		call    func() error
+		status  int
+		code    models.ErrorDetailCode
+		message string
+	}{
+		{"TeamExists", func() error {
+			_, err := admin.TeamAdd(ctx, models.Team{TeamName: "backend", Members: []models.TeamMember{}})
+			return err
+		}, 400, models.TEAM_EXISTS, "team_name already exists"},
+		{"PullRequestExists", func() error {
+			_, err := admin.PullRequestCreate(ctx, "r-open", "again", "u1", "")
+			return err
+		}, 409, models.PR_EXISTS, "pull_request already exists"},
+		{"ReassignMerged", func() error {
+			_, err := admin.PullRequestReassign(ctx, "r-merged", "u2", "")
+			return err
+		}, 409, models.PR_MERGED, "cannot reassign on merged PR"},
+		{"MergeClosed", func() error {
+			_, err := admin.PullRequestMerge(ctx, "r-closed")
+			return err
+		}, 409, models.PR_CLOSED, "cannot merge closed PR"},
+		{"NotAssigned", func() error {
+			_, err := admin.PullRequestReassign(ctx, "r-open", "u1", "")
+			return err
+		}, 409, models.NOT_ASSIGNED, "reviewer is not assigned to this PR"},
+		{"NoCandidate", func() error {
+			_, err := admin.PullRequestReassign(ctx, "f1", "u6", "")
+			return err
+		}, 409, models.NO_CANDIDATE, "no active replacement candidate in team"},
+		{"NotFound", func() error {
+			_, err := admin.TeamGet(ctx, "nope")
+			return err
+		}, 404, models.NOT_FOUND, "team_name not found"},
+		{"CandidateIsAuthor", func() error {
+			_, err := admin.PullRequestReassign(ctx, "r-open", "u2", "u1")
+			return err
+		}, 409, models.CANDIDATE_IS_AUTHOR, "author cannot review own PR"},
+		{"CandidateInactive", func() error {
+			_, err := admin.PullRequestReassign(ctx, "r-open", "u2", "u4")
+			return err
+		}, 409, models.CANDIDATE_INACTIVE, "new reviewer is not active"},
+		{"AlreadyAssigned", func() error {
+			_, err := admin.PullRequestReassign(ctx, "r-open", "u2", "u3")
+			return err
+		}, 409, models.ALREADY_ASSIGNED, "new reviewer is already assigned to this PR"},
+		{"WrongTeam", func() error {
+			_, err := admin.PullRequestReassign(ctx, "r-open", "u2", "u5")
+			return err
+		}, 409, models.WRONG_TEAM, "new reviewer is not in reviewer's or author's team"},
+		{"Unauthorized", func() error {
+			_, err := client.New(server.URL).TeamGet(ctx, "backend")
+			return err
+		}, 401, models.UNAUTHORIZED, "authentication required"},
+		{"Forbidden", func() error {
+			_, err := u2.PullRequestMerge(ctx, "r-open")
+			return err
+		}, 403, models.FORBIDDEN, "role user may not call POST /pullRequest/merge"},
+		{"ForbiddenSelf", func() error {
+			_, err := u2.PullRequestReassign(ctx, "r-open", "u3", "")
+			return err
+		}, 403, models.FORBIDDEN, "users may only reassign themselves"},
+		{"TenantExists", func() error {
+			_, err := admin.TenantCreate(ctx, models.Tenant{TenantId: "acme", Name: "Acme"})
+			return err
+		}, 400, models.TENANT_EXISTS, "tenant_id already exists"},
+		{"TenantNotFound", func() error {
+			_, err := client.New(server.URL, client.WithToken("admin-token"), client.WithTenant("nope")).TeamGet(ctx, "backend")
+			return err
+		}, 404, models.TENANT_NOT_FOUND, "tenant nope not found"},
+		{"NotEmpty", func() error {
+			_, err := admin.SnapshotImport(ctx, models.Snapshot{Version: 1, Teams: []models.Team{}, Users: []models.User{}, PullRequests: []models.PullRequest{}, Assignments: map[string][]string{}})
+			return err
+		}, 409, models.NOT_EMPTY, "Snapshot can only be imported into an empty instance"},
+		{"InvalidSnapshot", func() error {
+			_, err := admin.SnapshotImport(ctx, models.Snapshot{Version: 1, Teams: []models.Team{}, Users: []models.User{}, PullRequests: []models.PullRequest{
+				{PullRequestId: "x1", PullRequestName: "x1", AuthorId: "ghost", Status: models.OPEN, AssignedReviewers: []string{}},
+			}, Assignments: map[string][]string{}})
+			return err
+		}, 422, models.INVALID_SNAPSHOT, `pull request "x1": author "ghost" does not exist`},
+		{"BadRequest", func() error {
+			return rawRequest(t, http.MethodPost, server.URL+"/team/add", "{")
+		}, 400, models.BAD_REQUEST, "request body is not valid JSON: unexpected end of JSON input"},
+		{"SpecViolation", func() error {
+			_, err := admin.TeamSetMemberRole(ctx, "backend", "u2", "BOSS")
+			return err
+		}, 400, models.VALIDATION_ERROR, "invalid fields: role"},
+		{"InvalidInput", func() error {
+			_, err := bot.PullRequestCreate(ctx, "r 1", "bad id", "u1", "")
+			return err
+		}, 400, models.VALIDATION_ERROR, "invalid fields: pull_request_id"},
+		{"MethodNotAllowed", func() error {
+			return rawRequest(t, http.MethodGet, server.URL+"/pullRequest/merge", "")
+		}, 405, models.METHOD_NOT_ALLOWED, "method GET is not allowed for /pullRequest/merge, allowed: POST"},
+		{"FatalError", func() error {
+			_, err := broken.client.TeamAdd(ctx, models.Team{TeamName: "backend", Members: []models.TeamMember{}})
+			return err
+		}, 500, models.FATAL_ERROR, "storage is unavailable"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assertAPIError(t, tc.call(), tc.status, tc.code, tc.message)
+		})
+	}
+
+	t.Run("CoversSpec", func(t *testing.T) {
+		spec, err := openapi.Load(prreviewer.OpenAPISpec)
+		mustSucceed(t, err)
+		covered := map[models.ErrorDetailCode]bool{}
+		for _, tc := range cases {
+			covered[tc.code] = true
+		}
+		schema := spec.Operation(http.MethodPost, "/team/add").Responses["400"].Content["application/json"]
+		for _, code := range schema.Properties["error"].Properties["code"].Enum {
+			if !covered[models.ErrorDetailCode(code.(string))] {
+				t.Errorf("No case for %s", code)
+			}
+		}
 	})
 }
@@ -6,49 +6,260 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	prreviewer "github.com/Dowtai/pr-reviewer-service"
 	"github.com/Dowtai/pr-reviewer-service/internal/api"
+	"github.com/Dowtai/pr-reviewer-service/internal/auth"
+	"github.com/Dowtai/pr-reviewer-service/internal/clock"
+	"github.com/Dowtai/pr-reviewer-service/internal/health"
+	"github.com/Dowtai/pr-reviewer-service/internal/ids"
+	"github.com/Dowtai/pr-reviewer-service/internal/ingest"
+	"github.com/Dowtai/pr-reviewer-service/internal/metrics"
+	"github.com/Dowtai/pr-reviewer-service/internal/models"
+	"github.com/Dowtai/pr-reviewer-service/internal/openapi"
+	"github.com/Dowtai/pr-reviewer-service/internal/repo"
 	"github.com/Dowtai/pr-reviewer-service/internal/repo/memory_repo"
+	"github.com/Dowtai/pr-reviewer-service/internal/scheduler"
 	"github.com/Dowtai/pr-reviewer-service/internal/service"
+	"github.com/Dowtai/pr-reviewer-service/internal/webhook"
 )
 
-func NewServer(port string) *http.Server {
-	repo := memory_repo.NewMemoryRepo()
+// Version is set at build time: go build -ldflags "-X main.Version=1.2.3"
+var Version = "dev"
 
-	svc := service.NewService(repo)
+const (
+	DEFAULT_DRAIN_DELAY            = 5 * time.Second
+	DEFAULT_OVERDUE_CHECK_INTERVAL = time.Minute
+	DEFAULT_STALE_CHECK_INTERVAL   = time.Minute
+)
+
+// Server is the http.Server together with the background parts of the
+// service that have to be stopped with it.
+type Server struct {
+	*http.Server
+	health     *health.Checker
+	dispatcher *webhook.Dispatcher
+	scheduler  *scheduler.Scheduler
+}
+
+// Config is everything NewServer needs, ConfigFromEnv fills it in production.
+type Config struct {
+	Port string
+	// Tenants is the storage, a new in-memory one when nil.
+	Tenants      repo.TenantRepo
+	Ingest       ingest.Config
+	Auth         auth.Config
+	ResponseMode openapi.ResponseMode
+	// OverdueCheckInterval is how often REVIEW_OVERDUE events are recorded.
+	OverdueCheckInterval time.Duration
+	// StaleReviewAfter turns on the automatic reassignment of stale reviews
+	// when positive, checked every StaleReviewCheckInterval.
+	StaleReviewAfter         time.Duration
+	StaleReviewCheckInterval time.Duration
+}
+
+// ConfigFromEnv reads PORT, OVERDUE_CHECK_INTERVAL, STALE_REVIEW_AFTER,
+// STALE_REVIEW_CHECK_INTERVAL and the variables of ingest.ConfigFromEnv,
+// auth.ConfigFromEnv and openapi.ResponseModeFromEnv.
+func ConfigFromEnv() Config {
+	config := Config{
+		Port:                     os.Getenv("PORT"),
+		OverdueCheckInterval:     durationFromEnv("OVERDUE_CHECK_INTERVAL", DEFAULT_OVERDUE_CHECK_INTERVAL),
+		StaleReviewAfter:         durationFromEnv("STALE_REVIEW_AFTER", 0),
+		StaleReviewCheckInterval: durationFromEnv("STALE_REVIEW_CHECK_INTERVAL", DEFAULT_STALE_CHECK_INTERVAL),
+	}
+
+	var err error
+	if config.Ingest, err = ingest.ConfigFromEnv(); err != nil {
+		log.Printf("Error loading ingest config: %v", err)
+	}
+	if config.ResponseMode, err = openapi.ResponseModeFromEnv(); err != nil {
+		log.Printf("Error loading response validation mode: %v", err)
+	}
+	if config.Auth, err = auth.ConfigFromEnv(); err != nil {
+		log.Fatalf("Error loading auth config: %v", err)
+	}
+	return config
+}
+
+// NewServer builds the service from config alone, nothing is read from the
+// environment, so tests can run several servers side by side.
+func NewServer(config Config) *Server {
+	clk := clock.System{}
+	tenants := config.Tenants
+	if tenants == nil {
+		tenants = memory_repo.NewMemoryTenantRepo(memory_repo.NewMemoryStore(), clk)
+	}
+
+	svc := service.NewService(tenants, clk, ids.Random{})
+
+	dispatcher := webhook.NewDispatcher(memory_repo.NewMemoryWebhookRepo(memory_repo.DEFAULT_DELIVERY_LIMIT), svc, &http.Client{Timeout: 5 * time.Second}, clk, ids.Random{}, webhook.DEFAULT_MAX_ATTEMPTS, webhook.DEFAULT_BACKOFF)
+	svc.AddListener(dispatcher)
+
+	registry := metrics.NewRegistry()
+	httpMetrics := metrics.NewHTTPMetrics(registry)
+	svc.AddListener(metrics.NewServiceMetrics(registry))
+
+	ingestor := ingest.NewIngestor(svc, config.Ingest)
+
+	spec, err := openapi.Load(prreviewer.OpenAPISpec)
+	if err != nil {
+		log.Fatalf("Error loading openapi.yml: %v", err)
+	}
+	validator := openapi.NewValidator(spec, config.ResponseMode)
+
+	if err := config.Auth.Validate(); err != nil {
+		log.Fatalf("Refusing to start: %v", err)
+	}
+	if config.Auth.Disabled {
+		log.Println("Authentication is disabled by AUTH_DISABLED, every caller is an admin")
+	}
+	authenticator := auth.NewAuthenticator(config.Auth, svc.TenantExists)
+
+	jobs := scheduler.New(clk)
+	jobs.Add(scheduler.Job{Name: "overdue", Interval: config.OverdueCheckInterval,
+		Run: func(ctx context.Context, now time.Time) error {
+			return svc.ForEachTenant(ctx, func(ctx context.Context) error {
+				_, err := svc.RecordOverdueReviews(ctx, now)
+				return err
+			})
+		}})
+	// without STALE_REVIEW_AFTER reviews are never reassigned automatically
+	if staleAfter := config.StaleReviewAfter; staleAfter > 0 {
+		jobs.Add(scheduler.Job{Name: "stale", Interval: config.StaleReviewCheckInterval,
+			Run: func(ctx context.Context, now time.Time) error {
+				return svc.ForEachTenant(ctx, func(ctx context.Context) error {
+					_, _, err := svc.EscalateStaleReviews(ctx, now, staleAfter)
+					return err
+				})
+			}})
+	}
+	jobs.Start()
+
+	checker := health.NewChecker(Version, clk)
+	if storage, ok := tenants.(repo.HealthChecker); ok {
+		checker.AddCheck("storage", storage.HealthCheck)
+	}
+
+	// health, metrics, the spec and the webhooks, which carry their own
+	// signatures, are public; everything else needs one of these roles
+	admin := auth.Require(models.ROLE_ADMIN)
+	bot := auth.Require(models.ROLE_ADMIN, models.ROLE_BOT)
+	reviewer := auth.Require(models.ROLE_ADMIN, models.ROLE_USER)
+	anyRole := auth.Require(auth.ROLES...)
+	// requests are validated after the role check; the webhooks are checked
+	// by their handlers once the signature is verified
+	validate := validator.Request
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/team/add", api.TeamAddHandler(svc))
-	mux.HandleFunc("/team/get", api.TeamGetHandler(svc))
-	mux.HandleFunc("/users/setIsActive", api.UsersSetIsActiveHandler(svc))
-	mux.HandleFunc("/pullRequest/create", api.PullRequestCreateHandler(svc))
-	mux.HandleFunc("/pullRequest/merge", api.PullRequestMergeHandler(svc))
-	mux.HandleFunc("/pullRequest/reassign", api.PullRequestReassignHandler(svc))
-	mux.HandleFunc("/users/getReview", api.UsersGetReviewHandler(svc))
+	mux.HandleFunc("POST /team/add", admin(validate(api.TeamAddHandler(svc))))
+	mux.HandleFunc("GET /team/get", anyRole(validate(api.TeamGetHandler(svc))))
+	mux.HandleFunc("POST /team/setMemberRole", admin(validate(api.TeamSetMemberRoleHandler(svc))))
+	mux.HandleFunc("POST /team/setPolicy", admin(validate(api.TeamSetPolicyHandler(svc))))
+	mux.HandleFunc("POST /team/setSLA", admin(validate(api.TeamSetSLAHandler(svc))))
+	mux.HandleFunc("POST /users/setIsActive", admin(validate(api.UsersSetIsActiveHandler(svc))))
+	mux.HandleFunc("POST /users/setPrimaryTeam", admin(validate(api.UsersSetPrimaryTeamHandler(svc))))
+	mux.HandleFunc("POST /pullRequest/create", bot(validate(api.PullRequestCreateHandler(svc))))
+	mux.HandleFunc("POST /pullRequest/merge", bot(validate(api.PullRequestMergeHandler(svc))))
+	mux.HandleFunc("POST /pullRequest/close", bot(validate(api.PullRequestCloseHandler(svc))))
+	mux.HandleFunc("POST /pullRequest/reassign", reviewer(validate(api.PullRequestReassignHandler(svc))))
+	mux.HandleFunc("GET /pullRequest/history", anyRole(validate(api.PullRequestHistoryHandler(svc))))
+	mux.HandleFunc("GET /pullRequest/overdue", anyRole(validate(api.PullRequestOverdueHandler(svc))))
+	mux.HandleFunc("GET /users/getReview", anyRole(validate(api.UsersGetReviewHandler(svc))))
+	mux.HandleFunc("GET /audit", admin(validate(api.AuditHandler(svc))))
+	mux.HandleFunc("POST /webhooks/subscribe", admin(validate(api.WebhookSubscribeHandler(dispatcher))))
+	mux.HandleFunc("GET /webhooks/list", admin(validate(api.WebhookListHandler(dispatcher))))
+	mux.HandleFunc("POST /webhooks/unsubscribe", admin(validate(api.WebhookUnsubscribeHandler(dispatcher))))
+	mux.HandleFunc("GET /webhooks/deliveries", admin(validate(api.WebhookDeliveriesHandler(dispatcher))))
+	mux.HandleFunc("POST /ingest/github", api.GithubIngestHandler(ingestor))
+	mux.HandleFunc("POST /ingest/gitlab", api.GitlabIngestHandler(ingestor))
+	mux.HandleFunc("GET /metrics", metrics.Handler(registry))
+	mux.HandleFunc("GET /admin/consistency", admin(validate(api.ConsistencyCheckHandler(svc))))
+	mux.HandleFunc("POST /admin/consistency/repair", admin(validate(api.ConsistencyRepairHandler(svc))))
+	mux.HandleFunc("GET /admin/snapshot/export", admin(validate(api.SnapshotExportHandler(svc))))
+	mux.HandleFunc("POST /admin/snapshot/import", admin(validate(api.SnapshotImportHandler(svc))))
+	mux.HandleFunc("POST /admin/tenants", admin(validate(api.TenantCreateHandler(svc))))
+	mux.HandleFunc("GET /admin/tenants", admin(validate(api.TenantListHandler(svc))))
+	mux.HandleFunc("GET /health/live", api.LiveHandler(checker))
+	mux.HandleFunc("GET /health/ready", api.ReadyHandler(checker))
+	mux.HandleFunc("GET /openapi.yml", api.OpenAPIHandler(prreviewer.OpenAPISpec))
 
+	port := config.Port
 	if port == "" {
 		port = "8080"
 	}
 	server := &http.Server{
 		Addr:    ":" + port,
-		Handler: mux,
+		Handler: api.RequestContext(httpMetrics.Middleware(authenticator.Middleware(validator.Middleware(api.MuxErrors(mux))))),
+	}
+	return &Server{
+		Server:     server,
+		health:     checker,
+		dispatcher: dispatcher,
+		scheduler:  jobs,
 	}
-	return server
 }
 
-func ShutdownServer(server *http.Server) {
+// Drain makes readiness fail and waits, so load balancers stop sending
+// traffic before the listener is closed.
+func (s *Server) Drain(delay time.Duration) {
+	s.health.SetShuttingDown()
+	time.Sleep(delay)
+}
+
+func ShutdownServer(server *Server) {
+	server.health.SetShuttingDown()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 	if err := server.Shutdown(ctx); err != nil {
 		log.Printf("Error shutting down server: %v", err)
 	}
+	// the jobs may still record events for the dispatcher
+	server.scheduler.Close()
+	server.dispatcher.Close()
 }
 
 func main() {
-	server := NewServer(os.Getenv("PORT"))
-	log.Println("Server started on port", server.Addr)
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
+	server := NewServer(ConfigFromEnv())
+
+	drainDelay := durationFromEnv("SHUTDOWN_DRAIN_DELAY", DEFAULT_DRAIN_DELAY)
+
+	stopped := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		log.Println("Shutting down, draining for", drainDelay)
+		server.Drain(drainDelay)
+		ShutdownServer(server)
+		close(stopped)
+	}()
+
+	log.Println("Server started on port", server.Addr, "version", Version)
 	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal(err)
 	}
+	<-stopped
+}
+
+// durationFromEnv reads a Go duration from the environment variable name,
+// fallback when it is not set.
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Wrong %s: %v", name, err)
+	}
+	return d
 }
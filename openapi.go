@@ -0,0 +1,11 @@
+// Package prreviewer holds the files of the repository that the binaries
+// embed.
+package prreviewer
+
+import _ "embed"
+
+// OpenAPISpec is openapi.yml, the contract of the HTTP API. It is served at
+// /openapi.yml and requests and responses are validated against it.
+//
+//go:embed openapi.yml
+var OpenAPISpec []byte